@@ -1,6 +1,6 @@
 /*
 	Title: Perceptia Database Populate
-	Version: 0.2.0
+	Version: 0.5.0
 */
 -------------------------------------------------------------------------------
 -- Change Log --
@@ -9,6 +9,9 @@
 	Date, Changer, Short Description, Version
 	2019/05/19, Chris, Created Populate, 0.1.0
 	2019/05/21, Chris, Update versions for schema and proc, 0.2.0
+	2026/10/19, Gateway, Update versions for schema and proc to 1.1.0, 0.3.0
+	2026/10/19, Gateway, Update versions for schema and proc to 1.2.0, 0.4.0
+	2026/10/19, Gateway, Update versions for schema and proc to 1.3.0, 0.5.0
 */
 
 -------------------------------------------------------------------------------
@@ -45,7 +48,7 @@ INSERT INTO [Version] (
 VALUES (
 		N'1F51BCCE-959B-4732-97D4-3AD688850ED8'
 		,N'Stored Procedures'
-		,N'1.0.0'
+		,N'1.3.0'
 		,N'The Perceptia Database Stored Procedures.'
 	)
 ;
@@ -64,7 +67,7 @@ INSERT INTO [Version] (
 VALUES (
 		N'8FBE90DA-70C2-4C0C-91AB-A2B8FE31F0D4'
 		,N'Schema'
-		,N'1.0.0'
+		,N'1.3.0'
 		,N'The Perceptia Database Schema.'
 	)
 ;
@@ -75,6 +78,6 @@ GO
 -----------------------------------------------------------
 
 INSERT INTO [Version] ([Uuid], [Name], [Version], [Description])
-VALUES (N'CE8A00FF-5715-424C-B313-28E280F7165B', N'Populate', N'0.2.0', N'The Perceptia Database Populate.')
+VALUES (N'CE8A00FF-5715-424C-B313-28E280F7165B', N'Populate', N'0.5.0', N'The Perceptia Database Populate.')
 ;
 GO
\ No newline at end of file
@@ -1,7 +1,7 @@
 /*
 	Title: Perceptia Database Procedures
-	Version: 1.0.0
-	Schema Version: 1.0.0
+	Version: 1.3.0
+	Schema Version: 1.3.0
 */
 -------------------------------------------------------------------------------
 -- Change Log --
@@ -20,6 +20,9 @@
 	2019/05/18, Chris, Add Session get and delete sp, 0.8.0
 	2019/05/20, Chris, Move version populate to populate, 0.8.1
 	2019/05/21, Chris, Set version to 1.0.0, 1.0.0
+	2026/10/19, Gateway, Add create and read for audit events, 1.1.0
+	2026/10/19, Gateway, Add create and read for user roles, 1.2.0
+	2026/10/19, Gateway, Add request, cancel, and read for account deletion, 1.3.0
 */
 
 -------------------------------------------------------------------------------
@@ -62,6 +65,7 @@ GO
 				match existing object, object not found)
 		50400s: Referenced Object already exists (identifier provided was already
 				found in the system, conflict with existing object)
+		50500s: Operation not permitted on the referenced object
 
 	Meaning of specific value within range depends on procedure
 
@@ -456,6 +460,101 @@ END CATCH
 ;
 GO
 
+-----------------------------------------------------------
+-- CreateAuditEvent --
+-----------------------------------------------------------
+
+-- USP_CreateAuditEvent appends the provided event to the audit log.
+-- Parameters
+--	@Uuid:	UNIQUEIDENTIFIER (required) the uuid of the event.
+--	@Type:	NVARCHAR(50) (required) the type of the event, such as sign-in.
+--	@Occurred:	DATETIME2 (required) when the event occurred, in UTC.
+--	@UserUuid:	UNIQUEIDENTIFIER (optional) the user the event is about.
+--	@Username:	NVARCHAR(255) (optional) the username given in a failed sign-in.
+--	@SessionUuid:	UNIQUEIDENTIFIER (optional) the session the event is about.
+--	@RequestId:	NVARCHAR(128) (optional) the id of the request which caused the event.
+--	@ClientAddr:	NVARCHAR(255) (optional) the address of the client which sent the request.
+--	@UserAgent:	NVARCHAR(500) (optional) the user agent of the client which sent the request.
+--	@Detail:	NVARCHAR(1000) (optional) a description of the event.
+-- Outputs none
+-- Errors
+--	50101: The provided Uuid, Type, or Occurred was null.
+--	50401: Event with provided uuid already exists.
+CREATE PROCEDURE [USP_CreateAuditEvent]
+	@Uuid UNIQUEIDENTIFIER
+	,@Type NVARCHAR(50)
+	,@Occurred DATETIME2
+	,@UserUuid UNIQUEIDENTIFIER = NULL
+	,@Username NVARCHAR(255) = NULL
+	,@SessionUuid UNIQUEIDENTIFIER = NULL
+	,@RequestId NVARCHAR(128) = NULL
+	,@ClientAddr NVARCHAR(255) = NULL
+	,@UserAgent NVARCHAR(500) = NULL
+	,@Detail NVARCHAR(1000) = NULL
+AS
+SET NOCOUNT ON
+;
+BEGIN
+	IF @Uuid IS NULL OR @Type IS NULL OR @Occurred IS NULL
+		THROW 50101, N'uuid, type, and occurred must not be null', 1
+	;
+	IF EXISTS (SELECT [Uuid] FROM [AuditEvent] WHERE [Uuid] = @Uuid)
+		THROW 50401, N'audit event with provided uuid already exists', 1
+	;
+	INSERT INTO [AuditEvent]
+		([Uuid], [Type], [Occurred], [User_Uuid], [Username], [Session_Uuid], [RequestId], [ClientAddr],
+			[UserAgent], [Detail])
+	VALUES
+		(@Uuid, @Type, @Occurred, @UserUuid, @Username, @SessionUuid, @RequestId, @ClientAddr,
+			@UserAgent, @Detail)
+	;
+END
+;
+GO
+
+-----------------------------------------------------------
+-- CreateUserRole --
+-----------------------------------------------------------
+
+-- USP_CreateUserRole grants the role to the user.
+-- Parameters
+--	@UserUuid:	UNIQUEIDENTIFIER the UserUuid for the user who should be granted the role.
+--				Must be a valid v4 UUID.
+--	@Role:	NVARCHAR(50) the name of the role to grant.
+-- Outputs none
+-- Errors
+--	50101: The provided UserUuid was null.
+--	50102: The provided Role was null.
+--	50301: No user found with the provided UserUuid.
+--	50401: The user has already been granted the role.
+CREATE PROCEDURE [USP_CreateUserRole]
+	@UserUuid UNIQUEIDENTIFIER
+	,@Role NVARCHAR(50)
+AS
+SET NOCOUNT ON
+;
+BEGIN
+	IF @UserUuid IS NULL
+		THROW 50101, N'uuid must not be null', 1
+	;
+	IF @Role IS NULL
+		THROW 50102, N'role must not be null', 1
+	;
+	IF NOT EXISTS (SELECT [Uuid] FROM [User] WHERE [Uuid] = @UserUuid)
+		THROW 50301, N'user does not exist', 1
+	;
+	IF EXISTS (SELECT [Role] FROM [UserRole] WHERE [User_Uuid] = @UserUuid AND [Role] = @Role)
+		THROW 50401, N'role already granted to user', 1
+	;
+	INSERT INTO [UserRole]
+		([User_Uuid], [Role])
+	VALUES
+		(@UserUuid, @Role)
+	;
+END
+;
+GO
+
 
 ----------------------------------------------------------------
 -------- READ Procedures --------
@@ -913,11 +1012,165 @@ END
 ;
 GO
 
+-----------------------------------------------------------
+-- ReadUserAuditEvents --
+-----------------------------------------------------------
+
+-- USP_ReadUserAuditEvents gets the audit events about the given user, newest first.
+-- Events are returned even if the user has since been deleted.
+-- Parameters
+--	@UserUuid:	UNIQUEIDENTIFIER the uuid for the user who's events should be returned.
+--	@Before:	DATETIME2 only events which occurred before this time, in UTC, are returned.
+--	@Limit:	INT the maximum number of events to return.
+-- Outputs
+--	Query row containing 10 columns (may return 0 or more rows).
+--		Uuid: UNIQUEIDENTIFIER of the event.
+--		Type: NVARCHAR(50) the type of the event.
+--		Occurred: DATETIME2 when the event occurred.
+--		User_Uuid: UNIQUEIDENTIFIER the user the event is about.
+--		Username: NVARCHAR(255) the username given in a failed sign-in, or empty.
+--		Session_Uuid: UNIQUEIDENTIFIER the session the event is about, or the nil uuid.
+--		RequestId: NVARCHAR(128) the id of the request which caused the event, or empty.
+--		ClientAddr: NVARCHAR(255) the address of the client, or empty.
+--		UserAgent: NVARCHAR(500) the user agent of the client, or empty.
+--		Detail: NVARCHAR(1000) a description of the event, or empty.
+-- Errors
+--	50101: The provided UserUuid, Before, or Limit was null.
+CREATE PROCEDURE [USP_ReadUserAuditEvents]
+	@UserUuid UNIQUEIDENTIFIER
+	,@Before DATETIME2
+	,@Limit INT
+AS
+SET NOCOUNT ON
+;
+BEGIN
+	IF @UserUuid IS NULL OR @Before IS NULL OR @Limit IS NULL
+		THROW 50101, N'uuid, before, and limit must not be null', 1
+	;
+	SELECT TOP (@Limit) [Uuid], [Type], [Occurred], [User_Uuid], ISNULL([Username], N''),
+			ISNULL([Session_Uuid], CAST(0x0 AS UNIQUEIDENTIFIER)), ISNULL([RequestId], N''),
+			ISNULL([ClientAddr], N''), ISNULL([UserAgent], N''), ISNULL([Detail], N'')
+		FROM [AuditEvent]
+		WHERE [User_Uuid] = @UserUuid AND [Occurred] < @Before
+		ORDER BY [Occurred] DESC
+	;
+END
+;
+GO
+
+-----------------------------------------------------------
+-- ReadUserRoles --
+-----------------------------------------------------------
+
+-- USP_ReadUserRoles returns the roles granted to the user.
+-- Parameters
+--	@UserUuid:	UNIQUEIDENTIFIER the UserUuid for the user who's roles should be returned.
+--				Must be a valid v4 UUID.
+-- Outputs
+--	Query row containing 1 column (may return 0 or more rows), ordered by role.
+--		Role: NVARCHAR(50) the name of a role granted to the user.
+-- Errors
+--	50101: The provided UserUuid was null.
+--	50301: No user found with the provided UserUuid.
+CREATE PROCEDURE [USP_ReadUserRoles]
+	@UserUuid UNIQUEIDENTIFIER
+AS
+SET NOCOUNT ON
+;
+BEGIN
+	IF @UserUuid IS NULL
+		THROW 50101, N'uuid must not be null', 1
+	;
+	IF NOT EXISTS (SELECT [Uuid] FROM [User] WHERE [Uuid] = @UserUuid)
+		THROW 50301, N'user does not exist', 1
+	;
+	SELECT [Role]
+		FROM [UserRole]
+		WHERE [User_Uuid] = @UserUuid
+		ORDER BY [Role]
+	;
+END
+;
+GO
+
+
+-----------------------------------------------------------
+-- ReadUsersDeletionRequested --
+-----------------------------------------------------------
+
+-- USP_ReadUsersDeletionRequested returns the users who requested their account be deleted before the given time,
+-- oldest request first.
+-- Parameters
+--	@RequestedBefore:	DATETIME2 only users who requested deletion before this time, in UTC, are returned.
+--	@Limit:	INT the maximum number of users to return.
+-- Outputs
+--	Query row containing 1 column (may return 0 or more rows).
+--		Uuid: UNIQUEIDENTIFIER the uuid of the user.
+-- Errors
+--	50101: The provided RequestedBefore or Limit was null.
+CREATE PROCEDURE [USP_ReadUsersDeletionRequested]
+	@RequestedBefore DATETIME2
+	,@Limit INT
+AS
+SET NOCOUNT ON
+;
+BEGIN
+	IF @RequestedBefore IS NULL OR @Limit IS NULL
+		THROW 50101, N'requested before and limit must not be null', 1
+	;
+	SELECT TOP (@Limit) [Uuid]
+		FROM [User]
+		WHERE [DeletionRequested] < @RequestedBefore
+		ORDER BY [DeletionRequested]
+	;
+END
+;
+GO
+
 
 ----------------------------------------------------------------
 -------- UPDATE Procedures --------
 ----------------------------------------------------------------
 
+-----------------------------------------------------------
+-- UpdateUserDeletionRequested --
+-----------------------------------------------------------
+
+-- USP_UpdateUserDeletionRequested sets the time the user requested their account be deleted,
+-- which marks the account pending deletion.
+-- Parameters
+--	@UserUuid:	UNIQUEIDENTIFIER the UserUuid for the user who requested deletion.
+--				Must be a valid v4 UUID.
+--	@Requested:	DATETIME2 when the user requested deletion, in UTC.
+-- Outputs none
+-- Errors
+--	50101: The provided UserUuid was null.
+--	50102: The provided Requested was null.
+--	50301: No user found with the provided UserUuid.
+CREATE PROCEDURE [USP_UpdateUserDeletionRequested]
+	@UserUuid UNIQUEIDENTIFIER
+	,@Requested DATETIME2
+AS
+SET NOCOUNT ON
+;
+BEGIN
+	IF @UserUuid IS NULL
+		THROW 50101, N'uuid must not be null', 1
+	;
+	IF @Requested IS NULL
+		THROW 50102, N'requested must not be null', 1
+	;
+	IF NOT EXISTS (SELECT [Uuid] FROM [User] WHERE [Uuid] = @UserUuid)
+		THROW 50301, N'user does not exist', 1
+	;
+	UPDATE [User]
+		SET [DeletionRequested] = @Requested
+		WHERE [Uuid] = @UserUuid
+	;
+END
+;
+GO
+
 -----------------------------------------------------------
 -- UpdateUserEncodedHash --
 -----------------------------------------------------------
@@ -1568,6 +1821,67 @@ END CATCH
 ;
 GO
 
+-----------------------------------------------------------
+-- DeleteUserDeletionRequested --
+-----------------------------------------------------------
+
+-- USP_DeleteUserDeletionRequested cancels the deletion the user requested, if it was requested after the given
+-- time, restoring their account.
+-- Parameters
+--	@UserUuid:	UNIQUEIDENTIFIER the UserUuid for the user whose deletion should be canceled.
+--				Must be a valid v4 UUID.
+--	@RequestedAfter:	DATETIME2 a deletion requested before this time, in UTC, can no longer be canceled.
+-- Outputs
+--	Query row containing 1 column (should be exactly one row).
+--		Canceled: BIT 1 if a deletion was canceled, 0 if the user had not requested deletion.
+-- Errors
+--	50101: The provided UserUuid was null.
+--	50102: The provided RequestedAfter was null.
+--	50301: No user found with the provided UserUuid.
+--	50502: The deletion was requested before RequestedAfter, so can no longer be canceled.
+CREATE PROCEDURE [USP_DeleteUserDeletionRequested]
+	@UserUuid UNIQUEIDENTIFIER
+	,@RequestedAfter DATETIME2
+AS
+SET NOCOUNT ON
+;
+BEGIN
+	IF @UserUuid IS NULL
+		THROW 50101, N'uuid must not be null', 1
+	;
+	IF @RequestedAfter IS NULL
+		THROW 50102, N'requested after must not be null', 1
+	;
+	DECLARE @Requested DATETIME2
+	;
+	IF NOT EXISTS (SELECT [Uuid] FROM [User] WHERE [Uuid] = @UserUuid)
+		THROW 50301, N'user does not exist', 1
+	;
+	SELECT @Requested = [DeletionRequested]
+		FROM [User]
+		WHERE [Uuid] = @UserUuid
+	;
+	IF @Requested IS NULL
+	BEGIN
+		SELECT CAST(0 AS BIT) AS [Canceled]
+		;
+		RETURN
+		;
+	END
+	;
+	IF @Requested < @RequestedAfter
+		THROW 50502, N'deletion can no longer be canceled', 1
+	;
+	UPDATE [User]
+		SET [DeletionRequested] = NULL
+		WHERE [Uuid] = @UserUuid
+	;
+	SELECT CAST(1 AS BIT) AS [Canceled]
+	;
+END
+;
+GO
+
 -----------------------------------------------------------
 -- DeleteUser --
 -----------------------------------------------------------
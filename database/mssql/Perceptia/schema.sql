@@ -1,6 +1,6 @@
 /*
 	Title: Perceptia Database Schema
-	Version: 1.0.0
+	Version: 1.3.0
 */
 -------------------------------------------------------------------------------
 -- Change Log --
@@ -19,6 +19,9 @@
 	2019/05/18, Chris, Add Session Version Profile table, 0.7.0
 	2019/05/20, Chris, Move Version to Populate, 0.7.1
 	2019/05/21, Chris, Set version to 1.0.0, 1.0.0
+	2026/10/19, Gateway, Add append-only AuditEvent table, 1.1.0
+	2026/10/19, Gateway, Add UserRole table, 1.2.0
+	2026/10/19, Gateway, Add User DeletionRequested column, 1.3.0
 */
 
 -------------------------------------------------------------------------------
@@ -37,6 +40,7 @@
 -- Create Database Tables
 -- Create Database Foreign Key Constraints
 -- Create Database Indexes
+-- Create Database Triggers
 -- Create Database Roles
 -- Create Database Users
 -- Populate Database
@@ -108,6 +112,7 @@ CREATE TABLE [User] (
 	,[FullName] NVARCHAR(255)
 	,[DisplayName] NVARCHAR(255)
 	,[Created] DATETIME DEFAULT(GETDATE())
+	,[DeletionRequested] DATETIME2 NULL
 	,CONSTRAINT [PK_User_Uuid] PRIMARY KEY ([Uuid])
 	,CONSTRAINT [UQ_User_Username] UNIQUE ([Username])
 )
@@ -265,6 +270,42 @@ CREATE TABLE [UserProfileSharing] (
 ;
 GO
 
+-----------------------------------------------------------
+-- UserRole Table --
+-----------------------------------------------------------
+-- Summary: Store the roles granted to a user, such as by an operator
+
+CREATE TABLE [UserRole] (
+	[User_Uuid] UNIQUEIDENTIFIER NOT NULL
+	,[Role] NVARCHAR(50) NOT NULL
+	,[Created] DATETIME DEFAULT(GETDATE())
+	,CONSTRAINT [PK_UserRole_UserUuid_Role] PRIMARY KEY ([User_Uuid], [Role])
+)
+;
+GO
+
+-----------------------------------------------------------
+-- AuditEvent Table --
+-----------------------------------------------------------
+-- Summary: Store security relevant account and session events.
+-- Rows are never updated or deleted, see TR_AuditEvent_AppendOnly. User_Uuid and Session_Uuid
+-- are not foreign keys, so events outlive the users and sessions they are about.
+
+CREATE TABLE [AuditEvent] (
+	[Uuid] UNIQUEIDENTIFIER NOT NULL
+	,[Type] NVARCHAR(50) NOT NULL
+	,[Occurred] DATETIME2 NOT NULL
+	,[User_Uuid] UNIQUEIDENTIFIER
+	,[Username] NVARCHAR(255)
+	,[Session_Uuid] UNIQUEIDENTIFIER
+	,[RequestId] NVARCHAR(128)
+	,[ClientAddr] NVARCHAR(255)
+	,[UserAgent] NVARCHAR(500)
+	,[Detail] NVARCHAR(1000)
+	,CONSTRAINT [PK_AuditEvent_Uuid] PRIMARY KEY NONCLUSTERED ([Uuid])
+)
+;
+GO
 
 -------------------------------------------------------------------------------
 -- Create Foreign Key Constraints --
@@ -371,6 +412,18 @@ ALTER TABLE [UserProfileSharing]
 ;
 GO
 
+-----------------------------------------------------------
+-- UserRole Table --
+-----------------------------------------------------------
+
+ALTER TABLE [UserRole]
+	ADD
+	CONSTRAINT [FK_UserRole_UserUuid] FOREIGN KEY ([User_Uuid])
+		REFERENCES [User] ([Uuid])
+		ON DELETE CASCADE
+;
+GO
+
 
 
 
@@ -388,6 +441,13 @@ CREATE INDEX [IX_User_Username]
 ;
 GO
 
+-- Index for finding the users whose deletion is due, only holding users pending deletion
+CREATE NONCLUSTERED INDEX [IX_User_DeletionRequested]
+	ON [User] ([DeletionRequested])
+	WHERE [DeletionRequested] IS NOT NULL
+;
+GO
+
 -----------------------------------------------------------
 -- UserEmail Table --
 -----------------------------------------------------------
@@ -418,6 +478,36 @@ CREATE INDEX [IX_UserCredential_UserUuid]
 ;
 GO
 
+-----------------------------------------------------------
+-- AuditEvent Table --
+-----------------------------------------------------------
+
+-- Index for reading the events of a user, newest first
+CREATE CLUSTERED INDEX [IX_AuditEvent_UserUuid_Occurred]
+	ON [AuditEvent] ([User_Uuid], [Occurred] DESC)
+;
+GO
+
+-------------------------------------------------------------------------------
+-- Create Triggers --
+-------------------------------------------------------------------------------
+
+-----------------------------------------------------------
+-- AuditEvent Table --
+-----------------------------------------------------------
+
+-- Audit events are append-only, so may not be changed or removed once written
+CREATE TRIGGER [TR_AuditEvent_AppendOnly]
+	ON [AuditEvent]
+	INSTEAD OF UPDATE, DELETE
+AS
+BEGIN
+	THROW 50501, N'audit events are append-only', 1
+	;
+END
+;
+GO
+
 -------------------------------------------------------------------------------
 -- Create Roles --
 -------------------------------------------------------------------------------
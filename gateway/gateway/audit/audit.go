@@ -0,0 +1,158 @@
+// Package audit records security relevant account and session events, such as sign-ins and account deletion.
+//
+// Events are written to an append-only Store, which users can query for their own events,
+// and optionally to additional Writers, such as a json lines file.
+package audit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	kitlog "github.com/go-kit/kit/log"
+	uuid "github.com/satori/go.uuid"
+)
+
+// EventType identifies what happened in an audit event.
+type EventType string
+
+// Types of audit event.
+const (
+	// EventSignUp is recorded when a user creates an account.
+	EventSignUp EventType = "sign-up"
+	// EventSignIn is recorded when a user begins an authenticated session.
+	EventSignIn EventType = "sign-in"
+	// EventSignInFailed is recorded when credentials provided to sign in are not valid.
+	EventSignInFailed EventType = "sign-in-failed"
+	// EventSignOut is recorded when a user ends their current session.
+	EventSignOut EventType = "sign-out"
+	// EventSessionRevoked is recorded when a user ends one of their sessions from another session.
+	EventSessionRevoked EventType = "session-revoked"
+	// EventPasswordChanged is recorded when the password of a user is changed.
+	EventPasswordChanged EventType = "password-changed"
+	// EventAccountDeleted is recorded when a user deletes their account, which is pending deletion until it is
+	// restored or purged.
+	EventAccountDeleted EventType = "account-deleted"
+	// EventAccountRestored is recorded when a user signs in to an account pending deletion, which restores it.
+	EventAccountRestored EventType = "account-restored"
+	// EventAccountPurged is recorded when an account pending deletion is purged, once it can no longer be restored.
+	EventAccountPurged EventType = "account-purged"
+	// EventAccountPurgeFailed is recorded when an account could not be purged, such as when a service failed to
+	// delete the data it holds about the user, so the purge is tried again later.
+	EventAccountPurgeFailed EventType = "account-purge-failed"
+	// EventDataExported is recorded when a user requests an export of their personal data.
+	EventDataExported EventType = "data-exported"
+	// EventAdminAction is recorded for each action taken through the internal admin server.
+	EventAdminAction EventType = "admin-action"
+)
+
+// Default and maximum number of events returned by Log.UserEvents.
+const (
+	DefaultLimit = 50
+	MaxLimit     = 200
+)
+
+var ErrNotStored = errors.New("audit: events are not being stored")
+var ErrInvalidLimit = errors.New("audit: limit must be between 1 and 200")
+
+// Event is a single security relevant action.
+type Event struct {
+	Uuid     uuid.UUID `json:"uuid"`
+	Type     EventType `json:"type"`
+	Occurred time.Time `json:"occurred"`
+	// UserUuid is the user the event is about, or uuid.Nil if the user is not known,
+	// such as for a failed sign-in to an unknown username or an admin action.
+	UserUuid uuid.UUID `json:"userUuid"`
+	// Username is the username given in a failed sign-in attempt.
+	Username string `json:"username,omitempty"`
+	// SessionUuid is the session the event is about, or uuid.Nil if there is none.
+	SessionUuid uuid.UUID `json:"sessionUuid"`
+	// RequestId, ClientAddr, and UserAgent describe the request which caused the event.
+	RequestId  string `json:"requestId,omitempty"`
+	ClientAddr string `json:"clientAddr,omitempty"`
+	UserAgent  string `json:"userAgent,omitempty"`
+	// Detail is a short human readable description of the event.
+	Detail string `json:"detail,omitempty"`
+}
+
+// Writer is a destination events are written to.
+type Writer interface {
+	// Write records the event. Events may not be changed or removed once written.
+	Write(event *Event) error
+}
+
+// Store represents a store of events which can be queried.
+type Store interface {
+	Writer
+	// ReadUserEvents returns up to limit events about the user which occurred before the given time, newest first.
+	ReadUserEvents(ctx context.Context, userUuid uuid.UUID, before time.Time, limit int) ([]*Event, error)
+}
+
+// Log records events to a Store and any number of additional Writers.
+type Log struct {
+	store   Store
+	writers []Writer
+	logger  kitlog.Logger
+}
+
+// NewLog constructs a new Log, writing events to store and each of writers.
+// If store is nil, events are only written to writers, and can not be queried.
+// Failures to write an event are logged to logger.
+func NewLog(store Store, logger kitlog.Logger, writers ...Writer) *Log {
+	return &Log{store: store, writers: writers, logger: logger}
+}
+
+// Record sets the uuid and time of the event, and writes it to the store and every writer.
+// Recording an event never fails the action being recorded, so failures are logged rather than returned.
+func (l *Log) Record(event *Event) {
+	if l == nil {
+		return
+	}
+	event.Uuid = uuid.NewV4()
+	event.Occurred = time.Now().UTC()
+	if l.store != nil {
+		l.write(l.store, event)
+	}
+	for _, writer := range l.writers {
+		l.write(writer, event)
+	}
+}
+
+func (l *Log) write(writer Writer, event *Event) {
+	if errW := writer.Write(event); errW != nil {
+		_ = l.logger.Log("msg", "unable to write audit event", "eventUuid", event.Uuid, "type", event.Type,
+			"userUuid", event.UserUuid, "error", errW)
+	}
+}
+
+// Close closes each writer which holds resources, such as a FileWriter, returning the first error.
+func (l *Log) Close() error {
+	if l == nil {
+		return nil
+	}
+	var errClose error
+	for _, writer := range l.writers {
+		if closer, ok := writer.(io.Closer); ok {
+			if errC := closer.Close(); errC != nil && errClose == nil {
+				errClose = errC
+			}
+		}
+	}
+	return errClose
+}
+
+// UserEvents returns up to limit events about the user which occurred before the given time, newest first.
+// If before is the zero time, the newest events are returned.
+func (l *Log) UserEvents(ctx context.Context, userUuid uuid.UUID, before time.Time, limit int) ([]*Event, error) {
+	if l == nil || l.store == nil {
+		return nil, ErrNotStored
+	}
+	if limit < 1 || limit > MaxLimit {
+		return nil, ErrInvalidLimit
+	}
+	if before.IsZero() {
+		before = time.Now().UTC().Add(time.Minute)
+	}
+	return l.store.ReadUserEvents(ctx, userUuid, before, limit)
+}
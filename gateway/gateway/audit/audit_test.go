@@ -0,0 +1,177 @@
+// +build all unit
+
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	kitlog "github.com/go-kit/kit/log"
+	uuid "github.com/satori/go.uuid"
+)
+
+// sliceStore is a Store which keeps events in memory, or fails every write if err is set.
+type sliceStore struct {
+	events []*Event
+	err    error
+}
+
+func (ss *sliceStore) Write(event *Event) error {
+	if ss.err != nil {
+		return ss.err
+	}
+	copied := *event
+	ss.events = append(ss.events, &copied)
+	return nil
+}
+
+func (ss *sliceStore) ReadUserEvents(_ context.Context, userUuid uuid.UUID, before time.Time, limit int) ([]*Event, error) {
+	var events []*Event
+	for i := len(ss.events) - 1; i >= 0 && len(events) < limit; i-- {
+		if uuid.Equal(ss.events[i].UserUuid, userUuid) && ss.events[i].Occurred.Before(before) {
+			events = append(events, ss.events[i])
+		}
+	}
+	return events, nil
+}
+
+func TestLog_Record(t *testing.T) {
+	store := &sliceStore{}
+	failing := &sliceStore{err: errors.New("unavailable")}
+	writer := &sliceStore{}
+	log := NewLog(store, kitlog.NewNopLogger(), failing, writer)
+
+	userUuid := uuid.NewV4()
+	log.Record(&Event{Type: EventSignIn, UserUuid: userUuid})
+	log.Record(&Event{Type: EventSignOut, UserUuid: userUuid})
+	log.Record(&Event{Type: EventSignIn, UserUuid: uuid.NewV4()})
+
+	if len(store.events) != 3 || len(writer.events) != 3 {
+		t.Fatalf("case: record: expected 3 events in the store and writer, got %d and %d\n"+
+			"HINT: a failing writer should not stop events being written to the others",
+			len(store.events), len(writer.events))
+	}
+	if uuid.Equal(store.events[0].Uuid, uuid.Nil) || store.events[0].Occurred.IsZero() {
+		t.Errorf("case: record: expected uuid and time to be set, got %+v\n"+
+			"HINT: Record should set the uuid and time of the event", store.events[0])
+	}
+
+	events, errUE := log.UserEvents(context.Background(), userUuid, time.Time{}, DefaultLimit)
+	if errUE != nil {
+		t.Fatalf("case: user events: unexpected error: %s", errUE)
+	}
+	if len(events) != 2 || events[0].Type != EventSignOut || events[1].Type != EventSignIn {
+		t.Errorf("case: user events: expected sign-out then sign-in of the user, got %d events\n"+
+			"HINT: only events about the user should be returned, newest first", len(events))
+	}
+}
+
+func TestLog_UserEvents(t *testing.T) {
+	cases := []struct {
+		name        string
+		hint        string
+		log         *Log
+		limit       int
+		expectError error
+	}{
+		{
+			name:        "Basic: default limit",
+			hint:        "The default limit is valid",
+			log:         NewLog(&sliceStore{}, kitlog.NewNopLogger()),
+			limit:       DefaultLimit,
+			expectError: nil,
+		},
+		{
+			name:        "Limit too small",
+			hint:        "At least one event must be requested",
+			log:         NewLog(&sliceStore{}, kitlog.NewNopLogger()),
+			limit:       0,
+			expectError: ErrInvalidLimit,
+		},
+		{
+			name:        "Limit too large",
+			hint:        "At most MaxLimit events may be requested",
+			log:         NewLog(&sliceStore{}, kitlog.NewNopLogger()),
+			limit:       MaxLimit + 1,
+			expectError: ErrInvalidLimit,
+		},
+		{
+			name:        "No store",
+			hint:        "Events written only to writers can not be queried",
+			log:         NewLog(nil, kitlog.NewNopLogger(), &sliceStore{}),
+			limit:       DefaultLimit,
+			expectError: ErrNotStored,
+		},
+	}
+
+	for _, c := range cases {
+		_, errUE := c.log.UserEvents(context.Background(), uuid.NewV4(), time.Time{}, c.limit)
+		if errUE != c.expectError {
+			t.Errorf("case: %s: expected error %v but got %v\nHINT: %s", c.name, c.expectError, errUE, c.hint)
+		}
+	}
+}
+
+func TestMemStore(t *testing.T) {
+	store := NewMemStore()
+	userUuid := uuid.NewV4()
+	occurred := time.Now()
+	for i, eventType := range []EventType{EventSignUp, EventSignIn, EventSignOut} {
+		_ = store.Write(&Event{Uuid: uuid.NewV4(), Type: eventType, Occurred: occurred.Add(time.Duration(i)),
+			UserUuid: userUuid})
+	}
+	_ = store.Write(&Event{Uuid: uuid.NewV4(), Type: EventSignIn, Occurred: occurred, UserUuid: uuid.NewV4()})
+
+	events, errRUE := store.ReadUserEvents(context.Background(), userUuid, occurred.Add(2), 5)
+	if errRUE != nil || len(events) != 2 || events[0].Type != EventSignIn || events[1].Type != EventSignUp {
+		t.Errorf("case: Mem Store: expected the sign-in and sign-up events, newest first, but got %d events, "+
+			"error: %v\nHINT: only events of the user before the given time are read", len(events), errRUE)
+	}
+}
+
+func TestFileWriter(t *testing.T) {
+	dir, errTD := ioutil.TempDir("", "audit")
+	if errTD != nil {
+		t.Fatalf("case: N/A: unexpected error in test setup: %s", errTD)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.jsonl")
+
+	// Events written by separate writers, such as across restarts, should all be kept.
+	for i := 0; i < 2; i++ {
+		fw, errNFW := NewFileWriter(path)
+		if errNFW != nil {
+			t.Fatalf("case: file writer: unexpected error opening file: %s", errNFW)
+		}
+		NewLog(nil, kitlog.NewNopLogger(), fw).Record(&Event{Type: EventAdminAction, Detail: "cache purge"})
+		if errC := fw.Close(); errC != nil {
+			t.Fatalf("case: file writer: unexpected error closing file: %s", errC)
+		}
+	}
+
+	file, errO := os.Open(path)
+	if errO != nil {
+		t.Fatalf("case: file writer: unable to open written file: %s", errO)
+	}
+	defer file.Close()
+	lines := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		event := &Event{}
+		if errU := json.Unmarshal(scanner.Bytes(), event); errU != nil || event.Type != EventAdminAction {
+			t.Errorf("case: file writer: line %d is not the written event: %s", lines, scanner.Text())
+		}
+		lines++
+	}
+	if lines != 2 {
+		t.Errorf("case: file writer: expected 2 lines but got %d\nHINT: the file should be appended to, "+
+			"with one event per line", lines)
+	}
+}
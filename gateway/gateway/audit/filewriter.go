@@ -0,0 +1,42 @@
+package audit
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// FileWriter writes events to a file as json lines, one event per line.
+// The file is only ever appended to.
+type FileWriter struct {
+	mx   sync.Mutex
+	file *os.File
+}
+
+// NewFileWriter opens the file at path for appending, creating it if it does not exist.
+func NewFileWriter(path string) (*FileWriter, error) {
+	file, errOF := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if errOF != nil {
+		return nil, errOF
+	}
+	return &FileWriter{file: file}, nil
+}
+
+// Write appends the event to the file as a single line of json.
+func (fw *FileWriter) Write(event *Event) error {
+	line, errM := json.Marshal(event)
+	if errM != nil {
+		return errM
+	}
+	fw.mx.Lock()
+	defer fw.mx.Unlock()
+	_, errW := fw.file.Write(append(line, '\n'))
+	return errW
+}
+
+// Close closes the file.
+func (fw *FileWriter) Close() error {
+	fw.mx.Lock()
+	defer fw.mx.Unlock()
+	return fw.file.Close()
+}
@@ -0,0 +1,44 @@
+package audit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// MemStore keeps events in the memory of the process, which are lost when it exits.
+// This should be used only for development and testing, production systems should use a database.
+type MemStore struct {
+	mx     sync.RWMutex
+	events []*Event
+}
+
+// NewMemStore constructs a new, empty MemStore.
+func NewMemStore() *MemStore {
+	return &MemStore{}
+}
+
+// Write appends a copy of the event to the store.
+func (ms *MemStore) Write(event *Event) error {
+	copied := *event
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	ms.events = append(ms.events, &copied)
+	return nil
+}
+
+// ReadUserEvents returns up to limit events about the user which occurred before the given time, newest first.
+func (ms *MemStore) ReadUserEvents(_ context.Context, userUuid uuid.UUID, before time.Time, limit int) ([]*Event, error) {
+	ms.mx.RLock()
+	defer ms.mx.RUnlock()
+	events := make([]*Event, 0, limit)
+	for i := len(ms.events) - 1; i >= 0 && len(events) < limit; i-- {
+		if uuid.Equal(ms.events[i].UserUuid, userUuid) && ms.events[i].Occurred.Before(before) {
+			copied := *ms.events[i]
+			events = append(events, &copied)
+		}
+	}
+	return events, nil
+}
@@ -0,0 +1,103 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	mssql "github.com/denisenkom/go-mssqldb"
+	uuid "github.com/satori/go.uuid"
+)
+
+// MsSqlStore stores events in the append-only AuditEvent table, using the audit stored procedures.
+type MsSqlStore struct {
+	database *sql.DB
+}
+
+// NewMsSqlStore constructs a new MsSqlStore.
+// If *sql.DB is nil, function will return an error.
+func NewMsSqlStore(db *sql.DB) (*MsSqlStore, error) {
+	if db == nil {
+		return nil, errors.New("NewMsSqlStore: db cannot be nil")
+	}
+	return &MsSqlStore{db}, nil
+}
+
+// Write inserts the event into the AuditEvent table.
+func (ms *MsSqlStore) Write(event *Event) error {
+	stmt, errPS := ms.database.Prepare("USP_CreateAuditEvent")
+	if errPS != nil {
+		return errPS
+	}
+	defer stmt.Close()
+	_, errE := stmt.Exec(
+		sql.Named("Uuid", toSqlUuid(event.Uuid)),
+		sql.Named("Type", string(event.Type)),
+		sql.Named("Occurred", event.Occurred),
+		sql.Named("UserUuid", toNullSqlUuid(event.UserUuid)),
+		sql.Named("Username", event.Username),
+		sql.Named("SessionUuid", toNullSqlUuid(event.SessionUuid)),
+		sql.Named("RequestId", event.RequestId),
+		sql.Named("ClientAddr", event.ClientAddr),
+		sql.Named("UserAgent", event.UserAgent),
+		sql.Named("Detail", event.Detail),
+	)
+	return errE
+}
+
+// ReadUserEvents returns up to limit events about the user which occurred before the given time, newest first.
+func (ms *MsSqlStore) ReadUserEvents(ctx context.Context, userUuid uuid.UUID, before time.Time,
+	limit int) ([]*Event, error) {
+	stmt, errPS := ms.database.PrepareContext(ctx, "USP_ReadUserAuditEvents")
+	if errPS != nil {
+		return nil, errPS
+	}
+	defer stmt.Close()
+	rows, errQ := stmt.QueryContext(ctx,
+		sql.Named("UserUuid", toSqlUuid(userUuid)),
+		sql.Named("Before", before),
+		sql.Named("Limit", limit),
+	)
+	if errQ != nil {
+		return nil, errQ
+	}
+	defer rows.Close()
+
+	events := make([]*Event, 0, limit)
+	for rows.Next() {
+		event := &Event{}
+		var eventUuid, eventUserUuid, eventSessionUuid mssql.UniqueIdentifier
+		var eventType string
+		errS := rows.Scan(&eventUuid, &eventType, &event.Occurred, &eventUserUuid, &event.Username,
+			&eventSessionUuid, &event.RequestId, &event.ClientAddr, &event.UserAgent, &event.Detail)
+		if errS != nil {
+			return nil, errS
+		}
+		event.Type = EventType(eventType)
+		event.Uuid = fromSqlUuid(eventUuid)
+		event.UserUuid = fromSqlUuid(eventUserUuid)
+		event.SessionUuid = fromSqlUuid(eventSessionUuid)
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+func toSqlUuid(u uuid.UUID) mssql.UniqueIdentifier {
+	var sqlUuid mssql.UniqueIdentifier
+	copy(sqlUuid[:], u.Bytes())
+	return sqlUuid
+}
+
+// toNullSqlUuid converts u to a sql parameter, which is null if u is uuid.Nil.
+func toNullSqlUuid(u uuid.UUID) interface{} {
+	if uuid.Equal(u, uuid.Nil) {
+		return nil
+	}
+	return toSqlUuid(u)
+}
+
+func fromSqlUuid(sqlUuid mssql.UniqueIdentifier) uuid.UUID {
+	u, _ := uuid.FromBytes(sqlUuid[:])
+	return u
+}
@@ -0,0 +1,78 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// PgStore stores events in the append-only audit_event table of a PostgreSQL database.
+type PgStore struct {
+	database *sql.DB
+}
+
+// NewPgStore constructs a new PgStore.
+// If *sql.DB is nil, function will return an error.
+func NewPgStore(db *sql.DB) (*PgStore, error) {
+	if db == nil {
+		return nil, errors.New("NewPgStore: db cannot be nil")
+	}
+	return &PgStore{db}, nil
+}
+
+// Write inserts the event into the audit_event table.
+func (ps *PgStore) Write(event *Event) error {
+	_, errE := ps.database.Exec(`
+		INSERT INTO audit_event (uuid, type, occurred, user_uuid, username, session_uuid, request_id, client_addr,
+			user_agent, detail)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		event.Uuid, string(event.Type), event.Occurred, toNullPgUuid(event.UserUuid), event.Username,
+		toNullPgUuid(event.SessionUuid), event.RequestId, event.ClientAddr, event.UserAgent, event.Detail,
+	)
+	return errE
+}
+
+// ReadUserEvents returns up to limit events about the user which occurred before the given time, newest first.
+func (ps *PgStore) ReadUserEvents(ctx context.Context, userUuid uuid.UUID, before time.Time,
+	limit int) ([]*Event, error) {
+	rows, errQ := ps.database.QueryContext(ctx, `
+		SELECT uuid, type, occurred, user_uuid, COALESCE(username, ''), session_uuid, COALESCE(request_id, ''),
+				COALESCE(client_addr, ''), COALESCE(user_agent, ''), COALESCE(detail, '')
+			FROM audit_event
+			WHERE user_uuid = $1 AND occurred < $2
+			ORDER BY occurred DESC
+			LIMIT $3`,
+		userUuid, before, limit,
+	)
+	if errQ != nil {
+		return nil, errQ
+	}
+	defer rows.Close()
+
+	events := make([]*Event, 0, limit)
+	for rows.Next() {
+		event := &Event{}
+		var eventType string
+		var sessionUuid uuid.NullUUID
+		errS := rows.Scan(&event.Uuid, &eventType, &event.Occurred, &event.UserUuid, &event.Username,
+			&sessionUuid, &event.RequestId, &event.ClientAddr, &event.UserAgent, &event.Detail)
+		if errS != nil {
+			return nil, errS
+		}
+		event.Type = EventType(eventType)
+		event.SessionUuid = sessionUuid.UUID
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// toNullPgUuid converts u to a sql parameter, which is null if u is uuid.Nil.
+func toNullPgUuid(u uuid.UUID) interface{} {
+	if uuid.Equal(u, uuid.Nil) {
+		return nil
+	}
+	return u
+}
@@ -0,0 +1,119 @@
+// Package cache provides the HTTP response cache used by the gateway when proxying requests to services.
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+)
+
+// Results of a request passing through the cache, used as the value of the result metric label.
+const (
+	ResultHit    = "hit"
+	ResultMiss   = "miss"
+	ResultBypass = "bypass"
+)
+
+// scopeShared is the scope of responses the service marked public, which are shared by every user.
+const scopeShared = "shared"
+
+// ErrMiss is returned by a Store when no entry is stored for the key.
+var ErrMiss = errors.New("cache: entry not found")
+
+// Entry is a response stored in the cache.
+type Entry struct {
+	StatusCode int         `json:"statusCode"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body"`
+	StoredAt   time.Time   `json:"storedAt"`
+}
+
+// variants records how the responses for a url are keyed, based on the last response stored for it.
+type variants struct {
+	// Vary lists the request headers the response varies on.
+	Vary []string `json:"vary"`
+	// Shared is true if the response is the same for every user.
+	Shared bool `json:"shared"`
+}
+
+// Store persists cached responses.
+type Store interface {
+	// Get returns the value stored for the key, or ErrMiss if there is none.
+	Get(key string) ([]byte, error)
+	// Set stores the value for the key, expiring it after ttl. The key is indexed under path, the escaped path of
+	// the url the value is cached for, so it is deleted by PurgePath.
+	Set(path, key string, value []byte, ttl time.Duration) error
+	// PurgePath deletes every value indexed under path, returning the number deleted.
+	PurgePath(path string) (int, error)
+	// PurgePrefix deletes every value whose key starts with prefix, returning the number deleted.
+	PurgePrefix(prefix string) (int, error)
+}
+
+// Cache is an HTTP response cache, which stores responses from services in a Store.
+type Cache struct {
+	store   Store
+	results metrics.Counter
+	logger  kitlog.Logger
+}
+
+// New creates a Cache backed by the provided store.
+// results counts each request passing through the cache, labeled by service and result.
+func New(store Store, results metrics.Counter, logger kitlog.Logger) *Cache {
+	if store == nil {
+		panic("no store provided")
+	}
+	return &Cache{store: store, results: results, logger: logger}
+}
+
+// Purge removes every cached response whose path starts with pathPrefix, returning the number of keys deleted.
+func (c *Cache) Purge(pathPrefix string) (int, error) {
+	return c.store.PurgePrefix((&url.URL{Path: pathPrefix}).EscapedPath())
+}
+
+// invalidate removes every cached response for the path of the request, whatever its query.
+func (c *Cache) invalidate(r *http.Request) {
+	if _, errPP := c.store.PurgePath(r.URL.EscapedPath()); errPP != nil {
+		_ = c.logger.Log("msg", "unable to invalidate cached responses", "path", r.URL.Path, "error", errPP)
+	}
+}
+
+// baseKey identifies the url of the request, all keys for the url start with it.
+func baseKey(r *http.Request) string {
+	return r.URL.EscapedPath() + "?" + r.URL.RawQuery
+}
+
+// variantsKey is the key the variants of the url of the request are stored under.
+func variantsKey(r *http.Request) string {
+	return baseKey(r) + "#variants"
+}
+
+// entryKey is the key the response to the request is stored under, for the given scope and varying headers.
+func entryKey(r *http.Request, scope string, vary []string) string {
+	hash := sha256.New()
+	for _, name := range vary {
+		_, _ = hash.Write([]byte(name + ":" + strings.Join(r.Header[name], ",") + "\n"))
+	}
+	return baseKey(r) + "#" + scope + "#" + hex.EncodeToString(hash.Sum(nil)[:16])
+}
+
+// varyHeaders returns the canonical, sorted, names of the request headers the response varies on.
+func varyHeaders(header http.Header) []string {
+	var names []string
+	for _, value := range header["Vary"] {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); len(name) != 0 {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,228 @@
+// +build all unit
+
+package cache
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics/discard"
+
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/service"
+)
+
+// memStore is an in memory Store used for testing, it ignores ttls.
+type memStore struct {
+	mu     sync.Mutex
+	values map[string][]byte
+	// paths indexes the keys stored under each path
+	paths map[string]map[string]bool
+}
+
+func newMemStore() *memStore {
+	return &memStore{values: make(map[string][]byte), paths: make(map[string]map[string]bool)}
+}
+
+func (ms *memStore) Get(key string) ([]byte, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	val, ok := ms.values[key]
+	if !ok {
+		return nil, ErrMiss
+	}
+	return val, nil
+}
+
+func (ms *memStore) Set(path, key string, value []byte, ttl time.Duration) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.values[key] = value
+	if ms.paths[path] == nil {
+		ms.paths[path] = make(map[string]bool)
+	}
+	ms.paths[path][key] = true
+	return nil
+}
+
+func (ms *memStore) PurgePath(path string) (int, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	purged := 0
+	for key := range ms.paths[path] {
+		if _, ok := ms.values[key]; ok {
+			delete(ms.values, key)
+			purged++
+		}
+	}
+	delete(ms.paths, path)
+	return purged, nil
+}
+
+func (ms *memStore) PurgePrefix(prefix string) (int, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	purged := 0
+	for key := range ms.values {
+		if strings.HasPrefix(key, prefix) {
+			delete(ms.values, key)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// countingTransport responds to every request with a response using the provided headers,
+// counting the requests it receives.
+type countingTransport struct {
+	header http.Header
+	calls  int
+}
+
+func (ct *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	ct.calls++
+	header := http.Header{}
+	for name, values := range ct.header {
+		header[name] = values
+	}
+	return &http.Response{StatusCode: http.StatusOK, Header: header,
+		Body: ioutil.NopCloser(strings.NewReader("body")), ContentLength: 4, Request: r}, nil
+}
+
+func newTestTransport(t *testing.T, header http.Header) (http.RoundTripper, *countingTransport, *Cache) {
+	svc := &service.Service{Name: "test", Upstreams: []string{"http://a:80"},
+		Cache: service.ResponseCache{Enabled: true}}
+	if _, err := service.NewRegistry(svc); err != nil {
+		t.Fatalf("case: N/A: unexpected error in test setup: %s", err)
+	}
+	upstream := &countingTransport{header: header}
+	c := New(newMemStore(), discard.NewCounter(), kitlog.NewNopLogger())
+	identity := func(r *http.Request) string { return r.Header.Get("User") }
+	return c.Transport(svc, identity, upstream), upstream, c
+}
+
+func get(t *testing.T, rt http.RoundTripper, method, path, user string) *http.Response {
+	r, _ := http.NewRequest(method, "http://gateway"+path, nil)
+	r.Header.Set("User", user)
+	resp, err := rt.RoundTrip(r)
+	if err != nil {
+		t.Fatalf("case: N/A: unexpected error: %s", err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if string(body) != "body" {
+		t.Fatalf("case: N/A: expected body to be proxied unchanged, got %q", body)
+	}
+	return resp
+}
+
+func TestTransport_RoundTrip(t *testing.T) {
+	cases := []struct {
+		name          string
+		hint          string
+		cacheControl  string
+		vary          string
+		users         []string
+		expectedCalls int
+	}{
+		{"Public", "public responses are shared by every user", "public, max-age=60", "",
+			[]string{"a", "b", "a"}, 1},
+		{"Private", "responses not marked public are cached per user", "max-age=60", "",
+			[]string{"a", "b", "a", "b"}, 2},
+		{"No Store", "no-store responses must never be cached", "no-store, max-age=60", "",
+			[]string{"a", "a"}, 2},
+		{"No Max Age", "only responses with explicit freshness are cached", "public", "",
+			[]string{"a", "a"}, 2},
+		{"Vary Star", "a response varying on everything can not be cached", "public, max-age=60", "*",
+			[]string{"a", "a"}, 2},
+		{"Vary User", "a response varying on a header is cached per value", "public, max-age=60", "User",
+			[]string{"a", "b", "a", "b"}, 2},
+	}
+	for _, c := range cases {
+		header := http.Header{"Cache-Control": {c.cacheControl}}
+		if len(c.vary) != 0 {
+			header.Set("Vary", c.vary)
+		}
+		rt, upstream, _ := newTestTransport(t, header)
+		for _, user := range c.users {
+			get(t, rt, http.MethodGet, "/api/v1/test/quizzes/1", user)
+		}
+		if upstream.calls != c.expectedCalls {
+			t.Errorf("case: %s: expected %d requests to reach the service, got %d\nHINT: %s",
+				c.name, c.expectedCalls, upstream.calls, c.hint)
+		}
+	}
+}
+
+func TestTransport_Invalidation(t *testing.T) {
+	rt, upstream, c := newTestTransport(t, http.Header{"Cache-Control": {"public, max-age=60"}})
+	get(t, rt, http.MethodGet, "/api/v1/test/quizzes/1", "a")
+	if resp := get(t, rt, http.MethodGet, "/api/v1/test/quizzes/1", "a"); resp.Header.Get(HeaderCacheStatus) != "HIT" {
+		t.Errorf("case: invalidation: expected second request to be served from cache")
+	}
+	get(t, rt, http.MethodPut, "/api/v1/test/quizzes/1", "a")
+	get(t, rt, http.MethodGet, "/api/v1/test/quizzes/1", "a")
+	if upstream.calls != 3 {
+		t.Errorf("case: invalidation: expected PUT to invalidate the cached response, service got %d requests",
+			upstream.calls)
+	}
+
+	get(t, rt, http.MethodGet, "/api/v1/test/quizzes/1?page=2", "a")
+	get(t, rt, http.MethodGet, "/api/v1/test/quizzes/10", "a")
+	get(t, rt, http.MethodDelete, "/api/v1/test/quizzes/1", "a")
+	resp := get(t, rt, http.MethodGet, "/api/v1/test/quizzes/1?page=2", "a")
+	if resp.Header.Get(HeaderCacheStatus) == "HIT" {
+		t.Errorf("case: invalidation: expected DELETE to invalidate the cached response for every query of the path")
+	}
+	resp = get(t, rt, http.MethodGet, "/api/v1/test/quizzes/10", "a")
+	if resp.Header.Get(HeaderCacheStatus) != "HIT" {
+		t.Errorf("case: invalidation: expected DELETE to leave the cached responses of other paths")
+	}
+
+	calls := upstream.calls
+	get(t, rt, http.MethodGet, "/api/v1/test/quizzes/2", "a")
+	if purged, err := c.Purge("/api/v1/test/"); err != nil || purged == 0 {
+		t.Errorf("case: purge: expected cached responses to be purged, got %d, %v", purged, err)
+	}
+	get(t, rt, http.MethodGet, "/api/v1/test/quizzes/2", "a")
+	if upstream.calls != calls+2 {
+		t.Errorf("case: purge: expected purged response to be fetched again, service got %d requests",
+			upstream.calls)
+	}
+}
+
+func TestResponsePolicy(t *testing.T) {
+	maxTTL := time.Minute
+	cases := []struct {
+		name         string
+		hint         string
+		header       http.Header
+		expectedTTL  time.Duration
+		expectShared bool
+		expectOk     bool
+	}{
+		{"Max Age", "max-age sets the ttl", http.Header{"Cache-Control": {"max-age=30"}},
+			time.Second * 30, false, true},
+		{"S-Maxage", "s-maxage takes precedence over max-age", http.Header{"Cache-Control": {"max-age=30, s-maxage=10, public"}},
+			time.Second * 10, true, true},
+		{"Capped", "the ttl is capped at max ttl", http.Header{"Cache-Control": {"max-age=3600"}},
+			maxTTL, false, true},
+		{"Age", "the age of the response reduces the ttl", http.Header{"Cache-Control": {"max-age=30"}, "Age": {"20"}},
+			time.Second * 10, false, true},
+		{"Set-Cookie", "responses setting cookies are never cached",
+			http.Header{"Cache-Control": {"max-age=30"}, "Set-Cookie": {"a=b"}}, 0, false, false},
+		{"Private", "private overrides public", http.Header{"Cache-Control": {"public, private, max-age=30"}},
+			time.Second * 30, false, true},
+	}
+	for _, c := range cases {
+		ttl, shared, ok := responsePolicy(&http.Response{StatusCode: http.StatusOK, Header: c.header}, maxTTL)
+		if ttl != c.expectedTTL || shared != c.expectShared || ok != c.expectOk {
+			t.Errorf("case: %s: expected (%s, %t, %t), got (%s, %t, %t)\nHINT: %s", c.name,
+				c.expectedTTL, c.expectShared, c.expectOk, ttl, shared, ok, c.hint)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package cache
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cacheableStatus lists the response status codes which may be cached.
+var cacheableStatus = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusNotFound:             true,
+	http.StatusGone:                 true,
+}
+
+// cacheControl holds the directives of a Cache-Control header, keyed by lower case directive name.
+type cacheControl map[string]string
+
+// parseCacheControl parses every Cache-Control header in header into its directives.
+func parseCacheControl(header http.Header) cacheControl {
+	cc := cacheControl{}
+	for _, value := range header["Cache-Control"] {
+		for _, directive := range strings.Split(value, ",") {
+			directive = strings.TrimSpace(directive)
+			if len(directive) == 0 {
+				continue
+			}
+			name, arg := directive, ""
+			if i := strings.Index(directive, "="); i >= 0 {
+				name, arg = directive[:i], strings.Trim(strings.TrimSpace(directive[i+1:]), "\"")
+			}
+			cc[strings.ToLower(strings.TrimSpace(name))] = arg
+		}
+	}
+	return cc
+}
+
+// has reports if the directive is present.
+func (cc cacheControl) has(directive string) bool {
+	_, ok := cc[directive]
+	return ok
+}
+
+// seconds returns the value of a delta-seconds directive, such as max-age.
+func (cc cacheControl) seconds(directive string) (time.Duration, bool) {
+	arg, ok := cc[directive]
+	if !ok {
+		return 0, false
+	}
+	secs, errA := strconv.ParseInt(arg, 10, 64)
+	if errA != nil || secs < 0 {
+		return 0, false
+	}
+	return time.Duration(secs) * time.Second, true
+}
+
+// requestPolicy decides how the cache treats a request, based on its method and Cache-Control header.
+// If store is false the request bypasses the cache completely. If lookup is false the request is always
+// sent to the service, but its response may still be stored.
+func requestPolicy(r *http.Request) (lookup, store bool) {
+	if r.Method != http.MethodGet || isStream(r) {
+		return false, false
+	}
+	cc := parseCacheControl(r.Header)
+	if cc.has("no-store") {
+		return false, false
+	}
+	maxAge, hasMaxAge := cc.seconds("max-age")
+	if cc.has("no-cache") || (hasMaxAge && maxAge == 0) || strings.Contains(r.Header.Get("Pragma"), "no-cache") {
+		return false, true
+	}
+	return true, true
+}
+
+// isStream reports if the request is for a WebSocket or Server-Sent Events stream, which are never cached.
+func isStream(r *http.Request) bool {
+	return len(r.Header.Get("Upgrade")) != 0 || strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+// responsePolicy decides if a response may be stored, and for how long, based on its status and headers.
+// shared is true if the service marked the response public, so it can be served to every user.
+// The ttl is capped at maxTTL.
+func responsePolicy(resp *http.Response, maxTTL time.Duration) (ttl time.Duration, shared, ok bool) {
+	if !cacheableStatus[resp.StatusCode] || len(resp.Header["Set-Cookie"]) != 0 {
+		return 0, false, false
+	}
+	for _, name := range varyHeaders(resp.Header) {
+		if name == "*" {
+			return 0, false, false
+		}
+	}
+	cc := parseCacheControl(resp.Header)
+	if cc.has("no-store") || cc.has("no-cache") {
+		return 0, false, false
+	}
+	ttl, hasTTL := cc.seconds("s-maxage")
+	if !hasTTL {
+		ttl, hasTTL = cc.seconds("max-age")
+	}
+	if !hasTTL {
+		return 0, false, false
+	}
+	if age, errA := strconv.ParseInt(resp.Header.Get("Age"), 10, 64); errA == nil && age > 0 {
+		ttl -= time.Duration(age) * time.Second
+	}
+	if ttl > maxTTL {
+		ttl = maxTTL
+	}
+	if ttl <= 0 {
+		return 0, false, false
+	}
+	return ttl, cc.has("public") && !cc.has("private"), true
+}
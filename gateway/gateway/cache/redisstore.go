@@ -0,0 +1,116 @@
+package cache
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// redisKeyPrefix is prepended to every key, to keep cached responses apart from other data in redis.
+const redisKeyPrefix = "respcache:"
+
+// redisIndexSuffix is appended to the escaped path of a url to name the set indexing the keys cached for it.
+// A '#' in a path is escaped, so the index never clashes with a key cached for another url.
+const redisIndexSuffix = "#keys"
+
+// redisScanCount is the number of keys examined by each SCAN call when purging.
+const redisScanCount = 100
+
+// setScript stores a value and adds its key to the index of its path. The index expires with the longest lived
+// key it holds, so a key stored with a shorter ttl never leaves an earlier key unindexed.
+var setScript = redis.NewScript(`
+redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+redis.call("SADD", KEYS[2], KEYS[1])
+if redis.call("PTTL", KEYS[2]) < tonumber(ARGV[2]) then
+	redis.call("PEXPIRE", KEYS[2], ARGV[2])
+end
+return 1
+`)
+
+// purgePathScript deletes every key in the index of a path, and the index, returning the number of keys deleted.
+// Keys are deleted in batches, as unpack is limited by the size of the Lua stack.
+var purgePathScript = redis.NewScript(`
+local keys = redis.call("SMEMBERS", KEYS[1])
+local purged = 0
+for i = 1, #keys, 1000 do
+	purged = purged + redis.call("DEL", unpack(keys, i, math.min(i + 999, #keys)))
+end
+redis.call("DEL", KEYS[1])
+return purged
+`)
+
+// globEscaper escapes the characters redis treats as special in a SCAN MATCH pattern.
+var globEscaper = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`)
+
+// RedisStore represents a cache.Store backed by redis.
+type RedisStore struct {
+	//Redis client used to talk to redis server.
+	Client *redis.Client
+}
+
+// NewRedisStore constructs a new RedisStore
+func NewRedisStore(client *redis.Client) *RedisStore {
+	if client == nil {
+		panic("No client provided!")
+	}
+	return &RedisStore{client}
+}
+
+// Get returns the value stored for the key, or ErrMiss if there is none.
+func (rs *RedisStore) Get(key string) ([]byte, error) {
+	val, err := rs.Client.Get(redisKeyPrefix + key).Bytes()
+	if err == redis.Nil {
+		return nil, ErrMiss
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting cached response: %s", err)
+	}
+	return val, nil
+}
+
+// Set stores the value for the key, expiring it after ttl, and adds the key to the index of path.
+func (rs *RedisStore) Set(path, key string, value []byte, ttl time.Duration) error {
+	keys := []string{redisKeyPrefix + key, redisKeyPrefix + path + redisIndexSuffix}
+	if err := setScript.Run(rs.Client, keys, value, ttl.Milliseconds()).Err(); err != nil {
+		return fmt.Errorf("error setting cached response: %s", err)
+	}
+	return nil
+}
+
+// PurgePath deletes every value indexed under path, returning the number deleted.
+// Only the index of path is read, so the cost does not grow with the number of keys in redis.
+func (rs *RedisStore) PurgePath(path string) (int, error) {
+	purged, err := purgePathScript.Run(rs.Client, []string{redisKeyPrefix + path + redisIndexSuffix}).Int()
+	if err != nil {
+		return purged, fmt.Errorf("error purging cached responses: %s", err)
+	}
+	return purged, nil
+}
+
+// PurgePrefix deletes every value whose key starts with prefix, returning the number deleted.
+// The index of each path starting with prefix is deleted too, and counted.
+// Every key in redis is scanned, so it is only used to purge the cache on request, not on each unsafe request.
+func (rs *RedisStore) PurgePrefix(prefix string) (int, error) {
+	pattern := redisKeyPrefix + globEscaper.Replace(prefix) + "*"
+	purged := 0
+	var cursor uint64
+	for {
+		keys, next, err := rs.Client.Scan(cursor, pattern, redisScanCount).Result()
+		if err != nil {
+			return purged, fmt.Errorf("error scanning cached responses: %s", err)
+		}
+		if len(keys) != 0 {
+			deleted, errD := rs.Client.Del(keys...).Result()
+			purged += int(deleted)
+			if errD != nil {
+				return purged, fmt.Errorf("error deleting cached responses: %s", errD)
+			}
+		}
+		if next == 0 {
+			return purged, nil
+		}
+		cursor = next
+	}
+}
@@ -0,0 +1,73 @@
+// +build all integration
+
+package cache
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+/*
+TestRedisStore_PurgePath tests that the keys stored for a path are indexed, so PurgePath deletes them, and only them.
+
+By default, the test will try to use a local instance of redis running on its default port (6379). If you want to
+use a different address, set the REDISADDR environment variable.
+*/
+func TestRedisStore_PurgePath(t *testing.T) {
+	redisaddr := os.Getenv("REDISADDR")
+	if len(redisaddr) == 0 {
+		redisaddr = "127.0.0.1:6379"
+	}
+	client := redis.NewClient(&redis.Options{
+		Addr: redisaddr,
+	})
+	store := NewRedisStore(client)
+
+	stored := map[string]string{
+		"/test/quizzes/1?#variants":    "/test/quizzes/1",
+		"/test/quizzes/1?page=2#a#b":   "/test/quizzes/1",
+		"/test/quizzes/10?#variants":   "/test/quizzes/10",
+		"/test/quizzes/10?#shared#abc": "/test/quizzes/10",
+	}
+	for key, path := range stored {
+		// The shorter ttl of a later key must not expire the index of the earlier keys
+		if err := store.Set(path, key, []byte("value"), time.Minute); err != nil {
+			t.Fatalf("unexpected error setting up test: %s", err)
+		}
+	}
+	if err := store.Set("/test/quizzes/1", "/test/quizzes/1?short#a#b", []byte("value"), time.Second); err != nil {
+		t.Fatalf("unexpected error setting up test: %s", err)
+	}
+	defer func() {
+		_, _ = store.PurgePrefix("/test/quizzes/")
+	}()
+	if ttl := client.PTTL(redisKeyPrefix + "/test/quizzes/1" + redisIndexSuffix).Val(); ttl <= time.Second {
+		t.Errorf("case: Index TTL: expected the index to expire with its longest lived key, but got %s\n"+
+			"HINT: keys left out of the index are never invalidated", ttl)
+	}
+
+	purged, err := store.PurgePath("/test/quizzes/1")
+	if err != nil {
+		t.Fatalf("case: Purge: unexpected error: %s", err)
+	}
+	if purged != 3 {
+		t.Errorf("case: Purge: expected 3 keys to be purged but got %d\n"+
+			"HINT: every key stored for the path, whatever its query, should be purged", purged)
+	}
+	for key, path := range stored {
+		_, errG := store.Get(key)
+		if path == "/test/quizzes/1" && errG != ErrMiss {
+			t.Errorf("case: Purge: expected %s to be purged, but got %v", key, errG)
+		}
+		if path != "/test/quizzes/1" && errG != nil {
+			t.Errorf("case: Purge: expected %s of another path to be kept, but got %s\n"+
+				"HINT: a path which starts with the path purged is a different path", key, errG)
+		}
+	}
+	if exists := client.Exists(redisKeyPrefix + "/test/quizzes/1" + redisIndexSuffix).Val(); exists != 0 {
+		t.Errorf("case: Purge: expected the index of the path to be deleted with its keys")
+	}
+}
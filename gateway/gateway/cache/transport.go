@@ -0,0 +1,163 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/service"
+)
+
+// HeaderCacheStatus is set on each response passing through the cache, to either HIT or MISS.
+const HeaderCacheStatus = "X-Cache"
+
+// Transport is an http.RoundTripper which serves requests to a service from the cache when it can,
+// sending the rest on to next and storing their responses.
+type Transport struct {
+	cache    *Cache
+	svc      *service.Service
+	identity func(r *http.Request) string
+	next     http.RoundTripper
+}
+
+// Transport wraps next with the cache, using the cache config of the service.
+// identity returns who the request is made on behalf of, responses not marked public
+// are only served to requests with the same identity as the request they were stored for.
+// If caching is not enabled for the service, next is returned unchanged.
+func (c *Cache) Transport(svc *service.Service, identity func(r *http.Request) string,
+	next http.RoundTripper) http.RoundTripper {
+	if c == nil || !svc.Cache.Enabled {
+		return next
+	}
+	return &Transport{cache: c, svc: svc, identity: identity, next: next}
+}
+
+// RoundTrip serves the request from the cache if a fresh response is stored for it,
+// otherwise sends it on, storing the response if it is cacheable.
+// A successful request with an unsafe method, such as POST, invalidates the cached responses for its path.
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+	default:
+		resp, err := t.next.RoundTrip(r)
+		if err == nil && resp.StatusCode < http.StatusBadRequest {
+			t.cache.invalidate(r)
+		}
+		return resp, err
+	}
+	lookup, store := requestPolicy(r)
+	if !store {
+		t.cache.results.With("service", t.svc.Name, "result", ResultBypass).Add(1)
+		return t.next.RoundTrip(r)
+	}
+	if lookup {
+		if resp := t.lookup(r); resp != nil {
+			t.cache.results.With("service", t.svc.Name, "result", ResultHit).Add(1)
+			return resp, nil
+		}
+	}
+	t.cache.results.With("service", t.svc.Name, "result", ResultMiss).Add(1)
+	resp, err := t.next.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+	t.store(r, resp)
+	resp.Header.Set(HeaderCacheStatus, "MISS")
+	return resp, nil
+}
+
+// lookup returns the stored response for the request, or nil if there is none.
+func (t *Transport) lookup(r *http.Request) *http.Response {
+	var vars variants
+	if !t.get(variantsKey(r), &vars) {
+		return nil
+	}
+	scope := scopeShared
+	if !vars.Shared {
+		scope = t.identity(r)
+	}
+	var entry Entry
+	if !t.get(entryKey(r, scope, vars.Vary), &entry) {
+		return nil
+	}
+	header := make(http.Header, len(entry.Header)+2)
+	for name, values := range entry.Header {
+		header[name] = append([]string(nil), values...)
+	}
+	header.Set("Age", strconv.FormatInt(int64(time.Since(entry.StoredAt)/time.Second), 10))
+	header.Set(HeaderCacheStatus, "HIT")
+	return &http.Response{
+		Status:        strconv.Itoa(entry.StatusCode) + " " + http.StatusText(entry.StatusCode),
+		StatusCode:    entry.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(entry.Body)),
+		ContentLength: int64(len(entry.Body)),
+		Request:       r,
+	}
+}
+
+// get decodes the value stored for key into obj, reporting if it was found.
+func (t *Transport) get(key string, obj interface{}) bool {
+	val, errG := t.cache.store.Get(key)
+	if errG != nil {
+		if errG != ErrMiss {
+			_ = t.cache.logger.Log("msg", "unable to get cached response", "key", key, "error", errG)
+		}
+		return false
+	}
+	if errU := json.Unmarshal(val, obj); errU != nil {
+		_ = t.cache.logger.Log("msg", "unable to decode cached response", "key", key, "error", errU)
+		return false
+	}
+	return true
+}
+
+// store saves the response if it is cacheable, replacing its body with one that can still be read.
+func (t *Transport) store(r *http.Request, resp *http.Response) {
+	ttl, shared, ok := responsePolicy(resp, time.Duration(t.svc.Cache.MaxTTL))
+	maxBody := t.svc.Cache.MaxBodyBytes
+	if !ok || resp.ContentLength > maxBody {
+		return
+	}
+	body, errRA := ioutil.ReadAll(io.LimitReader(resp.Body, maxBody+1))
+	if errRA != nil || int64(len(body)) > maxBody {
+		// Not cacheable after all, but the client still needs the whole body.
+		resp.Body = &prefixedBody{Reader: io.MultiReader(bytes.NewReader(body), resp.Body), Closer: resp.Body}
+		return
+	}
+	_ = resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	vars := variants{Vary: varyHeaders(resp.Header), Shared: shared}
+	scope := scopeShared
+	if !shared {
+		scope = t.identity(r)
+	}
+	entry := Entry{StatusCode: resp.StatusCode, Header: resp.Header, Body: body, StoredAt: time.Now()}
+	t.set(r, entryKey(r, scope, vars.Vary), &entry, ttl)
+	t.set(r, variantsKey(r), &vars, ttl)
+}
+
+// set encodes obj and stores it under key, indexed under the path of the request.
+func (t *Transport) set(r *http.Request, key string, obj interface{}, ttl time.Duration) {
+	val, errM := json.Marshal(obj)
+	if errM == nil {
+		errM = t.cache.store.Set(r.URL.EscapedPath(), key, val, ttl)
+	}
+	if errM != nil {
+		_ = t.cache.logger.Log("msg", "unable to store response in cache", "key", key, "error", errM)
+	}
+}
+
+// prefixedBody is a response body of which a prefix has already been read into memory.
+type prefixedBody struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/config"
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/user"
+)
+
+// usage describes the subcommands of the gateway. Without a subcommand, the gateway serves requests.
+const usage = `usage: gateway [command]
+
+Without a command, the gateway serves requests.
+
+commands:
+  config check [-config path]                  validate the configuration and print the effective configuration
+  migrate [-dry-run] [-config path]            apply the migrations of the gateway to the database, or with -dry-run,
+                                               print the migrations which would be applied
+  user create -username name [-full-name name] [-display-name name] [-config path]
+                                               create a user, with the password read from stdin
+  user reset-password -username name [-keep-sessions] [-config path]
+                                               replace the password of a user with one read from stdin,
+                                               and revoke their sessions
+  user grant-role -username name -role role [-config path]
+                                               grant a role to a user
+  session revoke -user name [-config path]     end every session of a user
+  hash-password                                print the encoded hash of a password read from stdin
+  healthcheck [-url url] [-timeout duration] [-config path]
+                                               exit 0 if the gateway is live, such as for a docker HEALTHCHECK
+
+Commands which use the configuration load it as the gateway would, from GATEWAY_CONFIG_FILE and the environment.
+`
+
+// command runs a subcommand with the remaining arguments, returning the exit code of the program.
+type command func(args []string, stdin io.Reader, stdout, stderr io.Writer) int
+
+// commands are the subcommands of the gateway, by name.
+var commands = map[string]command{
+	"config check":        configCheck,
+	"migrate":             migrateCommand,
+	"user create":         userCreate,
+	"user reset-password": userResetPassword,
+	"user grant-role":     userGrantRole,
+	"session revoke":      sessionRevoke,
+	"hash-password":       hashPassword,
+	"healthcheck":         healthcheck,
+}
+
+// runCommand runs the subcommand named by args with the provided stdin, stdout and stderr,
+// returning the exit code of the program.
+func runCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) > 1 {
+		if cmd, ok := commands[args[0]+" "+args[1]]; ok {
+			return cmd(args[2:], stdin, stdout, stderr)
+		}
+	}
+	if cmd, ok := commands[args[0]]; ok {
+		return cmd(args[1:], stdin, stdout, stderr)
+	}
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		_, _ = fmt.Fprint(stdout, usage)
+		return 0
+	}
+	_, _ = fmt.Fprint(stderr, usage)
+	return 2
+}
+
+// newFlagSet creates the flags of a subcommand, including the -config flag, which defaults to GATEWAY_CONFIG_FILE.
+func newFlagSet(name string, stderr io.Writer) (*flag.FlagSet, *string) {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	path := flags.String("config", os.Getenv(config.EnvConfigFile), "path of the configuration file")
+	return flags, path
+}
+
+// flagSet is a flag.FlagSet which can report flags which must be set, but were not.
+type flagSet struct {
+	*flag.FlagSet
+	requiredNames []string
+}
+
+// required defines a string flag which must be set.
+func (fs *flagSet) required(name, usage string) *string {
+	fs.requiredNames = append(fs.requiredNames, name)
+	return fs.String(name, "", usage+" (required)")
+}
+
+// missing returns the name of the first required flag which was not set, or an empty string if all were.
+func (fs *flagSet) missing() string {
+	for _, name := range fs.requiredNames {
+		if len(fs.Lookup(name).Value.String()) == 0 {
+			return name
+		}
+	}
+	return ""
+}
+
+// loadConfig loads the configuration at path, and the environment, printing every problem found to stderr.
+// Returns nil if the configuration is not valid.
+func loadConfig(path string, stderr io.Writer) *config.Config {
+	cfg, errL := config.Load(path, os.LookupEnv)
+	if errL != nil {
+		_, _ = fmt.Fprintf(stderr, "configuration is not valid:\n%s\n", errL)
+		return nil
+	}
+	return cfg
+}
+
+// configCheck loads the configuration as the gateway would, printing the effective configuration, with
+// secrets redacted, to stdout and every problem found to stderr. Returns 1 if the configuration is not valid.
+func configCheck(args []string, _ io.Reader, stdout, stderr io.Writer) int {
+	flags, path := newFlagSet("config check", stderr)
+	if errP := flags.Parse(args); errP != nil {
+		return 2
+	}
+
+	cfg, errL := config.Load(*path, os.LookupEnv)
+	if cfg != nil {
+		dump, errD := cfg.Dump()
+		if errD != nil {
+			_, _ = fmt.Fprintf(stderr, "unable to print configuration: %s\n", errD)
+			return 1
+		}
+		_, _ = stdout.Write(dump)
+	}
+	if errL != nil {
+		_, _ = fmt.Fprintf(stderr, "configuration is not valid:\n%s\n", errL)
+		return 1
+	}
+	_, _ = fmt.Fprintln(stderr, "configuration is valid")
+	return 0
+}
+
+// readPassword reads a password from the first line of stdin, so it is not kept in the shell history
+// or visible in the process list, such as when piped from a secret file.
+func readPassword(stdin io.Reader) (string, error) {
+	line, errRS := bufio.NewReader(stdin).ReadString('\n')
+	if errRS != nil && errRS != io.EOF {
+		return "", fmt.Errorf("unable to read password from stdin: %s", errRS)
+	}
+	password := strings.TrimRight(line, "\r\n")
+	if len(password) == 0 {
+		return "", errors.New("a password must be provided on stdin")
+	}
+	return password, nil
+}
+
+// hashPassword prints the encoded hash of the password read from stdin, as it would be stored for a user.
+func hashPassword(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("hash-password", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	if errP := flags.Parse(args); errP != nil {
+		return 2
+	}
+	password, errRP := readPassword(stdin)
+	if errRP != nil {
+		_, _ = fmt.Fprintln(stderr, errRP)
+		return 1
+	}
+	encodedHash, errCEH := user.CreateEncodedHash(password)
+	if errCEH != nil {
+		_, _ = fmt.Fprintf(stderr, "unable to hash password: %s\n", errCEH)
+		return 1
+	}
+	_, _ = fmt.Fprintln(stdout, encodedHash)
+	return 0
+}
+
+// healthcheck requests the liveness endpoint of the gateway, returning 0 if it responds with 200 OK.
+// By default the gateway listening on this host, at the listen address of the configuration, is checked.
+func healthcheck(args []string, _ io.Reader, stdout, stderr io.Writer) int {
+	flags, path := newFlagSet("healthcheck", stderr)
+	url := flags.String("url", "", "url to check, defaults to the liveness endpoint of the listen address")
+	timeout := flags.Duration("timeout", time.Second*5, "time allowed for the gateway to respond")
+	if errP := flags.Parse(args); errP != nil {
+		return 2
+	}
+
+	if len(*url) == 0 {
+		// Only the listen address is needed, so a configuration with other problems can still be checked
+		cfg, errL := config.Load(*path, os.LookupEnv)
+		if cfg == nil {
+			_, _ = fmt.Fprintf(stderr, "unable to load configuration: %s\n", errL)
+			return 1
+		}
+		host, port, errSHP := net.SplitHostPort(cfg.Server.ListenAddr)
+		if errSHP != nil {
+			_, _ = fmt.Fprintf(stderr, "invalid listen address: %s\n", errSHP)
+			return 1
+		}
+		if len(host) == 0 {
+			host = "localhost"
+		}
+		*url = "https://" + net.JoinHostPort(host, port) + "/api/v1/" + serviceGateway + "/" + colHealth + "/live"
+	}
+
+	// The gateway is reached by its local address, which its certificate is not issued for
+	client := &http.Client{Timeout: *timeout, Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}}
+	resp, errG := client.Get(*url)
+	if errG != nil {
+		_, _ = fmt.Fprintf(stderr, "unhealthy: %s\n", errG)
+		return 1
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		_, _ = fmt.Fprintf(stderr, "unhealthy: %s responded %s\n", *url, resp.Status)
+		return 1
+	}
+	_, _ = fmt.Fprintln(stdout, "healthy")
+	return 0
+}
@@ -0,0 +1,446 @@
+// +build all unit
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/user"
+)
+
+// validConfigFile is a configuration file which sets every required setting.
+const validConfigFile = `
+tls:
+  certPath: /certs/gateway.crt
+  keyPath: /certs/gateway.key
+session:
+  key: file-session-key
+mssql:
+  scheme: sqlserver
+  username: gateway
+  password: file-password
+  host: mssql
+  port: "1433"
+  database: Perceptia
+redis:
+  address: redis:6379
+services:
+  aqRestHostname: anyquiz
+  aqRestPort: "80"
+`
+
+// writeConfigFile writes contents to a configuration file in a temporary directory, returning its path.
+func writeConfigFile(t *testing.T, contents string) string {
+	path := filepath.Join(t.TempDir(), "gateway.yaml")
+	if errW := ioutil.WriteFile(path, []byte(contents), 0600); errW != nil {
+		t.Fatalf("unexpected error setting up test: %s", errW)
+	}
+	return path
+}
+
+func TestRunCommand(t *testing.T) {
+	cases := []struct {
+		name         string
+		hint         string
+		args         []string
+		stdin        string
+		expectedCode int
+		// expectedOut and expectedErr must be in stdout and stderr
+		expectedOut string
+		expectedErr string
+	}{
+		{
+			name:         "Help",
+			hint:         "Help should print the usage to stdout and succeed",
+			args:         []string{"help"},
+			expectedCode: 0,
+			expectedOut:  "usage: gateway [command]",
+		},
+		{
+			name:         "Help Flag",
+			hint:         "The -h flag should print the usage to stdout and succeed",
+			args:         []string{"-h"},
+			expectedCode: 0,
+			expectedOut:  "usage: gateway [command]",
+		},
+		{
+			name:         "Unknown Command",
+			hint:         "An unknown command should print the usage to stderr and exit 2",
+			args:         []string{"serve"},
+			expectedCode: 2,
+			expectedErr:  "usage: gateway [command]",
+		},
+		{
+			name:         "Unknown Subcommand",
+			hint:         "An unknown subcommand of a known command should print the usage to stderr and exit 2",
+			args:         []string{"user", "delete", "-username", "joe"},
+			expectedCode: 2,
+			expectedErr:  "usage: gateway [command]",
+		},
+		{
+			name:         "Missing Subcommand",
+			hint:         "A command which needs a subcommand should not run without one",
+			args:         []string{"user"},
+			expectedCode: 2,
+			expectedErr:  "usage: gateway [command]",
+		},
+		{
+			name:         "One Word Command",
+			hint:         "A one word command should be run with the arguments after it",
+			args:         []string{"hash-password"},
+			stdin:        "really secure password!\n",
+			expectedCode: 0,
+			expectedOut:  "$argon2id$",
+		},
+		{
+			name:         "Two Word Command",
+			hint:         "A two word command should be run with the arguments after both words",
+			args:         []string{"config", "check", "-config", "/does/not/exist.yaml"},
+			expectedCode: 1,
+			expectedErr:  "unable to read file",
+		},
+		{
+			name:         "Missing Required Flag",
+			hint:         "A command should exit 2 naming the required flag which was not set",
+			args:         []string{"user", "create", "-full-name", "Joe User"},
+			stdin:        "really secure password!\n",
+			expectedCode: 2,
+			expectedErr:  "user create: -username must be set",
+		},
+		{
+			name:         "Second Required Flag Missing",
+			hint:         "Every required flag should be checked, not only the first",
+			args:         []string{"user", "grant-role", "-username", "joe"},
+			expectedCode: 2,
+			expectedErr:  "user grant-role: -role must be set",
+		},
+		{
+			name:         "Session Revoke Missing User",
+			hint:         "A command should exit 2 naming the required flag which was not set",
+			args:         []string{"session", "revoke"},
+			expectedCode: 2,
+			expectedErr:  "session revoke: -user must be set",
+		},
+		{
+			name:         "Unknown Flag",
+			hint:         "A flag the command does not define should exit 2",
+			args:         []string{"hash-password", "-cost", "3"},
+			stdin:        "really secure password!\n",
+			expectedCode: 2,
+			expectedErr:  "flag provided but not defined: -cost",
+		},
+	}
+
+	for _, c := range cases {
+		stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+		code := runCommand(c.args, strings.NewReader(c.stdin), stdout, stderr)
+		if code != c.expectedCode {
+			t.Errorf("case: %s: expected exit code %d but got %d, stderr: %s\nHINT: %s", c.name, c.expectedCode,
+				code, stderr, c.hint)
+		}
+		if !strings.Contains(stdout.String(), c.expectedOut) {
+			t.Errorf("case: %s: expected stdout to include %q but got %q\nHINT: %s", c.name, c.expectedOut,
+				stdout, c.hint)
+		}
+		if !strings.Contains(stderr.String(), c.expectedErr) {
+			t.Errorf("case: %s: expected stderr to include %q but got %q\nHINT: %s", c.name, c.expectedErr,
+				stderr, c.hint)
+		}
+	}
+}
+
+func TestFlagSet_Missing(t *testing.T) {
+	cases := []struct {
+		name     string
+		hint     string
+		args     []string
+		expected string
+	}{
+		{
+			name:     "All Set",
+			hint:     "No flag should be missing when every required flag is set, whatever the optional flags",
+			args:     []string{"-username", "joe", "-role", "admin"},
+			expected: "",
+		},
+		{
+			name:     "None Set",
+			hint:     "The first required flag defined should be reported",
+			args:     []string{},
+			expected: "username",
+		},
+		{
+			name:     "First Set",
+			hint:     "The first required flag which is not set should be reported",
+			args:     []string{"-username", "joe"},
+			expected: "role",
+		},
+		{
+			name:     "Set Empty",
+			hint:     "A required flag set to an empty value should be reported",
+			args:     []string{"-username", "", "-role", "admin"},
+			expected: "username",
+		},
+	}
+
+	for _, c := range cases {
+		fs := &flagSet{FlagSet: flag.NewFlagSet("test", flag.ContinueOnError)}
+		fs.required("username", "username of the user")
+		fs.String("full-name", "", "full name of the user")
+		fs.required("role", "role to grant")
+		if errP := fs.Parse(c.args); errP != nil {
+			t.Fatalf("unexpected error setting up test: %s", errP)
+		}
+		if missing := fs.missing(); missing != c.expected {
+			t.Errorf("case: %s: expected %q to be missing but got %q\nHINT: %s", c.name, c.expected, missing, c.hint)
+		}
+	}
+}
+
+func TestReadPassword(t *testing.T) {
+	cases := []struct {
+		name      string
+		hint      string
+		stdin     string
+		expected  string
+		expectErr bool
+	}{
+		{
+			name:     "Line",
+			hint:     "The password should be read without its line ending",
+			stdin:    "really secure password!\n",
+			expected: "really secure password!",
+		},
+		{
+			name:     "Windows Line Ending",
+			hint:     "A carriage return before the newline should not be part of the password",
+			stdin:    "really secure password!\r\n",
+			expected: "really secure password!",
+		},
+		{
+			name:     "No Line Ending",
+			hint:     "A password piped without a trailing newline should still be read",
+			stdin:    "really secure password!",
+			expected: "really secure password!",
+		},
+		{
+			name:     "First Line Only",
+			hint:     "Only the first line of stdin should be the password",
+			stdin:    "really secure password!\nsomething else\n",
+			expected: "really secure password!",
+		},
+		{
+			name:     "Spaces Kept",
+			hint:     "Spaces are part of the password, so should not be trimmed",
+			stdin:    "  spaced password  \n",
+			expected: "  spaced password  ",
+		},
+		{
+			name:      "Empty",
+			hint:      "An empty stdin should be an error",
+			stdin:     "",
+			expectErr: true,
+		},
+		{
+			name:      "Empty Line",
+			hint:      "An empty first line should be an error",
+			stdin:     "\nreally secure password!\n",
+			expectErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		password, errRP := readPassword(strings.NewReader(c.stdin))
+		if c.expectErr {
+			if errRP == nil {
+				t.Errorf("case: %s: expected an error but got password %q\nHINT: %s", c.name, password, c.hint)
+			}
+			continue
+		}
+		if errRP != nil {
+			t.Errorf("case: %s: unexpected error: %s\nHINT: %s", c.name, errRP, c.hint)
+			continue
+		}
+		if password != c.expected {
+			t.Errorf("case: %s: expected password %q but got %q\nHINT: %s", c.name, c.expected, password, c.hint)
+		}
+	}
+}
+
+func TestHashPassword(t *testing.T) {
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	if code := hashPassword(nil, strings.NewReader("really secure password!\n"), stdout, stderr); code != 0 {
+		t.Fatalf("case: Valid: expected exit code 0 but got %d, stderr: %s", code, stderr)
+	}
+	encodedHash := strings.TrimSpace(stdout.String())
+	if ok, errA := user.Authenticate("really secure password!", encodedHash); !ok {
+		t.Errorf("case: Valid: expected the hash printed to match the password, but got %s\n"+
+			"HINT: the hash should be the one stored for a user with the password", errA)
+	}
+	if strings.Contains(stdout.String()+stderr.String(), "really secure password!") {
+		t.Errorf("case: Valid: expected the password not to be printed\n" +
+			"HINT: the output may be kept in logs or the terminal scrollback")
+	}
+
+	stdout, stderr = &bytes.Buffer{}, &bytes.Buffer{}
+	if code := hashPassword(nil, strings.NewReader("short\n"), stdout, stderr); code != 1 || stdout.Len() != 0 {
+		t.Errorf("case: Invalid: expected exit code 1 and no hash, but got %d, stdout: %s\n"+
+			"HINT: a password a user could not sign up with should not be hashed", code, stdout)
+	}
+
+	stdout, stderr = &bytes.Buffer{}, &bytes.Buffer{}
+	if code := hashPassword(nil, strings.NewReader(""), stdout, stderr); code != 1 ||
+		!strings.Contains(stderr.String(), "a password must be provided on stdin") {
+		t.Errorf("case: No Password: expected exit code 1 explaining the password is missing, but got %d, "+
+			"stderr: %s\nHINT: the password is read from stdin", code, stderr)
+	}
+}
+
+func TestConfigCheck(t *testing.T) {
+	cases := []struct {
+		name         string
+		hint         string
+		file         string
+		expectedCode int
+		expectedOut  string
+		expectedErr  string
+		// secret must not be printed
+		secret string
+	}{
+		{
+			name:         "Valid",
+			hint:         "A valid configuration should be printed, with its secrets redacted",
+			file:         validConfigFile,
+			expectedCode: 0,
+			expectedOut:  "aqRestHostname: anyquiz",
+			expectedErr:  "configuration is valid",
+			secret:       "file-password",
+		},
+		{
+			name:         "Missing Setting",
+			hint:         "A configuration missing a required setting should exit 1 naming the setting",
+			file:         strings.Replace(validConfigFile, "  key: file-session-key\n", "", 1),
+			expectedCode: 1,
+			expectedOut:  "aqRestHostname: anyquiz",
+			expectedErr:  "session.key (GATEWAY_SESSION_KEY) must be set",
+			secret:       "file-password",
+		},
+		{
+			name:         "Unknown Setting",
+			hint:         "A configuration file which can not be parsed should exit 1",
+			file:         validConfigFile + "unknown: true\n",
+			expectedCode: 1,
+			expectedErr:  "unable to parse file",
+		},
+	}
+
+	for _, c := range cases {
+		stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+		code := configCheck([]string{"-config", writeConfigFile(t, c.file)}, nil, stdout, stderr)
+		if code != c.expectedCode {
+			t.Errorf("case: %s: expected exit code %d but got %d, stderr: %s\nHINT: %s", c.name, c.expectedCode,
+				code, stderr, c.hint)
+		}
+		if !strings.Contains(stdout.String(), c.expectedOut) {
+			t.Errorf("case: %s: expected stdout to include %q but got %q\nHINT: %s", c.name, c.expectedOut,
+				stdout, c.hint)
+		}
+		if !strings.Contains(stderr.String(), c.expectedErr) {
+			t.Errorf("case: %s: expected stderr to include %q but got %q\nHINT: %s", c.name, c.expectedErr,
+				stderr, c.hint)
+		}
+		if len(c.secret) != 0 && strings.Contains(stdout.String()+stderr.String(), c.secret) {
+			t.Errorf("case: %s: expected %q not to be printed\nHINT: secrets should be redacted", c.name,
+				c.secret)
+		}
+	}
+}
+
+func TestHealthcheck(t *testing.T) {
+	livePath := "/api/v1/" + serviceGateway + "/" + colHealth + "/live"
+	status := http.StatusOK
+	gateway := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != livePath {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(status)
+	}))
+	defer gateway.Close()
+
+	cases := []struct {
+		name         string
+		hint         string
+		args         []string
+		status       int
+		expectedCode int
+		expectedOut  string
+		expectedErr  string
+	}{
+		{
+			name:         "Live",
+			hint:         "A gateway which responds 200 should be healthy",
+			args:         []string{"-url", gateway.URL + livePath},
+			status:       http.StatusOK,
+			expectedCode: 0,
+			expectedOut:  "healthy",
+		},
+		{
+			name:         "Not Live",
+			hint:         "A gateway which responds with any other status should be unhealthy",
+			args:         []string{"-url", gateway.URL + livePath},
+			status:       http.StatusServiceUnavailable,
+			expectedCode: 1,
+			expectedErr:  "503 Service Unavailable",
+		},
+		{
+			name: "Listen Address",
+			hint: "By default the liveness endpoint of the listen address of the configuration should be checked",
+			args: []string{"-config", writeConfigFile(t, validConfigFile+"server:\n  listenAddr: "+
+				gateway.Listener.Addr().String()+"\n")},
+			status:       http.StatusOK,
+			expectedCode: 0,
+			expectedOut:  "healthy",
+		},
+		{
+			name:         "Unreachable",
+			hint:         "A gateway which can not be reached should be unhealthy",
+			args:         []string{"-url", "https://127.0.0.1:1" + livePath, "-timeout", "1s"},
+			status:       http.StatusOK,
+			expectedCode: 1,
+			expectedErr:  "unhealthy",
+		},
+		{
+			name:         "Invalid Timeout",
+			hint:         "A flag which can not be parsed should exit 2",
+			args:         []string{"-url", gateway.URL + livePath, "-timeout", "soon"},
+			status:       http.StatusOK,
+			expectedCode: 2,
+			expectedErr:  "invalid value",
+		},
+	}
+
+	for _, c := range cases {
+		status = c.status
+		stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+		code := healthcheck(c.args, nil, stdout, stderr)
+		if code != c.expectedCode {
+			t.Errorf("case: %s: expected exit code %d but got %d, stderr: %s\nHINT: %s", c.name, c.expectedCode,
+				code, stderr, c.hint)
+		}
+		if !strings.Contains(stdout.String(), c.expectedOut) {
+			t.Errorf("case: %s: expected stdout to include %q but got %q\nHINT: %s", c.name, c.expectedOut,
+				stdout, c.hint)
+		}
+		if !strings.Contains(stderr.String(), c.expectedErr) {
+			t.Errorf("case: %s: expected stderr to include %q but got %q\nHINT: %s", c.name, c.expectedErr,
+				stderr, c.hint)
+		}
+	}
+}
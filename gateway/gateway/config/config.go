@@ -0,0 +1,517 @@
+// Package config loads the configuration of the gateway from an optional YAML file,
+// overridden by environment variables.
+//
+// Every setting can be set by the environment variable named in the env tag of its field.
+// If that variable is not set, the variable with the _FILE suffix, such as MSSQL_PASSWORD_FILE,
+// is read as the path of a file holding the value, such as a Docker secret.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/migration"
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/session"
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/tlsconfig"
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/tracing"
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/user"
+)
+
+// EnvConfigFile is the environment variable holding the path of the configuration file.
+const EnvConfigFile = "GATEWAY_CONFIG_FILE"
+
+// fileSuffix is appended to the environment variable of a setting to name the variable holding
+// the path of a file containing the value.
+const fileSuffix = "_FILE"
+
+// Databases users and audit events may be stored in.
+const (
+	DatabaseMsSql    = "mssql"
+	DatabasePostgres = "postgres"
+)
+
+// Access log fields which may be omitted.
+var accessLogFields = map[string]bool{"clientAddr": true, "userAgent": true, "userUuid": true, "query": true}
+
+// Config is the complete configuration of the gateway.
+type Config struct {
+	// Environment is the name of the environment the gateway is deployed to, such as "development".
+	Environment string `yaml:"environment" json:"environment" env:"GATEWAY_ENVIRONMENT"`
+	// DevMode keeps users, audit events, and, if no redis address is set, sessions in the memory of the gateway,
+	// so it can be run with no database. Everything is lost when the gateway exits.
+	DevMode bool    `yaml:"devMode" json:"devMode" env:"GATEWAY_DEV_MODE"`
+	Server  Server  `yaml:"server" json:"server"`
+	Api     Api     `yaml:"api" json:"api"`
+	TLS     TLS     `yaml:"tls" json:"tls"`
+	Session Session `yaml:"session" json:"session"`
+	// Database is the database users and audit events are stored in, mssql or postgres.
+	Database  string    `yaml:"database" json:"database" env:"GATEWAY_DATABASE"`
+	Mssql     Mssql     `yaml:"mssql" json:"mssql"`
+	Postgres  Postgres  `yaml:"postgres" json:"postgres"`
+	Redis     Redis     `yaml:"redis" json:"redis"`
+	Stores    Stores    `yaml:"stores" json:"stores"`
+	Services  Services  `yaml:"services" json:"services"`
+	AccessLog AccessLog `yaml:"accessLog" json:"accessLog"`
+	Audit     Audit     `yaml:"audit" json:"audit"`
+	Export    Export    `yaml:"export" json:"export"`
+	Deletion  Deletion  `yaml:"deletion" json:"deletion"`
+	OpenApi   OpenApi   `yaml:"openApi" json:"openApi"`
+	Tracing   Tracing   `yaml:"tracing" json:"tracing"`
+	Shutdown  Shutdown  `yaml:"shutdown" json:"shutdown"`
+}
+
+// Server holds the addresses the gateway listens on.
+type Server struct {
+	ListenAddr string `yaml:"listenAddr" json:"listenAddr" env:"GATEWAY_LISTEN_ADDR"`
+	// AdminListenAddr is the address of the internal admin server, which must not be exposed to clients.
+	AdminListenAddr string `yaml:"adminListenAddr" json:"adminListenAddr" env:"GATEWAY_ADMIN_LISTEN_ADDR"`
+	// HttpRedirectAddr is the address of the optional plain http listener, which only redirects to https.
+	HttpRedirectAddr string `yaml:"httpRedirectAddr" json:"httpRedirectAddr" env:"GATEWAY_HTTP_REDIRECT_ADDR"`
+}
+
+// Api describes the external address clients reach the gateway from.
+type Api struct {
+	Scheme string `yaml:"scheme" json:"scheme" env:"GATEWAY_API_SCHEME"`
+	Host   string `yaml:"host" json:"host" env:"GATEWAY_API_HOST"`
+	Port   string `yaml:"port" json:"port" env:"GATEWAY_API_PORT"`
+	// InitialDeprecated is when version 1.0.0 of the gateway api is deprecated, or zero if it is not.
+	// Responses served with 1.0.0 give this time in the Deprecation header, even before it has passed.
+	InitialDeprecated Time `yaml:"initialDeprecated" json:"initialDeprecated" env:"GATEWAY_API_INITIAL_DEPRECATED"`
+	// InitialSunset is when version 1.0.0 stops being served, or zero if it is not planned.
+	InitialSunset Time `yaml:"initialSunset" json:"initialSunset" env:"GATEWAY_API_INITIAL_SUNSET"`
+}
+
+// TLS holds the certificates served by the gateway, and the versions and cipher suites clients may use.
+type TLS struct {
+	CertPath       string   `yaml:"certPath" json:"certPath" env:"GATEWAY_TLSCERTPATH"`
+	KeyPath        string   `yaml:"keyPath" json:"keyPath" env:"GATEWAY_TLSKEYPATH"`
+	SniCertPaths   []string `yaml:"sniCertPaths" json:"sniCertPaths" env:"GATEWAY_TLS_SNI_CERTPATHS"`
+	SniKeyPaths    []string `yaml:"sniKeyPaths" json:"sniKeyPaths" env:"GATEWAY_TLS_SNI_KEYPATHS"`
+	ReloadInterval Duration `yaml:"reloadInterval" json:"reloadInterval" env:"GATEWAY_TLS_RELOAD_INTERVAL"`
+	MinVersion     string   `yaml:"minVersion" json:"minVersion" env:"GATEWAY_TLS_MIN_VERSION"`
+	CipherSuites   []string `yaml:"cipherSuites" json:"cipherSuites" env:"GATEWAY_TLS_CIPHER_SUITES"`
+}
+
+// Session holds the settings of client sessions.
+type Session struct {
+	// Key is used to sign session tokens.
+	Key Secret `yaml:"key" json:"key" env:"GATEWAY_SESSION_KEY"`
+}
+
+// Mssql holds the connection settings of the mssql database.
+type Mssql struct {
+	Scheme   string `yaml:"scheme" json:"scheme" env:"MSSQL_SCHEME"`
+	Username string `yaml:"username" json:"username" env:"MSSQL_USERNAME"`
+	Password Secret `yaml:"password" json:"password" env:"MSSQL_PASSWORD"`
+	Host     string `yaml:"host" json:"host" env:"MSSQL_HOST"`
+	Port     string `yaml:"port" json:"port" env:"MSSQL_PORT"`
+	Database string `yaml:"database" json:"database" env:"MSSQL_DATABASE"`
+	// Migrate is what the gateway does with pending migrations when it starts: apply, check, or off.
+	Migrate string `yaml:"migrate" json:"migrate" env:"MSSQL_MIGRATE"`
+	// MigrationUsername and MigrationPassword login to apply migrations, as the gateway user may only execute
+	// stored procedures. If not set, the username and password are used.
+	MigrationUsername string `yaml:"migrationUsername" json:"migrationUsername" env:"MSSQL_MIGRATION_USERNAME"`
+	MigrationPassword Secret `yaml:"migrationPassword" json:"migrationPassword" env:"MSSQL_MIGRATION_PASSWORD"`
+}
+
+// MigrationLogin returns the username and password used to apply migrations.
+func (m Mssql) MigrationLogin() (string, string) {
+	if len(m.MigrationUsername) == 0 {
+		return m.Username, m.Password.Value()
+	}
+	return m.MigrationUsername, m.MigrationPassword.Value()
+}
+
+// Postgres holds the connection settings of the PostgreSQL database.
+type Postgres struct {
+	Host     string `yaml:"host" json:"host" env:"POSTGRES_HOST"`
+	Port     string `yaml:"port" json:"port" env:"POSTGRES_PORT"`
+	Username string `yaml:"username" json:"username" env:"POSTGRES_USERNAME"`
+	Password Secret `yaml:"password" json:"password" env:"POSTGRES_PASSWORD"`
+	Database string `yaml:"database" json:"database" env:"POSTGRES_DATABASE"`
+	// SslMode is the sslmode of the connection, such as require or verify-full.
+	SslMode string `yaml:"sslMode" json:"sslMode" env:"POSTGRES_SSLMODE"`
+	// Migrate is what the gateway does with pending migrations when it starts: apply, check, or off.
+	Migrate string `yaml:"migrate" json:"migrate" env:"POSTGRES_MIGRATE"`
+	// MigrationUsername and MigrationPassword login to apply migrations, such as the owner of the database.
+	// If not set, the username and password are used.
+	MigrationUsername string `yaml:"migrationUsername" json:"migrationUsername" env:"POSTGRES_MIGRATION_USERNAME"`
+	MigrationPassword Secret `yaml:"migrationPassword" json:"migrationPassword" env:"POSTGRES_MIGRATION_PASSWORD"`
+}
+
+// MigrationLogin returns the username and password used to apply migrations.
+func (p Postgres) MigrationLogin() (string, string) {
+	if len(p.MigrationUsername) == 0 {
+		return p.Username, p.Password.Value()
+	}
+	return p.MigrationUsername, p.MigrationPassword.Value()
+}
+
+// Redis holds the connection settings of redis.
+type Redis struct {
+	Address string `yaml:"address" json:"address" env:"REDIS_ADDRESS"`
+}
+
+// Stores holds the time allowed for calls to the user and session stores, after which the request fails with
+// 503 Service Unavailable, so a slow database or redis does not hold requests open, and the time users are cached.
+type Stores struct {
+	// Timeout is the time allowed for an operation which does not have its own timeout. Zero is no limit.
+	Timeout Duration `yaml:"timeout" json:"timeout" env:"GATEWAY_STORE_TIMEOUT"`
+	// UserCacheTtl is the time users read from the user store are cached in redis. Zero does not cache users.
+	UserCacheTtl Duration `yaml:"userCacheTtl" json:"userCacheTtl" env:"GATEWAY_USER_CACHE_TTL"`
+	// UserTimeouts are the time allowed for operations of the user store, by operation, such as ReadUserInfo.
+	UserTimeouts map[string]Duration `yaml:"userTimeouts" json:"userTimeouts" env:"GATEWAY_USER_STORE_TIMEOUTS"`
+	// SessionTimeouts are the time allowed for operations of the session store, by operation, such as Get.
+	SessionTimeouts map[string]Duration `yaml:"sessionTimeouts" json:"sessionTimeouts" env:"GATEWAY_SESSION_STORE_TIMEOUTS"`
+}
+
+// User returns the timeouts of the user store.
+func (s Stores) User() user.Timeouts {
+	return user.Timeouts{Default: time.Duration(s.Timeout), Operations: durations(s.UserTimeouts)}
+}
+
+// Session returns the timeouts of the session store.
+func (s Stores) Session() session.Timeouts {
+	return session.Timeouts{Default: time.Duration(s.Timeout), Operations: durations(s.SessionTimeouts)}
+}
+
+// durations converts a map of Duration to a map of time.Duration.
+func durations(m map[string]Duration) map[string]time.Duration {
+	converted := make(map[string]time.Duration, len(m))
+	for key, value := range m {
+		converted[key] = time.Duration(value)
+	}
+	return converted
+}
+
+// Services identifies the backend services the gateway proxies requests to.
+type Services struct {
+	// ConfigPath is the path of the service registry file.
+	ConfigPath string `yaml:"configPath" json:"configPath" env:"GATEWAY_SERVICES_CONFIG"`
+	// AqRestHostname and AqRestPort identify the only service, anyquiz, if ConfigPath is not set.
+	AqRestHostname string `yaml:"aqRestHostname" json:"aqRestHostname" env:"AQREST_HOSTNAME"`
+	AqRestPort     string `yaml:"aqRestPort" json:"aqRestPort" env:"AQREST_PORT"`
+}
+
+// AccessLog describes which requests, and which of their fields, are written to the access log.
+type AccessLog struct {
+	SampleRatio  float64  `yaml:"sampleRatio" json:"sampleRatio" env:"GATEWAY_ACCESS_LOG_SAMPLE_RATIO"`
+	RedactParams []string `yaml:"redactParams" json:"redactParams" env:"GATEWAY_ACCESS_LOG_REDACT_PARAMS"`
+	OmitFields   []string `yaml:"omitFields" json:"omitFields" env:"GATEWAY_ACCESS_LOG_OMIT_FIELDS"`
+}
+
+// Audit describes where audit events are written, in addition to the database.
+type Audit struct {
+	File string `yaml:"file" json:"file" env:"GATEWAY_AUDIT_FILE"`
+}
+
+// Export holds the settings of exports of the personal data of users.
+type Export struct {
+	// Ttl is the time an archive is kept once it is requested, during which it can be downloaded.
+	Ttl Duration `yaml:"ttl" json:"ttl" env:"GATEWAY_EXPORT_TTL"`
+	// LinkTtl is the time a download link can be used for once it is given to the user.
+	LinkTtl Duration `yaml:"linkTtl" json:"linkTtl" env:"GATEWAY_EXPORT_LINK_TTL"`
+	// Timeout is the time allowed to generate an archive, after which it has failed.
+	Timeout Duration `yaml:"timeout" json:"timeout" env:"GATEWAY_EXPORT_TIMEOUT"`
+}
+
+// Deletion holds the settings of deleting the accounts of users.
+type Deletion struct {
+	// GracePeriod is the time a deleted account can be restored by signing in, after which it is purged.
+	GracePeriod Duration `yaml:"gracePeriod" json:"gracePeriod" env:"GATEWAY_DELETION_GRACE_PERIOD"`
+	// PurgeInterval is the time between checks for accounts whose grace period has passed.
+	PurgeInterval Duration `yaml:"purgeInterval" json:"purgeInterval" env:"GATEWAY_DELETION_PURGE_INTERVAL"`
+}
+
+// OpenApi controls checking requests to the gateway against the OpenAPI spec of the gateway api.
+type OpenApi struct {
+	// Validate rejects requests which do not match the spec. In the development environment,
+	// responses are checked too, and any which do not match are logged.
+	Validate bool `yaml:"validate" json:"validate" env:"GATEWAY_OPENAPI_VALIDATE"`
+}
+
+// Tracing describes where spans are exported, and how many traces are recorded.
+type Tracing struct {
+	Exporter    string  `yaml:"exporter" json:"exporter" env:"GATEWAY_TRACING_EXPORTER"`
+	File        string  `yaml:"file" json:"file" env:"GATEWAY_TRACING_FILE"`
+	SampleRatio float64 `yaml:"sampleRatio" json:"sampleRatio" env:"GATEWAY_TRACING_SAMPLE_RATIO"`
+}
+
+// Shutdown describes how long the gateway takes to shut down.
+type Shutdown struct {
+	// Delay is the time the gateway reports not ready before it stops listening.
+	Delay Duration `yaml:"delay" json:"delay" env:"GATEWAY_SHUTDOWN_DELAY"`
+	// Timeout is the time allowed for in-flight requests and streams to complete.
+	Timeout Duration `yaml:"timeout" json:"timeout" env:"GATEWAY_SHUTDOWN_TIMEOUT"`
+}
+
+// Default returns the configuration used for any setting which is not provided.
+func Default() *Config {
+	return &Config{
+		Environment: "development",
+		Server:      Server{ListenAddr: ":443", AdminListenAddr: "localhost:8081"},
+		Api:         Api{Scheme: "https", Host: "localhost", Port: "443"},
+		TLS:         TLS{ReloadInterval: Duration(tlsconfig.DefaultReloadInterval), MinVersion: "1.2"},
+		AccessLog:   AccessLog{SampleRatio: 1},
+		Tracing:     Tracing{Exporter: tracing.ExporterNone, SampleRatio: 1},
+		Database:    DatabaseMsSql,
+		Mssql:       Mssql{Migrate: migration.ModeCheck},
+		Postgres:    Postgres{Port: "5432", SslMode: "require", Migrate: migration.ModeCheck},
+		Stores:      Stores{Timeout: Duration(time.Second * 5), UserCacheTtl: Duration(time.Minute * 5)},
+		Export: Export{Ttl: Duration(time.Hour), LinkTtl: Duration(time.Minute * 5),
+			Timeout: Duration(time.Minute * 2)},
+		Deletion: Deletion{GracePeriod: Duration(time.Hour * 24 * 30), PurgeInterval: Duration(time.Hour)},
+		Shutdown: Shutdown{Delay: Duration(time.Second * 5), Timeout: Duration(time.Second * 30)},
+	}
+}
+
+// Load reads the configuration file at path, if path is not empty, on top of the defaults,
+// and then applies any setting provided by the environment, as looked up by lookupEnv.
+//
+// If the configuration can be read but is not valid, or an environment variable can not be used,
+// it is returned along with an error describing every problem found.
+// If the file can not be read, only the error is returned.
+func Load(path string, lookupEnv func(string) (string, bool)) (*Config, error) {
+	cfg := Default()
+	if len(path) != 0 {
+		data, errRF := ioutil.ReadFile(path)
+		if errRF != nil {
+			return nil, fmt.Errorf("config: unable to read file: %s", errRF)
+		}
+		if errU := yaml.UnmarshalStrict(data, cfg); errU != nil {
+			return nil, fmt.Errorf("config: unable to parse file: %s", errU)
+		}
+	}
+	errAE := applyEnv(reflect.ValueOf(cfg).Elem(), lookupEnv)
+	return cfg, errors.Join(errAE, cfg.Validate())
+}
+
+// applyEnv sets each field of v which has an env tag from its environment variable, or the file named by
+// the variable with the _FILE suffix. Returns an error describing every variable which could not be used.
+func applyEnv(v reflect.Value, lookupEnv func(string) (string, bool)) error {
+	var errs []error
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		name, ok := v.Type().Field(i).Tag.Lookup("env")
+		if !ok {
+			if field.Kind() == reflect.Struct {
+				errs = append(errs, applyEnv(field, lookupEnv))
+			}
+			continue
+		}
+		value, set := lookupEnv(name)
+		if !set {
+			path, fileSet := lookupEnv(name + fileSuffix)
+			if !fileSet {
+				continue
+			}
+			data, errRF := ioutil.ReadFile(path)
+			if errRF != nil {
+				errs = append(errs, fmt.Errorf("%s%s: unable to read file: %s", name, fileSuffix, errRF))
+				continue
+			}
+			// Files usually end with a newline, which is never part of the value.
+			value = strings.TrimRight(string(data), "\r\n")
+		}
+		if errS := setField(field, value); errS != nil {
+			errs = append(errs, fmt.Errorf("%s: %s", name, errS))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// setField parses value into the field, according to its type.
+func setField(field reflect.Value, value string) error {
+	switch field.Interface().(type) {
+	case Duration:
+		duration, errPD := time.ParseDuration(value)
+		if errPD != nil {
+			return errors.New("must be a duration, such as 30s")
+		}
+		field.SetInt(int64(duration))
+	case Time:
+		at := Time{}
+		if errU := at.UnmarshalText([]byte(value)); errU != nil {
+			return errU
+		}
+		field.Set(reflect.ValueOf(at))
+	case []string:
+		field.Set(reflect.ValueOf(splitList(value)))
+	case map[string]Duration:
+		durations := make(map[string]Duration)
+		for _, item := range splitList(value) {
+			key, text, found := strings.Cut(item, "=")
+			duration, errPD := time.ParseDuration(strings.TrimSpace(text))
+			if !found || errPD != nil {
+				return errors.New("must be a list of name=duration, such as Get=1s,Save=2s")
+			}
+			durations[strings.TrimSpace(key)] = Duration(duration)
+		}
+		field.Set(reflect.ValueOf(durations))
+	case bool:
+		enabled, errPB := strconv.ParseBool(value)
+		if errPB != nil {
+			return errors.New("must be true or false")
+		}
+		field.SetBool(enabled)
+	case float64:
+		number, errPF := strconv.ParseFloat(value, 64)
+		if errPF != nil {
+			return errors.New("must be a number")
+		}
+		field.SetFloat(number)
+	default:
+		field.SetString(value)
+	}
+	return nil
+}
+
+// splitList splits a comma separated list, ignoring empty items and surrounding whitespace.
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); len(item) != 0 {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Validate reports every problem with the configuration at once, or nil if it is valid.
+func (cfg *Config) Validate() error {
+	var errs []error
+	required := func(value, name, env string) {
+		if len(value) == 0 {
+			errs = append(errs, fmt.Errorf("%s (%s) must be set", name, env))
+		}
+	}
+	required(cfg.Environment, "environment", "GATEWAY_ENVIRONMENT")
+	required(cfg.Server.ListenAddr, "server.listenAddr", "GATEWAY_LISTEN_ADDR")
+	required(cfg.Server.AdminListenAddr, "server.adminListenAddr", "GATEWAY_ADMIN_LISTEN_ADDR")
+	required(cfg.TLS.CertPath, "tls.certPath", "GATEWAY_TLSCERTPATH")
+	required(cfg.TLS.KeyPath, "tls.keyPath", "GATEWAY_TLSKEYPATH")
+	required(cfg.Session.Key.Value(), "session.key", "GATEWAY_SESSION_KEY")
+	migrateMode := func(value, name, env string) {
+		switch value {
+		case migration.ModeApply, migration.ModeCheck, migration.ModeOff:
+		default:
+			errs = append(errs, fmt.Errorf("%s (%s): %s", name, env, migration.ErrUnknownMode))
+		}
+	}
+	switch {
+	case cfg.DevMode:
+		// Users, audit events, and sessions are kept in memory, redis is only used if an address is set
+	case cfg.Database == DatabaseMsSql:
+		required(cfg.Mssql.Scheme, "mssql.scheme", "MSSQL_SCHEME")
+		required(cfg.Mssql.Username, "mssql.username", "MSSQL_USERNAME")
+		required(cfg.Mssql.Password.Value(), "mssql.password", "MSSQL_PASSWORD")
+		required(cfg.Mssql.Host, "mssql.host", "MSSQL_HOST")
+		required(cfg.Mssql.Port, "mssql.port", "MSSQL_PORT")
+		required(cfg.Mssql.Database, "mssql.database", "MSSQL_DATABASE")
+		if len(cfg.Mssql.MigrationUsername) != 0 {
+			required(cfg.Mssql.MigrationPassword.Value(), "mssql.migrationPassword", "MSSQL_MIGRATION_PASSWORD")
+		}
+		migrateMode(cfg.Mssql.Migrate, "mssql.migrate", "MSSQL_MIGRATE")
+	case cfg.Database == DatabasePostgres:
+		required(cfg.Postgres.Host, "postgres.host", "POSTGRES_HOST")
+		required(cfg.Postgres.Port, "postgres.port", "POSTGRES_PORT")
+		required(cfg.Postgres.Username, "postgres.username", "POSTGRES_USERNAME")
+		required(cfg.Postgres.Password.Value(), "postgres.password", "POSTGRES_PASSWORD")
+		required(cfg.Postgres.Database, "postgres.database", "POSTGRES_DATABASE")
+		required(cfg.Postgres.SslMode, "postgres.sslMode", "POSTGRES_SSLMODE")
+		if len(cfg.Postgres.MigrationUsername) != 0 {
+			required(cfg.Postgres.MigrationPassword.Value(), "postgres.migrationPassword",
+				"POSTGRES_MIGRATION_PASSWORD")
+		}
+		migrateMode(cfg.Postgres.Migrate, "postgres.migrate", "POSTGRES_MIGRATE")
+	default:
+		errs = append(errs, fmt.Errorf("database (GATEWAY_DATABASE) must be %s or %s", DatabaseMsSql,
+			DatabasePostgres))
+	}
+	if !cfg.DevMode {
+		required(cfg.Redis.Address, "redis.address", "REDIS_ADDRESS")
+	}
+	if len(cfg.Services.ConfigPath) == 0 {
+		required(cfg.Services.AqRestHostname, "services.aqRestHostname", "AQREST_HOSTNAME")
+		required(cfg.Services.AqRestPort, "services.aqRestPort", "AQREST_PORT")
+	}
+
+	if len(cfg.TLS.SniCertPaths) != len(cfg.TLS.SniKeyPaths) {
+		errs = append(errs, errors.New("tls.sniKeyPaths (GATEWAY_TLS_SNI_KEYPATHS) must list a key for each of "+
+			"tls.sniCertPaths (GATEWAY_TLS_SNI_CERTPATHS)"))
+	}
+	if _, errPV := tlsconfig.ParseVersion(cfg.TLS.MinVersion); errPV != nil {
+		errs = append(errs, fmt.Errorf("tls.minVersion (GATEWAY_TLS_MIN_VERSION): %s", errPV))
+	}
+	if _, errPCS := tlsconfig.ParseCipherSuites(cfg.TLS.CipherSuites); errPCS != nil {
+		errs = append(errs, fmt.Errorf("tls.cipherSuites (GATEWAY_TLS_CIPHER_SUITES): %s", errPCS))
+	}
+	for _, field := range cfg.AccessLog.OmitFields {
+		if !accessLogFields[field] {
+			errs = append(errs, fmt.Errorf("accessLog.omitFields (GATEWAY_ACCESS_LOG_OMIT_FIELDS): unknown field %s",
+				field))
+		}
+	}
+	switch cfg.Tracing.Exporter {
+	case tracing.ExporterNone, tracing.ExporterOtlp, tracing.ExporterStdout:
+	case tracing.ExporterFile:
+		required(cfg.Tracing.File, "tracing.file", "GATEWAY_TRACING_FILE")
+	default:
+		errs = append(errs, fmt.Errorf("tracing.exporter (GATEWAY_TRACING_EXPORTER): %s", tracing.ErrUnknownExporter))
+	}
+
+	deprecated, sunset := cfg.Api.InitialDeprecated.Time(), cfg.Api.InitialSunset.Time()
+	if !deprecated.IsZero() && !sunset.IsZero() && !sunset.After(deprecated) {
+		errs = append(errs, errors.New("api.initialSunset (GATEWAY_API_INITIAL_SUNSET) must be after "+
+			"api.initialDeprecated (GATEWAY_API_INITIAL_DEPRECATED)"))
+	}
+
+	ratio := func(value float64, name, env string) {
+		if value < 0 || value > 1 {
+			errs = append(errs, fmt.Errorf("%s (%s) must be between 0 and 1", name, env))
+		}
+	}
+	ratio(cfg.AccessLog.SampleRatio, "accessLog.sampleRatio", "GATEWAY_ACCESS_LOG_SAMPLE_RATIO")
+	ratio(cfg.Tracing.SampleRatio, "tracing.sampleRatio", "GATEWAY_TRACING_SAMPLE_RATIO")
+
+	nonNegative := func(value Duration, name, env string) {
+		if value < 0 {
+			errs = append(errs, fmt.Errorf("%s (%s) must not be negative", name, env))
+		}
+	}
+	positive := func(value Duration, name, env string) {
+		if value <= 0 {
+			errs = append(errs, fmt.Errorf("%s (%s) must be greater than zero", name, env))
+		}
+	}
+	if errV := cfg.Stores.User().Validate(); errV != nil {
+		errs = append(errs, fmt.Errorf("stores.userTimeouts (GATEWAY_USER_STORE_TIMEOUTS): %s", errV))
+	}
+	if errV := cfg.Stores.Session().Validate(); errV != nil {
+		errs = append(errs, fmt.Errorf("stores.sessionTimeouts (GATEWAY_SESSION_STORE_TIMEOUTS): %s", errV))
+	}
+
+	nonNegative(cfg.TLS.ReloadInterval, "tls.reloadInterval", "GATEWAY_TLS_RELOAD_INTERVAL")
+	nonNegative(cfg.Stores.Timeout, "stores.timeout", "GATEWAY_STORE_TIMEOUT")
+	nonNegative(cfg.Stores.UserCacheTtl, "stores.userCacheTtl", "GATEWAY_USER_CACHE_TTL")
+	nonNegative(cfg.Shutdown.Delay, "shutdown.delay", "GATEWAY_SHUTDOWN_DELAY")
+	nonNegative(cfg.Shutdown.Timeout, "shutdown.timeout", "GATEWAY_SHUTDOWN_TIMEOUT")
+	positive(cfg.Export.Ttl, "export.ttl", "GATEWAY_EXPORT_TTL")
+	positive(cfg.Export.LinkTtl, "export.linkTtl", "GATEWAY_EXPORT_LINK_TTL")
+	positive(cfg.Export.Timeout, "export.timeout", "GATEWAY_EXPORT_TIMEOUT")
+	positive(cfg.Deletion.GracePeriod, "deletion.gracePeriod", "GATEWAY_DELETION_GRACE_PERIOD")
+	positive(cfg.Deletion.PurgeInterval, "deletion.purgeInterval", "GATEWAY_DELETION_PURGE_INTERVAL")
+	return errors.Join(errs...)
+}
+
+// Dump returns the configuration as YAML, with every secret redacted.
+func (cfg *Config) Dump() ([]byte, error) {
+	return yaml.Marshal(cfg)
+}
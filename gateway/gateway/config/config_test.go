@@ -0,0 +1,305 @@
+// +build all unit
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// validFile is a configuration file which sets every required setting.
+const validFile = `
+tls:
+  certPath: /certs/gateway.crt
+  keyPath: /certs/gateway.key
+session:
+  key: file-session-key
+mssql:
+  scheme: sqlserver
+  username: gateway
+  password: file-password
+  host: mssql
+  port: "1433"
+  database: Perceptia
+redis:
+  address: redis:6379
+services:
+  aqRestHostname: anyquiz
+  aqRestPort: "80"
+`
+
+func writeFile(t *testing.T, dir, name, contents string) string {
+	path := filepath.Join(dir, name)
+	if errW := ioutil.WriteFile(path, []byte(contents), 0600); errW != nil {
+		t.Fatalf("case: N/A: unexpected error writing %s: %s", name, errW)
+	}
+	return path
+}
+
+func envFrom(vars map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := vars[name]
+		return value, ok
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir, errTD := ioutil.TempDir("", "config")
+	if errTD != nil {
+		t.Fatalf("case: N/A: unexpected error creating directory: %s", errTD)
+	}
+	defer os.RemoveAll(dir)
+	configPath := writeFile(t, dir, "gateway.yaml", validFile)
+	secretPath := writeFile(t, dir, "mssql_password", "secret-password\n")
+
+	cases := []struct {
+		name   string
+		hint   string
+		path   string
+		env    map[string]string
+		errors []string
+		check  func(cfg *Config) string
+	}{
+		{
+			name: "File Only",
+			hint: "Every setting should be read from the file, with defaults for the rest",
+			path: configPath,
+			check: func(cfg *Config) string {
+				if cfg.Mssql.Password.Value() != "file-password" || cfg.Server.ListenAddr != ":443" {
+					return "expected settings from the file and defaults"
+				}
+				return ""
+			},
+		},
+		{
+			name: "Env Overrides File",
+			hint: "A setting in the environment should replace the value from the file",
+			path: configPath,
+			env: map[string]string{"MSSQL_HOST": "other", "GATEWAY_SHUTDOWN_TIMEOUT": "1m",
+				"GATEWAY_ACCESS_LOG_OMIT_FIELDS": "query, userAgent"},
+			check: func(cfg *Config) string {
+				if cfg.Mssql.Host != "other" || time.Duration(cfg.Shutdown.Timeout) != time.Minute ||
+					len(cfg.AccessLog.OmitFields) != 2 {
+					return "expected settings from the environment"
+				}
+				return ""
+			},
+		},
+		{
+			name: "Secret File",
+			hint: "The _FILE variable should be read as the path of the value, without a trailing newline",
+			path: configPath,
+			env:  map[string]string{"MSSQL_PASSWORD_FILE": secretPath},
+			check: func(cfg *Config) string {
+				if cfg.Mssql.Password.Value() != "secret-password" {
+					return "expected password from the secret file, got " + cfg.Mssql.Password.Value()
+				}
+				return ""
+			},
+		},
+		{
+			name:   "Missing Secret File",
+			hint:   "A _FILE variable naming a file which does not exist should be reported",
+			path:   configPath,
+			env:    map[string]string{"MSSQL_PASSWORD_FILE": filepath.Join(dir, "missing")},
+			errors: []string{"MSSQL_PASSWORD_FILE"},
+		},
+		{
+			name: "Every Error Reported",
+			hint: "All problems should be reported together, not only the first",
+			env: map[string]string{"GATEWAY_SHUTDOWN_DELAY": "soon", "GATEWAY_TLS_MIN_VERSION": "2.0",
+				"GATEWAY_TRACING_SAMPLE_RATIO": "2"},
+			errors: []string{"GATEWAY_SHUTDOWN_DELAY", "GATEWAY_TLS_MIN_VERSION", "GATEWAY_TRACING_SAMPLE_RATIO",
+				"GATEWAY_TLSCERTPATH", "MSSQL_PASSWORD", "REDIS_ADDRESS", "AQREST_HOSTNAME"},
+		},
+		{
+			name: "Store Timeouts",
+			hint: "The timeouts of store operations should be read from a list of name=duration",
+			path: configPath,
+			env:  map[string]string{"GATEWAY_USER_STORE_TIMEOUTS": "ReadUserInfo=2s, CreateUser=10s"},
+			check: func(cfg *Config) string {
+				timeouts := cfg.Stores.User()
+				if timeouts.For("ReadUserInfo") != time.Second*2 || timeouts.For("CreateUser") != time.Second*10 ||
+					timeouts.For("DeleteUser") != time.Duration(cfg.Stores.Timeout) {
+					return "expected timeouts of the user store from the environment"
+				}
+				return ""
+			},
+		},
+		{
+			name: "Invalid Store Timeouts",
+			hint: "A timeout which can not be parsed, or of an operation a store does not have, should be reported",
+			path: configPath,
+			env: map[string]string{"GATEWAY_USER_STORE_TIMEOUTS": "ReadUserInfo",
+				"GATEWAY_SESSION_STORE_TIMEOUTS": "Fetch=1s"},
+			errors: []string{"GATEWAY_USER_STORE_TIMEOUTS", "GATEWAY_SESSION_STORE_TIMEOUTS", "Fetch"},
+		},
+		{
+			name: "Migration Login",
+			hint: "Migrations should be applied with the migration login if set, or the gateway login if not",
+			path: configPath,
+			env:  map[string]string{"MSSQL_MIGRATION_USERNAME": "sa", "MSSQL_MIGRATION_PASSWORD": "sa-password"},
+			check: func(cfg *Config) string {
+				username, password := cfg.Mssql.MigrationLogin()
+				if username != "sa" || password != "sa-password" || cfg.Mssql.Migrate != "check" {
+					return "expected the migration login from the environment, and to check migrations"
+				}
+				return ""
+			},
+		},
+		{
+			name:   "Invalid Migration Settings",
+			hint:   "An unknown migrate mode, or a migration username without a password, should be reported",
+			path:   configPath,
+			env:    map[string]string{"MSSQL_MIGRATE": "upgrade", "MSSQL_MIGRATION_USERNAME": "sa"},
+			errors: []string{"MSSQL_MIGRATE", "MSSQL_MIGRATION_PASSWORD"},
+		},
+		{
+			name: "Postgres",
+			hint: "Choosing postgres should only require the postgres settings, with defaults for the port and sslmode",
+			path: configPath,
+			env: map[string]string{"GATEWAY_DATABASE": "postgres", "POSTGRES_HOST": "postgres",
+				"POSTGRES_USERNAME": "gateway", "POSTGRES_PASSWORD": "pg-password", "POSTGRES_DATABASE": "perceptia"},
+			check: func(cfg *Config) string {
+				if cfg.Database != DatabasePostgres || cfg.Postgres.Port != "5432" || cfg.Postgres.SslMode != "require" {
+					return "expected postgres with the default port and sslmode"
+				}
+				return ""
+			},
+		},
+		{
+			name:   "Unknown Database",
+			hint:   "A database the gateway can not store users in should be reported",
+			path:   configPath,
+			env:    map[string]string{"GATEWAY_DATABASE": "mysql"},
+			errors: []string{"GATEWAY_DATABASE"},
+		},
+		{
+			name: "Dev Mode",
+			hint: "Dev mode should not require a database or redis, as users and sessions are kept in memory",
+			path: writeFile(t, dir, "dev.yaml", "tls:\n  certPath: /certs/gateway.crt\n  keyPath: "+
+				"/certs/gateway.key\nsession:\n  key: dev-key\nservices:\n  configPath: /config/services.yaml\n"),
+			env: map[string]string{"GATEWAY_DEV_MODE": "true"},
+			check: func(cfg *Config) string {
+				if !cfg.DevMode {
+					return "expected dev mode from the environment"
+				}
+				return ""
+			},
+		},
+		{
+			name:   "Invalid Dev Mode",
+			hint:   "A value which is not a boolean should be reported",
+			path:   configPath,
+			env:    map[string]string{"GATEWAY_DEV_MODE": "yes please"},
+			errors: []string{"GATEWAY_DEV_MODE"},
+		},
+		{
+			name:   "Invalid Export Settings",
+			hint:   "Exports must be kept, and download links last, for some time, so zero should be reported",
+			path:   configPath,
+			env:    map[string]string{"GATEWAY_EXPORT_TTL": "0s", "GATEWAY_EXPORT_LINK_TTL": "-1m"},
+			errors: []string{"GATEWAY_EXPORT_TTL", "GATEWAY_EXPORT_LINK_TTL"},
+		},
+		{
+			name:   "Invalid Deletion Settings",
+			hint:   "Deleted accounts must be restorable, and purged, after some time, so zero should be reported",
+			path:   configPath,
+			env:    map[string]string{"GATEWAY_DELETION_GRACE_PERIOD": "0s", "GATEWAY_DELETION_PURGE_INTERVAL": "-1h"},
+			errors: []string{"GATEWAY_DELETION_GRACE_PERIOD", "GATEWAY_DELETION_PURGE_INTERVAL"},
+		},
+		{
+			name: "Api Version Not Retired",
+			hint: "Version 1.0.0 should only be deprecated or sunset when configured to be, never on a default date",
+			path: configPath,
+			check: func(cfg *Config) string {
+				if !cfg.Api.InitialDeprecated.Time().IsZero() || !cfg.Api.InitialSunset.Time().IsZero() {
+					return "expected no deprecation or sunset, but got " + cfg.Api.InitialDeprecated.String() +
+						" and " + cfg.Api.InitialSunset.String()
+				}
+				return ""
+			},
+		},
+		{
+			name: "Api Version Dates",
+			hint: "The deprecation and sunset of version 1.0.0 should be read as a date or a time, from the file or " +
+				"the environment, and an empty value should mean none is planned",
+			path: writeFile(t, dir, "dates.yaml", validFile+"api:\n  initialDeprecated: 2027-03-01\n"),
+			env:  map[string]string{"GATEWAY_API_INITIAL_SUNSET": ""},
+			check: func(cfg *Config) string {
+				if !cfg.Api.InitialDeprecated.Time().Equal(time.Date(2027, time.March, 1, 0, 0, 0, 0, time.UTC)) ||
+					!cfg.Api.InitialSunset.Time().IsZero() {
+					return "expected the deprecation from the file and no sunset, but got " +
+						cfg.Api.InitialDeprecated.String() + " and " + cfg.Api.InitialSunset.String()
+				}
+				return ""
+			},
+		},
+		{
+			name: "Invalid Api Version Dates",
+			hint: "A sunset before the deprecation should be reported",
+			path: configPath,
+			env: map[string]string{"GATEWAY_API_INITIAL_DEPRECATED": "2027-01-19T00:00:00Z",
+				"GATEWAY_API_INITIAL_SUNSET": "2026-12-01"},
+			errors: []string{"(GATEWAY_API_INITIAL_SUNSET) must be after"},
+		},
+		{
+			name:   "Unparsable Api Version Date",
+			hint:   "A time which can not be parsed should be reported",
+			path:   configPath,
+			env:    map[string]string{"GATEWAY_API_INITIAL_DEPRECATED": "next spring"},
+			errors: []string{"GATEWAY_API_INITIAL_DEPRECATED: must be a date"},
+		},
+		{
+			name:   "Unknown Key",
+			hint:   "A misspelled key in the file should not be silently ignored",
+			path:   writeFile(t, dir, "unknown.yaml", "sever:\n  listenAddr: :8443\n"),
+			errors: []string{"sever"},
+		},
+	}
+
+	for _, c := range cases {
+		cfg, errL := Load(c.path, envFrom(c.env))
+		if len(c.errors) == 0 {
+			if errL != nil {
+				t.Errorf("case: %s: unexpected error: %s\nHINT: %s", c.name, errL, c.hint)
+				continue
+			}
+			if problem := c.check(cfg); len(problem) != 0 {
+				t.Errorf("case: %s: %s\nHINT: %s", c.name, problem, c.hint)
+			}
+			continue
+		}
+		if errL == nil {
+			t.Errorf("case: %s: expected an error\nHINT: %s", c.name, c.hint)
+			continue
+		}
+		for _, want := range c.errors {
+			if !strings.Contains(errL.Error(), want) {
+				t.Errorf("case: %s: expected error to mention %s, got: %s\nHINT: %s", c.name, want, errL, c.hint)
+			}
+		}
+	}
+}
+
+func TestDumpRedactsSecrets(t *testing.T) {
+	cfg := Default()
+	cfg.Session.Key = "session-key-value"
+	cfg.Mssql.Password = "password-value"
+	dump, errD := cfg.Dump()
+	if errD != nil {
+		t.Fatalf("case: Redacted: unexpected error: %s", errD)
+	}
+	for _, secret := range []string{"session-key-value", "password-value"} {
+		if strings.Contains(string(dump), secret) {
+			t.Errorf("case: Redacted: dump contains secret %s\nHINT: secrets must never be printed", secret)
+		}
+	}
+	if !strings.Contains(string(dump), redacted) {
+		t.Errorf("case: Redacted: expected secrets to be replaced with %s\nHINT: show that a secret is set", redacted)
+	}
+}
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"errors"
+	"time"
+)
+
+// redacted replaces the value of a secret wherever it is printed.
+const redacted = "REDACTED"
+
+// Secret is a setting which must never be logged, such as a password.
+// It is redacted whenever it is formatted or marshalled, so use Value to read it.
+type Secret string
+
+// Value returns the secret itself.
+func (s Secret) Value() string {
+	return string(s)
+}
+
+// String returns REDACTED if the secret is set, so it is not revealed by fmt or a logger.
+func (s Secret) String() string {
+	if len(s) == 0 {
+		return ""
+	}
+	return redacted
+}
+
+// MarshalText redacts the secret when the configuration is encoded, such as by Dump.
+func (s Secret) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText reads the secret.
+func (s *Secret) UnmarshalText(text []byte) error {
+	*s = Secret(text)
+	return nil
+}
+
+// Duration is a time.Duration which is read and written as a string, such as "30s".
+type Duration time.Duration
+
+// String returns the duration as a string, such as "1m30s".
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// MarshalText encodes the duration as a string, such as "1m30s".
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalText parses a duration string, such as "1m30s".
+func (d *Duration) UnmarshalText(text []byte) error {
+	duration, errPD := time.ParseDuration(string(text))
+	if errPD != nil {
+		return errPD
+	}
+	*d = Duration(duration)
+	return nil
+}
+
+// Time is a time.Time which is read and written as a date, such as "2027-01-19", which is midnight UTC,
+// or a time in RFC 3339 format. An empty string is the zero time.
+type Time time.Time
+
+// Time returns the time itself.
+func (t Time) Time() time.Time {
+	return time.Time(t)
+}
+
+// String returns the time in RFC 3339 format, or an empty string if it is zero.
+func (t Time) String() string {
+	if t.Time().IsZero() {
+		return ""
+	}
+	return t.Time().Format(time.RFC3339)
+}
+
+// MarshalText encodes the time in RFC 3339 format, or as an empty string if it is zero.
+func (t Time) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// UnmarshalText parses a date, such as "2027-01-19", or a time, such as "2027-01-19T00:00:00Z".
+func (t *Time) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*t = Time{}
+		return nil
+	}
+	at, errP := time.Parse("2006-01-02", string(text))
+	if errP != nil {
+		if at, errP = time.Parse(time.RFC3339, string(text)); errP != nil {
+			return errors.New("must be a date or time, such as 2027-01-19 or 2027-01-19T00:00:00Z")
+		}
+	}
+	*t = Time(at)
+	return nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+
+	kitlog "github.com/go-kit/kit/log"
+
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/audit"
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/config"
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/health"
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/migration"
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/user"
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/utility"
+)
+
+// errDevMode is returned by commands which use the database, as in dev mode users are kept in the memory of
+// the gateway instead.
+var errDevMode = errors.New("users are kept in the memory of the gateway in dev mode, so there is no database " +
+	"for commands to use")
+
+// postgresDriverName is the name of the PostgreSQL driver registered with the go sql lib.
+const postgresDriverName = "postgres"
+
+// database is the database users and audit events are stored in, as chosen by the configuration.
+type database struct {
+	// name identifies the database, such as mssql, in health checks and errors.
+	name   string
+	driver string
+	// migrate is what the gateway does with pending migrations when it starts.
+	migrate string
+	dialect *migration.Dialect
+	// username and password login for requests, and the migration login applies migrations.
+	username, password                   string
+	migrationUsername, migrationPassword string
+	// dsn returns the data source name of the database for a login.
+	dsn func(username, password string) *url.URL
+}
+
+// databaseOf returns the database chosen by the configuration.
+func databaseOf(cfg *config.Config) *database {
+	if cfg.Database == config.DatabasePostgres {
+		pg := cfg.Postgres
+		migrationUsername, migrationPassword := pg.MigrationLogin()
+		return &database{
+			name:              config.DatabasePostgres,
+			driver:            postgresDriverName,
+			migrate:           pg.Migrate,
+			dialect:           migration.Postgres,
+			username:          pg.Username,
+			password:          pg.Password.Value(),
+			migrationUsername: migrationUsername,
+			migrationPassword: migrationPassword,
+			dsn: func(username, password string) *url.URL {
+				return &url.URL{
+					Scheme:   "postgres",
+					User:     url.UserPassword(username, password),
+					Host:     net.JoinHostPort(pg.Host, pg.Port),
+					Path:     "/" + pg.Database,
+					RawQuery: url.Values{"sslmode": {pg.SslMode}}.Encode(),
+				}
+			},
+		}
+	}
+	ms := cfg.Mssql
+	migrationUsername, migrationPassword := ms.MigrationLogin()
+	return &database{
+		name:              config.DatabaseMsSql,
+		driver:            sqlDriverName,
+		migrate:           ms.Migrate,
+		dialect:           migration.MsSql,
+		username:          ms.Username,
+		password:          ms.Password.Value(),
+		migrationUsername: migrationUsername,
+		migrationPassword: migrationPassword,
+		dsn: func(username, password string) *url.URL {
+			return utility.BuildDsn(ms.Scheme, username, password, ms.Host, ms.Port, ms.Database)
+		},
+	}
+}
+
+// connect connects to the database with the given login, returning an error if it can not be reached.
+func (d *database) connect(username, password string) (*sql.DB, error) {
+	db, errO := sql.Open(d.driver, d.dsn(username, password).String())
+	if errO != nil {
+		return nil, fmt.Errorf("unable to connect to %s: %s", d.name, errO)
+	}
+	if errP := db.Ping(); errP != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("unable to connect to %s: %s", d.name, errP)
+	}
+	return db, nil
+}
+
+// userStore returns the user store of the database.
+func (d *database) userStore(db *sql.DB) (user.Store, error) {
+	if d.name == config.DatabasePostgres {
+		return user.NewPgStore(db)
+	}
+	return user.NewMsSqlStore(db)
+}
+
+// auditStore returns the audit store of the database.
+func (d *database) auditStore(db *sql.DB) (audit.Store, error) {
+	if d.name == config.DatabasePostgres {
+		return audit.NewPgStore(db)
+	}
+	return audit.NewMsSqlStore(db)
+}
+
+// healthCheck returns the check of the database, which must pass for the gateway to be ready.
+func (d *database) healthCheck(db *sql.DB) health.CheckFunc {
+	if d.name == config.DatabasePostgres {
+		return health.PostgresCheck(db)
+	}
+	return health.MsSqlCheck(db, mssqlRequiredVersion)
+}
+
+// connectMigration connects to the database with the migration login.
+func (d *database) connectMigration() (*sql.DB, error) {
+	return d.connect(d.migrationUsername, d.migrationPassword)
+}
+
+// openPerceptiaDatabase opens the database of the configuration, once its migrations have been applied or
+// checked as the migrate mode of the configuration sets. Exits if the database can not be used.
+func openPerceptiaDatabase(ctx context.Context, logger kitlog.Logger, cfg *config.Config) (*database, *sql.DB) {
+	d := databaseOf(cfg)
+	dsn := d.dsn(d.username, d.password)
+	db, errO := sql.Open(d.driver, dsn.String())
+	if errO != nil {
+		// The password is never logged, whatever the environment
+		_ = logger.Log("msg", "unable to connect to db", "dsn", dsn.Redacted(), "error", errO, "result", "exit")
+		os.Exit(1)
+	}
+
+	// Apply or check the migrations of the database, so requests are never served from a schema the
+	// gateway does not expect
+	if errMD := migrateDatabase(ctx, logger, cfg); errMD != nil {
+		_ = logger.Log("msg", "unable to migrate database", "mode", d.migrate, "error", errMD, "result", "exit")
+		os.Exit(1)
+	}
+	return d, db
+}
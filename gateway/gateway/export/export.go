@@ -0,0 +1,268 @@
+// Package export generates archives of the personal data held about a user, such as their account, profile,
+// sessions, and audit events, which the user downloads through a short-lived signed link.
+//
+// Archives are generated in the background by an Exporter, and kept in a Store shared by every gateway until
+// they expire, so the user may check on and download an archive from any gateway.
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	kitlog "github.com/go-kit/kit/log"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/audit"
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/user"
+)
+
+// Status is how far a Job has got generating its archive.
+type Status string
+
+// Statuses of a Job.
+const (
+	// StatusPending is the status of a job whose archive is being generated.
+	StatusPending Status = "pending"
+	// StatusReady is the status of a job whose archive can be downloaded.
+	StatusReady Status = "ready"
+	// StatusFailed is the status of a job whose archive could not be generated.
+	StatusFailed Status = "failed"
+)
+
+// Formats an archive may be downloaded in.
+const (
+	FormatJSON = "json"
+	FormatZip  = "zip"
+)
+
+var ErrJobNotFound = errors.New("export: no export requested for the user")
+var ErrArchiveNotFound = errors.New("export: archive not found, it may have expired")
+var ErrUnknownFormat = errors.New("export: format must be json or zip")
+var ErrEventsNotPaged = errors.New("export: more audit events occurred at the same time than fit in one page")
+
+// eventTimeOverlap is added to the time each page of audit events is read before, so the page includes every
+// event which occurred at the same time as the last event of the previous page. It is the coarsest precision
+// events are stored with, so is never lost to rounding by the store.
+const eventTimeOverlap = time.Microsecond
+
+// Job is a request to export the personal data of a user.
+type Job struct {
+	Uuid      uuid.UUID `json:"uuid"`
+	UserUuid  uuid.UUID `json:"userUuid"`
+	Status    Status    `json:"status"`
+	Requested time.Time `json:"requested"`
+	// Completed is when the archive was generated, or failed to be, or the zero time if the job is pending.
+	Completed time.Time `json:"completed"`
+}
+
+// Archive is everything exported about a user.
+type Archive struct {
+	Generated time.Time `json:"generated"`
+	user.PersonalData
+	// AuditEvents are the security relevant events about the user, newest first.
+	AuditEvents []*audit.Event `json:"auditEvents"`
+}
+
+// Store represents a store of export jobs and their archives, which expire after the time set by the Store.
+type Store interface {
+	// SaveJob saves the job as the current job of its user, replacing any other.
+	SaveJob(ctx context.Context, job *Job) error
+
+	// ClaimJob saves the job as the current job of its user only if the current job is still the one with the
+	// uuid replaced, or uuid.Nil if the user had none, so only one job is started when several requests race.
+	// Returns false if another job was saved first.
+	ClaimJob(ctx context.Context, job *Job, replaced uuid.UUID) (bool, error)
+
+	// UserJob gets the current job of the user, or returns ErrJobNotFound if there is none.
+	UserJob(ctx context.Context, userUuid uuid.UUID) (*Job, error)
+
+	// SaveArchive saves the archive of the job, encoded as json.
+	SaveArchive(ctx context.Context, jobUuid uuid.UUID, archive []byte) error
+
+	// Archive gets the archive of the job, encoded as json, or returns ErrArchiveNotFound if there is none.
+	Archive(ctx context.Context, jobUuid uuid.UUID) ([]byte, error)
+}
+
+// Exporter generates archives of the personal data of users, read from a user.Store and an audit.Log,
+// and saves them to a Store.
+type Exporter struct {
+	store     Store
+	userStore user.Store
+	auditLog  *audit.Log
+	logger    kitlog.Logger
+	// timeout is the time allowed to generate an archive. A job pending for longer was abandoned,
+	// such as by a gateway which shut down, so is started again when next requested.
+	timeout time.Duration
+	// wait is the time Request waits for a new archive to be generated before returning its job as pending,
+	// so small archives are ready as soon as they are requested.
+	wait time.Duration
+}
+
+// NewExporter constructs a new Exporter, allowing timeout to generate each archive, and waiting up to wait
+// for a new archive to be generated before its job is returned as pending.
+// If auditLog is nil, archives have no audit events.
+func NewExporter(store Store, userStore user.Store, auditLog *audit.Log, logger kitlog.Logger,
+	timeout time.Duration, wait time.Duration) *Exporter {
+	if store == nil || userStore == nil {
+		panic("no store or user store provided")
+	}
+	return &Exporter{store: store, userStore: userStore, auditLog: auditLog, logger: logger, timeout: timeout,
+		wait: wait}
+}
+
+// Request returns the current job of the user, or starts a new one if they have none, or their last job failed
+// or was abandoned. Returns true if a new job was started.
+//
+// A new job is generated in the background, and returned once it completes, or as pending once wait has passed.
+func (ex *Exporter) Request(ctx context.Context, userUuid uuid.UUID) (*Job, bool, error) {
+	current, errUJ := ex.store.UserJob(ctx, userUuid)
+	if errUJ != nil && errUJ != ErrJobNotFound {
+		return nil, false, errUJ
+	}
+	replaced := uuid.Nil
+	if errUJ == nil {
+		if !ex.restart(current) {
+			return current, false, nil
+		}
+		replaced = current.Uuid
+	}
+	job := &Job{Uuid: uuid.NewV4(), UserUuid: userUuid, Status: StatusPending, Requested: time.Now().UTC()}
+	claimed, errCJ := ex.store.ClaimJob(ctx, job, replaced)
+	if errCJ != nil {
+		return nil, false, errCJ
+	}
+	if !claimed {
+		// Another request started a job first, so it is returned rather than starting a second
+		current, errUJ = ex.store.UserJob(ctx, userUuid)
+		if errUJ != nil {
+			return nil, false, errUJ
+		}
+		return current, false, nil
+	}
+	completed := make(chan *Job, 1)
+	go func(job Job) {
+		completed <- ex.generate(&job)
+	}(*job)
+	timer := time.NewTimer(ex.wait)
+	defer timer.Stop()
+	select {
+	case completedJob := <-completed:
+		return completedJob, true, nil
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	return job, true, nil
+}
+
+// restart returns true if the job failed or was abandoned, so a new one should be started.
+func (ex *Exporter) restart(job *Job) bool {
+	return job.Status == StatusFailed ||
+		(job.Status == StatusPending && time.Since(job.Requested) > ex.timeout)
+}
+
+// generate generates and saves the archive of the job, and saves the job as ready, or as failed if the archive
+// could not be generated. Returns the job as saved.
+func (ex *Exporter) generate(job *Job) *Job {
+	ctx, cancel := context.WithTimeout(context.Background(), ex.timeout)
+	defer cancel()
+	errG := ex.generateArchive(ctx, job)
+	job.Completed = time.Now().UTC()
+	job.Status = StatusReady
+	if errG != nil {
+		_ = ex.logger.Log("msg", "unable to generate export", "jobUuid", job.Uuid, "userUuid", job.UserUuid,
+			"error", errG)
+		job.Status = StatusFailed
+	}
+	if errSJ := ex.store.SaveJob(ctx, job); errSJ != nil {
+		_ = ex.logger.Log("msg", "unable to save export job", "jobUuid", job.Uuid, "userUuid", job.UserUuid,
+			"status", job.Status, "error", errSJ)
+	}
+	return job
+}
+
+// generateArchive reads the personal data and audit events of the user of the job, and saves them as the archive
+// of the job.
+func (ex *Exporter) generateArchive(ctx context.Context, job *Job) error {
+	data, errRUPD := ex.userStore.ReadUserPersonalData(ctx, job.UserUuid)
+	if errRUPD != nil {
+		return fmt.Errorf("reading personal data: %w", errRUPD)
+	}
+	events, errUE := ex.userEvents(ctx, job.UserUuid)
+	if errUE != nil {
+		return fmt.Errorf("reading audit events: %w", errUE)
+	}
+	encoded, errM := json.MarshalIndent(&Archive{Generated: time.Now().UTC(), PersonalData: *data,
+		AuditEvents: events}, "", "  ")
+	if errM != nil {
+		return fmt.Errorf("encoding archive: %w", errM)
+	}
+	if errSA := ex.store.SaveArchive(ctx, job.Uuid, encoded); errSA != nil {
+		return fmt.Errorf("saving archive: %w", errSA)
+	}
+	return nil
+}
+
+// userEvents returns every audit event about the user, newest first, read a page at a time.
+// Events which occurred at the same time may be split across pages, so each page is read from the time of the
+// last event of the previous page, inclusive, skipping the events already read.
+// If audit events are not stored, the user has none.
+//
+// Returns ErrEventsNotPaged if a page holds only events already read, so no more could be read.
+func (ex *Exporter) userEvents(ctx context.Context, userUuid uuid.UUID) ([]*audit.Event, error) {
+	events := make([]*audit.Event, 0)
+	read := make(map[uuid.UUID]bool)
+	before := time.Time{}
+	for {
+		page, errUE := ex.auditLog.UserEvents(ctx, userUuid, before, audit.MaxLimit)
+		if errUE == audit.ErrNotStored {
+			return events, nil
+		}
+		if errUE != nil {
+			return nil, errUE
+		}
+		unread := 0
+		for _, event := range page {
+			if !read[event.Uuid] {
+				read[event.Uuid] = true
+				events = append(events, event)
+				unread++
+			}
+		}
+		if len(page) < audit.MaxLimit {
+			return events, nil
+		}
+		if unread == 0 {
+			return nil, ErrEventsNotPaged
+		}
+		before = page[len(page)-1].Occurred.Add(eventTimeOverlap)
+	}
+}
+
+// Encode returns the archive, encoded as json, in the given format, either FormatJSON or FormatZip.
+// A zip archive holds the json in a single file named name.
+func Encode(archive []byte, format string, name string) ([]byte, error) {
+	switch format {
+	case FormatJSON:
+		return archive, nil
+	case FormatZip:
+		buf := &bytes.Buffer{}
+		zw := zip.NewWriter(buf)
+		fw, errC := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now().UTC()})
+		if errC != nil {
+			return nil, errC
+		}
+		if _, errW := fw.Write(archive); errW != nil {
+			return nil, errW
+		}
+		if errCl := zw.Close(); errCl != nil {
+			return nil, errCl
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, ErrUnknownFormat
+}
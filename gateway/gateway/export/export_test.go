@@ -0,0 +1,393 @@
+// +build all unit
+
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	kitlog "github.com/go-kit/kit/log"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/audit"
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/user"
+)
+
+func TestSigner_Verify(t *testing.T) {
+	signer := NewSigner("test key")
+	jobUuid := uuid.NewV4()
+	expires := time.Now().Add(time.Minute)
+	expired := time.Now().Add(-time.Minute)
+	unix := func(at time.Time) string { return strconv.FormatInt(at.Unix(), 10) }
+
+	cases := []struct {
+		name      string
+		hint      string
+		jobUuid   uuid.UUID
+		expires   string
+		signature string
+		expected  error
+	}{
+		{
+			name:      "Valid",
+			hint:      "A link signed for the job which has not expired should be valid",
+			jobUuid:   jobUuid,
+			expires:   unix(expires),
+			signature: signer.Sign(jobUuid, expires),
+		},
+		{
+			name:      "Expired",
+			hint:      "A link signed for the job which has expired should not be valid",
+			jobUuid:   jobUuid,
+			expires:   unix(expired),
+			signature: signer.Sign(jobUuid, expired),
+			expected:  ErrLinkExpired,
+		},
+		{
+			name:      "Extended Expiry",
+			hint:      "The expiry of a link is signed, so it can not be changed",
+			jobUuid:   jobUuid,
+			expires:   unix(expires.Add(time.Hour)),
+			signature: signer.Sign(jobUuid, expires),
+			expected:  ErrInvalidSignature,
+		},
+		{
+			name:      "Other Job",
+			hint:      "The signature of a link to one job should not be valid for another",
+			jobUuid:   uuid.NewV4(),
+			expires:   unix(expires),
+			signature: signer.Sign(jobUuid, expires),
+			expected:  ErrInvalidSignature,
+		},
+		{
+			name:      "Other Key",
+			hint:      "A link signed with another key should not be valid",
+			jobUuid:   jobUuid,
+			expires:   unix(expires),
+			signature: NewSigner("other key").Sign(jobUuid, expires),
+			expected:  ErrInvalidSignature,
+		},
+		{
+			name:      "Malformed",
+			hint:      "An expiry which is not a number, or a signature which can not be decoded, should not be valid",
+			jobUuid:   jobUuid,
+			expires:   "tomorrow",
+			signature: "not base64!",
+			expected:  ErrInvalidSignature,
+		},
+	}
+	for _, c := range cases {
+		if errV := signer.Verify(c.jobUuid, c.expires, c.signature); errV != c.expected {
+			t.Errorf("case %s: expected %v but got %v\nHINT: %s", c.name, c.expected, errV, c.hint)
+		}
+	}
+}
+
+func TestExporter_Request(t *testing.T) {
+	ctx := context.Background()
+	userStore := user.NewMemStore()
+	encodedHash, errCEH := user.CreateEncodedHash("TestIngPasswordHash")
+	if errCEH != nil {
+		t.Fatalf("unexpected error setting up test: %s", errCEH)
+	}
+	usr, errCU := userStore.CreateUser(ctx, &user.NewUser{Username: "exporter", FullName: "Ex Porter",
+		DisplayName: "Ex", EncodedHash: encodedHash})
+	if errCU != nil {
+		t.Fatalf("unexpected error setting up test: %s", errCU)
+	}
+	auditLog := audit.NewLog(audit.NewMemStore(), kitlog.NewNopLogger())
+	// More events than fit in one page, so every page should be read
+	for i := 0; i < audit.MaxLimit+1; i++ {
+		auditLog.Record(&audit.Event{Type: audit.EventSignIn, UserUuid: usr.Uuid})
+	}
+	store := NewMemStore(time.Hour)
+	exporter := NewExporter(store, userStore, auditLog, kitlog.NewNopLogger(), time.Minute, time.Second*5)
+
+	job, started, errR := exporter.Request(ctx, usr.Uuid)
+	if errR != nil || !started || job.Status != StatusReady {
+		t.Fatalf("case: first request: expected a new job to be started and ready, but got %+v, started %t, "+
+			"error: %v\nHINT: a small archive should be generated before the wait passes", job, started, errR)
+	}
+	encoded, errA := store.Archive(ctx, job.Uuid)
+	if errA != nil {
+		t.Fatalf("case: archive: unexpected error getting the archive of a ready job: %s", errA)
+	}
+	archive := &Archive{}
+	if errU := json.Unmarshal(encoded, archive); errU != nil {
+		t.Fatalf("case: archive: unable to decode archive: %s", errU)
+	}
+	if archive.Account.FullName != "Ex Porter" || len(archive.AuditEvents) != audit.MaxLimit+1 {
+		t.Errorf("case: archive: expected the account and %d audit events, but got %+v and %d events\n"+
+			"HINT: the archive should hold the personal data and every audit event of the user",
+			audit.MaxLimit+1, archive.Account, len(archive.AuditEvents))
+	}
+
+	again, startedAgain, errRA := exporter.Request(ctx, usr.Uuid)
+	if errRA != nil || startedAgain || !uuid.Equal(again.Uuid, job.Uuid) {
+		t.Errorf("case: second request: expected the ready job %s, but got %+v, started %t, error: %v\n"+
+			"HINT: a ready archive should be returned rather than generated again", job.Uuid, again, startedAgain,
+			errRA)
+	}
+
+	failed := *job
+	failed.Status = StatusFailed
+	_ = store.SaveJob(ctx, &failed)
+	retried, startedRetry, errRR := exporter.Request(ctx, usr.Uuid)
+	if errRR != nil || !startedRetry || uuid.Equal(retried.Uuid, job.Uuid) {
+		t.Errorf("case: failed: expected a new job, but got %+v, started %t, error: %v\n"+
+			"HINT: a failed job should be started again", retried, startedRetry, errRR)
+	}
+
+	unknown, _, errRU := exporter.Request(ctx, uuid.NewV4())
+	if errRU != nil || unknown.Status != StatusFailed {
+		t.Errorf("case: unknown user: expected a failed job, but got %+v, error: %v\n"+
+			"HINT: the export of a user who does not exist can not be generated", unknown, errRU)
+	}
+}
+
+// racingStore is a MemStore whose first reads of the current job of a user each wait until all of them are made,
+// so the requests making them race to start a job.
+type racingStore struct {
+	*MemStore
+	racing int
+	mx     sync.Mutex
+	reads  int
+	read   sync.WaitGroup
+}
+
+// newRacingStore constructs a racingStore whose first racing reads wait for each other.
+func newRacingStore(racing int) *racingStore {
+	rs := &racingStore{MemStore: NewMemStore(time.Hour), racing: racing}
+	rs.read.Add(racing)
+	return rs
+}
+
+// UserJob gets the current job of the user, waiting until every racing read is made if this is one of them.
+func (rs *racingStore) UserJob(ctx context.Context, userUuid uuid.UUID) (*Job, error) {
+	job, errUJ := rs.MemStore.UserJob(ctx, userUuid)
+	rs.mx.Lock()
+	rs.reads++
+	racing := rs.reads <= rs.racing
+	rs.mx.Unlock()
+	if racing {
+		rs.read.Done()
+		rs.read.Wait()
+	}
+	return job, errUJ
+}
+
+func TestExporter_Request_Concurrent(t *testing.T) {
+	ctx := context.Background()
+	userStore := user.NewMemStore()
+	encodedHash, errCEH := user.CreateEncodedHash("TestIngPasswordHash")
+	if errCEH != nil {
+		t.Fatalf("unexpected error setting up test: %s", errCEH)
+	}
+	usr, errCU := userStore.CreateUser(ctx, &user.NewUser{Username: "exporter", FullName: "Ex Porter",
+		DisplayName: "Ex", EncodedHash: encodedHash})
+	if errCU != nil {
+		t.Fatalf("unexpected error setting up test: %s", errCU)
+	}
+
+	cases := []struct {
+		name string
+		hint string
+		// failed is true if the user has a failed job before the requests
+		failed bool
+	}{
+		{
+			name: "No Job",
+			hint: "Requests racing to start the first job of a user should start it once",
+		},
+		{
+			name:   "Failed Job",
+			hint:   "Requests racing to restart a failed job should restart it once",
+			failed: true,
+		},
+	}
+	const requests = 20
+	for _, c := range cases {
+		store := newRacingStore(requests)
+		exporter := NewExporter(store, userStore, nil, kitlog.NewNopLogger(), time.Minute, 0)
+		if c.failed {
+			failed := &Job{Uuid: uuid.NewV4(), UserUuid: usr.Uuid, Status: StatusFailed, Requested: time.Now().UTC()}
+			if errSJ := store.SaveJob(ctx, failed); errSJ != nil {
+				t.Fatalf("unexpected error setting up test: %s", errSJ)
+			}
+		}
+		var wg sync.WaitGroup
+		var mx sync.Mutex
+		started := 0
+		jobs := make(map[uuid.UUID]bool)
+		for i := 0; i < requests; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				job, isStarted, errR := exporter.Request(ctx, usr.Uuid)
+				mx.Lock()
+				defer mx.Unlock()
+				if errR != nil {
+					t.Errorf("case: %s: unexpected error: %s", c.name, errR)
+					return
+				}
+				if isStarted {
+					started++
+				}
+				jobs[job.Uuid] = true
+			}()
+		}
+		wg.Wait()
+		if started != 1 || len(jobs) != 1 {
+			t.Errorf("case: %s: expected one job to be started and returned to every request, but got %d started "+
+				"and %d jobs returned\nHINT: %s", c.name, started, len(jobs), c.hint)
+		}
+	}
+}
+
+// contextStore is an audit.Store whose reads fail once their context is done.
+type contextStore struct {
+	*audit.MemStore
+}
+
+func (cs contextStore) ReadUserEvents(ctx context.Context, userUuid uuid.UUID, before time.Time,
+	limit int) ([]*audit.Event, error) {
+	if errC := ctx.Err(); errC != nil {
+		return nil, errC
+	}
+	return cs.MemStore.ReadUserEvents(ctx, userUuid, before, limit)
+}
+
+func TestExporter_UserEvents_Context(t *testing.T) {
+	auditLog := audit.NewLog(contextStore{audit.NewMemStore()}, kitlog.NewNopLogger())
+	exporter := NewExporter(NewMemStore(time.Hour), user.NewMemStore(), auditLog, kitlog.NewNopLogger(),
+		time.Minute, time.Second)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, errUE := exporter.userEvents(ctx, uuid.NewV4()); errUE != context.Canceled {
+		t.Errorf("case: Canceled: expected error %s but got %v\n"+
+			"HINT: the audit events should be read with the context of the job, so they stop when it times out",
+			context.Canceled, errUE)
+	}
+}
+
+func TestExporter_UserEvents(t *testing.T) {
+	userUuid := uuid.NewV4()
+	occurred := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	cases := []struct {
+		name string
+		hint string
+		// groups are the number of events which share each time, oldest first
+		groups    []int
+		expectErr error
+	}{
+		{
+			name:   "Split At Page Boundary",
+			hint:   "Events sharing a time at the end of a page should all be read, once, by the next page",
+			groups: repeatedGroups(150, 3),
+		},
+		{
+			name:   "Group Spans Page",
+			hint:   "A group of events larger than the rest of a page should be read across pages",
+			groups: append(append(repeatedGroups(60, 3), audit.MaxLimit-10), repeatedGroups(60, 2)...),
+		},
+		{
+			name:   "Exactly One Page",
+			hint:   "A full page should be followed by an empty one, not an error",
+			groups: repeatedGroups(audit.MaxLimit/4, 4),
+		},
+		{
+			name:      "Too Many At Once",
+			hint:      "More events at one time than fit in a page can not be paged, which should be an error",
+			groups:    []int{1, audit.MaxLimit + 1},
+			expectErr: ErrEventsNotPaged,
+		},
+	}
+
+	for _, c := range cases {
+		store := audit.NewMemStore()
+		expected := make(map[uuid.UUID]bool)
+		for i, size := range c.groups {
+			for j := 0; j < size; j++ {
+				event := &audit.Event{Uuid: uuid.NewV4(), Type: audit.EventSignIn, UserUuid: userUuid,
+					Occurred: occurred.Add(time.Duration(i) * time.Microsecond)}
+				expected[event.Uuid] = true
+				_ = store.Write(event)
+			}
+		}
+		auditLog := audit.NewLog(store, kitlog.NewNopLogger())
+		exporter := NewExporter(NewMemStore(time.Hour), user.NewMemStore(), auditLog, kitlog.NewNopLogger(),
+			time.Minute, time.Second)
+
+		events, errUE := exporter.userEvents(context.Background(), userUuid)
+		if c.expectErr != nil {
+			if errUE != c.expectErr {
+				t.Errorf("case: %s: expected error %s but got %v\nHINT: %s", c.name, c.expectErr, errUE, c.hint)
+			}
+			continue
+		}
+		if errUE != nil {
+			t.Errorf("case: %s: unexpected error: %s\nHINT: %s", c.name, errUE, c.hint)
+			continue
+		}
+		if len(events) != len(expected) {
+			t.Errorf("case: %s: expected %d events but got %d\nHINT: %s", c.name, len(expected), len(events), c.hint)
+		}
+		read := make(map[uuid.UUID]bool)
+		for i, event := range events {
+			if !expected[event.Uuid] || read[event.Uuid] {
+				t.Errorf("case: %s: expected each event to be read once, but %s was read again\nHINT: %s", c.name,
+					event.Uuid, c.hint)
+				break
+			}
+			read[event.Uuid] = true
+			if i > 0 && event.Occurred.After(events[i-1].Occurred) {
+				t.Errorf("case: %s: expected events newest first, but %s is after %s\nHINT: %s", c.name,
+					event.Occurred, events[i-1].Occurred, c.hint)
+				break
+			}
+		}
+	}
+}
+
+// repeatedGroups returns count groups of events which each share a time, of size events.
+func repeatedGroups(count, size int) []int {
+	groups := make([]int, count)
+	for i := range groups {
+		groups[i] = size
+	}
+	return groups
+}
+
+func TestEncode(t *testing.T) {
+	archive := []byte(`{"account":{}}`)
+	if encoded, errE := Encode(archive, FormatJSON, "export.json"); errE != nil || !bytes.Equal(encoded, archive) {
+		t.Errorf("case: json: expected the archive unchanged, but got %s, error: %v", encoded, errE)
+	}
+	if _, errE := Encode(archive, "tar", "export.json"); errE != ErrUnknownFormat {
+		t.Errorf("case: unknown: expected ErrUnknownFormat, but got %v", errE)
+	}
+	zipped, errE := Encode(archive, FormatZip, "export.json")
+	if errE != nil {
+		t.Fatalf("case: zip: unexpected error: %s", errE)
+	}
+	zr, errNR := zip.NewReader(bytes.NewReader(zipped), int64(len(zipped)))
+	if errNR != nil || len(zr.File) != 1 || zr.File[0].Name != "export.json" {
+		t.Fatalf("case: zip: expected a zip holding export.json, error: %v", errNR)
+	}
+	fr, errO := zr.File[0].Open()
+	if errO != nil {
+		t.Fatalf("case: zip: unable to open export.json: %s", errO)
+	}
+	defer fr.Close()
+	if unzipped, errRA := ioutil.ReadAll(fr); errRA != nil || !bytes.Equal(unzipped, archive) {
+		t.Errorf("case: zip: expected export.json to hold the archive, but got %s, error: %v", unzipped, errRA)
+	}
+}
@@ -0,0 +1,63 @@
+package export
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+var ErrInvalidSignature = errors.New("export: download link signature is not valid")
+var ErrLinkExpired = errors.New("export: download link has expired")
+
+// linkPurpose is signed along with each link, so a signature made with the same key for another purpose,
+// such as a session id, is never a valid link signature.
+const linkPurpose = "export-download"
+
+// Signer signs and verifies links to download the archive of a job, so the archive can be downloaded with
+// the link alone, without a session, until the link expires.
+type Signer struct {
+	key []byte
+}
+
+// NewSigner constructs a new Signer, signing links with key.
+func NewSigner(key string) *Signer {
+	if len(key) == 0 {
+		panic("no signing key provided")
+	}
+	return &Signer{key: []byte(key)}
+}
+
+// Sign returns the signature of a link to the archive of the job which expires at expires,
+// encoded to be used in a url.
+func (s *Signer) Sign(jobUuid uuid.UUID, expires time.Time) string {
+	return base64.RawURLEncoding.EncodeToString(s.mac(jobUuid, expires.Unix()))
+}
+
+// Verify returns nil if signature is the signature of a link to the archive of the job which expires at expires,
+// given as unix seconds, and the link has not expired. Returns ErrInvalidSignature or ErrLinkExpired if not.
+func (s *Signer) Verify(jobUuid uuid.UUID, expires string, signature string) error {
+	expiresUnix, errPI := strconv.ParseInt(expires, 10, 64)
+	if errPI != nil {
+		return ErrInvalidSignature
+	}
+	messageMAC, errD := base64.RawURLEncoding.DecodeString(signature)
+	if errD != nil || !hmac.Equal(messageMAC, s.mac(jobUuid, expiresUnix)) {
+		return ErrInvalidSignature
+	}
+	if time.Now().Unix() >= expiresUnix {
+		return ErrLinkExpired
+	}
+	return nil
+}
+
+// mac returns the HMAC-SHA256 of the link to the archive of the job which expires at expiresUnix.
+func (s *Signer) mac(jobUuid uuid.UUID, expiresUnix int64) []byte {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(linkPurpose + ":" + jobUuid.String() + ":" + strconv.FormatInt(expiresUnix, 10)))
+	return mac.Sum(nil)
+}
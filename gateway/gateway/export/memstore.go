@@ -0,0 +1,78 @@
+package export
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	uuid "github.com/satori/go.uuid"
+)
+
+// MemStore represents an export.Store held in the memory of the process, which is lost when it exits.
+// This should be used only for development and testing, production systems should use a shared store like redis,
+// so the archive can be downloaded from any gateway.
+type MemStore struct {
+	// mx is held while the current job of a user is saved, so a job is only claimed if it was not replaced.
+	mx sync.Mutex
+	// jobs holds the current job of each user, by user uuid.
+	jobs *cache.Cache
+	// archives holds the archive of each job, by job uuid.
+	archives *cache.Cache
+}
+
+// NewMemStore constructs a new MemStore, keeping each job and archive for ttl.
+func NewMemStore(ttl time.Duration) *MemStore {
+	return &MemStore{jobs: cache.New(ttl, time.Minute), archives: cache.New(ttl, time.Minute)}
+}
+
+// SaveJob saves the job as the current job of its user, replacing any other.
+func (ms *MemStore) SaveJob(_ context.Context, job *Job) error {
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	copied := *job
+	ms.jobs.Set(job.UserUuid.String(), &copied, cache.DefaultExpiration)
+	return nil
+}
+
+// ClaimJob saves the job as the current job of its user only if the current job is the one with the uuid replaced,
+// or uuid.Nil if the user has none.
+func (ms *MemStore) ClaimJob(_ context.Context, job *Job, replaced uuid.UUID) (bool, error) {
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	current := uuid.Nil
+	if found, ok := ms.jobs.Get(job.UserUuid.String()); ok {
+		current = found.(*Job).Uuid
+	}
+	if !uuid.Equal(current, replaced) {
+		return false, nil
+	}
+	copied := *job
+	ms.jobs.Set(job.UserUuid.String(), &copied, cache.DefaultExpiration)
+	return true, nil
+}
+
+// UserJob gets the current job of the user.
+func (ms *MemStore) UserJob(_ context.Context, userUuid uuid.UUID) (*Job, error) {
+	job, found := ms.jobs.Get(userUuid.String())
+	if !found {
+		return nil, ErrJobNotFound
+	}
+	copied := *job.(*Job)
+	return &copied, nil
+}
+
+// SaveArchive saves the archive of the job.
+func (ms *MemStore) SaveArchive(_ context.Context, jobUuid uuid.UUID, archive []byte) error {
+	ms.archives.Set(jobUuid.String(), archive, cache.DefaultExpiration)
+	return nil
+}
+
+// Archive gets the archive of the job.
+func (ms *MemStore) Archive(_ context.Context, jobUuid uuid.UUID) ([]byte, error) {
+	archive, found := ms.archives.Get(jobUuid.String())
+	if !found {
+		return nil, ErrArchiveNotFound
+	}
+	return archive.([]byte), nil
+}
@@ -0,0 +1,109 @@
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/go-redis/redis"
+	uuid "github.com/satori/go.uuid"
+)
+
+// RedisStore represents an export.Store backed by redis, shared by every gateway.
+type RedisStore struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+// NewRedisStore constructs a new RedisStore, keeping each job and archive for ttl.
+func NewRedisStore(client *redis.Client, ttl time.Duration) *RedisStore {
+	if client == nil {
+		panic("no client provided")
+	}
+	return &RedisStore{client: client, ttl: ttl}
+}
+
+// SaveJob saves the job as the current job of its user, replacing any other.
+func (rs *RedisStore) SaveJob(ctx context.Context, job *Job) error {
+	encoded, errM := json.Marshal(job)
+	if errM != nil {
+		return errM
+	}
+	return rs.client.WithContext(ctx).Set(jobKey(job.UserUuid), encoded, rs.ttl).Err()
+}
+
+// ClaimJob saves the job as the current job of its user only if the current job is the one with the uuid replaced,
+// or uuid.Nil if the user has none. The job is set only if the key is not, or with the key watched, so a job saved
+// by another gateway in between is not replaced.
+func (rs *RedisStore) ClaimJob(ctx context.Context, job *Job, replaced uuid.UUID) (bool, error) {
+	encoded, errM := json.Marshal(job)
+	if errM != nil {
+		return false, errM
+	}
+	client := rs.client.WithContext(ctx)
+	key := jobKey(job.UserUuid)
+	if uuid.Equal(replaced, uuid.Nil) {
+		return client.SetNX(key, encoded, rs.ttl).Result()
+	}
+	errW := client.Watch(func(tx *redis.Tx) error {
+		current, errG := tx.Get(key).Bytes()
+		if errG != nil {
+			return errG
+		}
+		currentJob := &Job{}
+		if errU := json.Unmarshal(current, currentJob); errU != nil {
+			return errU
+		}
+		if !uuid.Equal(currentJob.Uuid, replaced) {
+			return redis.TxFailedErr
+		}
+		_, errP := tx.Pipelined(func(pipe redis.Pipeliner) error {
+			return pipe.Set(key, encoded, rs.ttl).Err()
+		})
+		return errP
+	}, key)
+	if errW == redis.TxFailedErr || errW == redis.Nil {
+		// The job was replaced, or expired, since it was read
+		return false, nil
+	}
+	return errW == nil, errW
+}
+
+// UserJob gets the current job of the user.
+func (rs *RedisStore) UserJob(ctx context.Context, userUuid uuid.UUID) (*Job, error) {
+	encoded, errG := rs.client.WithContext(ctx).Get(jobKey(userUuid)).Bytes()
+	if errG == redis.Nil {
+		return nil, ErrJobNotFound
+	} else if errG != nil {
+		return nil, errG
+	}
+	job := &Job{}
+	if errU := json.Unmarshal(encoded, job); errU != nil {
+		return nil, errU
+	}
+	return job, nil
+}
+
+// SaveArchive saves the archive of the job.
+func (rs *RedisStore) SaveArchive(ctx context.Context, jobUuid uuid.UUID, archive []byte) error {
+	return rs.client.WithContext(ctx).Set(archiveKey(jobUuid), archive, rs.ttl).Err()
+}
+
+// Archive gets the archive of the job.
+func (rs *RedisStore) Archive(ctx context.Context, jobUuid uuid.UUID) ([]byte, error) {
+	archive, errG := rs.client.WithContext(ctx).Get(archiveKey(jobUuid)).Bytes()
+	if errG == redis.Nil {
+		return nil, ErrArchiveNotFound
+	}
+	return archive, errG
+}
+
+// jobKey returns the redis key the current job of the user is saved at.
+func jobKey(userUuid uuid.UUID) string {
+	return "export:job:" + userUuid.String()
+}
+
+// archiveKey returns the redis key the archive of the job is saved at.
+func archiveKey(jobUuid uuid.UUID) string {
+	return "export:archive:" + jobUuid.String()
+}
@@ -0,0 +1,84 @@
+// +build all integration
+
+package export
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis"
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestRedisStore_ClaimJob(t *testing.T) {
+	redisaddr := os.Getenv("REDISADDR")
+	if len(redisaddr) == 0 {
+		redisaddr = "127.0.0.1:6379"
+	}
+	store := NewRedisStore(redis.NewClient(&redis.Options{Addr: redisaddr}), time.Minute)
+	ctx := context.Background()
+	userUuid := uuid.NewV4()
+	newJob := func() *Job {
+		return &Job{Uuid: uuid.NewV4(), UserUuid: userUuid, Status: StatusPending, Requested: time.Now().UTC()}
+	}
+	first := newJob()
+	second := newJob()
+	restarted := newJob()
+
+	cases := []struct {
+		name     string
+		hint     string
+		job      *Job
+		replaced uuid.UUID
+		claimed  bool
+		current  *Job
+	}{
+		{
+			name:     "First Job",
+			hint:     "A user with no job should have the job claimed",
+			job:      first,
+			replaced: uuid.Nil,
+			claimed:  true,
+			current:  first,
+		},
+		{
+			name:     "Raced First Job",
+			hint:     "A job started by another request should not be replaced by a request which found none",
+			job:      second,
+			replaced: uuid.Nil,
+			current:  first,
+		},
+		{
+			name:     "Restarted Job",
+			hint:     "A job should replace the job it was started to replace",
+			job:      restarted,
+			replaced: first.Uuid,
+			claimed:  true,
+			current:  restarted,
+		},
+		{
+			name:     "Raced Restarted Job",
+			hint:     "A job restarted by another request should not be replaced",
+			job:      second,
+			replaced: first.Uuid,
+			current:  restarted,
+		},
+	}
+	for _, c := range cases {
+		claimed, errCJ := store.ClaimJob(ctx, c.job, c.replaced)
+		if errCJ != nil {
+			t.Errorf("case: %s: unexpected error: %s\nHINT: %s", c.name, errCJ, c.hint)
+			continue
+		}
+		if claimed != c.claimed {
+			t.Errorf("case: %s: expected claimed to be %t but got %t\nHINT: %s", c.name, c.claimed, claimed, c.hint)
+		}
+		current, errUJ := store.UserJob(ctx, userUuid)
+		if errUJ != nil || !uuid.Equal(current.Uuid, c.current.Uuid) {
+			t.Errorf("case: %s: expected the current job to be %s but got %+v, error: %v\nHINT: %s", c.name,
+				c.current.Uuid, current, errUJ, c.hint)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/audit"
+)
+
+// Query parameters of the user activity collection.
+const (
+	QpActivityLimit  = "limit"
+	QpActivityBefore = "before"
+)
+
+// recordAudit records the event in the audit log, described by the request which caused it.
+func (cx *Context) recordAudit(r *http.Request, event *audit.Event) {
+	event.RequestId = getRequestId(r)
+	event.ClientAddr = r.RemoteAddr
+	event.UserAgent = r.UserAgent()
+	cx.auditLog.Record(event)
+}
+
+// UsersActivityHandler handles requests for the security activity of a user,
+// such as sign-ins, sign-outs, and revoked sessions.
+//
+// Method GET: returns the audit events about the user, newest first. Users may only get their own activity.
+// The number of events is limited by the "limit" query parameter, default 50 and at most 200.
+// Older events are requested using the "before" query parameter, the RFC 3339 time of the oldest event
+// already received.
+func (cx *Context) UsersActivityHandler(w http.ResponseWriter, r *http.Request) {
+	reqVars := mux.Vars(r)
+	if ver, ok := reqVars[ReqVarMajorVersion]; ok && ver != "v1" {
+		cx.handleMajorVersionNotSupported(w, r, "v1", ver)
+		return
+	}
+	if r.Method != http.MethodGet {
+		cx.handleMethodNotAllowed(w, r)
+		return
+	}
+	userCx, ok := cx.getUserFromContext(w, r)
+	if !ok {
+		// Ends method execution if user was not found in the request context.
+		return
+	}
+	reqUserUuid, errUFS := uuid.FromString(reqVars[ReqVarUserUuid])
+	if errUFS != nil {
+		retErr := &Error{
+			ClientError: false,
+			ServerError: true,
+			Message:     errUnexpected.Error(),
+			Context:     r.Method + " path:" + r.URL.Path,
+			Code:        CodeUnexpected,
+		}
+		cx.handleErrorJson(w, r, errUFS, "issue converting string to valid uuid", retErr, http.StatusInternalServerError)
+		return
+	}
+	if !uuid.Equal(userCx.Uuid, reqUserUuid) {
+		retErr := &Error{
+			ClientError: true,
+			ServerError: false,
+			Message:     errActionNotAuthorized.Error(),
+			Context:     r.Method + " path:" + r.URL.Path,
+			Code:        CodeActionNotAuthorized,
+		}
+		cx.handleErrorJson(w, r, nil, "user attempted to get the activity of another user", retErr,
+			http.StatusForbidden)
+		return
+	}
+
+	limit := audit.DefaultLimit
+	before := time.Time{}
+	query := r.URL.Query()
+	if limitString := query.Get(QpActivityLimit); len(limitString) != 0 {
+		var errA error
+		if limit, errA = strconv.Atoi(limitString); errA != nil || limit < 1 || limit > audit.MaxLimit {
+			cx.handleInvalidActivityQuery(w, r, fmt.Sprintf("%s must be a number between 1 and %d",
+				QpActivityLimit, audit.MaxLimit))
+			return
+		}
+	}
+	if beforeString := query.Get(QpActivityBefore); len(beforeString) != 0 {
+		var errP error
+		if before, errP = time.Parse(time.RFC3339Nano, beforeString); errP != nil {
+			cx.handleInvalidActivityQuery(w, r, fmt.Sprintf("%s must be an RFC 3339 time", QpActivityBefore))
+			return
+		}
+	}
+
+	events, errUE := cx.auditLog.UserEvents(r.Context(), reqUserUuid, before, limit)
+	if errUE != nil {
+		retErr := &Error{
+			ClientError: false,
+			ServerError: true,
+			Message:     errUnexpected.Error(),
+			Context:     r.Method + " path:" + r.URL.Path,
+			Code:        CodeUnexpected,
+		}
+		cx.handleErrorJson(w, r, errUE, "issue reading audit events of user", retErr, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Add(HeaderCacheControl, CacheControlNoStore)
+	_, _ = cx.respondEncode(w, r, events, http.StatusOK)
+}
+
+// handleInvalidActivityQuery responds that a query parameter of the activity collection is not valid.
+func (cx *Context) handleInvalidActivityQuery(w http.ResponseWriter, r *http.Request, message string) {
+	retErr := &Error{
+		ClientError: true,
+		ServerError: false,
+		Message:     message,
+		Context:     r.Method + " path:" + r.URL.Path,
+		Code:        CodeInvalidQuery,
+	}
+	cx.handleErrorJson(w, r, nil, "invalid activity query: "+r.URL.RawQuery, retErr, http.StatusBadRequest)
+}
@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/audit"
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/cache"
+)
+
+// AdminHandlerContext holds the resources used by the handlers served on the internal admin listener.
+// The admin listener must not be reachable by clients of the api.
+type AdminHandlerContext struct {
+	cx            *Context
+	responseCache *cache.Cache
+}
+
+// NewAdminHandlerContext creates a new AdminHandlerContext. responseCache may be nil if the gateway
+// has no response cache.
+func (cx *Context) NewAdminHandlerContext(responseCache *cache.Cache) *AdminHandlerContext {
+	return &AdminHandlerContext{cx: cx, responseCache: responseCache}
+}
+
+// CachePurgeRequest is the body of a request to purge cached responses.
+type CachePurgeRequest struct {
+	// PathPrefix is the start of the path of every cached response to purge, such as "/api/v1/anyquiz/".
+	PathPrefix string `json:"pathPrefix"`
+}
+
+// CachePurgeResponse is the body of the response to a purge request.
+type CachePurgeResponse struct {
+	PathPrefix string `json:"pathPrefix"`
+	// KeysPurged is the number of cache keys deleted.
+	KeysPurged int `json:"keysPurged"`
+}
+
+// CachePurgeHandler handles requests to purge cached responses by path prefix.
+//
+// Method POST: purges every cached response whose path starts with the provided path prefix.
+func (ah *AdminHandlerContext) CachePurgeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		ah.cx.handleMethodNotAllowed(w, r)
+		return
+	}
+	if ah.responseCache == nil {
+		retErr := &Error{
+			ClientError: true,
+			ServerError: false,
+			Message:     errCacheNotEnabled.Error(),
+			Context:     r.Method + " path:" + r.URL.Path,
+			Code:        CodeCacheNotEnabled,
+		}
+		ah.cx.handleErrorJson(w, r, nil, "request to purge cache, but no response cache configured", retErr,
+			http.StatusNotFound)
+		return
+	}
+	if !ah.cx.ensureJSONHeader(w, r) {
+		return
+	}
+	purgeReq := &CachePurgeRequest{}
+	if !ah.cx.decodeJSON(w, r, purgeReq, "cache purge request") {
+		return
+	}
+	if !strings.HasPrefix(purgeReq.PathPrefix, "/") {
+		retErr := &Error{
+			ClientError: true,
+			ServerError: false,
+			Message:     errInvalidPathPrefix.Error(),
+			Context:     r.Method + " path:" + r.URL.Path,
+			Code:        CodeInvalidPathPrefix,
+		}
+		ah.cx.handleErrorJson(w, r, nil, fmt.Sprintf("invalid path prefix provided: %s", purgeReq.PathPrefix),
+			retErr, http.StatusBadRequest)
+		return
+	}
+	purged, errP := ah.responseCache.Purge(purgeReq.PathPrefix)
+	if errP != nil {
+		retErr := &Error{
+			ClientError: false,
+			ServerError: true,
+			Message:     errUnexpected.Error(),
+			Context:     r.Method + " path:" + r.URL.Path,
+			Code:        CodeUnexpected,
+		}
+		ah.cx.handleErrorJson(w, r, errP, "issue purging cached responses", retErr, http.StatusInternalServerError)
+		return
+	}
+	_ = ah.cx.logger.Log("msg", "cached responses purged", "pathPrefix", purgeReq.PathPrefix, "keysPurged", purged)
+	ah.cx.recordAudit(r, &audit.Event{Type: audit.EventAdminAction,
+		Detail: fmt.Sprintf("cache purge: pathPrefix=%s keysPurged=%d", purgeReq.PathPrefix, purged)})
+	_, _ = ah.cx.respondEncode(w, r, &CachePurgeResponse{PathPrefix: purgeReq.PathPrefix, KeysPurged: purged},
+		http.StatusOK)
+}
@@ -9,6 +9,7 @@ import (
 
 	uuid "github.com/satori/go.uuid"
 
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/audit"
 	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/session"
 
 	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/user"
@@ -30,6 +31,15 @@ type signInCredentialsJson struct {
 	Password string `json:"password"`
 }
 
+// AccountDeletionResponse is the body of the response to a request to delete an account, which is pending deletion
+// until it is purged.
+type AccountDeletionResponse struct {
+	// RestoreBefore is the time before which signing in again restores the account. It is purged after.
+	RestoreBefore time.Time `json:"restoreBefore"`
+	// SessionsRevoked is the number of sessions of the user ended, including the one the request was made in.
+	SessionsRevoked int `json:"sessionsRevoked"`
+}
+
 // UsersDefaultHandler handles the default routes for the users collection.
 //
 // If the major version in the URL is not supported, request will return an error
@@ -46,7 +56,7 @@ func (cx *Context) UsersDefaultHandler(w http.ResponseWriter, r *http.Request) {
 			ServerError: true,
 			Message:     errUnexpected.Error(),
 			Context:     r.Method + " path:" + r.URL.Path,
-			Code:        0,
+			Code:        CodeUnexpected,
 		}
 		cx.handleErrorJson(w, r, nil, "did not find major version key in request vars", retErr, http.StatusInternalServerError)
 		return
@@ -77,7 +87,7 @@ func (cx *Context) UsersSpecificHandler(w http.ResponseWriter, r *http.Request)
 			ClientError: false,
 			ServerError: true,
 			Message:     errUnexpected.Error(),
-			Code:        0,
+			Code:        CodeUnexpected,
 		}
 		cx.handleErrorJson(w, r, nil, "did not find major version key in request vars", retErr, http.StatusInternalServerError)
 		return
@@ -137,7 +147,7 @@ func (cx *Context) SessionsSpecificHandler(w http.ResponseWriter, r *http.Reques
 			ClientError: false,
 			ServerError: true,
 			Message:     errUnexpected.Error(),
-			Code:        0,
+			Code:        CodeUnexpected,
 		}
 		cx.handleErrorJson(w, r, nil, "did not find major version key in request vars", retErr, http.StatusInternalServerError)
 		return
@@ -187,7 +197,7 @@ func (cx *Context) usersHandlerV1Post(w http.ResponseWriter, r *http.Request) {
 			ServerError: false,
 			Message:     fmt.Sprintf("the provided password is not a valid password: %s", err.Error()),
 			Context:     r.Method + " path:" + r.URL.Path,
-			Code:        0,
+			Code:        CodeInvalidPassword,
 		}
 		cx.handleErrorJson(w, r, err, "error: the provided password is not a valid password",
 			retErr, http.StatusBadRequest)
@@ -201,7 +211,7 @@ func (cx *Context) usersHandlerV1Post(w http.ResponseWriter, r *http.Request) {
 			ServerError: true,
 			Message:     errUnexpected.Error(),
 			Context:     r.Method + " path:" + r.URL.Path,
-			Code:        0,
+			Code:        CodeUnexpected,
 		}
 		cx.handleErrorJson(w, r, errCEH, "error: unable to create hash of provided password",
 			retErr, http.StatusInternalServerError)
@@ -216,7 +226,7 @@ func (cx *Context) usersHandlerV1Post(w http.ResponseWriter, r *http.Request) {
 			ServerError: false,
 			Message:     fmt.Sprintf("the provided new user is not a valid user: %s", err.Error()),
 			Context:     r.Method + " path:" + r.URL.Path,
-			Code:        0,
+			Code:        CodeInvalidNewUser,
 		}
 		cx.handleErrorJson(w, r, err, "error: the provided NewUser is not a valid user",
 			retErr, http.StatusBadRequest)
@@ -224,14 +234,14 @@ func (cx *Context) usersHandlerV1Post(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Ensure Username is not in use
-	_, errGUN := cx.userStore.ReadUserUuid(newUser.Username)
+	_, errGUN := cx.userStore.ReadUserUuid(r.Context(), newUser.Username)
 	if errGUN == nil {
 		retErr := &Error{
 			ClientError: true,
 			ServerError: false,
 			Message:     errAccountUserNameUnavailable.Error(),
 			Context:     r.Method + " path:" + r.URL.Path,
-			Code:        0,
+			Code:        CodeUsernameUnavailable,
 		}
 		cx.handleErrorJson(w, r, nil, fmt.Sprintf("user with that username already exists: %s", newUser.Username),
 			retErr,
@@ -243,15 +253,15 @@ func (cx *Context) usersHandlerV1Post(w http.ResponseWriter, r *http.Request) {
 			ServerError: false,
 			Message:     errUnexpected.Error(),
 			Context:     r.Method + " path:" + r.URL.Path,
-			Code:        0,
+			Code:        CodeUnexpected,
 		}
-		cx.handleErrorJson(w, r, nil, "error occurred trying to search for user",
+		cx.handleErrorJson(w, r, errGUN, "error occurred trying to search for user",
 			retErr,
 			http.StatusInternalServerError)
 		return
 	}
 
-	userINS, errINS := cx.userStore.CreateUser(newUser)
+	userINS, errINS := cx.userStore.CreateUser(r.Context(), newUser)
 	if errINS != nil {
 		if errINS == user.ErrUserAlreadyExists {
 			retErr := &Error{
@@ -259,7 +269,7 @@ func (cx *Context) usersHandlerV1Post(w http.ResponseWriter, r *http.Request) {
 				ServerError: true,
 				Message:     errUnexpected.Error(),
 				Context:     r.Method + " path:" + r.URL.Path,
-				Code:        0,
+				Code:        CodeUnexpected,
 			}
 			cx.handleErrorJson(w, r, errINS, "uuid matched existing user uuid", retErr,
 				http.StatusInternalServerError)
@@ -270,7 +280,7 @@ func (cx *Context) usersHandlerV1Post(w http.ResponseWriter, r *http.Request) {
 				ServerError: false,
 				Message:     errAccountUserNameUnavailable.Error(),
 				Context:     r.Method + " path:" + r.URL.Path,
-				Code:        0,
+				Code:        CodeUsernameUnavailable,
 			}
 			cx.handleErrorJson(w, r, nil, fmt.Sprintf("user with that username already exists: %s", newUser.Username),
 				retErr,
@@ -282,13 +292,15 @@ func (cx *Context) usersHandlerV1Post(w http.ResponseWriter, r *http.Request) {
 			ServerError: true,
 			Message:     errUnexpected.Error(),
 			Context:     r.Method + " path:" + r.URL.Path,
-			Code:        0,
+			Code:        CodeUnexpected,
 		}
 		cx.handleErrorJson(w, r, errINS, "error adding user to database", retErr,
 			http.StatusInternalServerError)
 		return
 	}
 
+	cx.recordAudit(r, &audit.Event{Type: audit.EventSignUp, UserUuid: userINS.Uuid})
+
 	sesId, sesUuid, errSID := session.CreateSession(cx.sessionSigningKey)
 	if errSID != nil {
 		retErr := &Error{
@@ -297,7 +309,7 @@ func (cx *Context) usersHandlerV1Post(w http.ResponseWriter, r *http.Request) {
 			Message: fmt.Sprintf("user created with username: %s; error creating new session, "+
 				"please log in with your username and password manually", userINS.Username),
 			Context: r.Method + " path:" + r.URL.Path,
-			Code:    0,
+			Code:    CodeSessionNotCreatedSignUp,
 		}
 		cx.handleErrorJson(w, r, errSID, "error beginning new session",
 			retErr,
@@ -306,7 +318,7 @@ func (cx *Context) usersHandlerV1Post(w http.ResponseWriter, r *http.Request) {
 	}
 	sessState := NewSessionState(time.Now(), userINS, sesUuid, sesId, true)
 	// This adds the authorization header to the response as well
-	errBS := session.BeginSession(sesId, sesUuid, cx.sessionStore, sessState, w)
+	errBS := session.BeginSession(r.Context(), sesId, sesUuid, cx.sessionStore, sessState, w)
 	if errBS != nil {
 		retErr := &Error{
 			ClientError: false,
@@ -314,7 +326,7 @@ func (cx *Context) usersHandlerV1Post(w http.ResponseWriter, r *http.Request) {
 			Message: fmt.Sprintf("user created with username: %s; error creating new session, "+
 				"please log in with your username and password manually", userINS.Username),
 			Context: r.Method + " path:" + r.URL.Path,
-			Code:    0,
+			Code:    CodeSessionNotCreatedSignUp,
 		}
 		cx.handleErrorJson(w, r, errBS, "error beginning new session",
 			retErr,
@@ -328,7 +340,7 @@ func (cx *Context) usersHandlerV1Post(w http.ResponseWriter, r *http.Request) {
 	location := fmt.Sprintf("%s/%s", strings.TrimSuffix(urlLoc.String(), "/"), userINS.Uuid.String())
 	w.Header().Add(HeaderLocation, location)
 	// Send response
-	_, _ = cx.respondEncode(w, userINS, http.StatusCreated)
+	_, _ = cx.respondEncode(w, r, userINS, http.StatusCreated)
 }
 
 // usersSpecificHandlerV1Get is a helper method for UsersSpecificHandler to handle Get requests to the users collection.
@@ -339,7 +351,7 @@ func (cx *Context) usersSpecificHandlerV1Get(w http.ResponseWriter, r *http.Requ
 			ServerError: true,
 			Message:     errUnexpected.Error(),
 			Context:     "DELETE path:" + r.URL.Path,
-			Code:        0,
+			Code:        CodeUnexpected,
 		}
 		cx.handleErrorJson(w, r, nil, "expected user to be passed, but got nil pointer to user", retErr, http.StatusInternalServerError)
 	}
@@ -351,7 +363,7 @@ func (cx *Context) usersSpecificHandlerV1Get(w http.ResponseWriter, r *http.Requ
 			ServerError: true,
 			Message:     fmt.Sprintf("uuid not extracted from request"),
 			Context:     "GET path:" + r.URL.Path,
-			Code:        0,
+			Code:        CodeUnexpected,
 		}
 		cx.handleErrorJson(w, r, nil, "uuid expected in path, but not found in mux vars", retErr, http.StatusInternalServerError)
 		return
@@ -364,7 +376,7 @@ func (cx *Context) usersSpecificHandlerV1Get(w http.ResponseWriter, r *http.Requ
 			ServerError: true,
 			Message:     fmt.Sprintf("unable to get valid uuid from path"),
 			Context:     "GET path:" + r.URL.Path,
-			Code:        0,
+			Code:        CodeUnexpected,
 		}
 		cx.handleErrorJson(w, r, errUFS, "issue converting string to valid uuid", retErr, http.StatusInternalServerError)
 		return
@@ -375,13 +387,13 @@ func (cx *Context) usersSpecificHandlerV1Get(w http.ResponseWriter, r *http.Requ
 			ServerError: false,
 			Message:     errActionNotAuthorized.Error(),
 			Context:     "GET path:" + r.URL.Path,
-			Code:        0,
+			Code:        CodeActionNotAuthorized,
 		}
 		cx.handleErrorJson(w, r, errUFS, "user attempted to get info about another user", retErr, http.StatusForbidden)
 		return
 	}
 
-	userProfile, errGID := cx.userStore.ReadUserInfo(reqUserUuid)
+	userProfile, errGID := cx.userStore.ReadUserInfo(r.Context(), reqUserUuid)
 	if errGID != nil {
 		if errGID == user.ErrUserNotFound {
 			retErr := &Error{
@@ -389,7 +401,7 @@ func (cx *Context) usersSpecificHandlerV1Get(w http.ResponseWriter, r *http.Requ
 				ServerError: false,
 				Message:     errUserNotFound.Error(),
 				Context:     "GET path:" + r.URL.Path,
-				Code:        0,
+				Code:        CodeUserNotFound,
 			}
 			cx.handleErrorJson(w, r, errGID, fmt.Sprintf("requested user not found in database: uuid=%s", reqUserUuid.String()), retErr, http.StatusNotFound)
 		} else {
@@ -398,17 +410,21 @@ func (cx *Context) usersSpecificHandlerV1Get(w http.ResponseWriter, r *http.Requ
 				ServerError: true,
 				Message:     errUnexpected.Error(),
 				Context:     "GET path:" + r.URL.Path,
-				Code:        0,
+				Code:        CodeUnexpected,
 			}
 			cx.handleErrorJson(w, r, errGID, fmt.Sprintf("issue retrieving user from database: uuid=%s", reqUserUuid.String()), retErr, http.StatusInternalServerError)
 		}
 		return
 	}
 	// Send response
-	_, _ = cx.respondEncode(w, userProfile, http.StatusOK)
+	_, _ = cx.respondEncode(w, r, userProfile, http.StatusOK)
 }
 
 // usersSpecificHandlerV1Delete is a helper method for SpecificUserHandler to handle Delete requests to the users collection.
+//
+// The account is marked pending deletion and every session of the user is ended. Signing in again within the
+// grace period restores the account, after which it is purged. Clients which negotiated a version of the api
+// older than apiVersionAccountDeletion are sent the 200 text response of that version.
 func (cx *Context) usersSpecificHandlerV1Delete(w http.ResponseWriter, r *http.Request, userCx *user.User) {
 	if userCx == nil {
 		retErr := &Error{
@@ -416,7 +432,7 @@ func (cx *Context) usersSpecificHandlerV1Delete(w http.ResponseWriter, r *http.R
 			ServerError: true,
 			Message:     errUnexpected.Error(),
 			Context:     "DELETE path:" + r.URL.Path,
-			Code:        0,
+			Code:        CodeUnexpected,
 		}
 		cx.handleErrorJson(w, r, nil, "expected user to be passed, but got nil pointer to user", retErr, http.StatusInternalServerError)
 	}
@@ -428,7 +444,7 @@ func (cx *Context) usersSpecificHandlerV1Delete(w http.ResponseWriter, r *http.R
 			ServerError: true,
 			Message:     errUnexpected.Error(),
 			Context:     "DELETE path:" + r.URL.Path,
-			Code:        0,
+			Code:        CodeUnexpected,
 		}
 		cx.handleErrorJson(w, r, nil, "uuid expected in path, but not found in mux vars", retErr, http.StatusInternalServerError)
 		return
@@ -441,7 +457,7 @@ func (cx *Context) usersSpecificHandlerV1Delete(w http.ResponseWriter, r *http.R
 			ServerError: true,
 			Message:     errUnexpected.Error(),
 			Context:     "DELETE path:" + r.URL.Path,
-			Code:        0,
+			Code:        CodeUnexpected,
 		}
 		cx.handleErrorJson(w, r, errUFS, "issue converting string to valid uuid", retErr, http.StatusInternalServerError)
 		return
@@ -453,7 +469,7 @@ func (cx *Context) usersSpecificHandlerV1Delete(w http.ResponseWriter, r *http.R
 			ServerError: false,
 			Message:     errActionNotAuthorized.Error(),
 			Context:     "DELETE path:" + r.URL.Path,
-			Code:        0,
+			Code:        CodeActionNotAuthorized,
 		}
 		cx.handleErrorJson(w, r, nil,
 			fmt.Sprintf("logged in user tried to update a different users profile: user=%s userToUpdate=%s",
@@ -461,25 +477,52 @@ func (cx *Context) usersSpecificHandlerV1Delete(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	errDU := cx.userStore.DeleteUser(reqUserUuid)
-	if errDU != nil {
+	requested := time.Now().UTC()
+	errUUDR := cx.userStore.UpdateUserDeletionRequested(r.Context(), reqUserUuid, requested)
+	if errUUDR != nil {
 		retErr := &Error{
 			ClientError: false,
 			ServerError: true,
 			Message:     errUnexpected.Error(),
 			Context:     "DELETE path:" + r.URL.Path,
-			Code:        0,
+			Code:        CodeUnexpected,
 		}
-		cx.handleErrorJson(w, r, errDU,
+		cx.handleErrorJson(w, r, errUUDR,
 			"error occurred while attempting to delete user account", retErr, http.StatusInternalServerError)
 		return
 	}
-	sesSt, errGSR := cx.getSessionStateFromRequest(r)
-	if errGSR == nil && sesSt != nil {
-		_ = cx.sessionStore.Delete(sesSt.SessionID)
+	restoreBefore := requested.Add(cx.deletion.GracePeriod)
+	deleted := &audit.Event{Type: audit.EventAccountDeleted, UserUuid: reqUserUuid,
+		Detail: "pending deletion, may be restored before " + restoreBefore.Format(time.RFC3339)}
+	if sesSt, errGSS := GetSessionStateFromContext(r); errGSS == nil {
+		deleted.SessionUuid = sesSt.SessionUuid
+	}
+	cx.recordAudit(r, deleted)
+
+	// Every session of the user is ended, so the account can only be used again by signing in, which restores it
+	revoked, errRUS := RevokeUserSessions(r.Context(), cx.deletion.Sessions, reqUserUuid, func(state *SessionState) {
+		cx.recordAudit(r, &audit.Event{Type: audit.EventSessionRevoked, UserUuid: reqUserUuid,
+			SessionUuid: state.SessionUuid, Detail: "revoked when the account was deleted"})
+	})
+	if errRUS != nil {
+		retErr := &Error{
+			ClientError: false,
+			ServerError: true,
+			Message:     errUnexpected.Error(),
+			Context:     "DELETE path:" + r.URL.Path,
+			Code:        CodeUnexpected,
+		}
+		cx.handleErrorJson(w, r, errRUS, fmt.Sprintf("error occurred while revoking the sessions of deleted "+
+			"user account, %d revoked", revoked), retErr, http.StatusInternalServerError)
+		return
 	}
 	// Send response to client.
-	_, _ = cx.respond(w, "account deleted successfully", http.StatusOK)
+	if !cx.servedApiVersionAtLeast(r, apiVersionAccountDeletion) {
+		_, _ = cx.respond(w, r, "account deleted successfully", http.StatusOK)
+		return
+	}
+	_, _ = cx.respondEncode(w, r, &AccountDeletionResponse{RestoreBefore: restoreBefore, SessionsRevoked: revoked},
+		http.StatusAccepted)
 }
 
 // sessionsHandlerV1Post is a helper method for SessionsHandler to handle Post requests to the sessions collection.
@@ -490,6 +533,8 @@ func (cx *Context) sessionsHandlerV1Post(w http.ResponseWriter, r *http.Request)
 	}
 	userPro := &user.User{}
 	signInCredentials := &signInCredentialsJson{}
+	// restored is true if signing in restored an account pending deletion
+	restored := false
 
 	// Extract credentials from request, decode function will write error if unable to decode
 	if !cx.decodeJSON(w, r, signInCredentials, "signInCredentials") {
@@ -509,21 +554,23 @@ func (cx *Context) sessionsHandlerV1Post(w http.ResponseWriter, r *http.Request)
 				ServerError: false,
 				Message:     errInvalidCredentials.Error(),
 				Context:     r.Method + " path:" + r.URL.Path,
-				Code:        0,
+				Code:        CodeInvalidCredentials,
 			}
 			cx.handleErrorJson(w, r, errVC,
 				"provided credentials are not valid in this system", retErr, http.StatusBadRequest)
 			return
 		}
-		validUserHash, errGEH := cx.userStore.ReadUserEncodedHash(credentials.Username)
+		validUserHash, errGEH := cx.userStore.ReadUserEncodedHash(r.Context(), credentials.Username)
 		if errGEH != nil {
 			if errGEH == user.ErrUserNotFound {
+				cx.recordAudit(r, &audit.Event{Type: audit.EventSignInFailed, Username: credentials.Username,
+					Detail: "unknown username"})
 				retErr := &Error{
 					ClientError: true,
 					ServerError: false,
 					Message:     errInvalidCredentials.Error(),
 					Context:     r.Method + " path:" + r.URL.Path,
-					Code:        0,
+					Code:        CodeInvalidCredentials,
 				}
 				cx.handleErrorJson(w, r, errGEH,
 					"user not found in database with that username", retErr, http.StatusForbidden)
@@ -533,7 +580,7 @@ func (cx *Context) sessionsHandlerV1Post(w http.ResponseWriter, r *http.Request)
 					ServerError: true,
 					Message:     errUnexpected.Error(),
 					Context:     r.Method + " path:" + r.URL.Path,
-					Code:        0,
+					Code:        CodeUnexpected,
 				}
 				cx.handleErrorJson(w, r, errGEH,
 					"error occurred when retrieving user encoded hash", retErr, http.StatusInternalServerError)
@@ -541,51 +588,91 @@ func (cx *Context) sessionsHandlerV1Post(w http.ResponseWriter, r *http.Request)
 
 			return
 		}
+		beginAuth := time.Now()
 		valid, errAuth := user.Authenticate(credentials.Password, validUserHash)
+		cx.metrics.PasswordVerifyDuration.With("result", passwordVerifyResult(valid, errAuth)).
+			Observe(time.Since(beginAuth).Seconds())
 		if errAuth != nil && errAuth != user.ErrHashNotFromPassword {
 			retErr := &Error{
 				ClientError: false,
 				ServerError: true,
 				Message:     errUnexpected.Error(),
 				Context:     r.Method + " path:" + r.URL.Path,
-				Code:        0,
+				Code:        CodeUnexpected,
 			}
 			cx.handleErrorJson(w, r, errAuth,
 				"error occurred when trying to validate credentials", retErr, http.StatusInternalServerError)
 			return
 		}
 		if !valid {
+			failed := &audit.Event{Type: audit.EventSignInFailed, Username: credentials.Username,
+				Detail: "incorrect password"}
+			if failedUuid, errRU := cx.userStore.ReadUserUuid(r.Context(), credentials.Username); errRU == nil {
+				failed.UserUuid = *failedUuid
+			}
+			cx.recordAudit(r, failed)
 			retErr := &Error{
 				ClientError: true,
 				ServerError: false,
 				Message:     errInvalidCredentials.Error(),
 				Context:     r.Method + " path:" + r.URL.Path,
-				Code:        0,
+				Code:        CodeInvalidCredentials,
 			}
 			cx.handleErrorJson(w, r, errAuth,
 				"provided credentials are not the same as were used to create the hash for this user",
 				retErr, http.StatusForbidden)
 			return
 		}
-		userUuid, errRU := cx.userStore.ReadUserUuid(credentials.Username)
+		userUuid, errRU := cx.userStore.ReadUserUuid(r.Context(), credentials.Username)
 		if errRU != nil {
 			retErr := &Error{
 				ClientError: false,
 				ServerError: true,
 				Message:     errUnexpected.Error(),
-				Code:        0,
+				Code:        CodeUnexpected,
 			}
 			cx.handleErrorJson(w, r, errRU,
 				"user was not found in database but should be in database", retErr, http.StatusInternalServerError)
+			return
+		}
+		var errDUDR error
+		restored, errDUDR = cx.userStore.DeleteUserDeletionRequested(r.Context(), *userUuid,
+			time.Now().UTC().Add(-cx.deletion.GracePeriod))
+		if errDUDR != nil {
+			if errDUDR == user.ErrDeletionGracePassed {
+				// The account is waiting to be purged, so is treated as though it were already gone
+				cx.recordAudit(r, &audit.Event{Type: audit.EventSignInFailed, UserUuid: *userUuid,
+					Username: credentials.Username, Detail: "account deleted"})
+				retErr := &Error{
+					ClientError: true,
+					ServerError: false,
+					Message:     errInvalidCredentials.Error(),
+					Context:     r.Method + " path:" + r.URL.Path,
+					Code:        CodeInvalidCredentials,
+				}
+				cx.handleErrorJson(w, r, errDUDR,
+					"user signed in to deleted account after the grace period", retErr, http.StatusForbidden)
+			} else {
+				retErr := &Error{
+					ClientError: false,
+					ServerError: true,
+					Message:     errUnexpected.Error(),
+					Context:     r.Method + " path:" + r.URL.Path,
+					Code:        CodeUnexpected,
+				}
+				cx.handleErrorJson(w, r, errDUDR,
+					"error occurred when restoring account pending deletion", retErr, http.StatusInternalServerError)
+			}
+			return
 		}
 		var errGUUN error
-		userPro, errGUUN = cx.userStore.ReadUserInfo(*userUuid)
+		userPro, errGUUN = cx.userStore.ReadUserInfo(r.Context(), *userUuid)
 		if errGUUN != nil {
 			retErr := &Error{
 				ClientError: false,
 				ServerError: true,
 				Message:     errUnexpected.Error(),
-				Code:        0,
+				Code:        CodeUnexpected,
 			}
 			cx.handleErrorJson(w, r, errGUUN,
 				"user was not found in database but should be in database", retErr, http.StatusInternalServerError)
@@ -603,7 +690,7 @@ func (cx *Context) sessionsHandlerV1Post(w http.ResponseWriter, r *http.Request)
 			ServerError: true,
 			Message:     "error creating new session, please try again",
 			Context:     r.Method + " path:" + r.URL.Path,
-			Code:        0,
+			Code:        CodeSessionNotCreated,
 		}
 		cx.handleErrorJson(w, r, errSID, "error beginning new session",
 			retErr,
@@ -612,20 +699,27 @@ func (cx *Context) sessionsHandlerV1Post(w http.ResponseWriter, r *http.Request)
 	}
 	sessState := NewSessionState(time.Now(), userPro, sesUuid, sesId, userPro.Uuid != user.InvalidUuid)
 	// This adds the authorization header to the response as well
-	errBS := session.BeginSession(sesId, sesUuid, cx.sessionStore, sessState, w)
+	errBS := session.BeginSession(r.Context(), sesId, sesUuid, cx.sessionStore, sessState, w)
 	if errBS != nil {
 		retErr := &Error{
 			ClientError: false,
 			ServerError: true,
 			Message:     "error creating new session, please try again",
 			Context:     r.Method + " path:" + r.URL.Path,
-			Code:        0,
+			Code:        CodeSessionNotCreated,
 		}
 		cx.handleErrorJson(w, r, errBS, "error beginning new session",
 			retErr,
 			http.StatusInternalServerError)
 		return
 	}
+	if sessState.Authenticated {
+		cx.recordAudit(r, &audit.Event{Type: audit.EventSignIn, UserUuid: userPro.Uuid, SessionUuid: sesUuid})
+	}
+	if restored {
+		cx.recordAudit(r, &audit.Event{Type: audit.EventAccountRestored, UserUuid: userPro.Uuid, SessionUuid: sesUuid,
+			Detail: "restored by signing in"})
+	}
 	urlLoc := url.URL{}
 	urlLoc.Host = cx.apiInfo.Host + ":" + cx.apiInfo.Port
 	urlLoc.Scheme = cx.apiInfo.Scheme
@@ -635,13 +729,14 @@ func (cx *Context) sessionsHandlerV1Post(w http.ResponseWriter, r *http.Request)
 	w.Header().Add(HeaderPragma, PragmaNoCache)
 	w.Header().Add(HeaderCacheControl, CacheControlNoStore)
 	// Send response
-	_, _ = cx.respondEncode(w, userPro, http.StatusCreated)
+	_, _ = cx.respondEncode(w, r, userPro, http.StatusCreated)
 }
 
 // sessionsSpecificHandlerV1Delete is a helper method for SpecificSessionHandler to handle Delete requests to the
 // sessions collection.
 func (cx *Context) sessionsSpecificHandlerV1Delete(w http.ResponseWriter, r *http.Request, sessionState *SessionState) {
 	var sessionIdToDelete session.SessionID
+	sessionUuidToDelete := sessionState.SessionUuid
 	reqVars := mux.Vars(r)
 	sesVar, ok := reqVars[ReqVarSession]
 	if !ok {
@@ -650,7 +745,7 @@ func (cx *Context) sessionsSpecificHandlerV1Delete(w http.ResponseWriter, r *htt
 			ServerError: true,
 			Message:     errUnexpected.Error(),
 			Context:     r.Method + " path:" + r.URL.Path,
-			Code:        0,
+			Code:        CodeUnexpected,
 		}
 		cx.handleErrorJson(w, r, nil, "session identifier expected in path, but not found in mux vars", retErr, http.StatusInternalServerError)
 		return
@@ -658,12 +753,12 @@ func (cx *Context) sessionsSpecificHandlerV1Delete(w http.ResponseWriter, r *htt
 
 	if sesVar == SpecificSessionHandlerDeleteCurrentSessionAlias {
 		sessionIdToDelete = sessionState.SessionID
-		if ok, err := cx.sessionStore.Exists(sessionIdToDelete); err != nil || ok == false {
+		if ok, err := cx.sessionStore.Exists(r.Context(), sessionIdToDelete); err != nil || ok == false {
 			retErr := &Error{
 				ClientError: true,
 				ServerError: false,
 				Message:     errSessionNotFound.Error(),
-				Code:        0,
+				Code:        CodeSessionNotFound,
 			}
 			cx.handleErrorJson(w, r, err, "session key not in session database", retErr, http.StatusBadRequest)
 			return
@@ -676,7 +771,7 @@ func (cx *Context) sessionsSpecificHandlerV1Delete(w http.ResponseWriter, r *htt
 				ServerError: true,
 				Message:     errUnexpected.Error(),
 				Context:     r.Method + " path:" + r.URL.Path,
-				Code:        0,
+				Code:        CodeUnexpected,
 			}
 			cx.handleErrorJson(w, r, errUFS, "session identifier expected to be uuid, but an error occurred during processing, sessionIdentifier: "+sesVar, retErr, http.StatusInternalServerError)
 			return
@@ -685,37 +780,37 @@ func (cx *Context) sessionsSpecificHandlerV1Delete(w http.ResponseWriter, r *htt
 			sessionIdToDelete = sessionState.SessionID
 		} else {
 			if sessionState.Authenticated {
-				sesIdOfSesVar, errGSID := cx.sessionStore.GetSessionId(sesVarUuid)
+				sesIdOfSesVar, errGSID := cx.sessionStore.GetSessionId(r.Context(), sesVarUuid)
 				if errGSID != nil || sesIdOfSesVar == session.InvalidSessionID {
 					retErr := &Error{
 						ClientError: false,
 						ServerError: true,
 						Message:     errUnexpected.Error(),
 						Context:     r.Method + " path:" + r.URL.Path,
-						Code:        0,
+						Code:        CodeUnexpected,
 					}
 					cx.handleErrorJson(w, r, errGSID, "issue getting sessionId from store", retErr, http.StatusInternalServerError)
 					return
 				}
-				if ok, err := cx.sessionStore.Exists(sesIdOfSesVar); err != nil || ok == false {
+				if ok, err := cx.sessionStore.Exists(r.Context(), sesIdOfSesVar); err != nil || ok == false {
 					retErr := &Error{
 						ClientError: true,
 						ServerError: false,
 						Message:     errSessionNotFound.Error(),
-						Code:        0,
+						Code:        CodeSessionNotFound,
 					}
-					cx.handleErrorJson(w, r, errGSID, "session does not exist", retErr, http.StatusBadRequest)
+					cx.handleErrorJson(w, r, err, "session does not exist", retErr, http.StatusBadRequest)
 					return
 				}
 				sesStOfSesVar := &SessionState{}
-				errGSST := cx.sessionStore.Get(sesIdOfSesVar, sesStOfSesVar)
+				errGSST := cx.sessionStore.Get(r.Context(), sesIdOfSesVar, sesStOfSesVar)
 				if errGSST != nil || sesIdOfSesVar == session.InvalidSessionID {
 					retErr := &Error{
 						ClientError: false,
 						ServerError: true,
 						Message:     errUnexpected.Error(),
 						Context:     r.Method + " path:" + r.URL.Path,
-						Code:        0,
+						Code:        CodeUnexpected,
 					}
 					cx.handleErrorJson(w, r, errGSST, "issue getting session state from store", retErr, http.StatusInternalServerError)
 					return
@@ -726,7 +821,7 @@ func (cx *Context) sessionsSpecificHandlerV1Delete(w http.ResponseWriter, r *htt
 						ServerError: false,
 						Message:     errActionNotAuthorized.Error(),
 						Context:     r.Method + " path:" + r.URL.Path,
-						Code:        0,
+						Code:        CodeActionNotAuthorized,
 					}
 					cx.handleErrorJson(w, r, nil, "user attempted to delete a session other than the current one but it is not in an authenticated session", retErr, http.StatusForbidden)
 					return
@@ -739,19 +834,20 @@ func (cx *Context) sessionsSpecificHandlerV1Delete(w http.ResponseWriter, r *htt
 							ServerError: false,
 							Message:     errActionNotAuthorized.Error(),
 							Context:     r.Method + " path:" + r.URL.Path,
-							Code:        0,
+							Code:        CodeActionNotAuthorized,
 						}
 						cx.handleErrorJson(w, r, nil, "user attempted to delete a session other than the current one was not the user that started that session", retErr, http.StatusForbidden)
 						return
 					}
 					sessionIdToDelete = sesIdOfSesVar
+					sessionUuidToDelete = sesVarUuid
 				} else {
 					retErr := &Error{
 						ClientError: false,
 						ServerError: true,
 						Message:     errUnexpected.Error(),
 						Context:     r.Method + " path:" + r.URL.Path,
-						Code:        0,
+						Code:        CodeUnexpected,
 					}
 					cx.handleErrorJson(w, r, errGSST, "user stored in authenticated session nil", retErr, http.StatusInternalServerError)
 					return
@@ -762,7 +858,7 @@ func (cx *Context) sessionsSpecificHandlerV1Delete(w http.ResponseWriter, r *htt
 					ServerError: false,
 					Message:     errActionNotAuthorized.Error(),
 					Context:     r.Method + " path:" + r.URL.Path,
-					Code:        0,
+					Code:        CodeActionNotAuthorized,
 				}
 				cx.handleErrorJson(w, r, nil, "user attempted to delete a session other than the current one but is not in an authenticated session", retErr, http.StatusForbidden)
 				return
@@ -771,18 +867,27 @@ func (cx *Context) sessionsSpecificHandlerV1Delete(w http.ResponseWriter, r *htt
 		}
 	}
 
-	errDSID := session.EndSession(sessionIdToDelete, cx.sessionStore)
+	errDSID := session.EndSession(r.Context(), sessionIdToDelete, cx.sessionStore)
 	if errDSID != nil {
 		retErr := &Error{
 			ClientError: false,
 			ServerError: true,
 			Message:     errUnexpected.Error(),
-			Code:        0,
+			Code:        CodeUnexpected,
 		}
 		cx.handleErrorJson(w, r, errDSID, "unable to delete user session", retErr, http.StatusInternalServerError)
 		return
 	}
+	if sessionState.Authenticated && sessionState.User != nil {
+		ended := &audit.Event{Type: audit.EventSignOut, UserUuid: sessionState.User.Uuid,
+			SessionUuid: sessionUuidToDelete}
+		if !uuid.Equal(sessionUuidToDelete, sessionState.SessionUuid) {
+			ended.Type = audit.EventSessionRevoked
+			ended.Detail = "revoked from session " + sessionState.SessionUuid.String()
+		}
+		cx.recordAudit(r, ended)
+	}
 
 	// Send response
-	_, _ = cx.respondText(w, "session successfully ended", http.StatusOK)
+	_, _ = cx.respondText(w, r, "session successfully ended", http.StatusOK)
 }
@@ -0,0 +1,232 @@
+// +build all unit
+
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/gorilla/mux"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/audit"
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/session"
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/user"
+)
+
+// testPassword is the password of every user created by newTestUser.
+const testPassword = "really secure password!"
+
+// newTestAuthGateway returns a Context, with an audit log backed by the store returned, and a router serving
+// the sessions and users routes of the gateway, as the gateway serves them.
+func newTestAuthGateway(t *testing.T) (*Context, *audit.MemStore, http.Handler) {
+	cx := newTestContext(t)
+	auditStore := audit.NewMemStore()
+	cx.auditLog = audit.NewLog(auditStore, kitlog.NewNopLogger())
+	cx.apiInfo = &ApiInfo{Scheme: "https", Host: "localhost", Port: "443"}
+
+	router := mux.NewRouter()
+	gateway := router.PathPrefix("/api/{" + ReqVarMajorVersion + ":v[0-9]+}/gateway/").Subrouter()
+	gateway.Use(cx.NewAuthenticator)
+	gateway.Use(cx.NewEnsureGatewayVersionSupported)
+	gateway.HandleFunc("/sessions", cx.SessionsDefaultHandler)
+	usersSpecific := gateway.PathPrefix("/users/{" + ReqVarUserUuid + ":" + testUuidV4Regex + "}").Subrouter()
+	usersSpecific.Use(cx.NewEnsureAuth)
+	usersSpecific.PathPrefix("").HandlerFunc(cx.UsersSpecificHandler)
+	return cx, auditStore, router
+}
+
+// newTestUser creates a user with the username and testPassword.
+func newTestUser(t *testing.T, cx *Context, username string) *user.User {
+	encodedHash, errCEH := user.CreateEncodedHash(testPassword)
+	if errCEH != nil {
+		t.Fatalf("unexpected error setting up test: %s", errCEH)
+	}
+	usr, errCU := cx.userStore.CreateUser(context.Background(), &user.NewUser{Username: username,
+		FullName: "Test " + username, DisplayName: username, EncodedHash: encodedHash})
+	if errCU != nil {
+		t.Fatalf("unexpected error setting up test: %s", errCU)
+	}
+	return usr
+}
+
+// signIn begins a session with the credentials, returning the response.
+func signIn(router http.Handler, username, password string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(&signInCredentialsJson{Username: username, Password: password})
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/gateway/sessions", bytes.NewReader(body))
+	r.Header.Set(HeaderContentType, ContentTypeJSON)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	return w
+}
+
+// signInSession signs in, returning the id of the session begun.
+func signInSession(t *testing.T, router http.Handler, username string) session.SessionID {
+	w := signIn(router, username, testPassword)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("unexpected status signing in to set up test: %d %s", w.Code, w.Body)
+	}
+	return session.SessionID(strings.TrimPrefix(w.Header().Get(session.HeaderAuthorization),
+		session.AuthHeaderSchemeBearerPrefix))
+}
+
+// deleteUser requests the account of the user be deleted, in the session, with the api version.
+func deleteUser(router http.Handler, sid session.SessionID, userUuid uuid.UUID,
+	apiVersion string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodDelete, "/api/v1/gateway/users/"+userUuid.String(), nil)
+	r.Header.Set(session.HeaderAuthorization, session.AuthHeaderSchemeBearerPrefix+string(sid))
+	if len(apiVersion) != 0 {
+		r.Header.Set(HeaderPerceptiaApiVersion, apiVersion)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	return w
+}
+
+// sessionExists reports if the session is still open.
+func sessionExists(t *testing.T, cx *Context, sid session.SessionID) bool {
+	exists, errE := cx.sessionStore.Exists(context.Background(), sid)
+	if errE != nil {
+		t.Fatalf("unexpected error checking session: %s", errE)
+	}
+	return exists
+}
+
+// countEvents returns the number of audit events of each type about the user.
+func countEvents(t *testing.T, store *audit.MemStore, userUuid uuid.UUID) map[audit.EventType]int {
+	events, errRUE := store.ReadUserEvents(context.Background(), userUuid, time.Now().Add(time.Minute), audit.MaxLimit)
+	if errRUE != nil {
+		t.Fatalf("unexpected error reading audit events: %s", errRUE)
+	}
+	counts := make(map[audit.EventType]int)
+	for _, event := range events {
+		counts[event.Type]++
+	}
+	return counts
+}
+
+func TestUsersSpecificHandlerV1Delete(t *testing.T) {
+	cx, auditStore, router := newTestAuthGateway(t)
+	deleted := newTestUser(t, cx, "deleted")
+	other := newTestUser(t, cx, "other")
+	first := signInSession(t, router, deleted.Username)
+	second := signInSession(t, router, deleted.Username)
+	otherSession := signInSession(t, router, other.Username)
+
+	w := deleteUser(router, first, other.Uuid, "")
+	if w.Code != http.StatusForbidden || !sessionExists(t, cx, otherSession) {
+		t.Errorf("case: Other User: expected status %d with the session of the user left open, but got %d\n"+
+			"HINT: a user may only delete their own account", http.StatusForbidden, w.Code)
+	}
+
+	requested := time.Now().UTC()
+	w = deleteUser(router, first, deleted.Uuid, "1.1")
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("case: Delete: expected status %d but got %d: %s", http.StatusAccepted, w.Code, w.Body)
+	}
+	deletion := &AccountDeletionResponse{}
+	if errU := json.Unmarshal(w.Body.Bytes(), deletion); errU != nil {
+		t.Fatalf("case: Delete: unable to decode response: %s", errU)
+	}
+	if restoreBefore := requested.Add(cx.deletion.GracePeriod); deletion.RestoreBefore.Before(restoreBefore) ||
+		deletion.RestoreBefore.After(restoreBefore.Add(time.Minute)) {
+		t.Errorf("case: Delete: expected restoreBefore to be the grace period after the request, %s, but got %s\n"+
+			"HINT: the client should be told when the account can no longer be restored", restoreBefore,
+			deletion.RestoreBefore)
+	}
+	if deletion.SessionsRevoked != 2 {
+		t.Errorf("case: Delete: expected sessionsRevoked to be 2 but got %d\n"+
+			"HINT: the session deleting the account and every other session of the user should be counted",
+			deletion.SessionsRevoked)
+	}
+	if sessionExists(t, cx, first) || sessionExists(t, cx, second) {
+		t.Errorf("case: Delete: expected every session of the user to be ended\n" +
+			"HINT: a deleted account should only be usable again by signing in, which restores it")
+	}
+	if !sessionExists(t, cx, otherSession) {
+		t.Errorf("case: Delete: expected the session of another user to be left open")
+	}
+	if counts := countEvents(t, auditStore, deleted.Uuid); counts[audit.EventAccountDeleted] != 1 ||
+		counts[audit.EventSessionRevoked] != 2 {
+		t.Errorf("case: Delete: expected the deletion and each session revoked to be audited, but got %v", counts)
+	}
+
+	restored := signIn(router, deleted.Username, testPassword)
+	if restored.Code != http.StatusCreated {
+		t.Errorf("case: Restore: expected status %d signing in within the grace period, but got %d\n"+
+			"HINT: signing in to an account pending deletion should restore it", http.StatusCreated, restored.Code)
+	}
+	pending, errRUDR := cx.userStore.ReadUsersDeletionRequested(context.Background(), time.Now().Add(time.Hour), 10)
+	if errRUDR != nil || len(pending) != 0 {
+		t.Errorf("case: Restore: expected no account to be pending deletion, but got %v, error: %v\n"+
+			"HINT: a restored account should not be purged", pending, errRUDR)
+	}
+	if counts := countEvents(t, auditStore, deleted.Uuid); counts[audit.EventAccountRestored] != 1 {
+		t.Errorf("case: Restore: expected the restore to be audited, but got %v", counts)
+	}
+}
+
+func TestUsersSpecificHandlerV1Delete_ApiVersion(t *testing.T) {
+	cases := []struct {
+		name       string
+		hint       string
+		apiVersion string
+	}{
+		{
+			name:       "Version 1.0",
+			hint:       "Clients of version 1.0 expect deletion to respond as it always has",
+			apiVersion: "1.0",
+		},
+		{
+			name: "Not Requested",
+			hint: "Clients which do not request a version were written against 1.0, so should be served it",
+		},
+	}
+	for _, c := range cases {
+		cx, _, router := newTestAuthGateway(t)
+		cx.apiVersions = []*ApiVersion{{Version: newTestSemVer(t, "1.0.0")}, {Version: newTestSemVer(t, "1.1.0")}}
+		deleted := newTestUser(t, cx, "deleted")
+
+		w := deleteUser(router, signInSession(t, router, deleted.Username), deleted.Uuid, c.apiVersion)
+		if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "restoreBefore") {
+			t.Errorf("case: %s: expected status %d with a text body, but got %d: %s\nHINT: %s", c.name, http.StatusOK,
+				w.Code, w.Body, c.hint)
+		}
+	}
+}
+
+func TestSessionsHandlerV1Post_GracePassed(t *testing.T) {
+	cx, auditStore, router := newTestAuthGateway(t)
+	deleted := newTestUser(t, cx, "deleted")
+	requested := time.Now().UTC().Add(-cx.deletion.GracePeriod - time.Minute)
+	if errUUDR := cx.userStore.UpdateUserDeletionRequested(context.Background(), deleted.Uuid,
+		requested); errUUDR != nil {
+		t.Fatalf("unexpected error setting up test: %s", errUUDR)
+	}
+
+	w := signIn(router, deleted.Username, testPassword)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("case: Grace Passed: expected status %d but got %d\n"+
+			"HINT: an account past its grace period is waiting to be purged, so can not be signed in to",
+			http.StatusForbidden, w.Code)
+	}
+	if len(w.Header().Get(session.HeaderAuthorization)) != 0 {
+		t.Errorf("case: Grace Passed: expected no session to be begun")
+	}
+	pending, errRUDR := cx.userStore.ReadUsersDeletionRequested(context.Background(), time.Now(), 10)
+	if errRUDR != nil || len(pending) != 1 {
+		t.Errorf("case: Grace Passed: expected the account to still be pending deletion, but got %v, error: %v\n"+
+			"HINT: signing in after the grace period should not restore the account", pending, errRUDR)
+	}
+	if counts := countEvents(t, auditStore, deleted.Uuid); counts[audit.EventSignInFailed] != 1 ||
+		counts[audit.EventAccountRestored] != 0 {
+		t.Errorf("case: Grace Passed: expected a failed sign in to be audited, but got %v", counts)
+	}
+}
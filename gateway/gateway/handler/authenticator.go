@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/session"
 
@@ -49,6 +50,19 @@ func (cx *Context) NewAuthenticator(handler http.Handler) http.Handler {
 // and passing the authenticated user's profile in a new http.Request object
 func (au *Authenticator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	sesSt, errGST := au.cx.getSessionStateFromRequest(r)
+	if _, ok := storeErrorStatus(errGST); ok {
+		// The session may be valid, so the request must not continue as if there were none
+		retErr := &Error{
+			ClientError: false,
+			ServerError: true,
+			Message:     errUnexpected.Error(),
+			Context:     r.Method + " path:" + r.URL.Path,
+			Code:        CodeUnexpected,
+		}
+		au.cx.handleErrorJson(w, r, errGST, "unable to get session from store", retErr,
+			http.StatusInternalServerError)
+		return
+	}
 	if errGST != nil {
 		var authErrorReason string = ""
 		var wasError bool = false
@@ -60,7 +74,7 @@ func (au *Authenticator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 				authErrorReason = WWWAuthenticateErrorInvalidToken + ",\n" + "error_description=\"token extracted not a valid session token\""
 				wasError = true
 			}
-			au.cx.logError(errGST, "issue getting session from request", "",
+			au.cx.logError(r, errGST, "issue getting session from request", "",
 				http.StatusInternalServerError)
 		}
 		cxWithAuthError := context.WithValue(r.Context(), authSessionErrorKey, wasError)
@@ -73,6 +87,12 @@ func (au *Authenticator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	au.cx.refreshSessionUser(r, sesSt)
+
+	if info := getRequestInfo(r); info != nil && sesSt.Authenticated && sesSt.User != nil {
+		info.userUuid = sesSt.User.Uuid.String()
+	}
+
 	//create a new request context containing the authenticated user
 	cxWithSessionActive := context.WithValue(r.Context(), authSessionActiveKey, true)
 	cxWithSessionState := context.WithValue(cxWithSessionActive, authSessionStateKey, sesSt)
@@ -106,7 +126,7 @@ func (ea *EnsureAuth) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			ServerError: false,
 			Message:     errUnauthorized.Error(),
 			Context:     fmt.Sprintf("method=%s path=%s", r.Method, r.URL.Path),
-			Code:        0,
+			Code:        CodeUnauthenticated,
 		}
 		wwwHeaderValue := WWWAuthenticateBearerRealm
 		wwwErrVal := getSessionErrorKeyValueFromContext(r)
@@ -140,7 +160,7 @@ func (ea *EnsureSession) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			ServerError: false,
 			Message:     errUserNotInSession.Error(),
 			Context:     fmt.Sprintf("%s path:%s", r.Method, r.URL.Path),
-			Code:        0,
+			Code:        CodeNotInSession,
 		}
 		ea.cx.handleErrorJson(w, r, nil, "request to access resource that requires an active session",
 			retErr, http.StatusForbidden)
@@ -223,3 +243,26 @@ func getSessionErrorKeyValueFromContext(r *http.Request) string {
 
 	}
 }
+
+// refreshSessionUser reads the user of an authenticated session again if they were invalidated since they were
+// read, such as when another gateway changed them, and saves the session state so they are only read again once
+// they next change. If the user can not be read, the session keeps the user it has.
+func (cx *Context) refreshSessionUser(r *http.Request, sesSt *SessionState) {
+	if cx.userInvalidations == nil || !sesSt.Authenticated || sesSt.User == nil ||
+		!cx.userInvalidations.InvalidatedSince(sesSt.User.Uuid, sesSt.UserRead) {
+		return
+	}
+	read := time.Now()
+	usr, errRUI := cx.userStore.ReadUserInfo(r.Context(), sesSt.User.Uuid)
+	if errRUI != nil {
+		if errRUI != user.ErrUserNotFound {
+			cx.logError(r, errRUI, "unable to read invalidated user of session", "", 0)
+		}
+		return
+	}
+	sesSt.User = usr
+	sesSt.UserRead = read
+	if errS := cx.sessionStore.Save(r.Context(), sesSt.SessionID, sesSt.SessionUuid, sesSt); errS != nil {
+		cx.logError(r, errS, "unable to save session state with invalidated user read again", "", 0)
+	}
+}
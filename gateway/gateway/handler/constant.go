@@ -16,22 +16,44 @@ const (
 	HeaderPragma          = "Pragma"
 	HeaderContentLength   = "Content-Length"
 	HeaderWWWAuthenticate = "WWW-Authenticate"
+	HeaderAccept          = "Accept"
+	HeaderConnection      = "Connection"
+	HeaderUpgrade         = "Upgrade"
+	HeaderRetryAfter      = "Retry-After"
+	HeaderVary            = "Vary"
+	// HeaderDeprecation marks a response as served by a deprecated version of the api, RFC 9745.
+	HeaderDeprecation = "Deprecation"
+	// HeaderSunset gives the time the version of the api which served a response stops being served, RFC 8594.
+	HeaderSunset = "Sunset"
+	// HeaderContentDisposition marks a response as an attachment to save, such as an exported archive.
+	HeaderContentDisposition = "Content-Disposition"
 	// Custom HTTP Header Names
 	HeaderPerceptiaUserUuid    = "Perceptia-User-Uuid"
 	HeaderPerceptiaSessionUuid = "Perceptia-Session-Uuid"
 	HeaderPerceptiaApiVersion  = "Perceptia-Api-Version"
+	HeaderRequestId            = "X-Request-Id"
 )
 
 const (
 	// HTTP Content-Type Header Values.
 	ContentTypeJSON      = "application/json"
 	ContentTypeTextPlain = "text/plain"
+	ContentTypeZip       = "application/zip"
+	// ContentTypeProblemJSON is the content type of an RFC 7807 problem details error response.
+	ContentTypeProblemJSON = "application/problem+json"
+	// ContentTypeEventStream is the content type of a Server-Sent Events stream.
+	ContentTypeEventStream = "text/event-stream"
+	// ContentTypeYAML is the content type the OpenAPI spec of the gateway api is served as.
+	ContentTypeYAML = "application/yaml"
 	// HTTP Access-Control Header Values.
 	ACAllowOriginAll = "*"
 	ACAllowMethods   = "GET, PUT, POST, PATCH, DELETE"
-	ACAllowHeaders   = HeaderContentType + ", " + HeaderAuthorization + ", " + HeaderPerceptiaApiVersion
-	ACExposeHeaders  = HeaderAuthorization + ", " + HeaderPerceptiaApiVersion + ", " + HeaderLocation + ", " +
-		HeaderCacheControl + ", " + HeaderPragma + ", " + HeaderContentLength + ", " + HeaderWWWAuthenticate
+	ACAllowHeaders   = HeaderContentType + ", " + HeaderAuthorization + ", " + HeaderPerceptiaApiVersion + ", " +
+		HeaderRequestId
+	ACExposeHeaders = HeaderAuthorization + ", " + HeaderPerceptiaApiVersion + ", " + HeaderLocation + ", " +
+		HeaderCacheControl + ", " + HeaderPragma + ", " + HeaderContentLength + ", " + HeaderWWWAuthenticate + ", " +
+		HeaderRequestId + ", " + HeaderRetryAfter + ", " + HeaderContentDisposition + ", " + HeaderDeprecation + ", " +
+		HeaderSunset
 	ACMaxAge = "600"
 	// HTTP Cache and Pragma Header Values
 	CacheControlNoStore = "no-store"
@@ -45,6 +67,10 @@ const (
 	WWWAuthenticateErrorInsufficientScope = "error=\"insufficient_scope\""
 )
 
+// StatusClientClosedRequest is the non-standard status, first used by nginx, of a request which was not completed
+// because the client closed the connection. It is only recorded, as the client is not there to receive it.
+const StatusClientClosedRequest = 499
+
 // Query Parameters
 const (
 	QpApiVersion = "apiVersion"
@@ -53,6 +79,16 @@ const (
 // URL path values.
 const SpecificSessionHandlerDeleteCurrentSessionAlias = "this"
 
+// ColExports is the collection of the gateway which archives of exported personal data are downloaded from.
+const ColExports = "exports"
+
+// Query parameters of the download link of an export.
+const (
+	QpExportExpires   = "expires"
+	QpExportSignature = "signature"
+	QpExportFormat    = "format"
+)
+
 // Handler Error Constants.
 var (
 	errUnexpected = errors.New("an unexpected error has occurred, try again if request did not complete")
@@ -72,6 +108,23 @@ var (
 	errUnauthorized        = errors.New("user not authorized, please start a new session")
 	errContentTypeNotJson  = errors.New("expected content type was json but application/json content type not set")
 	errDecodingJson        = errors.New("issue decoding request body into json object")
+
+	errServiceUnavailable = errors.New("service is currently unavailable, please try again later")
+	errServiceTimeout     = errors.New("service did not respond in time, please try again later")
+	errServiceUnreachable = errors.New("unable to reach service, please try again later")
+	errTooManyStreams     = errors.New("too many open streams to service, please close one and try again")
+
+	errStoreUnavailable = errors.New("unable to complete the request in time, please try again later")
+	errRequestCanceled  = errors.New("request canceled by the client")
+
+	errCacheNotEnabled   = errors.New("response cache is not enabled")
+	errInvalidPathPrefix = errors.New("path prefix must start with /")
+
+	errExportFailed        = errors.New("unable to export your data, please request the export again")
+	errInvalidExportLink   = errors.New("download link is not valid, please request the export again")
+	errExportLinkExpired   = errors.New("download link has expired, please request the export again")
+	errExportNotFound      = errors.New("export not found, it may have expired, please request the export again")
+	errUnknownExportFormat = errors.New("format must be json or zip")
 )
 
 // Gmux request variables
@@ -79,4 +132,5 @@ const (
 	ReqVarMajorVersion = "majorVersion"
 	ReqVarUserUuid     = "userUuid"
 	ReqVarSession      = "sessionVar"
+	ReqVarExportUuid   = "exportUuid"
 )
@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/utility"
 
@@ -13,44 +15,76 @@ import (
 
 	kitlog "github.com/go-kit/kit/log"
 
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/audit"
 	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/session"
 	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/user"
 )
 
 // Context represents the shared resources amongst all http.Handler functions that receive this struct.
 type Context struct {
-	sessionSigningKey        string
-	sessionStore             session.Store
-	userStore                user.Store
-	logger                   kitlog.Logger
-	gatewayVersion           *utility.SemVer
-	gatewayVersionsSupported map[int]*utility.SemVer
-	environment              string
-	apiInfo                  *ApiInfo
+	sessionSigningKey string
+	sessionStore      session.Store
+	userStore         user.Store
+	logger            kitlog.Logger
+	// gatewayVersion is the latest version of the api served.
+	gatewayVersion *utility.SemVer
+	// apiVersions are the versions of the api served, oldest first.
+	apiVersions       []*ApiVersion
+	environment       string
+	apiInfo           *ApiInfo
+	metrics           *Metrics
+	auditLog          *audit.Log
+	userInvalidations *user.Invalidations
+	deletion          AccountDeletion
+	streams           *streamTracker
 }
 
 // NewContext creates a new Context, initialized using the provided handler context values.
+// If metrics is nil, no metrics are recorded. If auditLog is nil, no audit events are recorded.
+// If userInvalidations is nil, the user kept in session state is never read again once the session starts.
+// apiVersions are the versions of the api served, each minor version of which is negotiated by clients.
 // Returns a pointer to the created Context.
 func NewContext(sessionStore session.Store, userStore user.Store,
-	sessionSigningKey string, gatewayVersion *utility.SemVer,
-	gatewayVersionsSupported map[int]*utility.SemVer, logger kitlog.Logger,
-	apiInfo *ApiInfo) *Context {
-	if sessionStore == nil || userStore == nil || len(sessionSigningKey) <= 0 {
+	sessionSigningKey string, apiVersions []*ApiVersion, logger kitlog.Logger, environment string,
+	apiInfo *ApiInfo, metrics *Metrics, auditLog *audit.Log, userInvalidations *user.Invalidations,
+	deletion AccountDeletion) *Context {
+	if sessionStore == nil || userStore == nil || len(sessionSigningKey) <= 0 || deletion.Sessions == nil ||
+		len(apiVersions) == 0 {
 		panic("all parameters must not be nil or empty")
 	}
-	environment, _ := utility.DefaultEnv("GATEWAY_ENVIRONMENT", "development")
+	if metrics == nil {
+		metrics = NewDiscardMetrics()
+	}
+	apiVersions = append([]*ApiVersion(nil), apiVersions...)
+	sort.Slice(apiVersions, func(i, j int) bool {
+		return apiVersions[i].Version.Compare(apiVersions[j].Version) < 0
+	})
 	return &Context{sessionSigningKey: sessionSigningKey, sessionStore: sessionStore,
-		userStore: userStore, logger: logger, gatewayVersion: gatewayVersion,
-		gatewayVersionsSupported: gatewayVersionsSupported, environment: environment, apiInfo: apiInfo}
+		userStore: userStore, logger: logger, gatewayVersion: apiVersions[len(apiVersions)-1].Version,
+		apiVersions: apiVersions, environment: environment, apiInfo: apiInfo,
+		metrics: metrics, auditLog: auditLog, userInvalidations: userInvalidations, deletion: deletion,
+		streams: newStreamTracker()}
+}
+
+// AccountDeletion describes how the accounts users delete are deleted. A deleted account is pending deletion,
+// and restored if the user signs in within the grace period, after which it is purged.
+type AccountDeletion struct {
+	// Sessions is the session store, which can list every session, so each session of a user is ended when they
+	// delete their account.
+	Sessions session.Lister
+	// GracePeriod is the time after a user deletes their account during which signing in again restores it.
+	GracePeriod time.Duration
 }
 
+// Error is the v1 json body of an error response, sent to clients which prefer application/json.
+// Other clients are sent the error as a Problem.
 type Error struct {
-	Reference   string `json:"reference"`
-	ServerError bool   `json:"serverError"`
-	ClientError bool   `json:"clientError"`
-	Message     string `json:"message"`
-	Context     string `json:"context"`
-	Code        int    `json:"Code"`
+	Reference   string    `json:"reference"`
+	ServerError bool      `json:"serverError"`
+	ClientError bool      `json:"clientError"`
+	Message     string    `json:"message"`
+	Context     string    `json:"context"`
+	Code        ErrorCode `json:"Code"`
 }
 
 type ApiInfo struct {
@@ -68,7 +102,7 @@ func (cx *Context) ensureJSONHeader(w http.ResponseWriter, r *http.Request) bool
 			ServerError: false,
 			Message:     errContentTypeNotJson.Error(),
 			Context:     r.Method + " path:" + r.URL.Path,
-			Code:        0,
+			Code:        CodeContentTypeNotJson,
 		}
 		cx.handleErrorJson(w, r, nil, "request Content-Type header was not application/json",
 			retErr, http.StatusUnsupportedMediaType)
@@ -83,7 +117,7 @@ func (cx *Context) ensureJSONHeader(w http.ResponseWriter, r *http.Request) bool
 func (cx *Context) handleError(w http.ResponseWriter, r *http.Request, errorToLog error, logContext,
 	clientErrorMessage string,
 	statusCode int) {
-	logReference := cx.logError(errorToLog, logContext, clientErrorMessage, statusCode)
+	logReference := cx.logError(r, errorToLog, logContext, clientErrorMessage, statusCode)
 
 	// Only send error to client if clientErrorMessage provided.
 	if len(clientErrorMessage) != 0 {
@@ -97,27 +131,69 @@ func (cx *Context) handleError(w http.ResponseWriter, r *http.Request, errorToLo
 }*/
 
 // handleError will handle logging error and respond to client with correct message and status code.
-// If len(clientErrorMessage) == 0 will only log error and will not send error to client.
+// If clientErrorJson is nil will only log error and will not send error to client.
 // If you only need to log an error without sending error to client you should use logError instead.
+// If errorToLog is a store timeout or cancellation, the response is 503 or 499 instead of statusCode,
+// so a slow store is not reported as a bug in the gateway.
+// The error is sent as a Problem, or as the v1 Error if the client prefers application/json,
+// or negotiated a version of the api older than apiVersionProblem.
 func (cx *Context) handleErrorJson(w http.ResponseWriter, r *http.Request, errorToLog error, logContext string,
 	clientErrorJson *Error,
 	statusCode int) {
-	logReference := cx.logError(errorToLog, logContext, clientErrorJson.Message, statusCode)
-	clientErrorJson.Reference = logReference
-	// Only send error to client if clientErrorMessage provided.
-	if clientErrorJson != nil {
-		_, _ = cx.respondEncode(w, clientErrorJson, statusCode)
+	// Only send error to client if clientErrorJson provided.
+	if clientErrorJson == nil {
+		_ = cx.logError(r, errorToLog, logContext, "", statusCode)
+		return
+	}
+	if storeStatus, ok := storeErrorStatus(errorToLog); ok {
+		statusCode = storeStatus
+		clientErrorJson = &Error{
+			ClientError: false,
+			ServerError: true,
+			Message:     errStoreUnavailable.Error(),
+			Context:     clientErrorJson.Context,
+			Code:        CodeStoreUnavailable,
+		}
+		if storeStatus == StatusClientClosedRequest {
+			clientErrorJson.Message = errRequestCanceled.Error()
+			clientErrorJson.Code = CodeRequestCanceled
+		}
+	}
+	clientErrorJson.Reference = cx.logError(r, errorToLog, logContext, clientErrorJson.Message, statusCode)
+	w.Header().Add(HeaderVary, HeaderAccept)
+	if cx.servedApiVersionAtLeast(r, apiVersionProblem) && acceptsProblem(r) {
+		_, _ = cx.respondProblem(w, r, newProblem(r, clientErrorJson, statusCode))
+	} else {
+		_, _ = cx.respondEncode(w, r, clientErrorJson, statusCode)
 	}
 	return
 }
 
+// storeErrorStatus returns the status of a request which failed because a call to the user or session store
+// did not complete in time, 503 Service Unavailable, or because the request was canceled, 499.
+// Returns false if err is any other error, such as nil.
+func storeErrorStatus(err error) (int, bool) {
+	switch err {
+	case user.ErrTimeout, session.ErrTimeout:
+		return http.StatusServiceUnavailable, true
+	case user.ErrCanceled, session.ErrCanceled:
+		return StatusClientClosedRequest, true
+	}
+	return 0, false
+}
+
 // logError will log an error provided to it, any context including message sent to client.
 // Will return a string containing the log reference to be used by the caller to associate further logging or
 // response to client with this logged error.
+// The log reference is the id of the request r, so the error can be found alongside the access log entry
+// for the request. If r has no id, a new reference is generated.
 // statusCode should be the expected status code to be sent to the client with the clientErrorMessage.
-func (cx *Context) logError(errorToLog error, logContext, clientErrorMessage string,
+func (cx *Context) logError(r *http.Request, errorToLog error, logContext, clientErrorMessage string,
 	statusCode int) string {
-	logReference := uuid.NewV4().String()
+	logReference := getRequestId(r)
+	if len(logReference) == 0 {
+		logReference = uuid.NewV4().String()
+	}
 	_ = cx.logger.Log("logReference", logReference,
 		"context", logContext, "error", errorToLog,
 		"messageToClient", clientErrorMessage,
@@ -138,7 +214,7 @@ func (cx *Context) getUserFromContext(w http.ResponseWriter, r *http.Request) (*
 			ServerError: true,
 			Message:     errUnexpected.Error(),
 			Context:     r.Method + " path:" + r.URL.Path,
-			Code:        0,
+			Code:        CodeUnexpected,
 		}
 		cx.handleErrorJson(w, r, errGUC, "issue getting user from request context", retErr, http.StatusInternalServerError)
 		return nil, false
@@ -158,7 +234,7 @@ func (cx *Context) getSessionStateFromContext(w http.ResponseWriter, r *http.Req
 			ServerError: true,
 			Message:     errUnexpected.Error(),
 			Context:     r.Method + " path:" + r.URL.Path,
-			Code:        0,
+			Code:        CodeUnexpected,
 		}
 		cx.handleErrorJson(w, r, errGST, "issue getting session state from context", retErr, http.StatusInternalServerError)
 		return nil, false
@@ -174,7 +250,7 @@ func (cx *Context) decodeJSON(w http.ResponseWriter, r *http.Request, obj interf
 			ServerError: false,
 			Message:     errDecodingJson.Error(),
 			Context:     r.Method + " path:" + r.URL.Path,
-			Code:        0,
+			Code:        CodeInvalidJson,
 		}
 		cx.handleErrorJson(w, r, err, fmt.Sprintf("error decoding %s from request body",
 			desc), retErr, http.StatusBadRequest)
@@ -189,7 +265,7 @@ func (cx *Context) handleMethodNotAllowed(w http.ResponseWriter, r *http.Request
 		ServerError: false,
 		Message:     errMethodNotAllowed.Error(),
 		Context:     r.Method + " path:" + r.URL.Path,
-		Code:        0,
+		Code:        CodeMethodNotAllowed,
 	}
 	cx.handleErrorJson(w, r, nil, fmt.Sprintf("the method (%s) is not allowed", r.Method), retErr, http.StatusMethodNotAllowed)
 }
@@ -200,7 +276,7 @@ func (cx *Context) handleMajorVersionNotSupported(w http.ResponseWriter, r *http
 		ServerError: false,
 		Message:     errMajorVersionNotSupported.Error(),
 		Context:     r.Method + " path:" + r.URL.Path,
-		Code:        0,
+		Code:        CodeApiVersionNotSupported,
 	}
 	cx.handleErrorJson(w, r, nil, fmt.Sprintf("major version of API not supported; requested=%s supported=%s", requested, supported), retErr, http.StatusNotFound)
 }
@@ -215,7 +291,7 @@ func (cx *Context) getUserFromRequest(r *http.Request) (*user.User, error) {
 		return nil, errTK
 	}
 	authSess := &SessionState{}
-	errAuth := cx.sessionStore.Get(sessToken, authSess)
+	errAuth := cx.sessionStore.Get(r.Context(), sessToken, authSess)
 	if errAuth != nil {
 		return nil, errAuth
 	}
@@ -228,7 +304,7 @@ func (cx *Context) getSessionUuidFromRequest(r *http.Request) (*uuid.UUID, error
 		return nil, errTK
 	}
 	authSess := &SessionState{}
-	errAuth := cx.sessionStore.Get(sessToken, authSess)
+	errAuth := cx.sessionStore.Get(r.Context(), sessToken, authSess)
 	if errAuth != nil {
 		return nil, errAuth
 	}
@@ -245,7 +321,7 @@ func (cx *Context) getSessionStateFromRequest(r *http.Request) (*SessionState, e
 		return nil, errTK
 	}
 	authSess := &SessionState{}
-	errAuth := cx.sessionStore.Get(sessToken, authSess)
+	errAuth := cx.sessionStore.Get(r.Context(), sessToken, authSess)
 	if errAuth != nil {
 		return nil, errAuth
 	}
@@ -257,36 +333,51 @@ func (cx *Context) getSessionStateFromRequest(r *http.Request) (*SessionState, e
 // For a text item, item should be of type string. All other types of item will be encoded as json.
 // Respond will handle logging any errors that occur. respond will return an error if any errors occur,
 // and a string that may contain the log reference.
-func (cx *Context) respond(w http.ResponseWriter, item interface{}, statusCode int) (error, string) {
+func (cx *Context) respond(w http.ResponseWriter, r *http.Request, item interface{}, statusCode int) (error, string) {
 	switch item.(type) {
 	case string:
-		return cx.respondText(w, item.(string), statusCode)
+		return cx.respondText(w, r, item.(string), statusCode)
 	default:
-		return cx.respondEncode(w, item, statusCode)
+		return cx.respondEncode(w, r, item, statusCode)
 	}
 }
 
 // respondEncode will encode the provided object to the provided response stream.
 // If an error occurs will log that error and return the error that occurred, and the logging reference string.
-func (cx *Context) respondEncode(w http.ResponseWriter, objToEncode interface{}, statusCode int) (error,
-	string) {
+func (cx *Context) respondEncode(w http.ResponseWriter, r *http.Request, objToEncode interface{},
+	statusCode int) (error, string) {
 	w.Header().Set(HeaderContentType, ContentTypeJSON)
 	w.WriteHeader(statusCode)
 	err := json.NewEncoder(w).Encode(objToEncode)
 	if err != nil {
-		logReference := cx.logError(err, fmt.Sprintf("error encoding object of type: %T, object:%v", objToEncode,
+		logReference := cx.logError(r, err, fmt.Sprintf("error encoding object of type: %T, object:%v", objToEncode,
 			objToEncode), "", statusCode)
 		return err, logReference
 	}
 	return nil, ""
 }
 
-func (cx *Context) respondText(w http.ResponseWriter, textToSend string, statusCode int) (error, string) {
+// respondProblem will encode the problem to the provided response stream as application/problem+json.
+// If an error occurs will log that error and return the error that occurred, and the logging reference string.
+func (cx *Context) respondProblem(w http.ResponseWriter, r *http.Request, problem *Problem) (error, string) {
+	w.Header().Set(HeaderContentType, ContentTypeProblemJSON)
+	w.WriteHeader(problem.Status)
+	err := json.NewEncoder(w).Encode(problem)
+	if err != nil {
+		logReference := cx.logError(r, err, fmt.Sprintf("error encoding problem: %v", problem), "",
+			problem.Status)
+		return err, logReference
+	}
+	return nil, ""
+}
+
+func (cx *Context) respondText(w http.ResponseWriter, r *http.Request, textToSend string,
+	statusCode int) (error, string) {
 	w.Header().Set(HeaderContentType, ContentTypeTextPlain)
 	w.WriteHeader(statusCode)
 	_, err := io.WriteString(w, textToSend)
 	if err != nil {
-		logReference := cx.logError(err, fmt.Sprintf("error writing textToSend to response stream"), "",
+		logReference := cx.logError(r, err, fmt.Sprintf("error writing textToSend to response stream"), "",
 			statusCode)
 		return err, logReference
 	}
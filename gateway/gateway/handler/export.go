@@ -0,0 +1,261 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/mux"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/audit"
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/export"
+)
+
+// exportRetryAfter is the number of seconds a client should wait before checking on a pending export again.
+const exportRetryAfter = "5"
+
+// ExportHandlerContext holds the resources used by the handlers which export the personal data of users.
+type ExportHandlerContext struct {
+	cx       *Context
+	exporter *export.Exporter
+	store    export.Store
+	signer   *export.Signer
+	// linkTtl is the time each download link can be used for once it is given to the user.
+	linkTtl time.Duration
+}
+
+// NewExportHandlerContext creates a new ExportHandlerContext, requesting exports from exporter, which saves their
+// archives to store, and giving download links signed by signer which expire after linkTtl.
+func (cx *Context) NewExportHandlerContext(exporter *export.Exporter, store export.Store, signer *export.Signer,
+	linkTtl time.Duration) *ExportHandlerContext {
+	if exporter == nil || store == nil || signer == nil {
+		panic("no exporter, store, or signer provided")
+	}
+	return &ExportHandlerContext{cx: cx, exporter: exporter, store: store, signer: signer, linkTtl: linkTtl}
+}
+
+// ExportResponse is the body of the response to a request to export the personal data of a user.
+type ExportResponse struct {
+	Uuid      uuid.UUID     `json:"uuid"`
+	Status    export.Status `json:"status"`
+	Requested time.Time     `json:"requested"`
+	// DownloadUrl is the signed link the archive is downloaded from once it is ready, as json, or zipped if
+	// the "format" query parameter is added with the value "zip". No session is needed to use it before Expires.
+	DownloadUrl string     `json:"downloadUrl,omitempty"`
+	Expires     *time.Time `json:"expires,omitempty"`
+}
+
+// UsersExportHandler handles requests to export the personal data held about a user, such as their account,
+// emails, profile, sharing settings, sessions, and audit events.
+//
+// Method GET: starts generating an archive of the personal data of the user, unless one is already being
+// generated or is ready. Responds 200 with a short-lived download link once the archive is ready, or 202 while
+// it is being generated, in which case the request should be repeated after the time in the Retry-After header.
+// Users may only export their own data.
+func (eh *ExportHandlerContext) UsersExportHandler(w http.ResponseWriter, r *http.Request) {
+	reqVars := mux.Vars(r)
+	if ver, ok := reqVars[ReqVarMajorVersion]; ok && ver != "v1" {
+		eh.cx.handleMajorVersionNotSupported(w, r, "v1", ver)
+		return
+	}
+	if r.Method != http.MethodGet {
+		eh.cx.handleMethodNotAllowed(w, r)
+		return
+	}
+	userCx, ok := eh.cx.getUserFromContext(w, r)
+	if !ok {
+		// Ends method execution if user was not found in the request context.
+		return
+	}
+	reqUserUuid, errUFS := uuid.FromString(reqVars[ReqVarUserUuid])
+	if errUFS != nil {
+		retErr := &Error{
+			ClientError: false,
+			ServerError: true,
+			Message:     errUnexpected.Error(),
+			Context:     r.Method + " path:" + r.URL.Path,
+			Code:        CodeUnexpected,
+		}
+		eh.cx.handleErrorJson(w, r, errUFS, "issue converting string to valid uuid", retErr,
+			http.StatusInternalServerError)
+		return
+	}
+	if !uuid.Equal(userCx.Uuid, reqUserUuid) {
+		retErr := &Error{
+			ClientError: true,
+			ServerError: false,
+			Message:     errActionNotAuthorized.Error(),
+			Context:     r.Method + " path:" + r.URL.Path,
+			Code:        CodeActionNotAuthorized,
+		}
+		eh.cx.handleErrorJson(w, r, nil, "user attempted to export the data of another user", retErr,
+			http.StatusForbidden)
+		return
+	}
+
+	job, started, errR := eh.exporter.Request(r.Context(), reqUserUuid)
+	if errR != nil {
+		retErr := &Error{
+			ClientError: false,
+			ServerError: true,
+			Message:     errUnexpected.Error(),
+			Context:     r.Method + " path:" + r.URL.Path,
+			Code:        CodeUnexpected,
+		}
+		eh.cx.handleErrorJson(w, r, errR, "issue requesting export of user data", retErr,
+			http.StatusInternalServerError)
+		return
+	}
+	if started {
+		exported := &audit.Event{Type: audit.EventDataExported, UserUuid: reqUserUuid,
+			Detail: "export " + job.Uuid.String()}
+		if sesSt, errGSS := GetSessionStateFromContext(r); errGSS == nil {
+			exported.SessionUuid = sesSt.SessionUuid
+		}
+		eh.cx.recordAudit(r, exported)
+	}
+
+	w.Header().Add(HeaderCacheControl, CacheControlNoStore)
+	exportResp := &ExportResponse{Uuid: job.Uuid, Status: job.Status, Requested: job.Requested}
+	switch job.Status {
+	case export.StatusReady:
+		expires := time.Now().Add(eh.linkTtl).UTC().Truncate(time.Second)
+		exportResp.DownloadUrl = eh.downloadUrl(reqVars[ReqVarMajorVersion], job.Uuid, expires)
+		exportResp.Expires = &expires
+		_, _ = eh.cx.respondEncode(w, r, exportResp, http.StatusOK)
+	case export.StatusPending:
+		w.Header().Set(HeaderRetryAfter, exportRetryAfter)
+		_, _ = eh.cx.respondEncode(w, r, exportResp, http.StatusAccepted)
+	default:
+		retErr := &Error{
+			ClientError: false,
+			ServerError: true,
+			Message:     errExportFailed.Error(),
+			Context:     r.Method + " path:" + r.URL.Path,
+			Code:        CodeExportFailed,
+		}
+		eh.cx.handleErrorJson(w, r, nil, fmt.Sprintf("export failed: export=%s", job.Uuid), retErr,
+			http.StatusInternalServerError)
+	}
+}
+
+// downloadUrl returns the signed link to download the archive of the job, which expires at expires.
+func (eh *ExportHandlerContext) downloadUrl(majorVersion string, jobUuid uuid.UUID, expires time.Time) string {
+	query := url.Values{}
+	query.Set(QpExportExpires, fmt.Sprint(expires.Unix()))
+	query.Set(QpExportSignature, eh.signer.Sign(jobUuid, expires))
+	urlLoc := url.URL{}
+	urlLoc.Host = eh.cx.apiInfo.Host + ":" + eh.cx.apiInfo.Port
+	urlLoc.Scheme = eh.cx.apiInfo.Scheme
+	urlLoc.Path = fmt.Sprintf("/api/%s/gateway/%s/%s", majorVersion, ColExports, jobUuid)
+	urlLoc.RawQuery = query.Encode()
+	return urlLoc.String()
+}
+
+// ExportsDownloadHandler handles requests to download the archive of an export, through the signed link given
+// once the archive is ready. The link authorizes the download, so no session is needed.
+//
+// Method GET: responds with the archive as a json attachment, or as a zip attachment if the "format" query
+// parameter is "zip".
+func (eh *ExportHandlerContext) ExportsDownloadHandler(w http.ResponseWriter, r *http.Request) {
+	reqVars := mux.Vars(r)
+	if ver, ok := reqVars[ReqVarMajorVersion]; ok && ver != "v1" {
+		eh.cx.handleMajorVersionNotSupported(w, r, "v1", ver)
+		return
+	}
+	if r.Method != http.MethodGet {
+		eh.cx.handleMethodNotAllowed(w, r)
+		return
+	}
+	jobUuid, errUFS := uuid.FromString(reqVars[ReqVarExportUuid])
+	if errUFS != nil {
+		retErr := &Error{
+			ClientError: false,
+			ServerError: true,
+			Message:     errUnexpected.Error(),
+			Context:     r.Method + " path:" + r.URL.Path,
+			Code:        CodeUnexpected,
+		}
+		eh.cx.handleErrorJson(w, r, errUFS, "issue converting string to valid uuid", retErr,
+			http.StatusInternalServerError)
+		return
+	}
+	query := r.URL.Query()
+	format := query.Get(QpExportFormat)
+	if len(format) == 0 {
+		format = export.FormatJSON
+	}
+	if format != export.FormatJSON && format != export.FormatZip {
+		retErr := &Error{
+			ClientError: true,
+			ServerError: false,
+			Message:     errUnknownExportFormat.Error(),
+			Context:     r.Method + " path:" + r.URL.Path,
+			Code:        CodeUnknownExportFormat,
+		}
+		eh.cx.handleErrorJson(w, r, nil, "unknown export format: "+format, retErr, http.StatusBadRequest)
+		return
+	}
+	if errV := eh.signer.Verify(jobUuid, query.Get(QpExportExpires), query.Get(QpExportSignature)); errV != nil {
+		retErr := &Error{
+			ClientError: true,
+			ServerError: false,
+			Message:     errInvalidExportLink.Error(),
+			Context:     r.Method + " path:" + r.URL.Path,
+			Code:        CodeInvalidExportLink,
+		}
+		statusCode := http.StatusForbidden
+		if errV == export.ErrLinkExpired {
+			retErr.Message = errExportLinkExpired.Error()
+			retErr.Code = CodeExportLinkExpired
+			statusCode = http.StatusGone
+		}
+		eh.cx.handleErrorJson(w, r, errV, "invalid export download link", retErr, statusCode)
+		return
+	}
+	archive, errA := eh.store.Archive(r.Context(), jobUuid)
+	if errA != nil {
+		retErr := &Error{
+			ClientError: false,
+			ServerError: true,
+			Message:     errUnexpected.Error(),
+			Context:     r.Method + " path:" + r.URL.Path,
+			Code:        CodeUnexpected,
+		}
+		statusCode := http.StatusInternalServerError
+		if errA == export.ErrArchiveNotFound {
+			retErr.ClientError, retErr.ServerError = true, false
+			retErr.Message = errExportNotFound.Error()
+			retErr.Code = CodeExportNotFound
+			statusCode = http.StatusNotFound
+		}
+		eh.cx.handleErrorJson(w, r, errA, "issue getting export archive", retErr, statusCode)
+		return
+	}
+	name := "perceptia-export-" + jobUuid.String()
+	encoded, errE := export.Encode(archive, format, name+"."+export.FormatJSON)
+	if errE != nil {
+		retErr := &Error{
+			ClientError: false,
+			ServerError: true,
+			Message:     errUnexpected.Error(),
+			Context:     r.Method + " path:" + r.URL.Path,
+			Code:        CodeUnexpected,
+		}
+		eh.cx.handleErrorJson(w, r, errE, "issue encoding export archive", retErr, http.StatusInternalServerError)
+		return
+	}
+	contentType := ContentTypeJSON
+	if format == export.FormatZip {
+		contentType = ContentTypeZip
+	}
+	w.Header().Set(HeaderContentType, contentType)
+	w.Header().Set(HeaderContentDisposition, fmt.Sprintf("attachment; filename=\"%s.%s\"", name, format))
+	w.Header().Set(HeaderCacheControl, CacheControlNoStore)
+	w.WriteHeader(http.StatusOK)
+	if _, errW := w.Write(encoded); errW != nil {
+		eh.cx.logError(r, errW, "error writing export archive to response stream", "", http.StatusOK)
+	}
+}
@@ -1,9 +1,15 @@
 package handler
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
 
 	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/utility"
 )
@@ -14,6 +20,35 @@ var ErrPerceptiaApiVersionNotValidSemVer = errors.New("perceptia API version not
 
 var ErrPerceptiaApiVersionNotSupported = errors.New("perceptia API version specified is not supported")
 
+// apiVersionKey is the context key of the ApiVersion negotiated for a request.
+const apiVersionKey contextKey = 8080
+
+// Versions of the gateway api which changed how existing routes behave. Clients which negotiate an older version
+// keep the behavior of that version.
+var (
+	// apiVersionProblem is the version errors are first sent as a Problem, to clients which accept one.
+	apiVersionProblem, _ = utility.NewSemVer(1, 1, 0)
+	// apiVersionAccountDeletion is the version deleting a user first responds 202 with an AccountDeletionResponse,
+	// as the account is only pending deletion, rather than 200 with text.
+	apiVersionAccountDeletion, _ = utility.NewSemVer(1, 1, 0)
+)
+
+// ApiVersion is a version of the gateway api served by the gateway.
+type ApiVersion struct {
+	Version *utility.SemVer
+	// Deprecated is the time the version was deprecated, or zero if it is not. Responses served with a deprecated
+	// version include the Deprecation header, so clients know to move to a newer version.
+	Deprecated time.Time
+	// Sunset is the time the version stops being served, or zero if none is planned. Responses served with the
+	// version include the Sunset header, and once it has passed, clients requesting the version are served a newer one.
+	Sunset time.Time
+}
+
+// servedAt reports if the version is still served at now.
+func (av *ApiVersion) servedAt(now time.Time) bool {
+	return av.Sunset.IsZero() || now.Before(av.Sunset)
+}
+
 // GatewayVersion represents the current handler in the request/response cycle.
 type GatewayVersion struct {
 	handler http.Handler
@@ -26,8 +61,9 @@ func (cx *Context) NewGatewayVersion(handler http.Handler) http.Handler {
 }
 
 // ServeHTTP adds the Perceptia-Api-Version custom header along with the latest version of the gateway api implemented.
+// It is replaced with the version negotiated by EnsureGatewayVersionSupported, once negotiated.
 func (gv *GatewayVersion) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	w.Header().Add(HeaderPerceptiaApiVersion, gv.cx.gatewayVersion.String())
+	w.Header().Set(HeaderPerceptiaApiVersion, gv.cx.gatewayVersion.String())
 	//call the real handler
 	gv.handler.ServeHTTP(w, r)
 }
@@ -44,52 +80,63 @@ func (cx *Context) NewEnsureGatewayVersionSupported(handler http.Handler) http.H
 	return &EnsureGatewayVersionSupported{handler, cx}
 }
 
-// ServeHTTP checks for the api version header or query param and verifies gateway supports it
+// ServeHTTP checks for the api version header or query param, and negotiates the version of the api the request
+// is served with, the oldest version served which is at least the version requested, or the oldest version served
+// if none was requested, so clients written before versions were negotiated keep the behavior they were written for. The negotiated version is echoed in the Perceptia-Api-Version header, along with the
+// Deprecation and Sunset headers if it is being retired.
+//
+// If the gateway serves no version new enough, responds 406 with the range of versions served.
+// Requests for a major version the gateway does not serve at all are left to the handler to reject.
 func (egv *EnsureGatewayVersionSupported) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	major, errA := strconv.Atoi(strings.TrimPrefix(mux.Vars(r)[ReqVarMajorVersion], "v"))
+	if errA != nil || len(egv.cx.apiVersionsServed(major, time.Now())) == 0 {
+		egv.handler.ServeHTTP(w, r)
+		return
+	}
 	reqApiVer, errRAP := egv.cx.GetPerceptiaApiVersionValue(r)
-	if errRAP != nil {
-		if errRAP != ErrPerceptiaApiVersionNotSet {
-			if errRAP == ErrPerceptiaApiVersionNotValidSemVer {
-				retErr := &Error{
-					ClientError: true,
-					ServerError: false,
-					Message:     fmt.Sprintf("api version specified, but could not be understood, not a valid api version"),
-					Context:     "request made to gateway collection",
-					Code:        0,
-				}
-				egv.cx.handleErrorJson(w, r, errRAP, "trying to convert api version header/query param to SemVer", retErr, http.StatusBadRequest)
-				return
-			} else {
-				return
-			}
+	if errRAP == ErrPerceptiaApiVersionNotValidSemVer {
+		retErr := &Error{
+			ClientError: true,
+			ServerError: false,
+			Message:     fmt.Sprintf("api version specified, but could not be understood, not a valid api version"),
+			Context:     "request made to gateway collection",
+			Code:        CodeInvalidApiVersion,
 		}
-
-	} else {
-		if !egv.cx.ApiVersionSupported(reqApiVer) {
-			retErr := &Error{
-				ClientError: true,
-				ServerError: false,
-				Message:     fmt.Sprintf("api version not supported, requested version: %s supported versions: %s", reqApiVer.String(), getSupportedVersionsString(egv.cx.gatewayVersionsSupported)),
-				Context:     "request made to gateway collection",
-				Code:        0,
-			}
-			egv.cx.handleErrorJson(w, r, errRAP, "trying to convert api version header/query param to SemVer", retErr, http.StatusBadRequest)
-			return
+		egv.cx.handleErrorJson(w, r, errRAP, "trying to convert api version header/query param to SemVer", retErr, http.StatusBadRequest)
+		return
+	}
+	w.Header().Add(HeaderVary, HeaderPerceptiaApiVersion)
+	served, errNAV := egv.cx.negotiateApiVersion(major, reqApiVer, time.Now())
+	if errNAV != nil {
+		retErr := &Error{
+			ClientError: true,
+			ServerError: false,
+			Message: fmt.Sprintf("api version not supported, requested version: %s supported versions: %s",
+				reqApiVer.String(), egv.cx.apiVersionRange(major, time.Now())),
+			Context: "request made to gateway collection",
+			Code:    CodeApiVersionNotSupported,
 		}
+		egv.cx.handleErrorJson(w, r, errNAV, "negotiating api version", retErr, http.StatusNotAcceptable)
+		return
 	}
 
+	w.Header().Set(HeaderPerceptiaApiVersion, served.Version.String())
+	if !served.Deprecated.IsZero() {
+		w.Header().Set(HeaderDeprecation, "@"+strconv.FormatInt(served.Deprecated.Unix(), 10))
+	}
+	if !served.Sunset.IsZero() {
+		w.Header().Set(HeaderSunset, served.Sunset.UTC().Format(http.TimeFormat))
+	}
 	//call the real handler
-	egv.handler.ServeHTTP(w, r)
+	egv.handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiVersionKey, served)))
 }
 
+// GetPerceptiaApiVersionValue returns the version of the api requested, by the Perceptia-Api-Version header,
+// or if not set, the apiVersion query parameter.
 func (cx *Context) GetPerceptiaApiVersionValue(r *http.Request) (apiVer *utility.SemVer, err error) {
 	apiVerRaw := r.Header.Get(HeaderPerceptiaApiVersion)
 	if apiVerRaw == "" {
-		apiVerRawValues, paramSet := (r.URL.Query())[QpApiVersion]
-		if !paramSet {
-			return nil, ErrPerceptiaApiVersionNotSet
-		}
-		apiVerRaw := apiVerRawValues[0]
+		apiVerRaw = r.URL.Query().Get(QpApiVersion)
 		if apiVerRaw == "" {
 			return nil, ErrPerceptiaApiVersionNotSet
 		}
@@ -101,35 +148,79 @@ func (cx *Context) GetPerceptiaApiVersionValue(r *http.Request) (apiVer *utility
 	return apiVerSVS, nil
 }
 
+// ApiVersionSupported reports if the gateway serves a version which satisfies the version requested.
 func (cx *Context) ApiVersionSupported(reqApiVersion *utility.SemVer) bool {
-	if cx.gatewayVersion.GetMajor() == 0 {
-		if cx.gatewayVersion.Compare(reqApiVersion) == 0 {
-			return true
-		} else {
-			if cx.gatewayVersion.GetMinor() == reqApiVersion.GetMinor() {
-				if cx.gatewayVersion.GetPatch() >= reqApiVersion.GetPatch() {
-					return true
-				} else {
-					return false
-				}
-			} else {
-				// In major version 0, if minor version don't match, not compatible
-				return false
-			}
+	_, errNAV := cx.negotiateApiVersion(reqApiVersion.GetMajor(), reqApiVersion, time.Now())
+	return errNAV == nil
+}
+
+// apiVersionsServed returns the versions of the major version served at now, oldest first.
+func (cx *Context) apiVersionsServed(major int, now time.Time) []*ApiVersion {
+	var served []*ApiVersion
+	for _, apiVer := range cx.apiVersions {
+		if apiVer.Version.GetMajor() == major && apiVer.servedAt(now) {
+			served = append(served, apiVer)
+		}
+	}
+	return served
+}
+
+// negotiateApiVersion returns the version of the major version to serve a request for the requested version
+// with, at now. This is the oldest version served which is at least the version requested, as a newer minor
+// version only adds to an older one, or the oldest version served if requested is nil, as a client which does not
+// request a version was written against the oldest, and only clients which request a newer version get its behavior.
+// In major version 0 a different minor version is not compatible, so only a newer patch may be served.
+//
+// Returns ErrPerceptiaApiVersionNotSupported if no version served satisfies the request.
+func (cx *Context) negotiateApiVersion(major int, requested *utility.SemVer, now time.Time) (*ApiVersion, error) {
+	served := cx.apiVersionsServed(major, now)
+	if len(served) == 0 {
+		return nil, ErrPerceptiaApiVersionNotSupported
+	}
+	if requested == nil {
+		return served[0], nil
+	}
+	if requested.GetMajor() != major {
+		return nil, ErrPerceptiaApiVersionNotSupported
+	}
+	for _, apiVer := range served {
+		if major == 0 && apiVer.Version.GetMinor() != requested.GetMinor() {
+			continue
 		}
-	} else {
-		gwVerSel, verSupported := cx.gatewayVersionsSupported[reqApiVersion.GetMajor()]
-		if !verSupported {
-			return false
+		if apiVer.Version.Compare(requested) >= 0 {
+			return apiVer, nil
 		}
-		return gwVerSel.Compare(reqApiVersion) >= 0
+	}
+	return nil, ErrPerceptiaApiVersionNotSupported
+}
+
+// apiVersionRange describes the versions of the major version served at now, such as "1.0.0 to 1.1.0".
+func (cx *Context) apiVersionRange(major int, now time.Time) string {
+	served := cx.apiVersionsServed(major, now)
+	switch len(served) {
+	case 0:
+		return "none"
+	case 1:
+		return served[0].Version.String()
+	default:
+		return served[0].Version.String() + " to " + served[len(served)-1].Version.String()
 	}
 }
 
-func getSupportedVersionsString(versions map[int]*utility.SemVer) string {
-	var versionsString string = ""
-	for _, semVer := range versions {
-		versionsString = fmt.Sprintf("%s %s", versionsString, semVer.String())
+// servedApiVersion returns the version of the api negotiated for r, or if none was negotiated, such as when the
+// request is rejected before it is negotiated, the oldest version served, as if the client requested none.
+func (cx *Context) servedApiVersion(r *http.Request) *utility.SemVer {
+	if served, ok := r.Context().Value(apiVersionKey).(*ApiVersion); ok && served != nil {
+		return served.Version
 	}
-	return versionsString
+	if served := cx.apiVersionsServed(cx.gatewayVersion.GetMajor(), time.Now()); len(served) != 0 {
+		return served[0].Version
+	}
+	return cx.gatewayVersion
+}
+
+// servedApiVersionAtLeast reports if the version of the api negotiated for r is version or newer,
+// so the handler should behave as version does.
+func (cx *Context) servedApiVersionAtLeast(r *http.Request, version *utility.SemVer) bool {
+	return cx.servedApiVersion(r).Compare(version) >= 0
 }
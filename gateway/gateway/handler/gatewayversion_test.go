@@ -0,0 +1,175 @@
+// +build all unit
+
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/gorilla/mux"
+
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/utility"
+)
+
+func newTestSemVer(t *testing.T, version string) *utility.SemVer {
+	semVer, errSVFS := utility.SemVerFromString(version)
+	if errSVFS != nil {
+		t.Fatalf("unexpected error setting up test: %s", errSVFS)
+	}
+	return semVer
+}
+
+func TestContext_NegotiateApiVersion(t *testing.T) {
+	now := time.Now()
+	cx := &Context{apiVersions: []*ApiVersion{
+		{Version: newTestSemVer(t, "0.1.0")},
+		{Version: newTestSemVer(t, "1.0.0"), Sunset: now.Add(-time.Hour)},
+		{Version: newTestSemVer(t, "1.1.0"), Deprecated: now.Add(-time.Hour), Sunset: now.Add(time.Hour)},
+		{Version: newTestSemVer(t, "1.2.3")},
+	}}
+	cases := []struct {
+		name      string
+		hint      string
+		major     int
+		requested string
+		expected  string
+	}{
+		{
+			name:     "Not Requested",
+			hint:     "A client which does not request a version should be served the oldest version still served",
+			major:    1,
+			expected: "1.1.0",
+		},
+		{
+			name:      "Oldest Satisfying",
+			hint:      "The oldest version at least the version requested should be served",
+			major:     1,
+			requested: "1.1",
+			expected:  "1.1.0",
+		},
+		{
+			name:      "Newer Minor",
+			hint:      "A newer minor version satisfies the request, as it only adds to the older",
+			major:     1,
+			requested: "1.1.1",
+			expected:  "1.2.3",
+		},
+		{
+			name:      "Sunset",
+			hint:      "A version past its sunset should no longer be served, a newer version should be",
+			major:     1,
+			requested: "1.0.0",
+			expected:  "1.1.0",
+		},
+		{
+			name:      "Too New",
+			hint:      "A version newer than any served should not be supported",
+			major:     1,
+			requested: "1.3",
+		},
+		{
+			name:      "Other Major",
+			hint:      "A version of a different major version than the path should not be supported",
+			major:     1,
+			requested: "0.1.0",
+		},
+		{
+			name:      "Major Zero Minor",
+			hint:      "In major version 0 a different minor version is not compatible",
+			major:     0,
+			requested: "0.0.1",
+		},
+	}
+
+	for _, c := range cases {
+		var requested *utility.SemVer
+		if len(c.requested) != 0 {
+			requested = newTestSemVer(t, c.requested)
+		}
+		served, errNAV := cx.negotiateApiVersion(c.major, requested, now)
+		if len(c.expected) == 0 {
+			if errNAV != ErrPerceptiaApiVersionNotSupported {
+				t.Errorf("case: %s: expected error %s but got %v, served %v\nHINT: %s", c.name,
+					ErrPerceptiaApiVersionNotSupported, errNAV, served, c.hint)
+			}
+			continue
+		}
+		if errNAV != nil {
+			t.Errorf("case: %s: unexpected error: %s\nHINT: %s", c.name, errNAV, c.hint)
+			continue
+		}
+		if served.Version.String() != c.expected {
+			t.Errorf("case: %s: expected version %s to be served but got %s\nHINT: %s", c.name, c.expected,
+				served.Version, c.hint)
+		}
+	}
+}
+
+func TestEnsureGatewayVersionSupported(t *testing.T) {
+	deprecated := time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+	sunset := time.Now().Add(time.Hour * 24).UTC().Truncate(time.Second)
+	cx := &Context{logger: kitlog.NewNopLogger(), gatewayVersion: newTestSemVer(t, "1.1.0"),
+		apiVersions: []*ApiVersion{
+			{Version: newTestSemVer(t, "1.0.0"), Deprecated: deprecated, Sunset: sunset},
+			{Version: newTestSemVer(t, "1.1.0")},
+		}}
+	var negotiated *utility.SemVer
+	egv := cx.NewEnsureGatewayVersionSupported(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		negotiated = cx.servedApiVersion(r)
+	}))
+	serve := func(requested string) *httptest.ResponseRecorder {
+		negotiated = nil
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/gateway/health", nil)
+		r = mux.SetURLVars(r, map[string]string{ReqVarMajorVersion: "v1"})
+		if len(requested) != 0 {
+			r.Header.Set(HeaderPerceptiaApiVersion, requested)
+		}
+		w := httptest.NewRecorder()
+		egv.ServeHTTP(w, r)
+		return w
+	}
+
+	w := serve("1.0")
+	if negotiated.String() != "1.0.0" || w.Header().Get(HeaderPerceptiaApiVersion) != "1.0.0" {
+		t.Errorf("case: Deprecated: expected 1.0.0 to be negotiated and echoed, but got %s, header %q\n"+
+			"HINT: the handler should be served the version negotiated", negotiated,
+			w.Header().Get(HeaderPerceptiaApiVersion))
+	}
+	if got := w.Header().Get(HeaderDeprecation); got != "@1792368000" {
+		t.Errorf("case: Deprecated: expected Deprecation header @1792368000 but got %q\n"+
+			"HINT: the Deprecation header is the unix time the version was deprecated, prefixed by @", got)
+	}
+	if got := w.Header().Get(HeaderSunset); got != sunset.Format(http.TimeFormat) {
+		t.Errorf("case: Deprecated: expected Sunset header %q but got %q\n"+
+			"HINT: the Sunset header is the http date the version stops being served", sunset.Format(http.TimeFormat),
+			got)
+	}
+
+	w = serve("")
+	if negotiated.String() != "1.0.0" || w.Header().Get(HeaderPerceptiaApiVersion) != "1.0.0" {
+		t.Errorf("case: Not Requested: expected 1.0.0 to be negotiated and echoed, but got %s, header %q\n"+
+			"HINT: a client which does not request a version was written against the oldest version served, so "+
+			"should keep its behavior", negotiated, w.Header().Get(HeaderPerceptiaApiVersion))
+	}
+
+	w = serve("1.1")
+	if negotiated.String() != "1.1.0" || len(w.Header().Get(HeaderDeprecation)) != 0 {
+		t.Errorf("case: Latest: expected 1.1.0 to be negotiated with no Deprecation header, but got %s, header %q\n"+
+			"HINT: only a client which requests the newer version should be served it", negotiated,
+			w.Header().Get(HeaderDeprecation))
+	}
+
+	w = serve("1.2")
+	if w.Code != http.StatusNotAcceptable || negotiated != nil {
+		t.Errorf("case: Too New: expected status %d without calling the handler, but got %d\n"+
+			"HINT: a request for a newer version than served should be rejected", http.StatusNotAcceptable, w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "1.0.0 to 1.1.0") {
+		t.Errorf("case: Too New: expected the error to include the supported range, but got %s\n"+
+			"HINT: the client should be told which versions it may request", w.Body.String())
+	}
+}
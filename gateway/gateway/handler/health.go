@@ -2,48 +2,112 @@ package handler
 
 import (
 	"net/http"
+
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/health"
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/service"
+)
+
+// Statuses reported by the health endpoints.
+const (
+	healthStatusAlive    = "alive"
+	healthStatusReady    = "ready"
+	healthStatusNotReady = "not ready"
 )
 
 type HealthHandlerContext struct {
-	cx                        *Context
-	userStoreStatusNotOkay    chan bool
-	sessionStoreStatusNotOkay chan bool
+	cx              *Context
+	healthRegistry  *health.Registry
+	serviceRegistry *service.Registry
 }
 
-func (cx *Context) NewHealthHandlerContext(userStoreStatusNotOkay chan bool, sessionStoreStatusNotOkay chan bool) *HealthHandlerContext {
-	return &HealthHandlerContext{cx: cx, userStoreStatusNotOkay: userStoreStatusNotOkay, sessionStoreStatusNotOkay: sessionStoreStatusNotOkay}
+func (cx *Context) NewHealthHandlerContext(healthRegistry *health.Registry,
+	serviceRegistry *service.Registry) *HealthHandlerContext {
+	return &HealthHandlerContext{cx: cx, healthRegistry: healthRegistry, serviceRegistry: serviceRegistry}
 }
 
-func (hh *HealthHandlerContext) HealthHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set(HeaderContentType, ContentTypeJSON)
-	type healthObj struct {
-		Name   string `json:"name"`
-		Status string `json:"status"`
+type serviceHealthObj struct {
+	Name           string                   `json:"name"`
+	Status         string                   `json:"status"`
+	CircuitBreaker service.BreakerState     `json:"circuitBreaker"`
+	Upstreams      []service.UpstreamStatus `json:"upstreams"`
+}
+
+// readyStatus returns the status of the gateway, and the http status code to report it with.
+func (hh *HealthHandlerContext) readyStatus() (string, int) {
+	if hh.healthRegistry.Ready() {
+		return healthStatusReady, http.StatusOK
 	}
-	gatewayStatus := "ready"
-	select {
-	case status, ok := <-hh.sessionStoreStatusNotOkay:
-		if ok {
-			if status {
-				gatewayStatus = "not ready"
-				hh.sessionStoreStatusNotOkay <- true
-			}
-		}
-	case status, ok := <-hh.userStoreStatusNotOkay:
-		if ok {
-			if status {
-				gatewayStatus = "not ready"
-				hh.userStoreStatusNotOkay <- true
-			}
+	return healthStatusNotReady, http.StatusServiceUnavailable
+}
+
+// servicesHealth returns the health of each service, including the state of each of its upstreams.
+func (hh *HealthHandlerContext) servicesHealth() []serviceHealthObj {
+	services := make([]serviceHealthObj, 0, len(hh.serviceRegistry.Services))
+	for _, svc := range hh.serviceRegistry.Services {
+		serviceStatus := healthStatusReady
+		breakerState := svc.Breaker().State()
+		if !svc.Pool().Healthy() || breakerState == service.BreakerOpen {
+			serviceStatus = healthStatusNotReady
 		}
-	default:
-		break
+		services = append(services, serviceHealthObj{
+			Name:           svc.Name,
+			Status:         serviceStatus,
+			CircuitBreaker: breakerState,
+			Upstreams:      svc.Pool().Status(),
+		})
 	}
+	return services
+}
 
+// HealthHandler reports if the gateway is ready, and the health of each service it proxies requests to.
+// Always responds with status 200, see HealthReadyHandler for a status code which reflects readiness.
+func (hh *HealthHandlerContext) HealthHandler(w http.ResponseWriter, r *http.Request) {
+	type healthObj struct {
+		Name     string             `json:"name"`
+		Status   string             `json:"status"`
+		Services []serviceHealthObj `json:"services"`
+	}
+	gatewayStatus, _ := hh.readyStatus()
 	healthStatus := healthObj{
-		Name:   "Perceptia API Health Report",
-		Status: gatewayStatus,
+		Name:     "Perceptia API Health Report",
+		Status:   gatewayStatus,
+		Services: hh.servicesHealth(),
+	}
+	_, _ = hh.cx.respondEncode(w, r, healthStatus, http.StatusOK)
+}
+
+// HealthLiveHandler reports that the gateway is running and able to serve requests.
+// It does not depend on any dependency, so a failing dependency does not cause the gateway to be restarted.
+func (hh *HealthHandlerContext) HealthLiveHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add(HeaderCacheControl, CacheControlNoStore)
+	_, _ = hh.cx.respondEncode(w, r, map[string]string{"status": healthStatusAlive}, http.StatusOK)
+}
+
+// HealthReadyHandler reports if the gateway should be sent traffic.
+// Responds with status 200 if every critical dependency is up, and status 503 otherwise.
+func (hh *HealthHandlerContext) HealthReadyHandler(w http.ResponseWriter, r *http.Request) {
+	gatewayStatus, statusCode := hh.readyStatus()
+	w.Header().Add(HeaderCacheControl, CacheControlNoStore)
+	_, _ = hh.cx.respondEncode(w, r, map[string]string{"status": gatewayStatus}, statusCode)
+}
+
+// HealthDetailsHandler reports the result of the most recent check of each dependency,
+// including its latency, last error, and information such as the database procedure version.
+// Requires an authenticated session, as the report describes the internals of the deployment.
+func (hh *HealthHandlerContext) HealthDetailsHandler(w http.ResponseWriter, r *http.Request) {
+	type healthDetailsObj struct {
+		Name         string             `json:"name"`
+		Status       string             `json:"status"`
+		Dependencies []health.Result    `json:"dependencies"`
+		Services     []serviceHealthObj `json:"services"`
+	}
+	gatewayStatus, _ := hh.readyStatus()
+	details := healthDetailsObj{
+		Name:         "Perceptia API Detailed Health Report",
+		Status:       gatewayStatus,
+		Dependencies: hh.healthRegistry.Results(),
+		Services:     hh.servicesHealth(),
 	}
-	_, _ = hh.cx.respondEncode(w, healthStatus, http.StatusOK)
-	return
+	w.Header().Add(HeaderCacheControl, CacheControlNoStore)
+	_, _ = hh.cx.respondEncode(w, r, details, http.StatusOK)
 }
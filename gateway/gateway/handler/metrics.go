@@ -0,0 +1,136 @@
+package handler
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/discard"
+	"github.com/gorilla/mux"
+
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/user"
+)
+
+// routeUnmatched is the route label used for requests which did not match any route.
+const routeUnmatched = "unmatched"
+
+// routeVarPattern matches the pattern of a variable in a route template, such as ":v[0-9]+" in "{majorVersion:v[0-9]+}".
+var routeVarPattern = regexp.MustCompile(`\{([^{}:]+):[^{}]*(?:\{[^{}]*\}[^{}]*)*\}`)
+
+// Metrics holds the metrics recorded by the handlers.
+type Metrics struct {
+	// RequestCount counts requests, labeled by route, method, and code.
+	RequestCount metrics.Counter
+	// RequestDuration observes the time in seconds to respond to a request, labeled by route, method, and code.
+	RequestDuration metrics.Histogram
+	// UpstreamDuration observes the time in seconds for an upstream to send the response headers
+	// for a proxied request, labeled by service, upstream, and code.
+	UpstreamDuration metrics.Histogram
+	// PasswordVerifyDuration observes the time in seconds to verify a password against its argon2 hash,
+	// labeled by result.
+	PasswordVerifyDuration metrics.Histogram
+}
+
+// NewDiscardMetrics creates Metrics which record nothing.
+func NewDiscardMetrics() *Metrics {
+	return &Metrics{
+		RequestCount:           discard.NewCounter(),
+		RequestDuration:        discard.NewHistogram(),
+		UpstreamDuration:       discard.NewHistogram(),
+		PasswordVerifyDuration: discard.NewHistogram(),
+	}
+}
+
+// RequestMetrics represents the current handler in the request/response cycle.
+type RequestMetrics struct {
+	handler http.Handler
+	cx      *Context
+}
+
+// NewRequestMetrics constructs a new RequestMetrics struct with the provided handler and Context.
+func (cx *Context) NewRequestMetrics(handler http.Handler) http.Handler {
+	return &RequestMetrics{handler, cx}
+}
+
+// ServeHTTP counts and times the request, labeling it with the template of the route it matched.
+func (rm *RequestMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	begin := time.Now()
+	rec := newStatusRecorder(w)
+	rm.handler.ServeHTTP(rec, r)
+	labels := []string{"route", routeTemplate(r), "method", r.Method, "code", strconv.Itoa(rec.status)}
+	rm.cx.metrics.RequestCount.With(labels...).Add(1)
+	rm.cx.metrics.RequestDuration.With(labels...).Observe(time.Since(begin).Seconds())
+}
+
+// routeTemplate returns the path template of the route the request matched, without variable patterns,
+// such as "/api/{majorVersion}/gateway/users/{userUuid}".
+func routeTemplate(r *http.Request) string {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return routeUnmatched
+	}
+	tmpl, errGPT := route.GetPathTemplate()
+	if errGPT != nil {
+		return routeUnmatched
+	}
+	return routeVarPattern.ReplaceAllString(tmpl, "{$1}")
+}
+
+// statusRecorder is an http.ResponseWriter which records the status code and number of bytes written.
+// It passes through the Flusher and Hijacker interfaces, so streamed and upgraded responses still work.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func newStatusRecorder(w http.ResponseWriter) *statusRecorder {
+	return &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+}
+
+// WriteHeader records the status code before writing it.
+func (sr *statusRecorder) WriteHeader(statusCode int) {
+	sr.status = statusCode
+	sr.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write records the number of bytes written.
+func (sr *statusRecorder) Write(b []byte) (int, error) {
+	n, err := sr.ResponseWriter.Write(b)
+	sr.bytes += int64(n)
+	return n, err
+}
+
+// Flush sends any buffered data to the client, if the underlying ResponseWriter supports it.
+func (sr *statusRecorder) Flush() {
+	if flusher, ok := sr.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack takes over the connection, if the underlying ResponseWriter supports it.
+// A hijacked connection is recorded as switching protocols.
+func (sr *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := sr.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	sr.status = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
+// passwordVerifyResult labels the outcome of verifying a password against its hash.
+func passwordVerifyResult(valid bool, err error) string {
+	switch {
+	case valid:
+		return "match"
+	case err == nil || err == user.ErrHashNotFromPassword:
+		return "mismatch"
+	default:
+		return "error"
+	}
+}
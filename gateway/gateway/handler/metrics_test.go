@@ -0,0 +1,142 @@
+// +build all unit
+
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// testUuidV4Regex is the pattern the gateway matches uuid route variables with, which contains braces.
+const testUuidV4Regex = "[0-9A-Fa-f]{8}-[0-9A-Fa-f]{4}-4[0-9A-Fa-f]{3}-[89aAbB][0-9A-Fa-f]{3}-[0-9A-Fa-f]{12}"
+
+func TestRouteVarPattern(t *testing.T) {
+	cases := []struct {
+		name     string
+		hint     string
+		tmpl     string
+		expected string
+	}{
+		{
+			name:     "No Variables",
+			hint:     "A template without variables should be left unchanged",
+			tmpl:     "/api/v1/gateway/health",
+			expected: "/api/v1/gateway/health",
+		},
+		{
+			name:     "Simple Pattern",
+			hint:     "The pattern of a variable should be removed, leaving its name",
+			tmpl:     "/api/{majorVersion:v[0-9]+}/gateway/health",
+			expected: "/api/{majorVersion}/gateway/health",
+		},
+		{
+			name:     "Nested Braces",
+			hint:     "A pattern with repetition counts, such as the uuid pattern, should be removed whole",
+			tmpl:     "/api/{majorVersion:v[0-9]+}/gateway/users/{userUuid:" + testUuidV4Regex + "}/activity",
+			expected: "/api/{majorVersion}/gateway/users/{userUuid}/activity",
+		},
+		{
+			name:     "Adjacent Variables",
+			hint:     "Each variable should be replaced on its own, not merged with the next",
+			tmpl:     "/{a:[0-9]{2}}{b:[a-z]{3}}/{c}",
+			expected: "/{a}{b}/{c}",
+		},
+		{
+			name:     "No Pattern",
+			hint:     "A variable without a pattern should be left unchanged",
+			tmpl:     "/api/{majorVersion}/{service}",
+			expected: "/api/{majorVersion}/{service}",
+		},
+	}
+
+	for _, c := range cases {
+		if got := routeVarPattern.ReplaceAllString(c.tmpl, "{$1}"); got != c.expected {
+			t.Errorf("case: %s: expected %q but got %q\nHINT: %s", c.name, c.expected, got, c.hint)
+		}
+	}
+}
+
+func TestRouteTemplate(t *testing.T) {
+	var template string
+	record := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		template = routeTemplate(r)
+	})
+	// The routes are built the way the gateway builds its own, from nested subrouters
+	router := mux.NewRouter()
+	router.NotFoundHandler = record
+	apiV := router.PathPrefix("/api/").Subrouter().PathPrefix("/{" + ReqVarMajorVersion + ":v[0-9]+}/").Subrouter()
+	apiV.PathPrefix("/anyquiz/").Subrouter().PathPrefix("").Handler(record)
+	gateway := apiV.PathPrefix("/gateway/").Subrouter()
+	gateway.Handle("/health", record)
+	usersSpecific := gateway.PathPrefix("/users/").Subrouter().PathPrefix("/{" + ReqVarUserUuid + ":" +
+		testUuidV4Regex + "}").Subrouter()
+	usersSpecific.Handle("/activity", record)
+	usersSpecific.PathPrefix("").Handler(record)
+
+	cases := []struct {
+		name     string
+		hint     string
+		path     string
+		expected string
+	}{
+		{
+			name:     "Static Route",
+			hint:     "The template of the route matched should be used",
+			path:     "/api/v1/gateway/health",
+			expected: "/api/{majorVersion}/gateway/health",
+		},
+		{
+			name:     "Uuid Route",
+			hint:     "The uuid in the path should be replaced by the name of its variable",
+			path:     "/api/v1/gateway/users/a3865f94-0c83-4e29-b6cc-1d295d062f50/activity",
+			expected: "/api/{majorVersion}/gateway/users/{userUuid}/activity",
+		},
+		{
+			name:     "Other Uuid",
+			hint:     "Requests for different users should share one label",
+			path:     "/api/v2/gateway/users/0f1e2d3c-4b5a-4978-8a6b-5c4d3e2f1a0b/activity",
+			expected: "/api/{majorVersion}/gateway/users/{userUuid}/activity",
+		},
+		{
+			name:     "Prefix Route",
+			hint:     "A path prefix route should be labeled with its prefix, not the rest of the path",
+			path:     "/api/v1/gateway/users/a3865f94-0c83-4e29-b6cc-1d295d062f50",
+			expected: "/api/{majorVersion}/gateway/users/{userUuid}",
+		},
+		{
+			name:     "Service Route",
+			hint:     "Every path proxied to a service should share the label of its prefix",
+			path:     "/api/v1/anyquiz/quizzes/42/questions",
+			expected: "/api/{majorVersion}/anyquiz",
+		},
+		{
+			name:     "Unmatched",
+			hint:     "A path matching no route should not be used as a label, to keep the number of labels bounded",
+			path:     "/wp-admin/setup.php",
+			expected: routeUnmatched,
+		},
+		{
+			name:     "Unmatched Uuid",
+			hint:     "A path which is not a uuid should not match the uuid route, nor be used as a label",
+			path:     "/api/v1/gateway/users/not-a-uuid/activity",
+			expected: routeUnmatched,
+		},
+		{
+			name:     "Unmatched Version",
+			hint:     "A path with an unknown major version format should not be used as a label",
+			path:     "/api/version1/gateway/health",
+			expected: routeUnmatched,
+		},
+	}
+
+	for _, c := range cases {
+		template = ""
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, c.path, nil))
+		if template != c.expected {
+			t.Errorf("case: %s: expected route %q but got %q\nHINT: %s", c.name, c.expected, template, c.hint)
+		}
+	}
+}
@@ -13,7 +13,7 @@ func (cx *Context) NotFoundHandler(w http.ResponseWriter, r *http.Request) {
 		ServerError: false,
 		Message:     mux.ErrNotFound.Error(),
 		Context:     fmt.Sprintf("method=%s path=%s", r.Method, r.URL.Path),
-		Code:        0,
+		Code:        CodeRouteNotFound,
 	}
 	cx.handleErrorJson(w, r, nil, "requested resource not found",
 		retErr, http.StatusNotFound)
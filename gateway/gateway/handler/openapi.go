@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/openapi"
+)
+
+// OpenApiValidation represents the current handler in the request/response cycle.
+type OpenApiValidation struct {
+	handler   http.Handler
+	cx        *Context
+	validator *openapi.Validator
+}
+
+// NewOpenApiValidation creates middleware which rejects requests that do not match the OpenAPI spec checked by
+// validator. In the development environment, responses are checked too, and any which do not match are logged,
+// but still sent. Requests to routes the spec does not describe are passed on unchecked.
+func (cx *Context) NewOpenApiValidation(validator *openapi.Validator) mux.MiddlewareFunc {
+	return func(handler http.Handler) http.Handler {
+		return &OpenApiValidation{handler: handler, cx: cx, validator: validator}
+	}
+}
+
+// ServeHTTP checks the request against the spec, responding with an error describing why it does not match,
+// if it does not, before calling the handler.
+func (ov *OpenApiValidation) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	route, errVR := ov.validator.ValidateRequest(r)
+	switch errVR {
+	case nil:
+	case openapi.ErrRouteNotInSpec, openapi.ErrContentTypeNotInSpec:
+		// Left to the handler, which responds with the error it always has
+		ov.handler.ServeHTTP(w, r)
+		return
+	default:
+		retErr := &Error{
+			ClientError: true,
+			ServerError: false,
+			Message:     errVR.Error(),
+			Context:     r.Method + " path:" + r.URL.Path,
+			Code:        CodeRequestNotValid,
+		}
+		ov.cx.handleErrorJson(w, r, errVR, "request does not match the openapi spec", retErr, http.StatusBadRequest)
+		return
+	}
+	if ov.cx.environment != "development" {
+		ov.handler.ServeHTTP(w, r)
+		return
+	}
+	rec := &responseCapture{statusRecorder: newStatusRecorder(w)}
+	ov.handler.ServeHTTP(rec, r)
+	errVRe := ov.validator.ValidateResponse(r, route, rec.status, w.Header(), rec.body.Bytes())
+	if errVRe != nil {
+		_ = ov.cx.logger.Log("msg", "response does not match the openapi spec", "requestId", getRequestId(r),
+			"method", r.Method, "route", route.Path, "status", rec.status, "error", errVRe)
+	}
+}
+
+// responseCapture is a statusRecorder which also keeps a copy of the body written, so it can be checked.
+type responseCapture struct {
+	*statusRecorder
+	body bytes.Buffer
+}
+
+// Write keeps a copy of b before writing it.
+func (rc *responseCapture) Write(b []byte) (int, error) {
+	rc.body.Write(b)
+	return rc.statusRecorder.Write(b)
+}
+
+// OpenApiSpecHandler serves the OpenAPI spec of the gateway api, as embedded in the gateway.
+//
+// If the major version in the URL is not supported, request will return an error
+func (cx *Context) OpenApiSpecHandler(w http.ResponseWriter, r *http.Request) {
+	if ver := mux.Vars(r)[ReqVarMajorVersion]; ver != "v1" {
+		cx.handleMajorVersionNotSupported(w, r, "v1", ver)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		cx.handleMethodNotAllowed(w, r)
+		return
+	}
+	w.Header().Set(HeaderContentType, ContentTypeYAML)
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodHead {
+		return
+	}
+	if _, errW := w.Write(openapi.Spec); errW != nil {
+		cx.logError(r, errW, "error writing openapi spec to response stream", "", http.StatusOK)
+	}
+}
@@ -0,0 +1,196 @@
+package handler
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ProblemTypePrefix is prefixed to the Slug of an ErrorCode to form the type of a Problem.
+const ProblemTypePrefix = "urn:perceptia:gateway:error:"
+
+// ErrorCode identifies the kind of failure reported to a client. Codes are stable, so clients can tell failures
+// apart by their code rather than their message, and are never reused.
+//
+// Codes are grouped by the thousand: 1xxx the request was not valid, 2xxx the client was not authenticated or
+// not authorized, 3xxx a resource was not found or could not be changed, 4xxx a service could not handle the
+// request, and 5xxx the gateway could not handle the request.
+type ErrorCode int
+
+// Error codes of the gateway. See errorCatalogue for the slug and title of each.
+const (
+	CodeContentTypeNotJson      ErrorCode = 1001
+	CodeInvalidJson             ErrorCode = 1002
+	CodeInvalidNewUser          ErrorCode = 1003
+	CodeInvalidPassword         ErrorCode = 1004
+	CodeInvalidApiVersion       ErrorCode = 1005
+	CodeApiVersionNotSupported  ErrorCode = 1006
+	CodeMethodNotAllowed        ErrorCode = 1007
+	CodeRouteNotFound           ErrorCode = 1008
+	CodeInvalidQuery            ErrorCode = 1009
+	CodeUnknownExportFormat     ErrorCode = 1010
+	CodeInvalidPathPrefix       ErrorCode = 1011
+	CodeRequestNotValid         ErrorCode = 1012
+	CodeInvalidCredentials      ErrorCode = 2001
+	CodeUnauthenticated         ErrorCode = 2002
+	CodeNotInSession            ErrorCode = 2003
+	CodeActionNotAuthorized     ErrorCode = 2004
+	CodeUserNotFound            ErrorCode = 3001
+	CodeUsernameUnavailable     ErrorCode = 3002
+	CodeSessionNotFound         ErrorCode = 3003
+	CodeExportNotFound          ErrorCode = 3004
+	CodeExportFailed            ErrorCode = 3005
+	CodeInvalidExportLink       ErrorCode = 3006
+	CodeExportLinkExpired       ErrorCode = 3007
+	CodeCacheNotEnabled         ErrorCode = 3008
+	CodeServiceUnreachable      ErrorCode = 4001
+	CodeServiceTimeout          ErrorCode = 4002
+	CodeServiceUnavailable      ErrorCode = 4003
+	CodeTooManyStreams          ErrorCode = 4004
+	CodeUnexpected              ErrorCode = 5001
+	CodeStoreUnavailable        ErrorCode = 5002
+	CodeRequestCanceled         ErrorCode = 5003
+	CodeSessionNotCreated       ErrorCode = 5004
+	CodeSessionNotCreatedSignUp ErrorCode = 5005
+)
+
+// errorDescription is how an ErrorCode is described in a Problem.
+type errorDescription struct {
+	slug  string
+	title string
+}
+
+// errorCatalogue describes every ErrorCode. Slugs, like codes, must not change once released.
+var errorCatalogue = map[ErrorCode]errorDescription{
+	CodeContentTypeNotJson:      {"content-type-not-json", "Content type is not JSON"},
+	CodeInvalidJson:             {"invalid-json", "Request body is not valid JSON"},
+	CodeInvalidNewUser:          {"invalid-new-user", "New user is not valid"},
+	CodeInvalidPassword:         {"invalid-password", "Password is not valid"},
+	CodeInvalidApiVersion:       {"invalid-api-version", "Api version is not valid"},
+	CodeApiVersionNotSupported:  {"api-version-not-supported", "Api version is not supported"},
+	CodeMethodNotAllowed:        {"method-not-allowed", "Method not allowed"},
+	CodeRouteNotFound:           {"route-not-found", "Resource not found"},
+	CodeInvalidQuery:            {"invalid-query", "Query parameter is not valid"},
+	CodeUnknownExportFormat:     {"unknown-export-format", "Export format is not known"},
+	CodeInvalidPathPrefix:       {"invalid-path-prefix", "Path prefix is not valid"},
+	CodeRequestNotValid:         {"request-not-valid", "Request does not match the api spec"},
+	CodeInvalidCredentials:      {"invalid-credentials", "Invalid credentials"},
+	CodeUnauthenticated:         {"unauthenticated", "Not authenticated"},
+	CodeNotInSession:            {"not-in-session", "Not in a session"},
+	CodeActionNotAuthorized:     {"action-not-authorized", "Action not authorized"},
+	CodeUserNotFound:            {"user-not-found", "User not found"},
+	CodeUsernameUnavailable:     {"username-unavailable", "Username unavailable"},
+	CodeSessionNotFound:         {"session-not-found", "Session not found"},
+	CodeExportNotFound:          {"export-not-found", "Export not found"},
+	CodeExportFailed:            {"export-failed", "Export failed"},
+	CodeInvalidExportLink:       {"invalid-export-link", "Download link is not valid"},
+	CodeExportLinkExpired:       {"export-link-expired", "Download link has expired"},
+	CodeCacheNotEnabled:         {"cache-not-enabled", "Response cache not enabled"},
+	CodeServiceUnreachable:      {"service-unreachable", "Service unreachable"},
+	CodeServiceTimeout:          {"service-timeout", "Service timed out"},
+	CodeServiceUnavailable:      {"service-unavailable", "Service unavailable"},
+	CodeTooManyStreams:          {"too-many-streams", "Too many open streams"},
+	CodeUnexpected:              {"unexpected", "Unexpected error"},
+	CodeStoreUnavailable:        {"store-unavailable", "Store unavailable"},
+	CodeRequestCanceled:         {"request-canceled", "Request canceled"},
+	CodeSessionNotCreated:       {"session-not-created", "Session not created"},
+	CodeSessionNotCreatedSignUp: {"session-not-created-sign-up", "User created but session not created"},
+}
+
+// Slug returns the name of the code used in the type of a Problem, such as "invalid-credentials".
+func (code ErrorCode) Slug() string {
+	if desc, ok := errorCatalogue[code]; ok {
+		return desc.slug
+	}
+	return errorCatalogue[CodeUnexpected].slug
+}
+
+// Title returns the short human readable summary of the code.
+func (code ErrorCode) Title() string {
+	if desc, ok := errorCatalogue[code]; ok {
+		return desc.title
+	}
+	return errorCatalogue[CodeUnexpected].title
+}
+
+// Problem is the RFC 7807 problem details body of an error response, sent as application/problem+json.
+type Problem struct {
+	// Type identifies the kind of failure, ProblemTypePrefix followed by the slug of Code.
+	Type string `json:"type"`
+	// Title is the summary of the kind of failure, which is the same for every occurrence.
+	Title string `json:"title"`
+	// Status is the http status code of the response.
+	Status int `json:"status"`
+	// Detail describes this occurrence of the failure.
+	Detail string `json:"detail,omitempty"`
+	// Instance is the path of the request which failed.
+	Instance string `json:"instance,omitempty"`
+	// Code is the stable ErrorCode of the failure.
+	Code ErrorCode `json:"code"`
+	// Reference identifies the failure in the logs of the gateway.
+	Reference string `json:"reference"`
+}
+
+// newProblem describes the error, sent to the client of r with statusCode, as a Problem.
+func newProblem(r *http.Request, clientErrorJson *Error, statusCode int) *Problem {
+	code := clientErrorJson.Code
+	if _, ok := errorCatalogue[code]; !ok {
+		code = CodeUnexpected
+	}
+	return &Problem{
+		Type:      ProblemTypePrefix + code.Slug(),
+		Title:     code.Title(),
+		Status:    statusCode,
+		Detail:    clientErrorJson.Message,
+		Instance:  r.URL.Path,
+		Code:      code,
+		Reference: clientErrorJson.Reference,
+	}
+}
+
+// acceptsProblem reports if errors should be sent to the client of r as a Problem, rather than the v1 Error.
+//
+// A Problem is only sent if the Accept header of the request names application/problem+json, and prefers it over
+// application/json. Clients which send no Accept header, or accept anything, such as curl and browsers, keep
+// receiving the v1 Error.
+func acceptsProblem(r *http.Request) bool {
+	accept := r.Header.Get(HeaderAccept)
+	problemQuality, named := acceptQuality(accept, ContentTypeProblemJSON)
+	jsonQuality, _ := acceptQuality(accept, ContentTypeJSON)
+	return named && problemQuality > jsonQuality
+}
+
+// acceptQuality returns the quality, between 0 and 1, the Accept header value gives the media type,
+// taken from the most specific media range which matches it, as in RFC 7231 section 5.3.2.
+// Returns true if that media range names the media type, rather than matching it with a wildcard.
+func acceptQuality(accept string, mediaType string) (float64, bool) {
+	quality := 0.0
+	specificity := -1
+	for _, mediaRange := range strings.Split(accept, ",") {
+		rangeType, params, errPMT := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+		if errPMT != nil {
+			continue
+		}
+		matched := -1
+		switch {
+		case rangeType == mediaType:
+			matched = 2
+		case rangeType == "*/*":
+			matched = 0
+		case strings.HasSuffix(rangeType, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(rangeType, "*")):
+			matched = 1
+		}
+		if matched <= specificity {
+			continue
+		}
+		specificity = matched
+		quality = 1
+		if q, ok := params["q"]; ok {
+			if parsed, errPF := strconv.ParseFloat(q, 64); errPF == nil && parsed >= 0 && parsed <= 1 {
+				quality = parsed
+			}
+		}
+	}
+	return quality, specificity == 2
+}
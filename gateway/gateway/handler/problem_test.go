@@ -0,0 +1,126 @@
+// +build all unit
+
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/user"
+)
+
+func TestAcceptsProblem(t *testing.T) {
+	cases := []struct {
+		name     string
+		hint     string
+		accept   string
+		expected bool
+	}{
+		{
+			name:     "No Accept",
+			hint:     "A client which does not say what it accepts was written for the v1 error, so should keep it",
+			accept:   "",
+			expected: false,
+		},
+		{
+			name:     "Problem",
+			hint:     "A client which asks for problems should be sent a problem",
+			accept:   ContentTypeProblemJSON,
+			expected: true,
+		},
+		{
+			name:     "Json",
+			hint:     "A client which asks only for application/json should keep receiving the v1 error",
+			accept:   ContentTypeJSON,
+			expected: false,
+		},
+		{
+			name:     "Any",
+			hint:     "A client which accepts anything, as curl and browsers do, should keep receiving the v1 error",
+			accept:   "*/*",
+			expected: false,
+		},
+		{
+			name:     "Application Wildcard",
+			hint:     "A problem should only be sent to a client which names application/problem+json",
+			accept:   "application/*",
+			expected: false,
+		},
+		{
+			name:     "Tied",
+			hint:     "A problem should only be sent if preferred over application/json, a tie keeps the v1 error",
+			accept:   "application/problem+json, application/json",
+			expected: false,
+		},
+		{
+			name:     "Json Preferred",
+			hint:     "The quality of each media range should be compared",
+			accept:   "application/problem+json;q=0.5, application/json",
+			expected: false,
+		},
+		{
+			name:     "Problem Preferred",
+			hint:     "The quality of each media range should be compared",
+			accept:   "application/json;q=0.8, application/problem+json",
+			expected: true,
+		},
+		{
+			name:     "Problem Preferred Over Wildcard",
+			hint:     "application/json matched only by a wildcard should be compared at the quality of the wildcard",
+			accept:   "application/problem+json, */*;q=0.1",
+			expected: true,
+		},
+		{
+			name:     "Most Specific",
+			hint:     "The quality of the most specific matching media range should be used, not the highest",
+			accept:   "application/*;q=0.1, application/json, */*",
+			expected: false,
+		},
+		{
+			name:     "Json Rejected",
+			hint:     "A media type with quality 0 is not acceptable",
+			accept:   "application/json;q=0, application/problem+json;q=0.5",
+			expected: true,
+		},
+	}
+
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", "/api/v1/gateway/users", nil)
+		if len(c.accept) != 0 {
+			r.Header.Set(HeaderAccept, c.accept)
+		}
+		if got := acceptsProblem(r); got != c.expected {
+			t.Errorf("case: %s: expected %t but got %t for Accept %q\nHINT: %s", c.name, c.expected, got,
+				c.accept, c.hint)
+		}
+	}
+}
+
+func TestContext_HandleErrorJson_LogOnly(t *testing.T) {
+	cx := newTestContext(t)
+	cases := []struct {
+		name       string
+		hint       string
+		errorToLog error
+	}{
+		{
+			name: "No Error",
+			hint: "An error with nothing to send the client should only be logged",
+		},
+		{
+			name:       "Store Timeout",
+			hint:       "A store timeout with nothing to send the client should only be logged",
+			errorToLog: user.ErrTimeout,
+		},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		cx.handleErrorJson(w, httptest.NewRequest(http.MethodGet, "/", nil), c.errorToLog, "testing", nil,
+			http.StatusInternalServerError)
+		if w.Body.Len() != 0 || len(w.Header()) != 0 {
+			t.Errorf("case: %s: expected nothing to be sent, but got %q with headers %v\nHINT: %s", c.name,
+				w.Body, w.Header(), c.hint)
+		}
+	}
+}
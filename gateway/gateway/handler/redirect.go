@@ -0,0 +1,30 @@
+package handler
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// HttpsRedirectHandler redirects every request to the same host and path over https,
+// on the port clients reach the gateway from. Served by the optional plain http listener.
+// A permanent redirect which preserves the method is used, so clients should not send credentials
+// over plain http again.
+func (cx *Context) HttpsRedirectHandler(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if hostname, _, errSHP := net.SplitHostPort(r.Host); errSHP == nil {
+		host = hostname
+	}
+	host = strings.Trim(host, "[]")
+	if len(host) == 0 {
+		host = cx.apiInfo.Host
+	}
+	if cx.apiInfo.Port != "443" {
+		host = net.JoinHostPort(host, cx.apiInfo.Port)
+	} else if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	target := url.URL{Scheme: "https", Host: host, Path: r.URL.Path, RawQuery: r.URL.RawQuery}
+	http.Redirect(w, r, target.String(), http.StatusPermanentRedirect)
+}
@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// requestInfoKey is the key used to retrieve the requestInfo once added to the request.
+const requestInfoKey contextKey = 7070
+
+// requestIdPattern matches the request ids accepted from clients. Other ids are replaced,
+// so they are safe to log and to forward to services.
+var requestIdPattern = regexp.MustCompile(`^[A-Za-z0-9._:/+=-]{1,128}$`)
+
+// requestInfo holds what is learned about a request as it is handled, for use once it has been handled.
+// It is shared by every handler of the request, so may be filled in by handlers after the one which added it.
+type requestInfo struct {
+	id       string
+	userUuid string
+}
+
+// RequestId represents the current handler in the request/response cycle.
+type RequestId struct {
+	handler http.Handler
+	cx      *Context
+}
+
+// NewRequestId constructs a new RequestId struct with the provided handler and Context.
+func (cx *Context) NewRequestId(handler http.Handler) http.Handler {
+	return &RequestId{handler, cx}
+}
+
+// ServeHTTP identifies the request by the X-Request-Id header sent by the client, or a new id if the client
+// did not send a valid one. The id is sent back in the response, and forwarded to services the request is
+// proxied to.
+func (ri *RequestId) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := r.Header.Get(HeaderRequestId)
+	if !requestIdPattern.MatchString(id) {
+		id = uuid.NewV4().String()
+	}
+	r.Header.Set(HeaderRequestId, id)
+	w.Header().Set(HeaderRequestId, id)
+	ri.handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestInfoKey, &requestInfo{id: id})))
+}
+
+// getRequestInfo returns the requestInfo added to the request by the RequestId middleware, or nil if it was not.
+func getRequestInfo(r *http.Request) *requestInfo {
+	if r == nil {
+		return nil
+	}
+	info, _ := r.Context().Value(requestInfoKey).(*requestInfo)
+	return info
+}
+
+// getRequestId returns the id of the request, or an empty string if it has none.
+func getRequestId(r *http.Request) string {
+	if info := getRequestInfo(r); info != nil {
+		return info.id
+	}
+	return ""
+}
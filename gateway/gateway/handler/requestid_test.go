@@ -0,0 +1,109 @@
+// +build all unit
+
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestRequestId(t *testing.T) {
+	cases := []struct {
+		name   string
+		hint   string
+		sent   string
+		accept bool
+	}{
+		{
+			name:   "Uuid",
+			hint:   "A uuid sent by the client should be used as the id",
+			sent:   "a3865f94-0c83-4e29-b6cc-1d295d062f50",
+			accept: true,
+		},
+		{
+			name:   "Other Characters",
+			hint:   "An id with characters other than letters, digits, and ._:/+=- should be replaced",
+			sent:   "Root=1-5759e988-bd862e3fe1be46a994272793;Sampled=1",
+			accept: false,
+		},
+		{
+			name:   "Punctuation",
+			hint:   "Ids made of letters, digits, and ._:/+=- should be used as the id",
+			sent:   "req.01:host/a+b=c_d-e",
+			accept: true,
+		},
+		{
+			name:   "Longest",
+			hint:   "An id of 128 characters should be used as the id",
+			sent:   strings.Repeat("a", 128),
+			accept: true,
+		},
+		{
+			name:   "Too Long",
+			hint:   "An id over 128 characters should be replaced, so it can not flood the logs",
+			sent:   strings.Repeat("a", 129),
+			accept: false,
+		},
+		{
+			name:   "Not Sent",
+			hint:   "A request without an id should be given one",
+			sent:   "",
+			accept: false,
+		},
+		{
+			name:   "Whitespace",
+			hint:   "An id with spaces should be replaced, so it can not forge fields in the logs",
+			sent:   "abc status=200",
+			accept: false,
+		},
+		{
+			name:   "Newline",
+			hint:   "An id with a newline should be replaced, so it can not forge entries in the logs",
+			sent:   "abc\nmsg=access",
+			accept: false,
+		},
+		{
+			name:   "Quote",
+			hint:   "An id with quotes should be replaced, so it is safe to log",
+			sent:   `abc"def`,
+			accept: false,
+		},
+	}
+
+	cx := &Context{}
+	for _, c := range cases {
+		var seen, forwarded string
+		ri := cx.NewRequestId(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			seen = getRequestId(r)
+			forwarded = r.Header.Get(HeaderRequestId)
+		}))
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/gateway/health", nil)
+		if len(c.sent) != 0 {
+			r.Header.Set(HeaderRequestId, c.sent)
+		}
+		w := httptest.NewRecorder()
+		ri.ServeHTTP(w, r)
+
+		if sent := w.Header().Get(HeaderRequestId); sent != seen || forwarded != seen {
+			t.Errorf("case: %s: expected the id %q to be sent back and forwarded, but got %q and %q\n"+
+				"HINT: the response, the request forwarded to services, and the logs should share one id",
+				c.name, seen, sent, forwarded)
+		}
+		if c.accept {
+			if seen != c.sent {
+				t.Errorf("case: %s: expected the id %q to be used but got %q\nHINT: %s", c.name, c.sent, seen, c.hint)
+			}
+			continue
+		}
+		if seen == c.sent {
+			t.Errorf("case: %s: expected the id %q to be replaced\nHINT: %s", c.name, c.sent, c.hint)
+		}
+		if _, errFS := uuid.FromString(seen); errFS != nil {
+			t.Errorf("case: %s: expected the id to be replaced by a uuid but got %q\nHINT: %s", c.name, seen, c.hint)
+		}
+	}
+}
@@ -1,25 +1,101 @@
 package handler
 
 import (
+	"math/rand"
 	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/session"
 )
 
+// Access log fields which may be omitted using AccessLogConfig.OmitFields.
+const (
+	AccessLogFieldClientAddr = "clientAddr"
+	AccessLogFieldUserAgent  = "userAgent"
+	AccessLogFieldUserUuid   = "userUuid"
+	AccessLogFieldQuery      = "query"
+)
+
+// accessLogRedacted replaces the value of each redacted query parameter in the access log.
+const accessLogRedacted = "REDACTED"
+
+// AccessLogConfig controls which requests are written to the access log, and what is written about them.
+type AccessLogConfig struct {
+	// SampleRatio is the fraction of successful requests which are logged.
+	// Requests which receive a 4xx or 5xx response are always logged.
+	SampleRatio float64
+	// RedactQueryParams lists the query parameters whose values are replaced in the logged query.
+	// The session token parameter, and the signature of export download links, are always redacted.
+	RedactQueryParams []string
+	// OmitFields lists the AccessLogField values which are not logged.
+	OmitFields []string
+}
+
 // RequestLogger represents the current handler in the request/response cycle.
 type RequestLogger struct {
 	handler http.Handler
 	cx      *Context
+	cfg     *AccessLogConfig
+	redact  map[string]bool
+	omit    map[string]bool
 }
 
-// NewRequestLogger constructs a new RequestLogger struct with the provided handler and Context.
-func (cx *Context) NewRequestLogger(handler http.Handler) http.Handler {
-	return &RequestLogger{handler, cx}
+// NewRequestLogger creates middleware which writes the access log described by cfg, using the Context logger.
+// If cfg is nil, every request is logged in full, except for the session token parameter.
+func (cx *Context) NewRequestLogger(cfg *AccessLogConfig) mux.MiddlewareFunc {
+	if cfg == nil {
+		cfg = &AccessLogConfig{SampleRatio: 1}
+	}
+	redact := map[string]bool{session.ParamAuthorization: true, QpExportSignature: true}
+	for _, param := range cfg.RedactQueryParams {
+		redact[param] = true
+	}
+	omit := make(map[string]bool)
+	for _, field := range cfg.OmitFields {
+		omit[field] = true
+	}
+	return func(handler http.Handler) http.Handler {
+		return &RequestLogger{handler: handler, cx: cx, cfg: cfg, redact: redact, omit: omit}
+	}
+}
+
+// ServeHTTP writes an access log entry for the request once it has been handled,
+// including the status, bytes written, duration, route template, and authenticated user.
+func (rl *RequestLogger) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	begin := time.Now()
+	rec := newStatusRecorder(w)
+	rl.handler.ServeHTTP(rec, r)
+	if rec.status < http.StatusBadRequest && rl.cfg.SampleRatio < 1 && rand.Float64() >= rl.cfg.SampleRatio {
+		return
+	}
+
+	entry := []interface{}{"msg", "access", "requestId", getRequestId(r), "method", r.Method,
+		"route", routeTemplate(r), "path", r.URL.Path, "status", rec.status, "bytes", rec.bytes,
+		"durationMs", float64(time.Since(begin).Microseconds()) / 1000}
+	if !rl.omit[AccessLogFieldQuery] && len(r.URL.RawQuery) != 0 {
+		entry = append(entry, AccessLogFieldQuery, rl.redactQuery(r.URL.Query()))
+	}
+	if info := getRequestInfo(r); !rl.omit[AccessLogFieldUserUuid] && info != nil && len(info.userUuid) != 0 {
+		entry = append(entry, AccessLogFieldUserUuid, info.userUuid)
+	}
+	if !rl.omit[AccessLogFieldClientAddr] {
+		entry = append(entry, AccessLogFieldClientAddr, r.RemoteAddr)
+	}
+	if !rl.omit[AccessLogFieldUserAgent] {
+		entry = append(entry, AccessLogFieldUserAgent, r.UserAgent())
+	}
+	_ = rl.cx.logger.Log(entry...)
 }
 
-// ServeHTTP logs all requests if in development environment
-func (gv *RequestLogger) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if gv.cx.environment == "development" {
-		_ = gv.cx.logger.Log("requestAgent", r.UserAgent(), "requestMethod", r.Method, "requestPath", r.URL.Path)
+// redactQuery encodes the query with the values of redacted parameters replaced.
+func (rl *RequestLogger) redactQuery(query url.Values) string {
+	for param := range query {
+		if rl.redact[param] {
+			query[param] = []string{accessLogRedacted}
+		}
 	}
-	//call the real handler
-	gv.handler.ServeHTTP(w, r)
+	return query.Encode()
 }
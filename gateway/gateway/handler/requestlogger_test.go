@@ -0,0 +1,249 @@
+// +build all unit
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// recordingLogger keeps every entry logged, keyed by field.
+type recordingLogger struct {
+	entries []map[string]interface{}
+}
+
+func (rl *recordingLogger) Log(keyvals ...interface{}) error {
+	entry := make(map[string]interface{})
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		entry[fmt.Sprint(keyvals[i])] = keyvals[i+1]
+	}
+	rl.entries = append(rl.entries, entry)
+	return nil
+}
+
+// serveLogged serves a request for target, sent by the user with the uuid, through a RequestLogger for cfg,
+// responding with status, and returns the entries logged.
+func serveLogged(cfg *AccessLogConfig, target, userUuid string, status int) []map[string]interface{} {
+	logger := &recordingLogger{}
+	cx := &Context{logger: logger}
+	rl := cx.NewRequestLogger(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	r.Header.Set("User-Agent", "test-agent")
+	info := &requestInfo{id: "test-request", userUuid: userUuid}
+	rl.ServeHTTP(httptest.NewRecorder(), r.WithContext(context.WithValue(r.Context(), requestInfoKey, info)))
+	return logger.entries
+}
+
+func TestRequestLogger_Redaction(t *testing.T) {
+	cases := []struct {
+		name     string
+		hint     string
+		cfg      *AccessLogConfig
+		target   string
+		expected string
+		// secrets must not appear anywhere in the entry logged
+		secrets []string
+	}{
+		{
+			name:     "Session Token",
+			hint:     "The session token query parameter should always be redacted",
+			cfg:      &AccessLogConfig{SampleRatio: 1},
+			target:   "/api/v1/anyquiz/events?access_token=secret-token&page=2",
+			expected: "access_token=REDACTED&page=2",
+			secrets:  []string{"secret-token"},
+		},
+		{
+			name:     "Session Token Default Config",
+			hint:     "The session token query parameter should be redacted when no config is provided",
+			target:   "/api/v1/anyquiz/events?access_token=secret-token",
+			expected: "access_token=REDACTED",
+			secrets:  []string{"secret-token"},
+		},
+		{
+			name:     "Export Signature",
+			hint:     "The signature of an export download link should always be redacted",
+			cfg:      &AccessLogConfig{SampleRatio: 1},
+			target:   "/api/v1/gateway/exports/a3865f94-0c83-4e29-b6cc-1d295d062f50?expires=1700000000&signature=c2lnbmVk",
+			expected: "expires=1700000000&signature=REDACTED",
+			secrets:  []string{"c2lnbmVk"},
+		},
+		{
+			name:     "Configured",
+			hint:     "The query parameters configured should be redacted",
+			cfg:      &AccessLogConfig{SampleRatio: 1, RedactQueryParams: []string{"code", "email"}},
+			target:   "/api/v1/anyquiz/callback?code=oauth-code&email=joe%40example.com&state=abc",
+			expected: "code=REDACTED&email=REDACTED&state=abc",
+			secrets:  []string{"oauth-code", "joe@example.com", "joe%40example.com"},
+		},
+		{
+			name:     "Repeated",
+			hint:     "Every value of a redacted query parameter should be redacted",
+			cfg:      &AccessLogConfig{SampleRatio: 1},
+			target:   "/api/v1/anyquiz/events?access_token=first-token&access_token=second-token",
+			expected: "access_token=REDACTED",
+			secrets:  []string{"first-token", "second-token"},
+		},
+		{
+			name:     "Encoded",
+			hint:     "A redacted query parameter should be redacted however its value is encoded",
+			cfg:      &AccessLogConfig{SampleRatio: 1},
+			target:   "/api/v1/anyquiz/events?access_token=secret%2Dtoken",
+			expected: "access_token=REDACTED",
+			secrets:  []string{"secret-token", "secret%2Dtoken"},
+		},
+		{
+			name:     "Not Redacted",
+			hint:     "Query parameters which are not redacted should be logged",
+			cfg:      &AccessLogConfig{SampleRatio: 1},
+			target:   "/api/v1/anyquiz/quizzes?page=2&sort=name",
+			expected: "page=2&sort=name",
+		},
+	}
+
+	for _, c := range cases {
+		entries := serveLogged(c.cfg, c.target, "", http.StatusOK)
+		if len(entries) != 1 {
+			t.Errorf("case: %s: expected one entry to be logged but got %d\nHINT: %s", c.name, len(entries), c.hint)
+			continue
+		}
+		if query := entries[0][AccessLogFieldQuery]; query != c.expected {
+			t.Errorf("case: %s: expected query %q to be logged but got %q\nHINT: %s", c.name, c.expected, query,
+				c.hint)
+		}
+		logged := fmt.Sprint(entries[0])
+		for _, secret := range c.secrets {
+			if strings.Contains(logged, secret) {
+				t.Errorf("case: %s: expected %q not to be logged, but the entry was %s\nHINT: %s", c.name, secret,
+					logged, c.hint)
+			}
+		}
+	}
+}
+
+func TestRequestLogger_Sampling(t *testing.T) {
+	cases := []struct {
+		name        string
+		hint        string
+		sampleRatio float64
+		status      int
+		expectLog   bool
+	}{
+		{
+			name:        "Success Sampled Out",
+			hint:        "With a sample ratio of 0, successful requests should not be logged",
+			sampleRatio: 0,
+			status:      http.StatusOK,
+		},
+		{
+			name:        "Redirect Sampled Out",
+			hint:        "With a sample ratio of 0, redirected requests should not be logged",
+			sampleRatio: 0,
+			status:      http.StatusFound,
+		},
+		{
+			name:        "Client Error",
+			hint:        "Requests which receive a 4xx response should always be logged",
+			sampleRatio: 0,
+			status:      http.StatusNotFound,
+			expectLog:   true,
+		},
+		{
+			name:        "Too Many Requests",
+			hint:        "Requests which receive a 4xx response should always be logged",
+			sampleRatio: 0.0001,
+			status:      http.StatusTooManyRequests,
+			expectLog:   true,
+		},
+		{
+			name:        "Server Error",
+			hint:        "Requests which receive a 5xx response should always be logged",
+			sampleRatio: 0,
+			status:      http.StatusBadGateway,
+			expectLog:   true,
+		},
+		{
+			name:        "Success Logged",
+			hint:        "With a sample ratio of 1, every request should be logged",
+			sampleRatio: 1,
+			status:      http.StatusOK,
+			expectLog:   true,
+		},
+	}
+
+	for _, c := range cases {
+		// Sampling is random, so each case is repeated to catch an entry which is only sometimes logged
+		for i := 0; i < 20; i++ {
+			entries := serveLogged(&AccessLogConfig{SampleRatio: c.sampleRatio}, "/api/v1/gateway/health", "",
+				c.status)
+			if logged := len(entries) != 0; logged != c.expectLog {
+				t.Errorf("case: %s: expected logged to be %t but got %t\nHINT: %s", c.name, c.expectLog, logged, c.hint)
+				break
+			}
+			if c.expectLog && entries[0]["status"] != c.status {
+				t.Errorf("case: %s: expected status %d to be logged but got %v\nHINT: %s", c.name, c.status,
+					entries[0]["status"], c.hint)
+				break
+			}
+		}
+	}
+}
+
+func TestRequestLogger_OmitFields(t *testing.T) {
+	allFields := []string{AccessLogFieldClientAddr, AccessLogFieldUserAgent, AccessLogFieldUserUuid,
+		AccessLogFieldQuery}
+	cases := []struct {
+		name string
+		hint string
+		omit []string
+	}{
+		{
+			name: "None",
+			hint: "Every field should be logged when none are omitted",
+		},
+		{
+			name: "Client",
+			hint: "Only the fields omitted should be left out",
+			omit: []string{AccessLogFieldClientAddr, AccessLogFieldUserAgent},
+		},
+		{
+			name: "All",
+			hint: "Every field omitted should be left out",
+			omit: allFields,
+		},
+		{
+			name: "Unknown",
+			hint: "Omitting a field which does not exist should change nothing",
+			omit: []string{"password"},
+		},
+	}
+
+	for _, c := range cases {
+		entries := serveLogged(&AccessLogConfig{SampleRatio: 1, OmitFields: c.omit}, "/api/v1/gateway/health?page=2",
+			"a3865f94-0c83-4e29-b6cc-1d295d062f50", http.StatusOK)
+		if len(entries) != 1 {
+			t.Errorf("case: %s: expected one entry to be logged but got %d\nHINT: %s", c.name, len(entries), c.hint)
+			continue
+		}
+		omitted := make(map[string]bool)
+		for _, field := range c.omit {
+			omitted[field] = true
+		}
+		for _, field := range allFields {
+			if _, logged := entries[0][field]; logged == omitted[field] {
+				t.Errorf("case: %s: expected field %s logged to be %t but got %t\nHINT: %s", c.name, field,
+					!omitted[field], logged, c.hint)
+			}
+		}
+		for _, field := range []string{"requestId", "method", "route", "path", "status", "durationMs"} {
+			if _, logged := entries[0][field]; !logged {
+				t.Errorf("case: %s: expected field %s to always be logged\nHINT: %s", c.name, field, c.hint)
+			}
+		}
+	}
+}
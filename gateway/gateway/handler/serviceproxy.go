@@ -1,36 +1,322 @@
 package handler
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httputil"
-	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/metrics"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/cache"
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/service"
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/session"
 )
 
 // NewServiceProxy is an http proxy that forwards requests on to the appropriate microservice,
-// as noted by the hostname provided.
-func (cx *Context) NewServiceProxy(hostname, port string) *httputil.ReverseProxy {
-	if len(hostname) == 0 {
-		_ = cx.logger.Log("error", "there must be at least one microservice address provided", "result", "exit")
-		os.Exit(1)
-	}
-
-	hostnameAndPort := fmt.Sprintf("%s:%s", hostname, port)
-
-	return &httputil.ReverseProxy{
-		Director: func(r *http.Request) {
-			r.URL.Scheme = "http"
-			r.URL.Host = hostnameAndPort
-			// Remove existing User Uuid header
-			r.Header.Del(HeaderPerceptiaUserUuid)
-			r.Header.Del(HeaderPerceptiaSessionUuid)
-
-			if user, errGAU := cx.getUserFromRequest(r); errGAU == nil && user != nil {
-				r.Header.Set(HeaderPerceptiaUserUuid, user.Uuid.String())
-			}
-			if sesUuid, errGAU := cx.getSessionUuidFromRequest(r); errGAU == nil && sesUuid != nil {
-				r.Header.Set(HeaderPerceptiaSessionUuid, sesUuid.String())
-			}
-		},
+// as described by the provided service.
+//
+// Each request is sent to one of the upstreams of the service, as picked by the service Pool.
+// The request path is forwarded unchanged, prefixed by the path of the upstream url if it has one.
+// Headers are modified according to the service HeaderPolicy.
+//
+// Requests are rejected without being sent while the circuit breaker of the service is open.
+// Requests which fail to reach the service are retried according to the service Retry policy.
+// If no response can be proxied, the client is sent the gateway Error json body.
+//
+// WebSocket upgrades and Server-Sent Events streams are passed through, flushing each write to the client.
+// Streams are closed once idle for the service streaming idle timeout, and are limited per user.
+//
+// If caching is enabled for the service, responses are served from, and stored in, responseCache,
+// which may be nil if the gateway has no response cache.
+func (cx *Context) NewServiceProxy(svc *service.Service, responseCache *cache.Cache) http.Handler {
+	director := func(r *http.Request) {
+		// Remove existing User Uuid header
+		r.Header.Del(HeaderPerceptiaUserUuid)
+		r.Header.Del(HeaderPerceptiaSessionUuid)
+
+		// Clients which can not set the Authorization header, such as browser WebSockets and EventSources,
+		// send the session token as a query parameter. It is for the gateway only, so is not forwarded.
+		if query := r.URL.Query(); len(query.Get(session.ParamAuthorization)) != 0 {
+			query.Del(session.ParamAuthorization)
+			r.URL.RawQuery = query.Encode()
+		}
+
+		for _, header := range svc.Headers.Remove {
+			r.Header.Del(header)
+		}
+		for header, value := range svc.Headers.Set {
+			r.Header.Set(header, value)
+		}
+		// Services log the id of the request, so their logs can be matched with the gateway access log.
+		if id := getRequestId(r); len(id) != 0 {
+			r.Header.Set(HeaderRequestId, id)
+		}
+
+		if !svc.Headers.ForwardsIdentity() {
+			return
+		}
+		if user, errGAU := cx.getUserFromRequest(r); errGAU == nil && user != nil {
+			r.Header.Set(HeaderPerceptiaUserUuid, user.Uuid.String())
+		}
+		if sesUuid, errGAU := cx.getSessionUuidFromRequest(r); errGAU == nil && sesUuid != nil {
+			r.Header.Set(HeaderPerceptiaSessionUuid, sesUuid.String())
+		}
+	}
+	errorHandler := func(w http.ResponseWriter, r *http.Request, err error) {
+		cx.handleServiceProxyError(w, r, svc, err)
+	}
+	base := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   time.Duration(svc.Timeouts.Dial),
+			KeepAlive: time.Second * 30,
+		}).DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       time.Second * 90,
+		TLSHandshakeTimeout:   time.Second * 10,
+		ExpectContinueTimeout: time.Second,
+		ResponseHeaderTimeout: time.Duration(svc.Timeouts.ResponseHeader),
+		TLSClientConfig:       svc.TLSConfig(),
+	}
+	var transport http.RoundTripper = &balancingTransport{svc: svc, pool: svc.Pool(),
+		duration: cx.metrics.UpstreamDuration, base: base}
+	transport = responseCache.Transport(svc, cacheIdentity, transport)
+	// The response already carries the id of the request, which services may echo back.
+	modifyResponse := func(resp *http.Response) error {
+		resp.Header.Del(HeaderRequestId)
+		return nil
+	}
+	proxy := &httputil.ReverseProxy{Director: director, Transport: transport, ErrorHandler: errorHandler,
+		ModifyResponse: modifyResponse}
+	// A negative flush interval flushes every write, so stream events reach the client as they are sent.
+	streamProxy := &httputil.ReverseProxy{Director: director, Transport: transport, ErrorHandler: errorHandler,
+		ModifyResponse: modifyResponse, FlushInterval: -1}
+	return cx.NewStreamLimiter(svc, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isStreamRequest(r) {
+			streamProxy.ServeHTTP(w, r)
+			return
+		}
+		proxy.ServeHTTP(w, r)
+	}))
+}
+
+// cacheIdentity identifies who a request is made on behalf of, so responses personalized for one user
+// are never served from the cache to another: the authenticated user, otherwise the session.
+func cacheIdentity(r *http.Request) string {
+	if sesSt, errGSS := GetSessionStateFromContext(r); errGSS == nil {
+		if sesSt.Authenticated && sesSt.User != nil {
+			return "user:" + sesSt.User.Uuid.String()
+		}
+		return "session:" + sesSt.SessionUuid.String()
+	}
+	return "anonymous"
+}
+
+// handleServiceProxyError responds with the gateway error body when a request could not be proxied.
+func (cx *Context) handleServiceProxyError(w http.ResponseWriter, r *http.Request, svc *service.Service, err error) {
+	statusCode := http.StatusBadGateway
+	message := errServiceUnreachable
+	code := CodeServiceUnreachable
+	if netErr, ok := err.(net.Error); (ok && netErr.Timeout()) || err == context.DeadlineExceeded {
+		statusCode = http.StatusGatewayTimeout
+		message = errServiceTimeout
+		code = CodeServiceTimeout
+	}
+	if err == service.ErrCircuitOpen || err == service.ErrNoHealthyUpstream {
+		statusCode = http.StatusServiceUnavailable
+		message = errServiceUnavailable
+		code = CodeServiceUnavailable
+	}
+	retErr := &Error{
+		ClientError: false,
+		ServerError: true,
+		Message:     message.Error(),
+		Context:     r.Method + " path:" + r.URL.Path,
+		Code:        code,
+	}
+	cx.handleErrorJson(w, r, err, fmt.Sprintf("unable to proxy request to service %s", svc.Name), retErr, statusCode)
+}
+
+// balancingTransport is an http.RoundTripper which sends each request to an upstream picked from the pool,
+// reporting the outcome of the request back to the pool and the circuit breaker of the service.
+type balancingTransport struct {
+	svc      *service.Service
+	pool     *service.Pool
+	duration metrics.Histogram
+	base     http.RoundTripper
+}
+
+// RoundTrip sends the request to the service, retrying it with a jittered backoff
+// if it is safe to do so and the previous attempt failed to reach the service.
+func (bt *balancingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	retry := bt.svc.Retry
+	retryable := retry.Retryable(r)
+	path := r.URL.Path
+	for attempt := 1; ; attempt++ {
+		resp, err := bt.roundTripOnce(r, path)
+		if !retryable || attempt >= retry.Attempts || !shouldRetry(r, resp, err) {
+			return resp, err
+		}
+		if resp != nil {
+			_, _ = io.Copy(ioutil.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}
+		timer := time.NewTimer(retry.BackoffFor(attempt))
+		select {
+		case <-r.Context().Done():
+			timer.Stop()
+			return nil, r.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// roundTripOnce rewrites the request to target the next upstream in the pool and sends it,
+// propagating the trace context of the attempt in the traceparent header.
+// A connection error or 5xx response is reported to the pool as a failure of that upstream,
+// and to the breaker as a failure of the service.
+func (bt *balancingTransport) roundTripOnce(r *http.Request, path string) (*http.Response, error) {
+	breaker := bt.svc.Breaker()
+	ticket, errA := breaker.Allow()
+	if errA != nil {
+		return nil, errA
 	}
+	upstream, errN := bt.pool.Next()
+	if errN != nil {
+		breaker.Failure(ticket)
+		return nil, errN
+	}
+	target := upstream.Url()
+	r.URL.Scheme = target.Scheme
+	r.URL.Host = target.Host
+	r.URL.Path = singleJoiningSlash(target.Path, path)
+
+	// Each attempt is a span of its own, and the upstream continues the trace from it.
+	ctx, span := otel.Tracer(tracerName).Start(r.Context(), "proxy "+bt.svc.Name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.PeerService(bt.svc.Name), semconv.ServerAddress(target.Host),
+			semconv.HTTPRequestMethodKey.String(r.Method), semconv.URLPath(r.URL.Path)))
+	defer span.End()
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(r.Header))
+
+	bt.pool.Acquire(upstream)
+	begin := time.Now()
+	resp, errRT := bt.base.RoundTrip(r)
+	code := "error"
+	if errRT == nil {
+		code = strconv.Itoa(resp.StatusCode)
+		span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+		if resp.StatusCode >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, resp.Status)
+		}
+	} else {
+		span.RecordError(errRT)
+		span.SetStatus(codes.Error, errRT.Error())
+	}
+	bt.duration.With("service", bt.svc.Name, "upstream", target.Host, "code", code).
+		Observe(time.Since(begin).Seconds())
+	if errRT != nil {
+		bt.pool.Release(upstream)
+		if r.Context().Err() != nil {
+			// The client went away, which says nothing about the upstream.
+			breaker.Abandon(ticket)
+			return nil, errRT
+		}
+		bt.pool.ReportFailure(upstream, errRT.Error())
+		breaker.Failure(ticket)
+		return nil, errRT
+	}
+	if resp.StatusCode >= http.StatusInternalServerError {
+		bt.pool.ReportFailure(upstream, "upstream returned status "+resp.Status)
+		breaker.Failure(ticket)
+	} else {
+		bt.pool.ReportSuccess(upstream)
+		breaker.Success(ticket)
+	}
+	// The upstream is still in use until the response body has been copied to the client,
+	// or for an upgraded connection, until the connection is closed.
+	// Streams are closed early if they are idle for too long.
+	release := func() { bt.pool.Release(upstream) }
+	idleTimeout := time.Duration(bt.svc.Streaming.IdleTimeout)
+	if conn, ok := resp.Body.(io.ReadWriteCloser); ok && resp.StatusCode == http.StatusSwitchingProtocols {
+		resp.Body = &releasingConn{ReadWriteCloser: newIdleConn(conn, idleTimeout), release: release}
+	} else if isStreamResponse(resp) {
+		resp.Body = &releasingBody{ReadCloser: newIdleBody(resp.Body, idleTimeout), release: release}
+	} else {
+		resp.Body = &releasingBody{ReadCloser: resp.Body, release: release}
+	}
+	return resp, nil
+}
+
+// shouldRetry reports if an attempt failed in a way another attempt, possibly to another upstream, may fix.
+// Requests rejected by the circuit breaker, or abandoned by the client, are never retried.
+func shouldRetry(r *http.Request, resp *http.Response, err error) bool {
+	if r.Context().Err() != nil {
+		return false
+	}
+	if err != nil {
+		return err != service.ErrCircuitOpen && err != service.ErrNoHealthyUpstream
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// releasingBody calls release once, when the body is closed.
+type releasingBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+// Close closes the underlying body and releases the upstream.
+func (rb *releasingBody) Close() error {
+	err := rb.ReadCloser.Close()
+	rb.once.Do(rb.release)
+	return err
+}
+
+// singleJoiningSlash joins the two url paths with exactly one slash between them.
+func singleJoiningSlash(a, b string) string {
+	if len(a) == 0 {
+		return b
+	}
+	aSlash := strings.HasSuffix(a, "/")
+	bSlash := strings.HasPrefix(b, "/")
+	switch {
+	case aSlash && bSlash:
+		return a + b[1:]
+	case !aSlash && !bSlash:
+		return a + "/" + b
+	}
+	return a + b
+}
+
+// releasingConn calls release once, when the upgraded connection is closed.
+type releasingConn struct {
+	io.ReadWriteCloser
+	once    sync.Once
+	release func()
+}
+
+// Close closes the underlying connection and releases the upstream.
+func (rc *releasingConn) Close() error {
+	err := rc.ReadWriteCloser.Close()
+	rc.once.Do(rc.release)
+	return err
 }
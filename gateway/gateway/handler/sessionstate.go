@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"context"
 	"time"
 
 	uuid "github.com/satori/go.uuid"
@@ -18,11 +19,62 @@ type SessionState struct {
 	StartTime     time.Time         `json:"startTime"`
 	Authenticated bool              `json:"authenticated"`
 	User          *user.User        `json:"user"`
+	// UserRead is when User was read from the user store, so it can be read again once the user changes.
+	UserRead time.Time `json:"userRead"`
 }
 
 // NewSessionState constructs a new SessionState struct using the provided startTime and User.
 func NewSessionState(startTime time.Time, user *user.User,
 	sessionUuid uuid.UUID, sessionId session.SessionID, authenticated bool) *SessionState {
-	return &SessionState{StartTime: startTime, User: user,
+	return &SessionState{StartTime: startTime, User: user, UserRead: startTime,
 		SessionUuid: sessionUuid, SessionID: sessionId, Authenticated: authenticated}
 }
+
+// SessionOwner returns the uuid of the user the session is authenticated as, so the session store can keep the
+// sessions of each user.
+func (ss *SessionState) SessionOwner() (uuid.UUID, bool) {
+	if !ss.Authenticated || ss.User == nil {
+		return uuid.Nil, false
+	}
+	return ss.User.Uuid, true
+}
+
+// RevokeUserSessions ends every authenticated session of the user in store, calling revoked with the state of each
+// session ended. Returns the number of sessions ended, which is the number ended before an error if one occurs.
+// Unless store is a session.UserLister, every session in the store is read, so it is meant for rare operations,
+// such as deleting an account.
+func RevokeUserSessions(ctx context.Context, store session.Lister, userUuid uuid.UUID,
+	revoked func(state *SessionState)) (int, error) {
+	var sids []session.SessionID
+	var errSI error
+	if userLister, ok := store.(session.UserLister); ok {
+		sids, errSI = userLister.UserSessionIds(ctx, userUuid)
+	} else {
+		sids, errSI = store.SessionIds(ctx)
+	}
+	if errSI != nil {
+		return 0, errSI
+	}
+	count := 0
+	for _, sid := range sids {
+		state := &SessionState{}
+		if errP := store.Peek(ctx, sid, state); errP != nil {
+			if errP == session.ErrStateNotFound {
+				// The session expired since the sessions were listed
+				continue
+			}
+			return count, errP
+		}
+		if !state.Authenticated || state.User == nil || !uuid.Equal(state.User.Uuid, userUuid) {
+			continue
+		}
+		if errES := session.EndSession(ctx, sid, store); errES != nil {
+			return count, errES
+		}
+		count++
+		if revoked != nil {
+			revoked(state)
+		}
+	}
+	return count, nil
+}
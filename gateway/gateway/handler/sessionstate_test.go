@@ -0,0 +1,159 @@
+// +build all unit
+
+package handler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/session"
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/user"
+)
+
+func TestRevokeUserSessions(t *testing.T) {
+	ctx := context.Background()
+	store := session.NewMemStore(time.Hour, time.Hour)
+	deleted := &user.User{Uuid: uuid.NewV4(), Username: "deleted"}
+	other := &user.User{Uuid: uuid.NewV4(), Username: "other"}
+	// save starts a session, returning its id
+	save := func(usr *user.User, authenticated bool) session.SessionID {
+		sid, errNSI := session.NewSessionID("test signing key")
+		if errNSI != nil {
+			t.Fatalf("unexpected error setting up test: %s", errNSI)
+		}
+		state := NewSessionState(time.Now(), usr, uuid.NewV4(), sid, authenticated)
+		if errS := store.Save(ctx, sid, state.SessionUuid, state); errS != nil {
+			t.Fatalf("unexpected error setting up test: %s", errS)
+		}
+		return sid
+	}
+	cases := []struct {
+		name   string
+		hint   string
+		sid    session.SessionID
+		revoke bool
+	}{
+		{
+			name:   "First Session",
+			hint:   "Every authenticated session of the user should be ended",
+			sid:    save(deleted, true),
+			revoke: true,
+		},
+		{
+			name:   "Second Session",
+			hint:   "Every authenticated session of the user should be ended",
+			sid:    save(deleted, true),
+			revoke: true,
+		},
+		{
+			name: "Other User",
+			hint: "The sessions of other users should be left open",
+			sid:  save(other, true),
+		},
+		{
+			name: "Not Authenticated",
+			hint: "Sessions which are not authenticated belong to no user, so should be left open",
+			sid:  save(user.InvalidUser, false),
+		},
+	}
+
+	var revoked []uuid.UUID
+	count, errRUS := RevokeUserSessions(ctx, store, deleted.Uuid, func(state *SessionState) {
+		revoked = append(revoked, state.SessionUuid)
+	})
+	if errRUS != nil {
+		t.Fatalf("case: Revoke: unexpected error: %s", errRUS)
+	}
+	if count != 2 || len(revoked) != 2 {
+		t.Errorf("case: Revoke: expected 2 sessions to be revoked and reported, but got %d and %d\n"+
+			"HINT: the count and the callback should cover each session ended", count, len(revoked))
+	}
+	for _, c := range cases {
+		exists, errE := store.Exists(ctx, c.sid)
+		if errE != nil {
+			t.Fatalf("case: %s: unexpected error: %s", c.name, errE)
+		}
+		if exists == c.revoke {
+			t.Errorf("case: %s: expected session to exist to be %t but got %t\nHINT: %s", c.name, !c.revoke,
+				exists, c.hint)
+		}
+	}
+
+	again, errRUSA := RevokeUserSessions(ctx, store, deleted.Uuid, nil)
+	if errRUSA != nil || again != 0 {
+		t.Errorf("case: Again: expected no sessions to be revoked, but got %d, error: %v\n"+
+			"HINT: a user without sessions has none to revoke, and the callback is optional", again, errRUSA)
+	}
+}
+
+// userListedStore is a session.UserLister which keeps the sessions of each user in memory.
+type userListedStore struct {
+	*session.MemStore
+	t     *testing.T
+	users map[uuid.UUID][]session.SessionID
+}
+
+// Save saves the session, keeping it with the sessions of its owner.
+func (s *userListedStore) Save(ctx context.Context, sid session.SessionID, suuid uuid.UUID,
+	sessionState interface{}) error {
+	if owned, ok := sessionState.(session.Owned); ok {
+		if userUuid, isOwned := owned.SessionOwner(); isOwned {
+			s.users[userUuid] = append(s.users[userUuid], sid)
+		}
+	}
+	return s.MemStore.Save(ctx, sid, suuid, sessionState)
+}
+
+// UserSessionIds returns the sessions kept for the user, including those since deleted.
+func (s *userListedStore) UserSessionIds(_ context.Context, userUuid uuid.UUID) ([]session.SessionID, error) {
+	return s.users[userUuid], nil
+}
+
+// SessionIds fails the test, as the sessions of a user should be read without listing every session.
+func (s *userListedStore) SessionIds(ctx context.Context) ([]session.SessionID, error) {
+	s.t.Errorf("case: User Lister: expected the sessions of the user to be read without listing every session")
+	return s.MemStore.SessionIds(ctx)
+}
+
+func TestRevokeUserSessions_UserLister(t *testing.T) {
+	ctx := context.Background()
+	store := &userListedStore{MemStore: session.NewMemStore(time.Hour, time.Hour), t: t,
+		users: make(map[uuid.UUID][]session.SessionID)}
+	deleted := &user.User{Uuid: uuid.NewV4(), Username: "deleted"}
+	save := func(usr *user.User, authenticated bool) session.SessionID {
+		sid, errNSI := session.NewSessionID("test signing key")
+		if errNSI != nil {
+			t.Fatalf("unexpected error setting up test: %s", errNSI)
+		}
+		state := NewSessionState(time.Now(), usr, uuid.NewV4(), sid, authenticated)
+		if errS := store.Save(ctx, sid, state.SessionUuid, state); errS != nil {
+			t.Fatalf("unexpected error setting up test: %s", errS)
+		}
+		return sid
+	}
+	first := save(deleted, true)
+	second := save(deleted, true)
+	ended := save(deleted, true)
+	save(&user.User{Uuid: uuid.NewV4(), Username: "other"}, true)
+	save(user.InvalidUser, false)
+	if errD := store.Delete(ctx, ended); errD != nil {
+		t.Fatalf("unexpected error setting up test: %s", errD)
+	}
+
+	count, errRUS := RevokeUserSessions(ctx, store, deleted.Uuid, nil)
+	if errRUS != nil || count != 2 {
+		t.Errorf("case: User Lister: expected 2 sessions to be revoked, but got %d, error: %v\n"+
+			"HINT: sessions of the user which already ended should be skipped", count, errRUS)
+	}
+	for _, sid := range []session.SessionID{first, second} {
+		if exists, _ := store.Exists(ctx, sid); exists {
+			t.Errorf("case: User Lister: expected every session of the user to be ended")
+		}
+	}
+	if count, _ := store.Count(ctx); count != 2 {
+		t.Errorf("case: User Lister: expected the sessions of others to be left open")
+	}
+}
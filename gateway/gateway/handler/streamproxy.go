@@ -0,0 +1,266 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/service"
+)
+
+// isStreamRequest reports if the request is for a long lived stream,
+// either an upgraded connection, such as a WebSocket, or a Server-Sent Events stream.
+func isStreamRequest(r *http.Request) bool {
+	return isUpgradeRequest(r) || strings.Contains(r.Header.Get(HeaderAccept), ContentTypeEventStream)
+}
+
+// isUpgradeRequest reports if the request asks for the connection to be upgraded to another protocol.
+func isUpgradeRequest(r *http.Request) bool {
+	if len(r.Header.Get(HeaderUpgrade)) == 0 {
+		return false
+	}
+	for _, value := range strings.Split(r.Header.Get(HeaderConnection), ",") {
+		if strings.EqualFold(strings.TrimSpace(value), "upgrade") {
+			return true
+		}
+	}
+	return false
+}
+
+// isStreamResponse reports if the response is a long lived stream.
+func isStreamResponse(resp *http.Response) bool {
+	return resp.StatusCode == http.StatusSwitchingProtocols ||
+		strings.HasPrefix(resp.Header.Get(HeaderContentType), ContentTypeEventStream)
+}
+
+// StreamLimiter represents the current handler in the request/response cycle,
+// limiting the number of streams each user may have open to a service at once.
+type StreamLimiter struct {
+	handler http.Handler
+	cx      *Context
+	svc     *service.Service
+
+	mu      sync.Mutex
+	streams map[string]int
+}
+
+// NewStreamLimiter constructs a new StreamLimiter for the provided service, wrapping the provided handler.
+// Requests which are not for a stream are passed on to the handler unchanged.
+func (cx *Context) NewStreamLimiter(svc *service.Service, handler http.Handler) http.Handler {
+	return &StreamLimiter{handler: handler, cx: cx, svc: svc, streams: make(map[string]int)}
+}
+
+// ServeHTTP rejects the request with a 429 if the user already has the maximum number of streams open.
+func (sl *StreamLimiter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !isStreamRequest(r) {
+		sl.handler.ServeHTTP(w, r)
+		return
+	}
+	key := streamOwner(r)
+	if !sl.acquire(key) {
+		retErr := &Error{
+			ClientError: true,
+			ServerError: false,
+			Message:     errTooManyStreams.Error(),
+			Context:     r.Method + " path:" + r.URL.Path,
+			Code:        CodeTooManyStreams,
+		}
+		sl.cx.handleErrorJson(w, r, nil, fmt.Sprintf("stream limit of %d reached for service %s by %s",
+			sl.svc.Streaming.MaxPerUser, sl.svc.Name, key), retErr, http.StatusTooManyRequests)
+		return
+	}
+	defer sl.release(key)
+	r, done := sl.cx.streams.track(r)
+	defer done()
+	sl.handler.ServeHTTP(w, r)
+}
+
+func (sl *StreamLimiter) acquire(key string) bool {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+	if sl.streams[key] >= sl.svc.Streaming.MaxPerUser {
+		return false
+	}
+	sl.streams[key]++
+	return true
+}
+
+func (sl *StreamLimiter) release(key string) {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+	sl.streams[key]--
+	if sl.streams[key] <= 0 {
+		delete(sl.streams, key)
+	}
+}
+
+// streamTracker tracks the open streams of every service, so they can be closed when the gateway shuts down.
+// Upgraded connections are hijacked from the http.Server, so are not waited for by its Shutdown.
+type streamTracker struct {
+	mu      sync.Mutex
+	next    int
+	cancels map[int]context.CancelFunc
+	closing bool
+}
+
+func newStreamTracker() *streamTracker {
+	return &streamTracker{cancels: make(map[int]context.CancelFunc)}
+}
+
+// track records the stream as open until done is called.
+// The returned request is cancelled if the stream is still open when the tracker is closed,
+// which closes the connection to the upstream.
+func (st *streamTracker) track(r *http.Request) (tracked *http.Request, done func()) {
+	ctx, cancel := context.WithCancel(r.Context())
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.closing {
+		cancel()
+		return r.WithContext(ctx), func() {}
+	}
+	id := st.next
+	st.next++
+	st.cancels[id] = cancel
+	return r.WithContext(ctx), func() {
+		cancel()
+		st.mu.Lock()
+		defer st.mu.Unlock()
+		delete(st.cancels, id)
+	}
+}
+
+// open returns the number of streams which are open.
+func (st *streamTracker) open() int {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return len(st.cancels)
+}
+
+// close cancels every open stream, and any stream opened afterwards.
+func (st *streamTracker) close() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.closing = true
+	for _, cancel := range st.cancels {
+		cancel()
+	}
+}
+
+// streamDrainPollInterval is how often CloseStreams checks if every stream has closed.
+const streamDrainPollInterval = time.Millisecond * 100
+
+// CloseStreams waits for every proxied stream to be closed by its client or upstream, until ctx is done.
+// Streams still open once ctx is done are closed, and ctx.Err() is returned once they have finished.
+func (cx *Context) CloseStreams(ctx context.Context) error {
+	ticker := time.NewTicker(streamDrainPollInterval)
+	defer ticker.Stop()
+	for cx.streams.open() > 0 {
+		select {
+		case <-ctx.Done():
+			_ = cx.logger.Log("msg", "closing streams still open", "streams", cx.streams.open())
+			cx.streams.close()
+			for cx.streams.open() > 0 {
+				<-ticker.C
+			}
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// streamOwner identifies who a stream is counted against: the authenticated user,
+// otherwise the session, otherwise the address of the client.
+func streamOwner(r *http.Request) string {
+	if sesSt, errGSS := GetSessionStateFromContext(r); errGSS == nil {
+		if sesSt.Authenticated && sesSt.User != nil {
+			return "user:" + sesSt.User.Uuid.String()
+		}
+		return "session:" + sesSt.SessionUuid.String()
+	}
+	host, _, errSHP := net.SplitHostPort(r.RemoteAddr)
+	if errSHP != nil {
+		host = r.RemoteAddr
+	}
+	return "addr:" + host
+}
+
+// idleTimer closes a stream once no data has passed through it for the idle timeout.
+type idleTimer struct {
+	timeout time.Duration
+	timer   *time.Timer
+}
+
+// newIdleTimer starts a timer which calls close once timeout passes without a call to touch.
+func newIdleTimer(timeout time.Duration, close func()) *idleTimer {
+	return &idleTimer{timeout: timeout, timer: time.AfterFunc(timeout, close)}
+}
+
+// touch records activity on the stream, restarting the idle timeout.
+func (it *idleTimer) touch() {
+	it.timer.Reset(it.timeout)
+}
+
+// stop cancels the idle timeout.
+func (it *idleTimer) stop() {
+	it.timer.Stop()
+}
+
+// idleBody is a streamed response body which is closed if the upstream sends nothing for the idle timeout.
+type idleBody struct {
+	io.ReadCloser
+	idle *idleTimer
+}
+
+func newIdleBody(body io.ReadCloser, timeout time.Duration) *idleBody {
+	return &idleBody{ReadCloser: body, idle: newIdleTimer(timeout, func() { _ = body.Close() })}
+}
+
+// Read reads from the upstream, restarting the idle timeout.
+func (ib *idleBody) Read(p []byte) (int, error) {
+	n, err := ib.ReadCloser.Read(p)
+	ib.idle.touch()
+	return n, err
+}
+
+// Close stops the idle timeout and closes the body.
+func (ib *idleBody) Close() error {
+	ib.idle.stop()
+	return ib.ReadCloser.Close()
+}
+
+// idleConn is an upgraded connection to an upstream which is closed if no data is sent
+// in either direction for the idle timeout.
+type idleConn struct {
+	io.ReadWriteCloser
+	idle *idleTimer
+}
+
+func newIdleConn(conn io.ReadWriteCloser, timeout time.Duration) *idleConn {
+	return &idleConn{ReadWriteCloser: conn, idle: newIdleTimer(timeout, func() { _ = conn.Close() })}
+}
+
+// Read reads from the upstream, restarting the idle timeout.
+func (ic *idleConn) Read(p []byte) (int, error) {
+	n, err := ic.ReadWriteCloser.Read(p)
+	ic.idle.touch()
+	return n, err
+}
+
+// Write writes to the upstream, restarting the idle timeout.
+func (ic *idleConn) Write(p []byte) (int, error) {
+	n, err := ic.ReadWriteCloser.Write(p)
+	ic.idle.touch()
+	return n, err
+}
+
+// Close stops the idle timeout and closes the connection.
+func (ic *idleConn) Close() error {
+	ic.idle.stop()
+	return ic.ReadWriteCloser.Close()
+}
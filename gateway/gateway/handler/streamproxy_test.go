@@ -0,0 +1,265 @@
+// +build all unit
+
+package handler
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	kitlog "github.com/go-kit/kit/log"
+
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/service"
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/session"
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/user"
+)
+
+// newTestContext returns a Context backed by in-memory stores, as in the development environment.
+func newTestContext(t *testing.T) *Context {
+	sessionStore := session.NewMemStore(time.Hour, time.Hour)
+	return NewContext(sessionStore, user.NewMemStore(), "test signing key",
+		[]*ApiVersion{{Version: newTestSemVer(t, "1.1.0")}}, kitlog.NewNopLogger(), "testing", nil, nil, nil, nil,
+		AccountDeletion{Sessions: sessionStore, GracePeriod: time.Hour})
+}
+
+// newTestStreamUpstream starts an upstream which serves a Server-Sent Events stream, sending one event then
+// nothing more, and echoes everything sent over a WebSocket upgrade. Streams stay open until the gateway closes them.
+func newTestStreamUpstream(t *testing.T) *httptest.Server {
+	stop := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isUpgradeRequest(r) {
+			conn, buf, errH := w.(http.Hijacker).Hijack()
+			if errH != nil {
+				t.Errorf("unexpected error hijacking upstream connection: %s", errH)
+				return
+			}
+			defer conn.Close()
+			_, _ = buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+			_ = buf.Flush()
+			_, _ = io.Copy(conn, buf)
+			return
+		}
+		w.Header().Set(HeaderContentType, ContentTypeEventStream)
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("data: hello\n\n"))
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-stop:
+		}
+	}))
+	t.Cleanup(func() {
+		close(stop)
+		upstream.Close()
+	})
+	return upstream
+}
+
+// newTestStreamGateway starts a gateway proxying every request to upstream, with the streaming limits provided.
+func newTestStreamGateway(t *testing.T, cx *Context, upstream *httptest.Server,
+	streaming service.Streaming) (*httptest.Server, *StreamLimiter) {
+	svc := &service.Service{Name: "streamer", Upstreams: []string{upstream.URL}, Streaming: streaming}
+	if _, errNR := service.NewRegistry(svc); errNR != nil {
+		t.Fatalf("unexpected error setting up test: %s", errNR)
+	}
+	limiter := cx.NewServiceProxy(svc, nil).(*StreamLimiter)
+	gateway := httptest.NewServer(limiter)
+	t.Cleanup(gateway.Close)
+	return gateway, limiter
+}
+
+// openEventStream requests a Server-Sent Events stream from the gateway.
+func openEventStream(t *testing.T, gateway *httptest.Server) *http.Response {
+	req, errNR := http.NewRequest(http.MethodGet, gateway.URL+"/api/v1/streamer/events", nil)
+	if errNR != nil {
+		t.Fatalf("unexpected error setting up test: %s", errNR)
+	}
+	req.Header.Set(HeaderAccept, ContentTypeEventStream)
+	resp, errD := gateway.Client().Do(req)
+	if errD != nil {
+		t.Fatalf("unexpected error opening event stream: %s", errD)
+	}
+	return resp
+}
+
+// openWebSocket upgrades a connection to the gateway, returning the connection once upgraded.
+func openWebSocket(t *testing.T, gateway *httptest.Server) (net.Conn, *bufio.Reader) {
+	conn, errD := net.Dial("tcp", gateway.Listener.Addr().String())
+	if errD != nil {
+		t.Fatalf("unexpected error setting up test: %s", errD)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	_, _ = fmt.Fprintf(conn, "GET /api/v1/streamer/socket HTTP/1.1\r\nHost: %s\r\n"+
+		"Connection: Upgrade\r\nUpgrade: websocket\r\n\r\n", gateway.Listener.Addr())
+	reader := bufio.NewReader(conn)
+	resp, errRR := http.ReadResponse(reader, nil)
+	if errRR != nil {
+		t.Fatalf("unexpected error upgrading connection: %s", errRR)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("unexpected status upgrading connection: %d", resp.StatusCode)
+	}
+	return conn, reader
+}
+
+// streamsCounted returns the number of streams the limiter counts as open, across every user.
+func streamsCounted(sl *StreamLimiter) int {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+	count := 0
+	for _, open := range sl.streams {
+		count += open
+	}
+	return count
+}
+
+// waitFor polls until done reports true, or fails the test once timeout passes.
+func waitFor(t *testing.T, timeout time.Duration, failure string, done func() bool) {
+	deadline := time.Now().Add(timeout)
+	for !done() {
+		if time.Now().After(deadline) {
+			t.Fatal(failure)
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+func TestStreamLimiter_MaxPerUser(t *testing.T) {
+	cx := newTestContext(t)
+	gateway, limiter := newTestStreamGateway(t, cx, newTestStreamUpstream(t),
+		service.Streaming{IdleTimeout: service.Duration(time.Minute), MaxPerUser: 1})
+
+	first := openEventStream(t, gateway)
+	if first.StatusCode != http.StatusOK {
+		t.Fatalf("case: First Stream: expected status %d but got %d", http.StatusOK, first.StatusCode)
+	}
+	event, errRS := bufio.NewReader(first.Body).ReadString('\n')
+	if errRS != nil || event != "data: hello\n" {
+		t.Errorf("case: First Stream: expected the event sent by the upstream, but got %q, error %v\n"+
+			"HINT: events should be flushed to the client as they are sent", event, errRS)
+	}
+
+	second := openEventStream(t, gateway)
+	_ = second.Body.Close()
+	if second.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("case: Limit Reached: expected status %d but got %d\n"+
+			"HINT: a user with MaxPerUser streams open should not be able to open another",
+			http.StatusTooManyRequests, second.StatusCode)
+	}
+
+	_ = first.Body.Close()
+	waitFor(t, time.Second*2, "case: Released: expected the stream to no longer be counted once closed\n"+
+		"HINT: the slot of a stream should be released when the stream closes", func() bool {
+		return streamsCounted(limiter) == 0
+	})
+	third := openEventStream(t, gateway)
+	_ = third.Body.Close()
+	if third.StatusCode != http.StatusOK {
+		t.Errorf("case: Released: expected status %d once the first stream closed, but got %d\n"+
+			"HINT: the slot of a stream should be released when the stream closes", http.StatusOK, third.StatusCode)
+	}
+}
+
+func TestStreamLimiter_IdleTimeout(t *testing.T) {
+	cases := []struct {
+		name string
+		hint string
+		// open opens the stream and returns its body, which is read until the stream is closed
+		open func(t *testing.T, gateway *httptest.Server) io.Reader
+	}{
+		{
+			name: "Server-Sent Events",
+			hint: "An event stream the upstream sends nothing on should be closed once idle",
+			open: func(t *testing.T, gateway *httptest.Server) io.Reader {
+				resp := openEventStream(t, gateway)
+				t.Cleanup(func() { _ = resp.Body.Close() })
+				return resp.Body
+			},
+		},
+		{
+			name: "WebSocket",
+			hint: "An upgraded connection nothing is sent over should be closed once idle",
+			open: func(t *testing.T, gateway *httptest.Server) io.Reader {
+				_, reader := openWebSocket(t, gateway)
+				return reader
+			},
+		},
+	}
+
+	for _, c := range cases {
+		cx := newTestContext(t)
+		gateway, limiter := newTestStreamGateway(t, cx, newTestStreamUpstream(t),
+			service.Streaming{IdleTimeout: service.Duration(time.Millisecond * 50), MaxPerUser: 1})
+		body := c.open(t, gateway)
+		closed := make(chan struct{})
+		go func() {
+			_, _ = io.Copy(ioutil.Discard, body)
+			close(closed)
+		}()
+		select {
+		case <-closed:
+		case <-time.After(time.Second * 2):
+			t.Errorf("case: %s: expected the stream to be closed after the idle timeout\nHINT: %s", c.name, c.hint)
+			continue
+		}
+		waitFor(t, time.Second*2, fmt.Sprintf("case: %s: expected the slot of the stream to be released once "+
+			"closed\nHINT: %s", c.name, c.hint), func() bool {
+			return streamsCounted(limiter) == 0
+		})
+	}
+}
+
+func TestContext_CloseStreams(t *testing.T) {
+	cx := newTestContext(t)
+	gateway, limiter := newTestStreamGateway(t, cx, newTestStreamUpstream(t),
+		service.Streaming{IdleTimeout: service.Duration(time.Minute), MaxPerUser: 2})
+	conn, reader := openWebSocket(t, gateway)
+	if _, errW := conn.Write([]byte("ping\n")); errW != nil {
+		t.Fatalf("unexpected error writing to WebSocket: %s", errW)
+	}
+	if echoed, errRS := reader.ReadString('\n'); errRS != nil || echoed != "ping\n" {
+		t.Fatalf("case: Open: expected the upstream to echo ping, but got %q, error %v", echoed, errRS)
+	}
+	events := openEventStream(t, gateway)
+	defer events.Body.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	if errCS := cx.CloseStreams(ctx); errCS != context.DeadlineExceeded {
+		t.Errorf("case: Close: expected error %s but got %v\n"+
+			"HINT: streams still open once the deadline passes should be closed, and the deadline reported",
+			context.DeadlineExceeded, errCS)
+	}
+	if open := cx.streams.open(); open != 0 {
+		t.Errorf("case: Close: expected no streams to be open but got %d\n"+
+			"HINT: CloseStreams should only return once every stream has finished", open)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second * 2))
+	if _, errRA := ioutil.ReadAll(reader); errRA != nil && strings.Contains(errRA.Error(), "timeout") {
+		t.Errorf("case: Close: expected the WebSocket to be closed, but it is still open\n" +
+			"HINT: upgraded connections are hijacked, so must be closed by CloseStreams")
+	}
+	eventsClosed := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(ioutil.Discard, events.Body)
+		close(eventsClosed)
+	}()
+	select {
+	case <-eventsClosed:
+	case <-time.After(time.Second * 2):
+		t.Errorf("case: Close: expected the event stream to be closed, but it is still open\n" +
+			"HINT: every stream still open should be closed by CloseStreams")
+	}
+	waitFor(t, time.Second*2, "case: Close: expected the slots of the streams to be released\n"+
+		"HINT: closing a stream should release its slot", func() bool {
+		return streamsCounted(limiter) == 0
+	})
+}
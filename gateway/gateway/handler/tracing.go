@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName identifies the spans created by the handlers.
+const tracerName = "github.com/uw-thalesians/perceptia-servers/gateway/gateway/handler"
+
+// Tracing represents the current handler in the request/response cycle.
+type Tracing struct {
+	handler http.Handler
+	cx      *Context
+}
+
+// NewTracing constructs a new Tracing struct with the provided handler and Context.
+func (cx *Context) NewTracing(handler http.Handler) http.Handler {
+	return &Tracing{handler, cx}
+}
+
+// ServeHTTP records a server span for the request, continuing the trace of the caller if the request
+// carries a W3C traceparent header. The span is named after the template of the route the request matched.
+func (tr *Tracing) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	route := routeTemplate(r)
+	ctx, span := otel.Tracer(tracerName).Start(ctx, r.Method+" "+route,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(semconv.HTTPRequestMethodKey.String(r.Method), semconv.HTTPRoute(route),
+			semconv.URLPath(r.URL.Path)))
+	defer span.End()
+
+	rec := newStatusRecorder(w)
+	tr.handler.ServeHTTP(rec, r.WithContext(ctx))
+	span.SetAttributes(semconv.HTTPResponseStatusCode(rec.status))
+	if rec.status >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, strconv.Itoa(rec.status)+" "+http.StatusText(rec.status))
+	}
+}
+
+// parentSpanKey is the context key of the span which was current before a traced middleware started its own.
+type parentSpanKey struct{}
+
+// TraceMiddleware wraps mw so each request it handles is recorded as a span with the given name.
+// The span ends once mw passes the request on, so it covers only the work done by mw itself,
+// and the rest of the chain continues as part of the enclosing span.
+func TraceMiddleware(name string, mw mux.MiddlewareFunc) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		traced := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			trace.SpanFromContext(r.Context()).End()
+			// Keep any values mw added to the context, but not its span.
+			parent, _ := r.Context().Value(parentSpanKey{}).(trace.Span)
+			next.ServeHTTP(w, r.WithContext(trace.ContextWithSpan(r.Context(), parent)))
+		}))
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), parentSpanKey{}, trace.SpanFromContext(r.Context()))
+			ctx, span := otel.Tracer(tracerName).Start(ctx, "middleware "+name)
+			defer span.End()
+			traced.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package health
+
+import (
+	"context"
+	"crypto/tls"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/go-redis/redis"
+
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/service"
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/utility"
+)
+
+// Keys of the info reported by the checks.
+const (
+	InfoProcedureVersion   = "procedureVersion"
+	InfoRequiredVersion    = "requiredVersion"
+	InfoCircuitBreaker     = "circuitBreaker"
+	InfoUpstreamsReachable = "upstreamsReachable"
+)
+
+// ErrUnsupportedVersion is returned when the database exposes procedures older than the version required.
+var ErrUnsupportedVersion = errors.New("health: unsupported database procedure version")
+
+// MsSqlCheck checks that the database can be reached, and that the version of its stored procedures
+// is at least requiredVersion.
+func MsSqlCheck(db *sql.DB, requiredVersion *utility.SemVer) CheckFunc {
+	return func(ctx context.Context) (map[string]string, error) {
+		info := map[string]string{InfoRequiredVersion: requiredVersion.String()}
+		if errP := db.PingContext(ctx); errP != nil {
+			return info, errP
+		}
+		var version string
+		if errS := db.QueryRowContext(ctx, "USP_ReadProcedureVersion").Scan(&version); errS != nil {
+			return info, fmt.Errorf("unable to read procedure version: %v", errS)
+		}
+		info[InfoProcedureVersion] = version
+		procVersion, errSVS := utility.SemVerFromString(version)
+		if errSVS != nil {
+			return info, fmt.Errorf("invalid procedure version %q: %v", version, errSVS)
+		}
+		if procVersion.Compare(requiredVersion) < 0 {
+			return info, ErrUnsupportedVersion
+		}
+		return info, nil
+	}
+}
+
+// PostgresCheck checks that the postgres database can be reached. Its schema is checked by the migrations
+// when the gateway starts, as postgres has no stored procedures to report a version.
+func PostgresCheck(db *sql.DB) CheckFunc {
+	return func(ctx context.Context) (map[string]string, error) {
+		return nil, db.PingContext(ctx)
+	}
+}
+
+// RedisCheck checks that redis can be reached.
+func RedisCheck(rc *redis.Client) CheckFunc {
+	return func(ctx context.Context) (map[string]string, error) {
+		return nil, rc.WithContext(ctx).Ping().Err()
+	}
+}
+
+// ServiceCheck checks that at least one upstream of the service accepts connections,
+// completing a tls handshake with https upstreams, and that its circuit breaker is not open.
+func ServiceCheck(svc *service.Service) CheckFunc {
+	return func(ctx context.Context) (map[string]string, error) {
+		breakerState := svc.Breaker().State()
+		reachable := 0
+		var errDial error
+		for _, u := range svc.UpstreamUrls() {
+			host := u.Host
+			if len(u.Port()) == 0 {
+				port := "80"
+				if u.Scheme == "https" {
+					port = "443"
+				}
+				host = net.JoinHostPort(u.Hostname(), port)
+			}
+			// Https upstreams must also complete a handshake, verifying their certificate is trusted
+			// and that they accept the client certificate of the gateway.
+			var dialer interface {
+				DialContext(ctx context.Context, network, addr string) (net.Conn, error)
+			} = &net.Dialer{}
+			if u.Scheme == "https" {
+				tlsConfig := svc.TLSConfig().Clone()
+				if len(tlsConfig.ServerName) == 0 {
+					tlsConfig.ServerName = u.Hostname()
+				}
+				dialer = &tls.Dialer{Config: tlsConfig}
+			}
+			conn, errD := dialer.DialContext(ctx, "tcp", host)
+			if errD != nil {
+				errDial = errD
+				continue
+			}
+			_ = conn.Close()
+			reachable++
+		}
+		info := map[string]string{
+			InfoCircuitBreaker:     string(breakerState),
+			InfoUpstreamsReachable: strconv.Itoa(reachable) + "/" + strconv.Itoa(len(svc.UpstreamUrls())),
+		}
+		if reachable == 0 {
+			return info, fmt.Errorf("no upstream reachable: %v", errDial)
+		}
+		if breakerState == service.BreakerOpen {
+			return info, service.ErrCircuitOpen
+		}
+		return info, nil
+	}
+}
@@ -0,0 +1,182 @@
+// Package health periodically checks the dependencies of the gateway, and reports their health.
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	kitlog "github.com/go-kit/kit/log"
+)
+
+// Status is the health of a dependency.
+type Status string
+
+const (
+	// StatusUnknown is the status of a dependency before it is first checked.
+	StatusUnknown Status = "unknown"
+	// StatusUp is the status of a dependency whose last check succeeded.
+	StatusUp Status = "up"
+	// StatusDown is the status of a dependency whose last check failed.
+	StatusDown Status = "down"
+)
+
+// Default time between checks, and time each check may take.
+const (
+	DefaultInterval = time.Second * 15
+	DefaultTimeout  = time.Second * 5
+)
+
+// CheckFunc checks the health of a dependency, returning an error if it is not healthy.
+// Info describes the dependency, such as its version, and may be returned along with an error.
+type CheckFunc func(ctx context.Context) (info map[string]string, err error)
+
+// Result is the outcome of the most recent check of a dependency.
+type Result struct {
+	Name   string `json:"name"`
+	Status Status `json:"status"`
+	// Critical dependencies must be up for the gateway to be ready.
+	Critical bool `json:"critical"`
+	// LatencyMs is the time the last check took, in milliseconds.
+	LatencyMs   float64   `json:"latencyMs"`
+	LastChecked time.Time `json:"lastChecked,omitempty"`
+	// LastError is the error of the most recent failed check, which is kept once the dependency is up again.
+	LastError   string            `json:"lastError,omitempty"`
+	LastErrorAt time.Time         `json:"lastErrorAt,omitempty"`
+	Info        map[string]string `json:"info,omitempty"`
+}
+
+type check struct {
+	fn     CheckFunc
+	result Result
+}
+
+// Registry holds the checks of every dependency, and the result of running each most recently.
+type Registry struct {
+	mx       sync.RWMutex
+	checks   []*check
+	interval time.Duration
+	timeout  time.Duration
+	logger   kitlog.Logger
+	draining bool
+}
+
+// NewRegistry creates an empty Registry which runs each check every interval, allowing it timeout to complete.
+// If interval or timeout are not positive, the defaults are used.
+func NewRegistry(interval, timeout time.Duration, logger kitlog.Logger) *Registry {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &Registry{interval: interval, timeout: timeout, logger: logger}
+}
+
+// Register adds the check of the named dependency. Checks must be registered before Run is called.
+func (reg *Registry) Register(name string, critical bool, fn CheckFunc) {
+	reg.mx.Lock()
+	defer reg.mx.Unlock()
+	reg.checks = append(reg.checks, &check{fn: fn,
+		result: Result{Name: name, Status: StatusUnknown, Critical: critical}})
+}
+
+// Run checks every dependency immediately, and then every interval, until ctx is done.
+// Each check runs in its own goroutine, so a slow dependency does not delay checking the others.
+func (reg *Registry) Run(ctx context.Context) {
+	reg.mx.RLock()
+	defer reg.mx.RUnlock()
+	for _, c := range reg.checks {
+		go reg.runCheck(ctx, c)
+	}
+}
+
+func (reg *Registry) runCheck(ctx context.Context, c *check) {
+	ticker := time.NewTicker(reg.interval)
+	defer ticker.Stop()
+	for {
+		reg.checkNow(ctx, c)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CheckAll runs every check once, waiting for them all to complete.
+func (reg *Registry) CheckAll(ctx context.Context) {
+	reg.mx.RLock()
+	checks := reg.checks
+	reg.mx.RUnlock()
+	var wg sync.WaitGroup
+	for _, c := range checks {
+		wg.Add(1)
+		go func(c *check) {
+			defer wg.Done()
+			reg.checkNow(ctx, c)
+		}(c)
+	}
+	wg.Wait()
+}
+
+// checkNow runs the check once, and records its result.
+func (reg *Registry) checkNow(ctx context.Context, c *check) {
+	checkCtx, cancel := context.WithTimeout(ctx, reg.timeout)
+	defer cancel()
+	begin := time.Now()
+	info, errC := c.fn(checkCtx)
+	latency := time.Since(begin)
+
+	reg.mx.Lock()
+	defer reg.mx.Unlock()
+	previous := c.result.Status
+	c.result.LatencyMs = float64(latency.Microseconds()) / 1000
+	c.result.LastChecked = begin.UTC()
+	c.result.Info = info
+	if errC != nil {
+		c.result.Status = StatusDown
+		c.result.LastError = errC.Error()
+		c.result.LastErrorAt = begin.UTC()
+	} else {
+		c.result.Status = StatusUp
+	}
+	if c.result.Status != previous {
+		_ = reg.logger.Log("msg", "dependency health changed", "dependency", c.result.Name, "from", previous,
+			"to", c.result.Status, "error", errC)
+	}
+}
+
+// Results returns the result of the most recent check of every dependency, in the order they were registered.
+func (reg *Registry) Results() []Result {
+	reg.mx.RLock()
+	defer reg.mx.RUnlock()
+	results := make([]Result, 0, len(reg.checks))
+	for _, c := range reg.checks {
+		results = append(results, c.result)
+	}
+	return results
+}
+
+// Drain marks the gateway as shutting down, after which it is never ready,
+// so that no new traffic is sent to it while in-flight requests complete.
+func (reg *Registry) Drain() {
+	reg.mx.Lock()
+	defer reg.mx.Unlock()
+	reg.draining = true
+}
+
+// Ready reports if every critical dependency is up, and the gateway is not draining.
+func (reg *Registry) Ready() bool {
+	reg.mx.RLock()
+	defer reg.mx.RUnlock()
+	if reg.draining {
+		return false
+	}
+	for _, c := range reg.checks {
+		if c.result.Critical && c.result.Status != StatusUp {
+			return false
+		}
+	}
+	return true
+}
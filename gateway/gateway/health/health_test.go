@@ -0,0 +1,201 @@
+// +build all unit
+
+package health
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	kitlog "github.com/go-kit/kit/log"
+
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/service"
+)
+
+func staticCheck(err error) CheckFunc {
+	return func(ctx context.Context) (map[string]string, error) {
+		return map[string]string{"checked": "true"}, err
+	}
+}
+
+func TestRegistry_Ready(t *testing.T) {
+	errDown := errors.New("unavailable")
+	cases := []struct {
+		name        string
+		hint        string
+		critical    []error
+		optional    []error
+		checked     bool
+		draining    bool
+		expectReady bool
+	}{
+		{
+			name:        "Basic: all up",
+			hint:        "The gateway is ready when every dependency is up",
+			critical:    []error{nil, nil},
+			optional:    []error{nil},
+			checked:     true,
+			expectReady: true,
+		},
+		{
+			name:        "Critical down",
+			hint:        "The gateway is not ready when any critical dependency is down",
+			critical:    []error{nil, errDown},
+			checked:     true,
+			expectReady: false,
+		},
+		{
+			name:        "Optional down",
+			hint:        "Dependencies which are not critical do not affect readiness",
+			critical:    []error{nil},
+			optional:    []error{errDown},
+			checked:     true,
+			expectReady: true,
+		},
+		{
+			name:        "Not yet checked",
+			hint:        "The gateway is not ready until critical dependencies have been checked",
+			critical:    []error{nil},
+			checked:     false,
+			expectReady: false,
+		},
+		{
+			name:        "Draining",
+			hint:        "The gateway is never ready once it has started to shut down",
+			critical:    []error{nil},
+			checked:     true,
+			draining:    true,
+			expectReady: false,
+		},
+		{
+			name:        "No checks",
+			hint:        "A gateway without dependencies is always ready",
+			checked:     true,
+			expectReady: true,
+		},
+	}
+
+	for _, c := range cases {
+		reg := NewRegistry(0, 0, kitlog.NewNopLogger())
+		for _, err := range c.critical {
+			reg.Register("critical", true, staticCheck(err))
+		}
+		for _, err := range c.optional {
+			reg.Register("optional", false, staticCheck(err))
+		}
+		if c.checked {
+			reg.CheckAll(context.Background())
+		}
+		if c.draining {
+			reg.Drain()
+		}
+		if ready := reg.Ready(); ready != c.expectReady {
+			t.Errorf("case: %s: expected ready to be %t but got %t\nHINT: %s", c.name, c.expectReady, ready, c.hint)
+		}
+	}
+}
+
+func TestRegistry_Results(t *testing.T) {
+	var err error
+	reg := NewRegistry(0, 0, kitlog.NewNopLogger())
+	reg.Register("dependency", true, func(ctx context.Context) (map[string]string, error) {
+		return nil, err
+	})
+
+	results := reg.Results()
+	if len(results) != 1 || results[0].Status != StatusUnknown {
+		t.Fatalf("case: unchecked: expected one unknown result, got %+v\n"+
+			"HINT: a dependency is unknown until it has been checked", results)
+	}
+
+	err = errors.New("connection refused")
+	reg.CheckAll(context.Background())
+	err = nil
+	reg.CheckAll(context.Background())
+	result := reg.Results()[0]
+	if result.Status != StatusUp {
+		t.Errorf("case: recovered: expected status %s but got %s", StatusUp, result.Status)
+	}
+	if result.LastError != "connection refused" || result.LastErrorAt.IsZero() {
+		t.Errorf("case: recovered: expected last error to be kept, got %q at %s\n"+
+			"HINT: the last error should be reported after the dependency recovers", result.LastError,
+			result.LastErrorAt)
+	}
+	if result.LastChecked.IsZero() {
+		t.Errorf("case: recovered: expected last checked time to be set")
+	}
+}
+
+func TestRegistry_Timeout(t *testing.T) {
+	reg := NewRegistry(0, time.Millisecond*10, kitlog.NewNopLogger())
+	reg.Register("slow", true, func(ctx context.Context) (map[string]string, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	reg.CheckAll(context.Background())
+	if result := reg.Results()[0]; result.Status != StatusDown {
+		t.Errorf("case: slow dependency: expected status %s but got %s\n"+
+			"HINT: a check should be cancelled once the timeout has passed", StatusDown, result.Status)
+	}
+}
+
+func TestServiceCheck(t *testing.T) {
+	listener, errL := net.Listen("tcp", "127.0.0.1:0")
+	if errL != nil {
+		t.Fatalf("case: N/A: unexpected error in test setup: %s", errL)
+	}
+	defer listener.Close()
+	closed, errL := net.Listen("tcp", "127.0.0.1:0")
+	if errL != nil {
+		t.Fatalf("case: N/A: unexpected error in test setup: %s", errL)
+	}
+	closedAddr := closed.Addr().String()
+	_ = closed.Close()
+
+	cases := []struct {
+		name            string
+		hint            string
+		upstreams       []string
+		expectReachable string
+		expectError     bool
+	}{
+		{
+			name:            "Basic: reachable",
+			hint:            "A service with a listening upstream is reachable",
+			upstreams:       []string{"http://" + listener.Addr().String()},
+			expectReachable: "1/1",
+			expectError:     false,
+		},
+		{
+			name:            "Some reachable",
+			hint:            "A service is reachable if any of its upstreams are",
+			upstreams:       []string{"http://" + closedAddr, "http://" + listener.Addr().String()},
+			expectReachable: "1/2",
+			expectError:     false,
+		},
+		{
+			name:            "None reachable",
+			hint:            "A service is down if none of its upstreams accept connections",
+			upstreams:       []string{"http://" + closedAddr},
+			expectReachable: "0/1",
+			expectError:     true,
+		},
+	}
+
+	for _, c := range cases {
+		svc := &service.Service{Name: "test", Upstreams: c.upstreams}
+		if _, errNR := service.NewRegistry(svc); errNR != nil {
+			t.Fatalf("case: %s: unexpected error in test setup: %s", c.name, errNR)
+		}
+		info, errC := ServiceCheck(svc)(context.Background())
+		if (errC != nil) != c.expectError {
+			t.Errorf("case: %s: expected error %t but got %v\nHINT: %s", c.name, c.expectError, errC, c.hint)
+		}
+		if info[InfoUpstreamsReachable] != c.expectReachable {
+			t.Errorf("case: %s: expected %s upstreams reachable but got %s\nHINT: %s", c.name,
+				c.expectReachable, info[InfoUpstreamsReachable], c.hint)
+		}
+	}
+}
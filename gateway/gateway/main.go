@@ -8,9 +8,22 @@ package main
 //noinspection SpellCheckingInspection
 import (
 	"context"
+	"crypto/tls"
 	"database/sql"
-
+	"encoding/json"
+	"fmt"
+
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/audit"
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/cache"
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/config"
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/export"
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/health"
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/openapi"
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/purge"
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/service"
 	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/session"
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/tlsconfig"
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/tracing"
 
 	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/user"
 
@@ -19,10 +32,15 @@ import (
 
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
 	_ "github.com/denisenkom/go-mssqldb"
 	kitlog "github.com/go-kit/kit/log"
+	_ "github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/utility"
 
 	"github.com/gorilla/mux"
@@ -31,6 +49,13 @@ import (
 // sessionDuration is the time a session is valid.
 const sessionDuration = time.Duration(time.Hour * 48)
 
+// userInvalidationRetry is the time between attempts to subscribe to user invalidations.
+const userInvalidationRetry = time.Second * 5
+
+// exportWait is the time a request for an export waits for the archive to be generated, so small archives are
+// ready in the response, rather than polled for.
+const exportWait = time.Second * 2
+
 // sqlDriverName is the name of the SQL driver to register with the go sql lib
 const sqlDriverName = "sqlserver"
 
@@ -53,97 +78,190 @@ const (
 )
 
 //
-var gatewayServiceApiVersion, _ = utility.NewSemVer(1, 0, 0)
-
-var gatewayServiceApiVersionsSupported = map[int]*utility.SemVer{gatewayServiceApiVersion.GetMajor(): gatewayServiceApiVersion}
+var gatewayServiceApiVersion, _ = utility.NewSemVer(1, 1, 0)
+
+var gatewayServiceApiVersionInitial, _ = utility.NewSemVer(1, 0, 0)
+
+// gatewayServiceApiVersions returns the versions of the gateway api served, which clients negotiate using the
+// Perceptia-Api-Version header. Version 1.0.0 is still served, deprecated and sunset at the times configured,
+// as 1.1.0 sends errors as problems and responds to account deletion with the time the account can be
+// restored before.
+func gatewayServiceApiVersions(api config.Api) []*handler.ApiVersion {
+	return []*handler.ApiVersion{
+		{Version: gatewayServiceApiVersionInitial, Deprecated: api.InitialDeprecated.Time(),
+			Sunset: api.InitialSunset.Time()},
+		{Version: gatewayServiceApiVersion},
+	}
+}
 
-var mssqlRequiredVersion, _ = utility.NewSemVer(1, 0, 0)
+var mssqlRequiredVersion, _ = utility.NewSemVer(1, 3, 0)
 
 func main() {
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+	}
+
 	logger := kitlog.NewLogfmtLogger(kitlog.NewSyncWriter(os.Stdout))
-	// Get environment setting
-	gwEnv, _ := logEnvVar(logger, "GATEWAY_ENVIRONMENT", "development", false)
+
+	// Load configuration from the optional config file, overridden by environment variables
+	cfg, errL := config.Load(os.Getenv(config.EnvConfigFile), os.LookupEnv)
+	if errL != nil {
+		_ = logger.Log("msg", "invalid configuration", "error", errL, "result", "exit")
+		os.Exit(1)
+	}
 
 	// Setup Logger
-	logger = kitlog.With(logger, "ts", kitlog.DefaultTimestampUTC, "caller", kitlog.DefaultCaller, "env", gwEnv)
+	logger = kitlog.With(logger, "ts", kitlog.DefaultTimestampUTC, "caller", kitlog.DefaultCaller,
+		"env", cfg.Environment)
 
-	// Get address for server to listen for requests on
-	listenAddr, _ := logEnvVar(logger, "GATEWAY_LISTEN_ADDR", ":443", false)
-	apiScheme, _ := logEnvVar(logger, "GATEWAY_API_SCHEME", "https", false)
-	apiHost, _ := logEnvVar(logger, "GATEWAY_API_HOST", "localhost", false)
-	apiPort, _ := logEnvVar(logger, "GATEWAY_API_PORT", "443", false)
+	// Log the effective configuration once, secrets are redacted
+	effectiveConfig, _ := json.Marshal(cfg)
+	_ = logger.Log("msg", "configuration loaded", "path", os.Getenv(config.EnvConfigFile),
+		"config", string(effectiveConfig))
 
 	apiInfo := &handler.ApiInfo{
-		Scheme: apiScheme,
-		Host:   apiHost,
-		Port:   apiPort,
+		Scheme: cfg.Api.Scheme,
+		Host:   cfg.Api.Host,
+		Port:   cfg.Api.Port,
 	}
 
-	// Get the directory path to the TLS key and cert
-	tlsCertPath := exitOnEnvError(logger, "GATEWAY_TLSCERTPATH")
-	tlsKeyPath := exitOnEnvError(logger, "GATEWAY_TLSKEYPATH")
-
-	sessionSigningKey := exitOnEnvError(logger, "GATEWAY_SESSION_KEY")
-
-	mssqlScheme := exitOnEnvError(logger, "MSSQL_SCHEME")
-
-	mssqlUsername := exitOnEnvError(logger, "MSSQL_USERNAME")
-
-	mssqlPassword := exitOnEnvError(logger, "MSSQL_PASSWORD")
-
-	mssqlHost := exitOnEnvError(logger, "MSSQL_HOST")
-
-	mssqlPort := exitOnEnvError(logger, "MSSQL_PORT")
-
-	mssqlDatabase := exitOnEnvError(logger, "MSSQL_DATABASE")
+	// Setup tracing, spans are only recorded if an exporter is configured
+	shutdownTracing, errST := tracing.Setup(context.Background(), tracing.Config{
+		Exporter:       cfg.Tracing.Exporter,
+		FilePath:       cfg.Tracing.File,
+		SampleRatio:    cfg.Tracing.SampleRatio,
+		ServiceName:    serviceGateway,
+		ServiceVersion: gatewayServiceApiVersion.String(),
+	})
+	if errST != nil {
+		_ = logger.Log("msg", "unable to setup tracing", "error", errST, "result", "exit")
+		os.Exit(1)
+	}
+	defer func() {
+		if errSD := shutdownTracing(context.Background()); errSD != nil {
+			_ = logger.Log("msg", "unable to flush spans", "error", errSD)
+		}
+	}()
 
-	redisAddress := exitOnEnvError(logger, "REDIS_ADDRESS")
+	// Setup access log, written for requests in every environment
+	accessLogConfig := &handler.AccessLogConfig{
+		SampleRatio:       cfg.AccessLog.SampleRatio,
+		RedactQueryParams: cfg.AccessLog.RedactParams,
+		OmitFields:        cfg.AccessLog.OmitFields,
+	}
 
-	aqRestHostname := exitOnEnvError(logger, "AQREST_HOSTNAME")
+	// Get the time allowed to drain in-flight requests and streams on shutdown, and the time to wait
+	// before draining, during which the gateway reports not ready so load balancers stop sending it traffic
+	shutdownTimeout := time.Duration(cfg.Shutdown.Timeout)
+	shutdownDelay := time.Duration(cfg.Shutdown.Delay)
+
+	// Background tasks, such as dependency health checks, run until the gateway shuts down
+	backgroundCtx, cancelBackground := context.WithCancel(context.Background())
+	defer cancelBackground()
+
+	// Load the registry of services the gateway proxies requests to
+	serviceRegistry := loadServiceRegistry(logger, cfg.Services)
+	observeBreakers(logger, serviceRegistry)
+
+	// Connect to the database users are stored in, mssql or postgres as configured, and apply or check its
+	// migrations. In dev mode users and audit events are kept in memory instead
+	var perceptiaDatabase *database
+	var perceptiaDb *sql.DB
+	if cfg.DevMode {
+		_ = logger.Log("msg", "dev mode, users and audit events are kept in memory, and lost when the gateway exits")
+	} else {
+		perceptiaDatabase, perceptiaDb = openPerceptiaDatabase(backgroundCtx, logger, cfg)
+	}
 
-	aqRestPort := exitOnEnvError(logger, "AQREST_PORT")
+	//Create a new Redis client, which is optional in dev mode
+	var rc *redis.Client
+	if len(cfg.Redis.Address) != 0 {
+		rc = redis.NewClient(&redis.Options{Addr: cfg.Redis.Address, Password: "", DB: 0})
+	}
 
-	// Create DSN to use for connection to mssql
-	mssqlDsn := utility.BuildDsn(mssqlScheme, mssqlUsername, mssqlPassword, mssqlHost, mssqlPort, mssqlDatabase)
+	// Periodically check the health of each dependency, the gateway is only ready while the database and redis are up
+	healthRegistry := health.NewRegistry(health.DefaultInterval, health.DefaultTimeout, logger)
+	if perceptiaDb != nil {
+		healthRegistry.Register(perceptiaDatabase.name, true, perceptiaDatabase.healthCheck(perceptiaDb))
+	}
+	if rc != nil {
+		healthRegistry.Register("redis", true, health.RedisCheck(rc))
+	}
+	for _, svc := range serviceRegistry.Services {
+		healthRegistry.Register("service:"+svc.Name, false, health.ServiceCheck(svc))
+	}
+	healthRegistry.Run(backgroundCtx)
 
-	// Connect to mssql database
-	perceptiaDb, errEMSD := sql.Open(sqlDriverName, mssqlDsn.String())
-	if errEMSD != nil {
-		if gwEnv == "development" {
-			_ = logger.Log("msg", "unable to connect to db", "dsn", mssqlDsn.String(), "error", errEMSD, "result", "exit")
-		} else {
-			_ = logger.Log("msg", "unable to connect to db", "dsn", "hidden", "error", errEMSD, "result", "exit")
+	// Setup Stores
+	var dbStore user.Store = user.NewMemStore()
+	var auditStore audit.Store = audit.NewMemStore()
+	if perceptiaDb != nil {
+		var errNMSDB, errNAS error
+		dbStore, errNMSDB = perceptiaDatabase.userStore(perceptiaDb)
+		if errNMSDB != nil {
+			_ = logger.Log("error", errNMSDB, "result", "exit")
+			os.Exit(1)
 		}
-		os.Exit(1)
+		auditStore, errNAS = perceptiaDatabase.auditStore(perceptiaDb)
+		if errNAS != nil {
+			_ = logger.Log("msg", "unable to create audit store", "error", errNAS, "result", "exit")
+			os.Exit(1)
+		}
+		registerSqlPoolMetrics(perceptiaDb)
+	}
+	var readStore user.Store = user.NewInstrumentedStore(dbStore, newStoreDurationHistogram("user_store"))
+	// Users are read through a cache in redis, and the users kept in sessions are read again once any gateway
+	// changes them
+	var userInvalidations *user.Invalidations
+	if rc != nil && cfg.Stores.UserCacheTtl > 0 {
+		cachedStore := user.NewCachedStore(readStore, rc, time.Duration(cfg.Stores.UserCacheTtl))
+		userInvalidations = user.NewInvalidations()
+		go subscribeUserInvalidations(backgroundCtx, logger, cachedStore, userInvalidations)
+		readStore = cachedStore
 	}
+	// Each call is traced as part of its request, and fails with user.ErrTimeout if it takes longer than allowed
+	userStore := user.NewTracedStore(user.NewTimeoutStore(readStore, cfg.Stores.User()))
 
-	// Periodically check status of mssql database connection
-	mssqlStatusNotOkay := make(chan bool, 1)
-	mssqlStatusNotOkay <- true
-	pingDbCtx := context.TODO()
-	go utility.PingDatabase(pingDbCtx, perceptiaDb, time.Second*10, time.Minute, mssqlRequiredVersion, logger, mssqlStatusNotOkay)
+	// Sessions are kept in redis, or in memory in dev mode if no redis address is set
+	var countedSessionStore countedStore = session.NewMemStore(sessionDuration, time.Minute)
+	if rc != nil {
+		countedSessionStore = session.NewRedisStore(rc, sessionDuration)
+	}
+	sessionStore := session.NewTracedStore(session.NewTimeoutStore(
+		session.NewInstrumentedStore(countedSessionStore, newStoreDurationHistogram("session_store")),
+		cfg.Stores.Session()))
+	go countActiveSessions(backgroundCtx, countedSessionStore, time.Minute, logger)
 
-	//Create a new Redis client.
-	rc := redis.NewClient(&redis.Options{Addr: redisAddress, Password: "", DB: 0})
-	redisStatusNotOkay := make(chan bool, 1)
-	redisStatusNotOkay <- true
-	pingRedisCtx := context.TODO()
-	go utility.PingRedis(pingRedisCtx, rc, time.Second*10, time.Minute, logger, redisStatusNotOkay)
+	// Setup audit log, written to the database and optionally a json lines file
+	auditLog := newAuditLog(logger, auditStore, cfg.Audit.File)
 
-	// Setup Stores
-	userStore, errNMSDB := user.NewMsSqlStore(perceptiaDb)
-	if errNMSDB != nil {
-		_ = logger.Log("error", errNMSDB, "result", "exit")
-		os.Exit(1)
+	// Setup response cache, only used by services which enable caching
+	responseCache := newResponseCache(logger, rc, serviceRegistry)
+
+	// Create Handler Context
+	hcx := handler.NewContext(sessionStore, userStore, cfg.Session.Key.Value(), gatewayServiceApiVersions(cfg.Api), logger,
+		cfg.Environment, apiInfo, newHandlerMetrics(), auditLog, userInvalidations,
+		handler.AccountDeletion{Sessions: countedSessionStore, GracePeriod: time.Duration(cfg.Deletion.GracePeriod)})
+
+	// Exports of the personal data of users are kept in redis, so they can be downloaded from any gateway,
+	// or in memory in dev mode if no redis address is set
+	var exportStore export.Store = export.NewMemStore(time.Duration(cfg.Export.Ttl))
+	if rc != nil {
+		exportStore = export.NewRedisStore(rc, time.Duration(cfg.Export.Ttl))
 	}
+	exporter := export.NewExporter(exportStore, userStore, auditLog, logger, time.Duration(cfg.Export.Timeout),
+		exportWait)
+	ehcx := hcx.NewExportHandlerContext(exporter, exportStore, export.NewSigner(cfg.Session.Key.Value()),
+		time.Duration(cfg.Export.LinkTtl))
 
-	sessionStore := session.NewRedisStore(rc, sessionDuration)
+	// Purge deleted accounts once their grace period has passed, telling each service to delete their data
+	purger := purge.NewPurger(userStore, serviceRegistry, auditLog, logger, time.Duration(cfg.Deletion.GracePeriod))
+	go purger.Run(backgroundCtx, time.Duration(cfg.Deletion.PurgeInterval))
 
-	// Create Handler Context
-	hcx := handler.NewContext(sessionStore, userStore, sessionSigningKey,
-		gatewayServiceApiVersion, gatewayServiceApiVersionsSupported, logger, apiInfo)
+	// Periodically check status of each service upstream
+	serviceRegistry.RunHealthChecks(backgroundCtx, logger)
 
-	hhcx := hcx.NewHealthHandlerContext(mssqlStatusNotOkay, redisStatusNotOkay)
+	hhcx := hcx.NewHealthHandlerContext(healthRegistry, serviceRegistry)
 
 	// Create new mux router
 	gmux := mux.NewRouter()
@@ -155,14 +273,31 @@ func main() {
 
 	//// Service Routes
 
-	// "/api/vX/anyquiz/"
-	gmuxApiV.PathPrefix("/" + serviceAqRest + "/").Handler(hcx.NewServiceProxy(aqRestHostname, aqRestPort))
+	// "/api/vX/{service}/"
+	for _, svc := range serviceRegistry.Services {
+		gmuxApiVService := gmuxApiV.PathPrefix("/" + svc.PathPrefix + "/").Subrouter()
+		gmuxApiVService.PathPrefix("").Handler(hcx.NewServiceProxy(svc, responseCache))
+
+		// Add Middleware to "/api/{majorVersion}/{service}"
+		switch svc.Auth {
+		case service.AuthSession:
+			gmuxApiVService.Use(handler.TraceMiddleware("EnsureSession", hcx.NewEnsureSession))
+		case service.AuthAuthenticated:
+			gmuxApiVService.Use(handler.TraceMiddleware("EnsureAuth", hcx.NewEnsureAuth))
+		}
+		_ = logger.Log("msg", "service registered", "service", svc.Name, "pathPrefix", svc.PathPrefix,
+			"auth", svc.Auth, "upstreams", strings.Join(svc.Upstreams, ","), "cache", svc.Cache.Enabled)
+	}
 
 	//// Gateway routes /api/vX/gateway/
 	gmuxApiVGateway := gmuxApiV.PathPrefix("/" + serviceGateway + "/").Subrouter()
 
-	// Health check route
+	// Health check routes
 	gmuxApiVGateway.HandleFunc("/"+colHealth, hhcx.HealthHandler)
+	gmuxApiVGateway.HandleFunc("/"+colHealth+"/live", hhcx.HealthLiveHandler)
+	gmuxApiVGateway.HandleFunc("/"+colHealth+"/ready", hhcx.HealthReadyHandler)
+	gmuxApiVGateway.Handle("/"+colHealth+"/details", handler.TraceMiddleware("EnsureAuth", hcx.NewEnsureAuth)(
+		http.HandlerFunc(hhcx.HealthDetailsHandler)))
 
 	// Users route
 	gmuxApiVGateway.HandleFunc("/"+colUsers, hcx.UsersDefaultHandler)
@@ -171,6 +306,13 @@ func main() {
 
 	gmuxApiVGateway.HandleFunc("/"+colSessions, hcx.SessionsDefaultHandler)
 
+	// OpenAPI spec route, the spec the gateway api is described by
+	gmuxApiVGateway.HandleFunc("/openapi.yaml", hcx.OpenApiSpecHandler)
+
+	// Exports route, the signed link authorizes the download so no session is needed
+	gmuxApiVGateway.HandleFunc("/"+handler.ColExports+"/{"+handler.ReqVarExportUuid+":"+uuidV4Regex+"}",
+		ehcx.ExportsDownloadHandler)
+
 	// Users Subroutes
 	gmuxApiVGatewayUsers := gmuxApiVGateway.PathPrefix("/" + colUsers + "/").Subrouter()
 
@@ -178,6 +320,8 @@ func main() {
 	gmuxApiVGatewayUsersSpecific := gmuxApiVGatewayUsers.PathPrefix("/{" + handler.ReqVarUserUuid +
 		":" + uuidV4Regex + "}").Subrouter()
 
+	gmuxApiVGatewayUsersSpecific.HandleFunc("/activity", hcx.UsersActivityHandler)
+	gmuxApiVGatewayUsersSpecific.HandleFunc("/export", ehcx.UsersExportHandler)
 	gmuxApiVGatewayUsersSpecific.PathPrefix("").HandlerFunc(hcx.UsersSpecificHandler)
 
 	// Sessions Subroutes
@@ -192,63 +336,214 @@ func main() {
 	gmuxApiVGatewaySessionsSpecific.PathPrefix("").HandlerFunc(hcx.SessionsSpecificHandler)
 
 	// Add Middleware to "/"
-	gmux.NotFoundHandler = http.HandlerFunc(hcx.NotFoundHandler)
+	requestLogger := hcx.NewRequestLogger(accessLogConfig)
+	gmux.NotFoundHandler = hcx.NewRequestId(requestLogger(hcx.NewTracing(hcx.NewRequestMetrics(
+		http.HandlerFunc(hcx.NotFoundHandler)))))
+	gmux.Use(hcx.NewRequestId)
+	gmux.Use(requestLogger)
+	gmux.Use(hcx.NewTracing)
+	gmux.Use(hcx.NewRequestMetrics)
 	// Add Middleware to "/api"
 	//gmuxApi.Use
-	gmuxApi.Use(handler.NewCors)
-	gmuxApi.Use(hcx.NewAuthenticator)
-	gmuxApi.Use(hcx.NewRequestLogger)
+	gmuxApi.Use(handler.TraceMiddleware("Cors", handler.NewCors))
+	gmuxApi.Use(handler.TraceMiddleware("Authenticator", hcx.NewAuthenticator))
 
 	// Add Middleware to "/api/{majorVersion}"
 	// gmuxApiV.Use
 
 	// Add Middleware to "/api/{majorVersion}/gateway"
 	// gmuxApiVGateway.Use
-	gmuxApiVGateway.Use(hcx.NewGatewayVersion)
-	gmuxApiVGateway.Use(hcx.NewEnsureGatewayVersionSupported)
+	gmuxApiVGateway.Use(handler.TraceMiddleware("GatewayVersion", hcx.NewGatewayVersion))
+	gmuxApiVGateway.Use(handler.TraceMiddleware("EnsureGatewayVersionSupported", hcx.NewEnsureGatewayVersionSupported))
+	if cfg.OpenApi.Validate {
+		// Reject requests which do not match the spec, and in development log responses which do not
+		validator, errNV := openapi.NewValidator()
+		if errNV != nil {
+			_ = logger.Log("msg", "unable to load the openapi spec", "error", errNV, "result", "exit")
+			os.Exit(1)
+		}
+		gmuxApiVGateway.Use(handler.TraceMiddleware("OpenApiValidation", hcx.NewOpenApiValidation(validator)))
+	}
 
 	// Add Middleware to "/api/{majorVersion}/gateway/users/{uuid}"
-	gmuxApiVGatewayUsersSpecific.Use(hcx.NewEnsureAuth)
+	gmuxApiVGatewayUsersSpecific.Use(handler.TraceMiddleware("EnsureAuth", hcx.NewEnsureAuth))
 
 	// Add Middleware to "/api/{majorVersion}/gateway/sessions/{matchVar}"
-	gmuxApiVGatewaySessionsSpecific.Use(hcx.NewEnsureSession)
-
-	// Add Middleware to "/api/{majorVersion}/anyquiz"
+	gmuxApiVGatewaySessionsSpecific.Use(handler.TraceMiddleware("EnsureSession", hcx.NewEnsureSession))
+
+	//// Admin routes, served on the internal admin listener
+	ahcx := hcx.NewAdminHandlerContext(responseCache)
+	adminMux := mux.NewRouter()
+	adminMux.HandleFunc("/cache/purge", ahcx.CachePurgeHandler)
+	adminMux.Handle("/metrics", promhttp.Handler())
+	adminMux.NotFoundHandler = http.HandlerFunc(hcx.NotFoundHandler)
+
+	// Streams and proxied responses may be open for longer than any fixed write timeout,
+	// so only reading the request headers and idle keep-alive connections are limited
+	server := &http.Server{Addr: cfg.Server.ListenAddr, Handler: gmux, ReadHeaderTimeout: serverReadHeaderTimeout,
+		IdleTimeout: serverIdleTimeout, TLSConfig: newTlsConfig(backgroundCtx, logger, cfg.TLS)}
+	adminServer := &http.Server{Addr: cfg.Server.AdminListenAddr, Handler: adminMux, ReadHeaderTimeout: serverReadHeaderTimeout,
+		IdleTimeout: serverIdleTimeout}
+
+	go func() {
+		_ = logger.Log("adminListenAddress", cfg.Server.AdminListenAddr)
+		errALS := adminServer.ListenAndServe()
+		if errALS != nil && errALS != http.ErrServerClosed {
+			_ = logger.Log("http.ListenAndServe", "an error occurred while serving admin routes", "error", errALS.Error())
+		}
+	}()
+
+	servers := []*http.Server{server, adminServer}
+	if len(cfg.Server.HttpRedirectAddr) != 0 {
+		redirectServer := &http.Server{Addr: cfg.Server.HttpRedirectAddr, Handler: http.HandlerFunc(hcx.HttpsRedirectHandler),
+			ReadHeaderTimeout: serverReadHeaderTimeout, IdleTimeout: serverIdleTimeout}
+		servers = append(servers, redirectServer)
+		go func() {
+			_ = logger.Log("httpRedirectAddress", cfg.Server.HttpRedirectAddr)
+			errRLS := redirectServer.ListenAndServe()
+			if errRLS != nil && errRLS != http.ErrServerClosed {
+				_ = logger.Log("http.ListenAndServe", "an error occurred while serving https redirects",
+					"error", errRLS.Error())
+			}
+		}()
+	}
 
 	//Starts listening at the address set, and passes requests at that address
-	//to the mux. Exits if ListenAndServerTLS fails
-	_ = logger.Log("listenAddress", listenAddr)
-	errLS := http.ListenAndServeTLS(listenAddr, tlsCertPath, tlsKeyPath, gmux)
-	if errLS != nil {
+	//to the mux. Shuts down if ListenAndServerTLS fails
+	serveErrors := make(chan error, 1)
+	go func() {
+		_ = logger.Log("listenAddress", cfg.Server.ListenAddr)
+		// Certificates are served by the TLSConfig of the server, so no files are given here
+		serveErrors <- server.ListenAndServeTLS("", "")
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	select {
+	case errLS := <-serveErrors:
 		_ = logger.Log("http.ListenAndServerTLS", "an error occurred while serving", "error", errLS.Error())
+	case sig := <-signals:
+		_ = logger.Log("msg", "shutting down", "signal", sig.String(), "delay", shutdownDelay.String(),
+			"timeout", shutdownTimeout.String())
+		healthRegistry.Drain()
+		time.Sleep(shutdownDelay)
 	}
+	signal.Stop(signals)
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancelShutdown()
+	drainServers(shutdownCtx, logger, hcx, servers...)
+
+	// Stop background tasks, and close connections to dependencies once no request can use them
+	cancelBackground()
+	if errC := auditLog.Close(); errC != nil {
+		_ = logger.Log("msg", "unable to close audit log", "error", errC)
+	}
+	if perceptiaDb != nil {
+		if errC := perceptiaDb.Close(); errC != nil {
+			_ = logger.Log("msg", "unable to close database connections", "error", errC)
+		}
+	}
+	if rc != nil {
+		if errC := rc.Close(); errC != nil {
+			_ = logger.Log("msg", "unable to close redis connections", "error", errC)
+		}
+	}
+	_ = logger.Log("msg", "shutdown complete")
 }
 
-func logEnvVar(logger kitlog.Logger, envVar, defaultVal string, required bool) (envVal string, err error) {
-	err = nil
-	envVal = ""
-	if required {
-		envVal, err = utility.RequireEnv(envVar)
-		if err != nil {
-			return
+// loadServiceRegistry loads the service registry from the file at cfg.ConfigPath.
+// If it is not set, a registry containing only the anyquiz service is built from cfg.AqRestHostname
+// and cfg.AqRestPort. Exits if the registry can not be loaded.
+func loadServiceRegistry(logger kitlog.Logger, cfg config.Services) *service.Registry {
+	if len(cfg.ConfigPath) != 0 {
+		reg, errLR := service.LoadRegistry(cfg.ConfigPath)
+		if errLR != nil {
+			_ = logger.Log("msg", "unable to load service registry", "path", cfg.ConfigPath, "error", errLR,
+				"result", "exit")
+			os.Exit(1)
 		}
-	} else {
-		var varSet bool
-		envVal, varSet = utility.DefaultEnv(envVar, defaultVal)
-		if !varSet {
-			_ = logger.Log("notice", "environment variable not set, using default value", "var", envVar, "default", defaultVal)
+		return reg
+	}
+
+	reg, errNR := service.NewRegistry(&service.Service{
+		Name:      serviceAqRest,
+		Upstreams: []string{fmt.Sprintf("http://%s:%s", cfg.AqRestHostname, cfg.AqRestPort)},
+	})
+	if errNR != nil {
+		_ = logger.Log("msg", "unable to create service registry", "error", errNR, "result", "exit")
+		os.Exit(1)
+	}
+	return reg
+}
+
+// newAuditLog creates the audit log, stored in auditStore. If auditFile is set, events are also
+// appended to that file as json lines. Exits if the audit log can not be created.
+func newAuditLog(logger kitlog.Logger, auditStore audit.Store, auditFile string) *audit.Log {
+	auditLogger := kitlog.With(logger, "component", "audit")
+	if len(auditFile) == 0 {
+		return audit.NewLog(auditStore, auditLogger)
+	}
+	fileWriter, errNFW := audit.NewFileWriter(auditFile)
+	if errNFW != nil {
+		_ = logger.Log("msg", "unable to open audit file", "path", auditFile, "error", errNFW, "result", "exit")
+		os.Exit(1)
+	}
+	return audit.NewLog(auditStore, auditLogger, fileWriter)
+}
+
+// subscribeUserInvalidations records each user invalidated by any gateway in invalidations until ctx is done,
+// subscribing again after userInvalidationRetry if the subscription can not be made, such as while redis is down.
+func subscribeUserInvalidations(ctx context.Context, logger kitlog.Logger, store *user.CachedStore,
+	invalidations *user.Invalidations) {
+	for {
+		if errS := store.Subscribe(ctx, invalidations.Invalidate); errS != nil {
+			_ = logger.Log("msg", "unable to subscribe to user invalidations", "error", errS)
+		}
+		select {
+		case <-ctx.Done():
 			return
+		case <-time.After(userInvalidationRetry):
 		}
 	}
-	_ = logger.Log("logEnvVar", "environment variable set", "var", envVar, "val", envVal)
-	return
 }
 
-func exitOnEnvError(logger kitlog.Logger, envVar string) (envVal string) {
-	val, errL := logEnvVar(logger, envVar, "", true)
-	if errL != nil {
-		_ = logger.Log("exitOnEnvError", "environment variable must be set", "error", errL, "var", envVar, "result", "exit")
+// newResponseCache creates the redis backed response cache, counting hits and misses for each service.
+// Returns nil if no service has caching enabled, or there is no redis client, as in dev mode.
+func newResponseCache(logger kitlog.Logger, rc *redis.Client, reg *service.Registry) *cache.Cache {
+	enabled := false
+	for _, svc := range reg.Services {
+		enabled = enabled || svc.Cache.Enabled
+	}
+	if !enabled {
+		return nil
+	}
+	if rc == nil {
+		_ = logger.Log("msg", "responses are not cached, as no redis address is set")
+		return nil
+	}
+	return cache.New(cache.NewRedisStore(rc), newCacheResultsCounter(), kitlog.With(logger, "component", "cache"))
+}
+
+// newTlsConfig creates the tls config of the gateway server, serving the certificate at cfg.CertPath, and any
+// additional certificates for other server names listed by cfg.SniCertPaths and cfg.SniKeyPaths.
+// Certificates are reloaded when their files change, until ctx is done. Exits if the certificates can not be loaded.
+func newTlsConfig(ctx context.Context, logger kitlog.Logger, cfg config.TLS) *tls.Config {
+	// The version and cipher suites have already been validated with the rest of the configuration
+	minVersion, _ := tlsconfig.ParseVersion(cfg.MinVersion)
+	cipherSuites, _ := tlsconfig.ParseCipherSuites(cfg.CipherSuites)
+
+	pairs := []tlsconfig.KeyPair{{CertPath: cfg.CertPath, KeyPath: cfg.KeyPath}}
+	for i := range cfg.SniCertPaths {
+		pairs = append(pairs, tlsconfig.KeyPair{CertPath: cfg.SniCertPaths[i], KeyPath: cfg.SniKeyPaths[i]})
+	}
+	reloader, errNR := tlsconfig.NewReloader(pairs, kitlog.With(logger, "component", "tls"))
+	if errNR != nil {
+		_ = logger.Log("msg", "unable to load tls certificates", "error", errNR, "result", "exit")
 		os.Exit(1)
 	}
-	return val
+	if cfg.ReloadInterval > 0 {
+		go reloader.Watch(ctx, time.Duration(cfg.ReloadInterval))
+	}
+	return tlsconfig.New(reloader, minVersion, cipherSuites)
 }
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+	kitprometheus "github.com/go-kit/kit/metrics/prometheus"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/handler"
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/service"
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/session"
+)
+
+// metricsNamespace prefixes the name of every metric reported by the gateway.
+const metricsNamespace = "gateway"
+
+// newHandlerMetrics creates the metrics recorded by the handlers, registered with the default prometheus registry.
+func newHandlerMetrics() *handler.Metrics {
+	return &handler.Metrics{
+		RequestCount: kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "http",
+			Name:      "requests_total",
+			Help:      "Number of requests handled, by route template, method, and status code.",
+		}, []string{"route", "method", "code"}),
+		RequestDuration: kitprometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "http",
+			Name:      "request_duration_seconds",
+			Help:      "Time taken to respond to requests, by route template, method, and status code.",
+			Buckets:   stdprometheus.DefBuckets,
+		}, []string{"route", "method", "code"}),
+		UpstreamDuration: kitprometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "proxy",
+			Name:      "upstream_duration_seconds",
+			Help:      "Time taken for an upstream to send the response headers of a proxied request.",
+			Buckets:   stdprometheus.DefBuckets,
+		}, []string{"service", "upstream", "code"}),
+		PasswordVerifyDuration: kitprometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "auth",
+			Name:      "password_verify_duration_seconds",
+			Help:      "Time taken to verify a password against its argon2 hash, by result.",
+			Buckets:   []float64{.01, .025, .05, .1, .25, .5, 1, 2.5},
+		}, []string{"result"}),
+	}
+}
+
+// newStoreDurationHistogram creates a histogram for the duration of calls to a store, by method and success.
+func newStoreDurationHistogram(subsystem string) metrics.Histogram {
+	return kitprometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Subsystem: subsystem,
+		Name:      "duration_seconds",
+		Help:      "Time taken by calls to the store, by method and success.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"method", "success"})
+}
+
+// newCacheResultsCounter creates the counter of requests passing through the response cache, by service and result.
+func newCacheResultsCounter() metrics.Counter {
+	return kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "proxy",
+		Name:      "cache_requests_total",
+		Help:      "Number of proxied requests by whether they were served from the response cache.",
+	}, []string{"service", "result"})
+}
+
+// registerSqlPoolMetrics reports the state of the connection pool of the database.
+func registerSqlPoolMetrics(db *sql.DB) {
+	stdprometheus.MustRegister(
+		stdprometheus.NewGaugeFunc(stdprometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "sql",
+			Name:      "connections_open",
+			Help:      "Number of open connections to the database.",
+		}, func() float64 { return float64(db.Stats().OpenConnections) }),
+		stdprometheus.NewGaugeFunc(stdprometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "sql",
+			Name:      "connections_in_use",
+			Help:      "Number of connections to the database currently in use.",
+		}, func() float64 { return float64(db.Stats().InUse) }),
+	)
+}
+
+// countedStore is a session store which can count, and list, the sessions which have not expired.
+type countedStore interface {
+	session.Lister
+	Count(ctx context.Context) (int, error)
+}
+
+// countActiveSessions periodically counts the sessions in the store until ctx is done.
+// Counting scans the store, so is done on an interval rather than each time metrics are collected.
+func countActiveSessions(ctx context.Context, store countedStore, interval time.Duration,
+	logger kitlog.Logger) {
+	active := kitprometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "sessions",
+		Name:      "active",
+		Help:      "Number of sessions which have not expired.",
+	}, []string{})
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		count, errC := store.Count(ctx)
+		if errC != nil {
+			_ = logger.Log("msg", "unable to count active sessions", "error", errC)
+		} else {
+			active.Set(float64(count))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// observeBreakers logs and counts each state transition of the circuit breaker of every service.
+func observeBreakers(logger kitlog.Logger, reg *service.Registry) {
+	transitions := kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "proxy",
+		Name:      "circuit_breaker_transitions_total",
+		Help:      "Number of times the circuit breaker of a service changed state.",
+	}, []string{"service", "from", "to"})
+	reg.ObserveBreakers(func(svc *service.Service, from, to service.BreakerState) {
+		transitions.With("service", svc.Name, "from", string(from), "to", string(to)).Add(1)
+		_ = logger.Log("msg", "circuit breaker state changed", "service", svc.Name, "from", from, "to", to)
+	})
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	kitlog "github.com/go-kit/kit/log"
+
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/config"
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/migration"
+)
+
+// Time allowed for the database to be reached when the gateway starts, and the time between attempts,
+// as the database may start after the gateway.
+const (
+	migrationConnectTimeout = time.Minute * 2
+	migrationConnectRetry   = time.Second * 5
+)
+
+// migrateCommand applies the migrations embedded in the gateway to the database of the configuration.
+// With -dry-run, it prints what would be done without changing the database.
+func migrateCommand(args []string, _ io.Reader, stdout, stderr io.Writer) int {
+	flags, path := newFlagSet("migrate", stderr)
+	dryRun := flags.Bool("dry-run", false, "print the migrations which would be applied, without applying them")
+	if errP := flags.Parse(args); errP != nil {
+		return 2
+	}
+	cfg := loadConfig(*path, stderr)
+	if cfg == nil {
+		return 1
+	}
+	if cfg.DevMode {
+		_, _ = fmt.Fprintln(stderr, errDevMode)
+		return 1
+	}
+
+	d := databaseOf(cfg)
+	migrations, errE := migration.Embedded(d.dialect)
+	if errE != nil {
+		_, _ = fmt.Fprintln(stderr, errE)
+		return 1
+	}
+	db, errOMD := d.connectMigration()
+	if errOMD != nil {
+		_, _ = fmt.Fprintln(stderr, errOMD)
+		return 1
+	}
+	defer db.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	runner := migration.NewRunner(db, d.dialect, migrations)
+
+	if *dryRun {
+		plan, errP := runner.Plan(ctx)
+		if errP != nil {
+			_, _ = fmt.Fprintln(stderr, errP)
+			return 1
+		}
+		printPlan(stdout, plan)
+		return 0
+	}
+
+	plan, errA := runner.Apply(ctx, func(m *migration.Migration, adopted bool) {
+		if adopted {
+			_, _ = fmt.Fprintf(stdout, "adopted %s\n", m)
+		} else {
+			_, _ = fmt.Fprintf(stdout, "applied %s\n", m)
+		}
+	})
+	if errA != nil {
+		_, _ = fmt.Fprintln(stderr, errA)
+		return 1
+	}
+	if plan.UpToDate() {
+		_, _ = fmt.Fprintln(stdout, "database is up to date")
+	}
+	return 0
+}
+
+// printPlan prints each migration of the plan, and what applying it would do.
+func printPlan(w io.Writer, plan *migration.Plan) {
+	for _, m := range plan.Applied {
+		_, _ = fmt.Fprintf(w, "%-40s applied\n", m)
+	}
+	for _, m := range plan.Adopted {
+		_, _ = fmt.Fprintf(w, "%-40s adopt, as the sql scripts applied it, it is only recorded\n", m)
+	}
+	for _, m := range plan.Pending {
+		_, _ = fmt.Fprintf(w, "%-40s pending\n", m)
+	}
+	if plan.UpToDate() {
+		_, _ = fmt.Fprintln(w, "database is up to date")
+	} else {
+		_, _ = fmt.Fprintf(w, "%d migrations would be applied, and %d adopted\n", len(plan.Pending),
+			len(plan.Adopted))
+	}
+}
+
+// migrateDatabase applies or checks the migrations of the database when the gateway starts, as set by
+// the migrate mode of the configuration. Returns an error if the gateway must not start, such as when the
+// database has drifted from the migrations, or a migration is pending and the mode is check.
+func migrateDatabase(ctx context.Context, logger kitlog.Logger, cfg *config.Config) error {
+	d := databaseOf(cfg)
+	if d.migrate == migration.ModeOff {
+		return nil
+	}
+	migrations, errE := migration.Embedded(d.dialect)
+	if errE != nil {
+		return errE
+	}
+
+	connectCtx, cancel := context.WithTimeout(ctx, migrationConnectTimeout)
+	defer cancel()
+	db, errOMD := d.connectMigration()
+	for errOMD != nil {
+		_ = logger.Log("msg", "waiting for database to apply migrations", "error", errOMD)
+		select {
+		case <-connectCtx.Done():
+			return errOMD
+		case <-time.After(migrationConnectRetry):
+		}
+		db, errOMD = d.connectMigration()
+	}
+	defer db.Close()
+	runner := migration.NewRunner(db, d.dialect, migrations)
+
+	if d.migrate == migration.ModeCheck {
+		plan, errP := runner.Plan(ctx)
+		if errP != nil {
+			return errP
+		}
+		if len(plan.Pending) != 0 {
+			return fmt.Errorf("%d migrations are pending, starting with %s, apply them with the migrate command, "+
+				"or set %s_MIGRATE to apply", len(plan.Pending), plan.Pending[0], strings.ToUpper(d.name))
+		}
+		_ = logger.Log("msg", "database migrations checked", "migrations", len(migrations))
+		return nil
+	}
+
+	_, errA := runner.Apply(ctx, func(m *migration.Migration, adopted bool) {
+		if adopted {
+			_ = logger.Log("msg", "database migration adopted", "migration", m.String())
+		} else {
+			_ = logger.Log("msg", "database migration applied", "migration", m.String())
+		}
+	})
+	return errA
+}
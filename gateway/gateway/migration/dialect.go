@@ -0,0 +1,62 @@
+package migration
+
+import (
+	mssql "github.com/denisenkom/go-mssqldb"
+	"github.com/lib/pq"
+)
+
+// Error numbers, and codes, of a query which refers to a table that does not exist.
+const (
+	mssqlInvalidObjectName = 208
+	pqUndefinedTable       = "42P01"
+)
+
+// Dialect is what differs between the databases migrations are applied to.
+type Dialect struct {
+	// Name identifies the database, such as "mssql", and is the directory of its migrations.
+	Name string
+	// readRecords selects the name, version, and update of every row of the Version table.
+	readRecords string
+	// insertRecord inserts a row into the Version table, from its name, version, description, and update.
+	insertRecord string
+	// lock waits for, and acquires, the migration lock for the session, and unlock releases it.
+	lock   string
+	unlock string
+	// missingTable returns true if err is returned because the Version table does not exist.
+	missingTable func(err error) bool
+	// batches splits a script into the statements which are executed separately.
+	batches func(script string) []string
+}
+
+// MsSql is the dialect of the mssql database, whose migrations are split into batches by GO lines.
+var MsSql = &Dialect{
+	Name:         "mssql",
+	readRecords:  "SELECT [Name], ISNULL([Version], N''), ISNULL([Update], N'') FROM [Version]",
+	insertRecord: "INSERT INTO [Version] ([Name], [Version], [Description], [Update]) VALUES (@p1, @p2, @p3, @p4)",
+	lock: `DECLARE @Result INT;
+EXEC @Result = sp_getapplock @Resource = N'` + lockResource + `', @LockMode = N'Exclusive',
+	@LockOwner = N'Session', @LockTimeout = 60000;
+IF @Result < 0 THROW 50000, N'unable to acquire the migration lock', 1;`,
+	unlock: "EXEC sp_releaseapplock @Resource = N'" + lockResource + "', @LockOwner = N'Session'",
+	missingTable: func(err error) bool {
+		msErr, ok := err.(mssql.Error)
+		return ok && msErr.Number == mssqlInvalidObjectName
+	},
+	batches: SplitBatches,
+}
+
+// Postgres is the dialect of the PostgreSQL database, whose migrations are executed as a single batch.
+var Postgres = &Dialect{
+	Name:         "postgres",
+	readRecords:  `SELECT name, COALESCE(version, ''), COALESCE("update", '') FROM version`,
+	insertRecord: `INSERT INTO version (name, version, description, "update") VALUES ($1, $2, $3, $4)`,
+	lock:         "SELECT pg_advisory_lock(hashtext('" + lockResource + "'))",
+	unlock:       "SELECT pg_advisory_unlock(hashtext('" + lockResource + "'))",
+	missingTable: func(err error) bool {
+		pqErr, ok := err.(*pq.Error)
+		return ok && pqErr.Code == pqUndefinedTable
+	},
+	batches: func(script string) []string {
+		return []string{script}
+	},
+}
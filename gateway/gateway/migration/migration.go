@@ -0,0 +1,165 @@
+// Package migration applies the versioned migrations of the Perceptia database, which are embedded in the
+// gateway for each database it supports, in order, recording each one applied, and its checksum, in the Version
+// table of the database.
+//
+// An mssql database set up by the sql scripts of the mssql image has no migrations recorded, so the migrations
+// which result in its Schema and Stored Procedures versions are adopted: recorded as applied without being run.
+package migration
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Modes the gateway may start in, which decide what it does with pending migrations.
+const (
+	// ModeApply applies pending migrations before the gateway serves requests.
+	ModeApply = "apply"
+	// ModeCheck refuses to start while a migration is pending, so they are only applied by the migrate command.
+	ModeCheck = "check"
+	// ModeOff does not look at the migrations of the database.
+	ModeOff = "off"
+)
+
+// ErrUnknownMode is returned for a mode which is not ModeApply, ModeCheck, or ModeOff.
+var ErrUnknownMode = errors.New("migration: mode must be one of apply, check, or off")
+
+// embedded holds the migrations of the gateway, in the directory of each Dialect, named such as
+// mssql/0001_baseline.sql.
+//
+//go:embed migrations/*/*.sql
+var embedded embed.FS
+
+// fileName matches the name of a migration file, capturing its version and name.
+var fileName = regexp.MustCompile(`^(\d{4})_([a-z0-9_]+)\.sql$`)
+
+// versionNames are the names of the rows in the Version table, set by the sql scripts, which a migration
+// may declare the version of in its header, such as "Schema: 1.2.0".
+var versionNames = []string{"Schema", "Stored Procedures"}
+
+// Migration is a sql script which changes the database from one version to the next.
+type Migration struct {
+	// Version orders the migrations, starting at 1.
+	Version int
+	// Name describes the change, such as "baseline".
+	Name string
+	// Script holds the batches of the migration, separated by GO lines, as sqlcmd does.
+	Script string
+	// Checksum identifies the contents of the script, such as "sha256:4f2a...".
+	Checksum string
+	// Versions are the versions of the rows of the Version table the migration results in, by name,
+	// as declared in its header. A migration which does not declare a version leaves it unchanged.
+	Versions map[string]string
+}
+
+// String returns the file name of the migration, without its extension, such as "0001_baseline".
+func (m *Migration) String() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
+
+// Embedded returns the migrations of the dialect embedded in the gateway, in order.
+func Embedded(d *Dialect) ([]*Migration, error) {
+	migrations, errS := fs.Sub(embedded, path.Join("migrations", d.Name))
+	if errS != nil {
+		return nil, errS
+	}
+	return Load(migrations)
+}
+
+// Load reads every .sql file at the root of fsys as a migration, returning them in order.
+// Returns an error if a file is not named as a migration, or the versions do not run from 1 without a gap.
+func Load(fsys fs.FS) ([]*Migration, error) {
+	files, errG := fs.Glob(fsys, "*.sql")
+	if errG != nil {
+		return nil, errG
+	}
+	migrations := make([]*Migration, 0, len(files))
+	for _, file := range files {
+		match := fileName.FindStringSubmatch(path.Base(file))
+		if match == nil {
+			return nil, fmt.Errorf("migration: %s must be named such as 0001_name.sql", file)
+		}
+		contents, errRF := fs.ReadFile(fsys, file)
+		if errRF != nil {
+			return nil, fmt.Errorf("migration: unable to read %s: %s", file, errRF)
+		}
+		version, _ := strconv.Atoi(match[1])
+		sum := sha256.Sum256(contents)
+		migrations = append(migrations, &Migration{
+			Version:  version,
+			Name:     match[2],
+			Script:   string(contents),
+			Checksum: "sha256:" + hex.EncodeToString(sum[:]),
+			Versions: headerVersions(string(contents)),
+		})
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migration: expected version %04d but found %s", i+1, m)
+		}
+	}
+	return migrations, nil
+}
+
+// headerVersions returns the versions declared in the header comment of a script, such as "Schema: 1.2.0",
+// by name.
+func headerVersions(script string) map[string]string {
+	versions := make(map[string]string)
+	scanner := bufio.NewScanner(strings.NewReader(script))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "*/") {
+			break
+		}
+		for _, name := range versionNames {
+			if strings.HasPrefix(line, name+":") {
+				versions[name] = strings.TrimSpace(strings.TrimPrefix(line, name+":"))
+			}
+		}
+	}
+	return versions
+}
+
+// SplitBatches splits a script into the batches separated by GO lines, as sqlcmd does.
+// GO lines within block comments, such as the commented out setup of the scripts, are not separators.
+func SplitBatches(script string) []string {
+	var batches []string
+	var batch strings.Builder
+	commentDepth := 0
+	for _, line := range strings.Split(script, "\n") {
+		if commentDepth == 0 && strings.EqualFold(strings.TrimSpace(line), "GO") {
+			if len(strings.TrimSpace(batch.String())) != 0 {
+				batches = append(batches, batch.String())
+			}
+			batch.Reset()
+			continue
+		}
+		commentDepth += strings.Count(line, "/*") - strings.Count(line, "*/")
+		batch.WriteString(line)
+		batch.WriteString("\n")
+	}
+	if len(strings.TrimSpace(batch.String())) != 0 {
+		batches = append(batches, batch.String())
+	}
+	return batches
+}
+
+// ErrDrift is returned when the migrations recorded in the database do not match those of the gateway,
+// such as a migration which was changed after it was applied, so the gateway must not use the database.
+var ErrDrift = errors.New("migration: database has drifted from the migrations of the gateway")
+
+// driftError returns an error describing the drift, which is ErrDrift.
+func driftError(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrDrift, fmt.Sprintf(format, args...))
+}
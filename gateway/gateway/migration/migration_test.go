@@ -0,0 +1,209 @@
+// +build all unit
+
+package migration
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+)
+
+func TestEmbedded(t *testing.T) {
+	migrations, errE := Embedded(MsSql)
+	if errE != nil {
+		t.Fatalf("case: Embedded: unexpected error: %s\nHINT: every embedded migration must load", errE)
+	}
+	if len(migrations) == 0 || migrations[0].String() != "0001_baseline" {
+		t.Fatalf("case: Embedded: expected the first migration to be 0001_baseline\nHINT: the baseline must be embedded")
+	}
+	baseline := migrations[0]
+	if baseline.Versions["Schema"] != "1.2.0" || baseline.Versions["Stored Procedures"] != "1.2.0" {
+		t.Errorf("case: Embedded: expected the baseline to result in Schema and Stored Procedures 1.2.0, "+
+			"but got %v\nHINT: only the header comment declares versions", baseline.Versions)
+	}
+	if len(SplitBatches(baseline.Script)) < 2 {
+		t.Errorf("case: Embedded: expected the baseline to be split into batches\nHINT: GO lines separate batches")
+	}
+
+	pgMigrations, errEP := Embedded(Postgres)
+	if errEP != nil || len(pgMigrations) == 0 || pgMigrations[0].String() != "0001_baseline" {
+		t.Errorf("case: Embedded Postgres: expected the first migration to be 0001_baseline, error: %v\n"+
+			"HINT: each dialect embeds its own migrations", errEP)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	cases := []struct {
+		name        string
+		hint        string
+		files       fstest.MapFS
+		expected    []string
+		expectError bool
+	}{
+		{
+			"Ordered",
+			"Remember to order migrations by version, not by the order files are read",
+			fstest.MapFS{
+				"0002_second.sql": {Data: []byte("SELECT 2")},
+				"0001_first.sql":  {Data: []byte("SELECT 1")},
+			},
+			[]string{"0001_first", "0002_second"},
+			false,
+		},
+		{
+			"Gap",
+			"Remember to return an error if a version is missing, as it could never be applied",
+			fstest.MapFS{
+				"0001_first.sql": {Data: []byte("SELECT 1")},
+				"0003_third.sql": {Data: []byte("SELECT 3")},
+			},
+			nil,
+			true,
+		},
+		{
+			"Misnamed",
+			"Remember to return an error for a file which is not named as a migration",
+			fstest.MapFS{"first.sql": {Data: []byte("SELECT 1")}},
+			nil,
+			true,
+		},
+	}
+
+	for _, c := range cases {
+		migrations, err := Load(c.files)
+		if err != nil && !c.expectError {
+			t.Errorf("case %s: unexpected error: %v\nHINT: %s", c.name, err, c.hint)
+			continue
+		}
+		if err == nil && c.expectError {
+			t.Errorf("case %s: expected error but didn't get one\nHINT: %s", c.name, c.hint)
+			continue
+		}
+		if len(migrations) != len(c.expected) {
+			t.Errorf("case %s: expected %d migrations but got %d\nHINT: %s", c.name, len(c.expected),
+				len(migrations), c.hint)
+			continue
+		}
+		for i, m := range migrations {
+			if m.String() != c.expected[i] {
+				t.Errorf("case %s: expected migration %s but got %s\nHINT: %s", c.name, c.expected[i], m, c.hint)
+			}
+		}
+	}
+}
+
+func TestSplitBatches(t *testing.T) {
+	script := "CREATE TABLE [A] ([Id] INT)\nGO\n/*\nUSE [master]\nGO\n*/\nCREATE TABLE [B] ([Id] INT)\ngo\n\nGO\n"
+	batches := SplitBatches(script)
+	if len(batches) != 2 {
+		t.Errorf("case: Split Batches: expected 2 batches but got %d: %q\nHINT: GO lines within comments, "+
+			"and empty batches, must not separate batches", len(batches), batches)
+	}
+}
+
+func TestPlan(t *testing.T) {
+	migrations := []*Migration{
+		{Version: 1, Name: "baseline", Checksum: "sha256:1", Versions: map[string]string{"Schema": "1.2.0",
+			"Stored Procedures": "1.2.0"}},
+		{Version: 2, Name: "second", Checksum: "sha256:2", Versions: map[string]string{"Schema": "1.3.0"}},
+		{Version: 3, Name: "third", Checksum: "sha256:3", Versions: map[string]string{}},
+	}
+	scripts := map[string]string{"Schema": "1.2.0", "Stored Procedures": "1.2.0", "Populate": "0.4.0"}
+	migrated := map[string]string{"Schema": "1.3.0", "Stored Procedures": "1.2.0"}
+
+	cases := []struct {
+		name            string
+		hint            string
+		state           *state
+		expectedApplied int
+		expectedAdopted int
+		expectedPending int
+		expectDrift     bool
+	}{
+		{
+			"Empty Database",
+			"Remember every migration is pending for a database without a Version table",
+			&state{},
+			0, 0, 3,
+			false,
+		},
+		{
+			"Scripts Database",
+			"Remember to adopt the migrations resulting in the versions the scripts recorded",
+			&state{exists: true, versions: scripts},
+			0, 1, 2,
+			false,
+		},
+		{
+			"Unknown Scripts Version",
+			"Remember a database the scripts set up at a version no migration results in has drifted",
+			&state{exists: true, versions: map[string]string{"Schema": "1.1.0", "Stored Procedures": "1.1.0"}},
+			0, 0, 0,
+			true,
+		},
+		{
+			"Partly Migrated",
+			"Remember only the migrations after those recorded are pending",
+			&state{exists: true, versions: scripts, records: []record{{1, "sha256:1"}}},
+			1, 0, 2,
+			false,
+		},
+		{
+			"Up To Date",
+			"Remember no migration is pending once every one is recorded",
+			&state{exists: true, versions: migrated, records: []record{{3, "sha256:3"}, {1, "sha256:1"},
+				{2, "sha256:2"}}},
+			3, 0, 0,
+			false,
+		},
+		{
+			"Changed Migration",
+			"Remember a migration recorded with a different checksum has drifted",
+			&state{exists: true, versions: scripts, records: []record{{1, "sha256:changed"}}},
+			0, 0, 0,
+			true,
+		},
+		{
+			"Unknown Migration",
+			"Remember a database with a migration the gateway does not have has drifted",
+			&state{exists: true, versions: migrated, records: []record{{1, "sha256:1"}, {2, "sha256:2"},
+				{3, "sha256:3"}, {4, "sha256:4"}}},
+			0, 0, 0,
+			true,
+		},
+		{
+			"Missing Migration",
+			"Remember migrations are applied in order, so a gap in those recorded has drifted",
+			&state{exists: true, versions: migrated, records: []record{{1, "sha256:1"}, {3, "sha256:3"}}},
+			0, 0, 0,
+			true,
+		},
+		{
+			"Changed Schema",
+			"Remember a database whose versions do not match the migrations recorded has drifted",
+			&state{exists: true, versions: scripts, records: []record{{1, "sha256:1"}, {2, "sha256:2"}}},
+			0, 0, 0,
+			true,
+		},
+	}
+
+	for _, c := range cases {
+		p, err := plan(migrations, c.state)
+		if c.expectDrift {
+			if !errors.Is(err, ErrDrift) {
+				t.Errorf("case %s: expected ErrDrift but got %v\nHINT: %s", c.name, err, c.hint)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %s: unexpected error: %v\nHINT: %s", c.name, err, c.hint)
+			continue
+		}
+		if len(p.Applied) != c.expectedApplied || len(p.Adopted) != c.expectedAdopted ||
+			len(p.Pending) != c.expectedPending {
+			t.Errorf("case %s: expected %d applied, %d adopted, and %d pending, but got %d, %d, and %d\nHINT: %s",
+				c.name, c.expectedApplied, c.expectedAdopted, c.expectedPending, len(p.Applied), len(p.Adopted),
+				len(p.Pending), c.hint)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+/*
+	Title: Perceptia Database Account Deletion
+	Schema: 1.3.0
+	Stored Procedures: 1.3.0
+*/
+-------------------------------------------------------------------------------
+-- Summary --
+-------------------------------------------------------------------------------
+/*
+	Adds the time a user requested their account be deleted to the User table,
+	and the procedures which request, cancel, and find the deletions, as in
+	schema.sql, procedure.sql, and populate.sql of database/mssql/Perceptia at
+	Schema 1.3.0 and Stored Procedures 1.3.0.
+
+	An account is pending deletion while DeletionRequested is set, and is purged
+	by the gateway once the grace period to restore it has passed.
+*/
+
+-------------------------------------------------------------------------------
+-- Alter Tables --
+-------------------------------------------------------------------------------
+
+ALTER TABLE [User]
+	ADD [DeletionRequested] DATETIME2 NULL
+;
+GO
+
+-------------------------------------------------------------------------------
+-- Create Database Indexes --
+-------------------------------------------------------------------------------
+
+CREATE NONCLUSTERED INDEX [IX_User_DeletionRequested]
+	ON [User] ([DeletionRequested])
+	WHERE [DeletionRequested] IS NOT NULL
+;
+GO
+
+-------------------------------------------------------------------------------
+-- Create Procedures --
+-------------------------------------------------------------------------------
+
+-----------------------------------------------------------
+-- ReadUsersDeletionRequested --
+-----------------------------------------------------------
+
+-- USP_ReadUsersDeletionRequested returns the users who requested their account be deleted before the given time,
+-- oldest request first.
+-- Parameters
+--	@RequestedBefore:	DATETIME2 only users who requested deletion before this time, in UTC, are returned.
+--	@Limit:	INT the maximum number of users to return.
+-- Outputs
+--	Query row containing 1 column (may return 0 or more rows).
+--		Uuid: UNIQUEIDENTIFIER the uuid of the user.
+-- Errors
+--	50101: The provided RequestedBefore or Limit was null.
+CREATE PROCEDURE [USP_ReadUsersDeletionRequested]
+	@RequestedBefore DATETIME2
+	,@Limit INT
+AS
+SET NOCOUNT ON
+;
+BEGIN
+	IF @RequestedBefore IS NULL OR @Limit IS NULL
+		THROW 50101, N'requested before and limit must not be null', 1
+	;
+	SELECT TOP (@Limit) [Uuid]
+		FROM [User]
+		WHERE [DeletionRequested] < @RequestedBefore
+		ORDER BY [DeletionRequested]
+	;
+END
+;
+GO
+
+-----------------------------------------------------------
+-- UpdateUserDeletionRequested --
+-----------------------------------------------------------
+
+-- USP_UpdateUserDeletionRequested sets the time the user requested their account be deleted,
+-- which marks the account pending deletion.
+-- Parameters
+--	@UserUuid:	UNIQUEIDENTIFIER the UserUuid for the user who requested deletion.
+--				Must be a valid v4 UUID.
+--	@Requested:	DATETIME2 when the user requested deletion, in UTC.
+-- Outputs none
+-- Errors
+--	50101: The provided UserUuid was null.
+--	50102: The provided Requested was null.
+--	50301: No user found with the provided UserUuid.
+CREATE PROCEDURE [USP_UpdateUserDeletionRequested]
+	@UserUuid UNIQUEIDENTIFIER
+	,@Requested DATETIME2
+AS
+SET NOCOUNT ON
+;
+BEGIN
+	IF @UserUuid IS NULL
+		THROW 50101, N'uuid must not be null', 1
+	;
+	IF @Requested IS NULL
+		THROW 50102, N'requested must not be null', 1
+	;
+	IF NOT EXISTS (SELECT [Uuid] FROM [User] WHERE [Uuid] = @UserUuid)
+		THROW 50301, N'user does not exist', 1
+	;
+	UPDATE [User]
+		SET [DeletionRequested] = @Requested
+		WHERE [Uuid] = @UserUuid
+	;
+END
+;
+GO
+
+-----------------------------------------------------------
+-- DeleteUserDeletionRequested --
+-----------------------------------------------------------
+
+-- USP_DeleteUserDeletionRequested cancels the deletion the user requested, if it was requested after the given
+-- time, restoring their account.
+-- Parameters
+--	@UserUuid:	UNIQUEIDENTIFIER the UserUuid for the user whose deletion should be canceled.
+--				Must be a valid v4 UUID.
+--	@RequestedAfter:	DATETIME2 a deletion requested before this time, in UTC, can no longer be canceled.
+-- Outputs
+--	Query row containing 1 column (should be exactly one row).
+--		Canceled: BIT 1 if a deletion was canceled, 0 if the user had not requested deletion.
+-- Errors
+--	50101: The provided UserUuid was null.
+--	50102: The provided RequestedAfter was null.
+--	50301: No user found with the provided UserUuid.
+--	50502: The deletion was requested before RequestedAfter, so can no longer be canceled.
+CREATE PROCEDURE [USP_DeleteUserDeletionRequested]
+	@UserUuid UNIQUEIDENTIFIER
+	,@RequestedAfter DATETIME2
+AS
+SET NOCOUNT ON
+;
+BEGIN
+	IF @UserUuid IS NULL
+		THROW 50101, N'uuid must not be null', 1
+	;
+	IF @RequestedAfter IS NULL
+		THROW 50102, N'requested after must not be null', 1
+	;
+	DECLARE @Requested DATETIME2
+	;
+	IF NOT EXISTS (SELECT [Uuid] FROM [User] WHERE [Uuid] = @UserUuid)
+		THROW 50301, N'user does not exist', 1
+	;
+	SELECT @Requested = [DeletionRequested]
+		FROM [User]
+		WHERE [Uuid] = @UserUuid
+	;
+	IF @Requested IS NULL
+	BEGIN
+		SELECT CAST(0 AS BIT) AS [Canceled]
+		;
+		RETURN
+		;
+	END
+	;
+	IF @Requested < @RequestedAfter
+		THROW 50502, N'deletion can no longer be canceled', 1
+	;
+	UPDATE [User]
+		SET [DeletionRequested] = NULL
+		WHERE [Uuid] = @UserUuid
+	;
+	SELECT CAST(1 AS BIT) AS [Canceled]
+	;
+END
+;
+GO
+
+-------------------------------------------------------------------------------
+-- Populate Database --
+-------------------------------------------------------------------------------
+
+UPDATE [Version]
+	SET [Version] = N'1.3.0'
+	WHERE [Name] IN (N'Schema', N'Stored Procedures')
+;
+GO
+
+UPDATE [Version]
+	SET [Version] = N'0.5.0'
+	WHERE [Name] = N'Populate'
+;
+GO
@@ -0,0 +1,176 @@
+/*
+	Title: Perceptia Database Baseline for PostgreSQL
+*/
+-------------------------------------------------------------------------------
+-- Summary --
+-------------------------------------------------------------------------------
+/*
+	The schema of database/mssql/Perceptia at Schema 1.2.0, for PostgreSQL 13 or
+	later. Tables and columns are named in snake_case, such as user_credential for
+	[UserCredential]. The stored procedures of the mssql database are implemented
+	by the queries of user.PgStore and audit.PgStore instead.
+
+	Usernames are unique, and found, ignoring case, as with the case insensitive
+	collation of the mssql database.
+
+	A released migration must never be changed, as its checksum is recorded in the
+	version table of every database it was applied to. Add a new migration instead.
+*/
+
+-------------------------------------------------------------------------------
+-- Create Tables --
+-------------------------------------------------------------------------------
+
+-- Summary: Store information about the version of the schema, and the migrations applied
+CREATE TABLE version (
+	uuid UUID DEFAULT gen_random_uuid() NOT NULL
+	,name VARCHAR(255) NOT NULL
+	,version VARCHAR(255)
+	,description VARCHAR(255)
+	,"update" VARCHAR(255)
+	,created TIMESTAMPTZ DEFAULT now()
+	,CONSTRAINT pk_version_uuid PRIMARY KEY (uuid)
+	,CONSTRAINT uq_version_name UNIQUE (name)
+);
+
+-- Summary: Store basic information about a user
+CREATE TABLE "user" (
+	uuid UUID DEFAULT gen_random_uuid() NOT NULL
+	,username VARCHAR(255) NOT NULL
+	,full_name VARCHAR(255)
+	,display_name VARCHAR(255)
+	,created TIMESTAMPTZ DEFAULT now()
+	,CONSTRAINT pk_user_uuid PRIMARY KEY (uuid)
+);
+
+CREATE UNIQUE INDEX uq_user_username ON "user" (lower(username));
+
+-- Summary: Store an email
+CREATE TABLE email (
+	uuid UUID DEFAULT gen_random_uuid() NOT NULL
+	,email VARCHAR(255) NOT NULL
+	,created TIMESTAMPTZ DEFAULT now()
+	,CONSTRAINT pk_email_uuid PRIMARY KEY (uuid)
+);
+
+CREATE INDEX ix_email_email ON email (email);
+
+-- Summary: Associate an email with a user
+CREATE TABLE user_email (
+	uuid UUID DEFAULT gen_random_uuid() NOT NULL
+	,user_uuid UUID NOT NULL REFERENCES "user" (uuid) ON DELETE CASCADE
+	,email_uuid UUID NOT NULL REFERENCES email (uuid) ON DELETE CASCADE
+	,CONSTRAINT pk_user_email_uuid PRIMARY KEY (uuid)
+	,CONSTRAINT uq_user_email_email_uuid UNIQUE (email_uuid)
+);
+
+CREATE INDEX ix_user_email_user_uuid ON user_email (user_uuid);
+
+-- Summary: Store the encoded hash of a password
+CREATE TABLE credential (
+	uuid UUID DEFAULT gen_random_uuid() NOT NULL
+	,created TIMESTAMPTZ DEFAULT now()
+	,encoded_hash VARCHAR(500) NOT NULL
+	,CONSTRAINT pk_credential_uuid PRIMARY KEY (uuid)
+);
+
+-- Summary: Associate a credential with a user
+CREATE TABLE user_credential (
+	uuid UUID DEFAULT gen_random_uuid() NOT NULL
+	,user_uuid UUID NOT NULL REFERENCES "user" (uuid) ON DELETE CASCADE
+	,credential_uuid UUID NOT NULL REFERENCES credential (uuid) ON DELETE CASCADE
+	,CONSTRAINT pk_user_credential_uuid PRIMARY KEY (uuid)
+	,CONSTRAINT uq_user_credential_user_uuid UNIQUE (user_uuid)
+	,CONSTRAINT uq_user_credential_credential_uuid UNIQUE (credential_uuid)
+);
+
+-- Summary: Store a session
+CREATE TABLE session (
+	uuid UUID DEFAULT gen_random_uuid() NOT NULL
+	,session_id VARCHAR(255) NOT NULL
+	,status VARCHAR(255) NOT NULL
+	,created TIMESTAMPTZ DEFAULT now()
+	,CONSTRAINT pk_session_uuid PRIMARY KEY (uuid)
+);
+
+-- Summary: Associate a session with a user
+CREATE TABLE user_session (
+	uuid UUID DEFAULT gen_random_uuid() NOT NULL
+	,user_uuid UUID NOT NULL REFERENCES "user" (uuid) ON DELETE CASCADE
+	,session_uuid UUID NOT NULL REFERENCES session (uuid) ON DELETE CASCADE
+	,CONSTRAINT pk_user_session_uuid PRIMARY KEY (uuid)
+	,CONSTRAINT uq_user_session_session_uuid UNIQUE (session_uuid)
+);
+
+-- Summary: Store the profile of a user
+CREATE TABLE profile (
+	uuid UUID DEFAULT gen_random_uuid() NOT NULL
+	,bio VARCHAR(1000)
+	,gravatar_url VARCHAR(1000)
+	,created TIMESTAMPTZ DEFAULT now()
+	,CONSTRAINT pk_profile_uuid PRIMARY KEY (uuid)
+);
+
+-- Summary: Associate a profile with a user
+CREATE TABLE user_profile (
+	uuid UUID DEFAULT gen_random_uuid() NOT NULL
+	,user_uuid UUID NOT NULL REFERENCES "user" (uuid) ON DELETE CASCADE
+	,profile_uuid UUID NOT NULL REFERENCES profile (uuid) ON DELETE CASCADE
+	,CONSTRAINT pk_user_profile_uuid PRIMARY KEY (uuid)
+	,CONSTRAINT uq_user_profile_profile_uuid UNIQUE (profile_uuid)
+	,CONSTRAINT uq_user_profile_user_uuid UNIQUE (user_uuid)
+);
+
+-- Summary: Store which fields of a profile are shared publicly, as Y or N
+CREATE TABLE profile_sharing (
+	uuid UUID DEFAULT gen_random_uuid() NOT NULL
+	,bio CHAR(1)
+	,gravatar_url CHAR(1)
+	,display_name CHAR(1)
+	,CONSTRAINT pk_profile_sharing_uuid PRIMARY KEY (uuid)
+);
+
+-- Summary: Associate profile sharing with a user
+CREATE TABLE user_profile_sharing (
+	uuid UUID DEFAULT gen_random_uuid() NOT NULL
+	,user_uuid UUID NOT NULL REFERENCES "user" (uuid) ON DELETE CASCADE
+	,profile_sharing_uuid UUID NOT NULL REFERENCES profile_sharing (uuid) ON DELETE CASCADE
+	,CONSTRAINT pk_user_profile_sharing_uuid PRIMARY KEY (uuid)
+	,CONSTRAINT uq_user_profile_sharing_profile_sharing_uuid UNIQUE (profile_sharing_uuid)
+	,CONSTRAINT uq_user_profile_sharing_user_uuid UNIQUE (user_uuid)
+);
+
+-- Summary: Store the roles granted to a user, such as admin
+CREATE TABLE user_role (
+	user_uuid UUID NOT NULL REFERENCES "user" (uuid) ON DELETE CASCADE
+	,role VARCHAR(50) NOT NULL
+	,created TIMESTAMPTZ DEFAULT now()
+	,CONSTRAINT pk_user_role_user_uuid_role PRIMARY KEY (user_uuid, role)
+);
+
+-- Summary: Store security relevant events, which are never updated or deleted
+CREATE TABLE audit_event (
+	uuid UUID NOT NULL
+	,type VARCHAR(50) NOT NULL
+	,occurred TIMESTAMPTZ NOT NULL
+	,user_uuid UUID
+	,username VARCHAR(255)
+	,session_uuid UUID
+	,request_id VARCHAR(128)
+	,client_addr VARCHAR(255)
+	,user_agent VARCHAR(500)
+	,detail VARCHAR(1000)
+	,CONSTRAINT pk_audit_event_uuid PRIMARY KEY (uuid)
+);
+
+CREATE INDEX ix_audit_event_user_uuid_occurred ON audit_event (user_uuid, occurred DESC);
+
+CREATE FUNCTION audit_event_append_only() RETURNS TRIGGER AS $$
+BEGIN
+	RAISE EXCEPTION 'audit events are append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER tr_audit_event_append_only
+	BEFORE UPDATE OR DELETE ON audit_event
+	FOR EACH ROW EXECUTE FUNCTION audit_event_append_only();
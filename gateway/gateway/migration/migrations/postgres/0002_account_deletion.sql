@@ -0,0 +1,17 @@
+/*
+	Title: Perceptia Database Account Deletion for PostgreSQL
+*/
+-------------------------------------------------------------------------------
+-- Summary --
+-------------------------------------------------------------------------------
+/*
+	Adds the time a user requested their account be deleted to the user table,
+	as migration 0002 of the mssql database does. An account is pending deletion
+	while deletion_requested is set, and is purged by the gateway once the grace
+	period to restore it has passed.
+*/
+
+ALTER TABLE "user" ADD COLUMN deletion_requested TIMESTAMPTZ;
+
+-- Only holds the users pending deletion, for finding those whose deletion is due
+CREATE INDEX ix_user_deletion_requested ON "user" (deletion_requested) WHERE deletion_requested IS NOT NULL;
@@ -0,0 +1,104 @@
+package migration
+
+import (
+	"sort"
+)
+
+// Plan describes the migrations of the gateway by what must be done for them to be applied to a database.
+type Plan struct {
+	// Applied are the migrations already recorded in the database.
+	Applied []*Migration
+	// Adopted are the migrations the sql scripts already applied to the database, which are only recorded.
+	Adopted []*Migration
+	// Pending are the migrations to apply, in order.
+	Pending []*Migration
+}
+
+// UpToDate returns true if the database has every migration, so applying the plan would change nothing.
+func (p *Plan) UpToDate() bool {
+	return len(p.Adopted) == 0 && len(p.Pending) == 0
+}
+
+// record is a migration recorded as applied in the Version table.
+type record struct {
+	version  int
+	checksum string
+}
+
+// state is what the Version table of a database records.
+type state struct {
+	// exists is false if the database has no Version table, as it is empty.
+	exists bool
+	// records are the migrations applied.
+	records []record
+	// versions are the versions of the other rows, such as Schema, by name.
+	versions map[string]string
+}
+
+// plan compares the migrations with the state of a database, returning what must be done to apply them,
+// or an error wrapping ErrDrift if the database does not match the migrations.
+func plan(migrations []*Migration, st *state) (*Plan, error) {
+	if !st.exists {
+		return &Plan{Pending: migrations}, nil
+	}
+	if len(st.records) == 0 {
+		return adopt(migrations, st.versions)
+	}
+
+	records := append([]record(nil), st.records...)
+	sort.Slice(records, func(i, j int) bool { return records[i].version < records[j].version })
+	for i, r := range records {
+		if r.version != i+1 {
+			return nil, driftError("migration %04d is recorded, but %04d is not", r.version, i+1)
+		}
+		if r.version > len(migrations) {
+			return nil, driftError("migration %04d is recorded, but the gateway only has migrations up to %04d, "+
+				"so it is older than the database", r.version, len(migrations))
+		}
+		if m := migrations[i]; r.checksum != m.Checksum {
+			return nil, driftError("migration %s was changed after it was applied, it was recorded with %s but is %s",
+				m, r.checksum, m.Checksum)
+		}
+	}
+
+	applied := migrations[:len(records)]
+	expected := resultingVersions(applied)
+	for _, name := range versionNames {
+		if version, ok := expected[name]; ok && st.versions[name] != version {
+			return nil, driftError("database has %s %s, but migrations up to %s result in %s", name,
+				st.versions[name], applied[len(applied)-1], version)
+		}
+	}
+	return &Plan{Applied: applied, Pending: migrations[len(records):]}, nil
+}
+
+// adopt returns a plan for a database set up by the sql scripts, which adopts the most migrations resulting
+// in the versions the scripts recorded.
+func adopt(migrations []*Migration, versions map[string]string) (*Plan, error) {
+	for n := len(migrations); n > 0; n-- {
+		expected := resultingVersions(migrations[:n])
+		matches := len(expected) != 0
+		for _, name := range versionNames {
+			if expected[name] != versions[name] {
+				matches = false
+			}
+		}
+		if matches {
+			return &Plan{Adopted: migrations[:n], Pending: migrations[n:]}, nil
+		}
+	}
+	return nil, driftError("database has Schema %q and Stored Procedures %q, which no migration results in",
+		versions["Schema"], versions["Stored Procedures"])
+}
+
+// resultingVersions returns the versions declared by the migrations, by name, with the latest declaration of
+// each name taking effect.
+func resultingVersions(migrations []*Migration) map[string]string {
+	versions := make(map[string]string)
+	for _, m := range migrations {
+		for name, version := range m.Versions {
+			versions[name] = version
+		}
+	}
+	return versions
+}
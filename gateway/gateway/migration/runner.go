@@ -0,0 +1,168 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// recordPrefix starts the Name of a row of the Version table which records a migration, such as "Migration 0001".
+const recordPrefix = "Migration "
+
+// Descriptions of the rows recording a migration.
+const (
+	descriptionApplied = "Applied by the gateway."
+	descriptionAdopted = "Adopted by the gateway, as the sql scripts applied it."
+)
+
+// lockResource names the application lock held while migrations are applied, so only one gateway applies them.
+const lockResource = "perceptia-migration"
+
+// querier runs a query, such as a sql.DB or sql.Conn.
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// Runner plans and applies migrations to a database.
+type Runner struct {
+	db         *sql.DB
+	dialect    *Dialect
+	migrations []*Migration
+}
+
+// NewRunner constructs a new Runner applying migrations to db, which is a database of the dialect.
+// The user of db must be allowed to read and write the Version table, and to change the schema.
+func NewRunner(db *sql.DB, dialect *Dialect, migrations []*Migration) *Runner {
+	if db == nil {
+		panic("no db provided")
+	}
+	return &Runner{db: db, dialect: dialect, migrations: migrations}
+}
+
+// Plan returns what must be done to apply the migrations to the database, without changing it,
+// or an error wrapping ErrDrift if the database does not match the migrations.
+func (ru *Runner) Plan(ctx context.Context) (*Plan, error) {
+	st, errRS := ru.readState(ctx, ru.db)
+	if errRS != nil {
+		return nil, errRS
+	}
+	return plan(ru.migrations, st)
+}
+
+// Apply records the adopted migrations, then applies each pending migration in its own transaction,
+// calling done after each one. Returns the plan which was applied.
+//
+// The plan is made while holding a lock on the database, so gateways starting together apply each migration once.
+// If a migration fails, it is rolled back, and those applied before it are kept.
+func (ru *Runner) Apply(ctx context.Context, done func(m *Migration, adopted bool)) (*Plan, error) {
+	conn, errC := ru.db.Conn(ctx)
+	if errC != nil {
+		return nil, errC
+	}
+	defer conn.Close()
+
+	if _, errL := conn.ExecContext(ctx, ru.dialect.lock); errL != nil {
+		return nil, fmt.Errorf("migration: unable to lock the database: %s", errL)
+	}
+	// The session of conn outlives the lock in the connection pool, so it must be released
+	defer func() {
+		_, _ = conn.ExecContext(context.Background(), ru.dialect.unlock)
+	}()
+
+	st, errRS := ru.readState(ctx, conn)
+	if errRS != nil {
+		return nil, errRS
+	}
+	p, errP := plan(ru.migrations, st)
+	if errP != nil {
+		return nil, errP
+	}
+
+	if len(p.Adopted) != 0 {
+		errA := inTransaction(ctx, conn, func(tx *sql.Tx) error {
+			for _, m := range p.Adopted {
+				if errR := ru.insertRecord(ctx, tx, m, descriptionAdopted); errR != nil {
+					return errR
+				}
+			}
+			return nil
+		})
+		if errA != nil {
+			return nil, fmt.Errorf("migration: unable to record adopted migrations: %s", errA)
+		}
+		for _, m := range p.Adopted {
+			done(m, true)
+		}
+	}
+
+	for _, m := range p.Pending {
+		errA := inTransaction(ctx, conn, func(tx *sql.Tx) error {
+			for _, batch := range ru.dialect.batches(m.Script) {
+				if _, errE := tx.ExecContext(ctx, batch); errE != nil {
+					return errE
+				}
+			}
+			return ru.insertRecord(ctx, tx, m, descriptionApplied)
+		})
+		if errA != nil {
+			return nil, fmt.Errorf("migration: unable to apply %s, it was rolled back: %s", m, errA)
+		}
+		done(m, false)
+	}
+	return p, nil
+}
+
+// readState reads the migrations, and other versions, recorded in the Version table.
+func (ru *Runner) readState(ctx context.Context, q querier) (*state, error) {
+	rows, errQ := q.QueryContext(ctx, ru.dialect.readRecords)
+	if errQ != nil {
+		if ru.dialect.missingTable(errQ) {
+			return &state{}, nil
+		}
+		return nil, fmt.Errorf("migration: unable to read the Version table: %s", errQ)
+	}
+	defer rows.Close()
+
+	st := &state{exists: true, versions: make(map[string]string)}
+	for rows.Next() {
+		var name, version, update string
+		if errS := rows.Scan(&name, &version, &update); errS != nil {
+			return nil, fmt.Errorf("migration: unable to read the Version table: %s", errS)
+		}
+		if !strings.HasPrefix(name, recordPrefix) {
+			st.versions[name] = version
+			continue
+		}
+		number, errA := strconv.Atoi(strings.TrimPrefix(name, recordPrefix))
+		if errA != nil {
+			return nil, driftError("the Version table has a row named %s, which is not a migration", name)
+		}
+		st.records = append(st.records, record{version: number, checksum: update})
+	}
+	if errR := rows.Err(); errR != nil {
+		return nil, fmt.Errorf("migration: unable to read the Version table: %s", errR)
+	}
+	return st, nil
+}
+
+// insertRecord records the migration as applied, with its checksum.
+func (ru *Runner) insertRecord(ctx context.Context, tx *sql.Tx, m *Migration, description string) error {
+	_, errE := tx.ExecContext(ctx, ru.dialect.insertRecord, fmt.Sprintf("%s%04d", recordPrefix, m.Version),
+		m.String(), description, m.Checksum)
+	return errE
+}
+
+// inTransaction runs fn in a transaction on conn, which is committed if fn succeeds and rolled back if not.
+func inTransaction(ctx context.Context, conn *sql.Conn, fn func(tx *sql.Tx) error) error {
+	tx, errB := conn.BeginTx(ctx, nil)
+	if errB != nil {
+		return errB
+	}
+	if errF := fn(tx); errF != nil {
+		_ = tx.Rollback()
+		return errF
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,190 @@
+// Package openapi checks requests to the gateway, and its responses, against the OpenAPI spec of the gateway api.
+//
+// The spec, gateway-service-api.yaml, is embedded in the gateway, so the spec checked is always the one the
+// gateway was built with, and is served to clients as is. It is the working spec of the api, describing every
+// version the gateway serves, rather than the published api/v1/gateway/1.0.0.yaml, which is a frozen copy of 1.0.0
+// and is outside the module, so can not be embedded.
+package openapi
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+)
+
+// Spec is the OpenAPI spec of the gateway api, in YAML.
+//
+//go:embed gateway-service-api.yaml
+var Spec []byte
+
+var (
+	// ErrRouteNotInSpec is returned when the spec does not describe the path and method of a request,
+	// such as a request to be proxied to a service, so it can not be checked.
+	ErrRouteNotInSpec = errors.New("openapi: route not described by the spec")
+	// ErrContentTypeNotInSpec is returned when the body of a request is of a type the spec does not describe
+	// for the route, so it can not be checked.
+	ErrContentTypeNotInSpec = errors.New("openapi: content type of request body not described by the spec")
+)
+
+// Validator checks requests and responses against Spec.
+type Validator struct {
+	router routers.Router
+}
+
+// ValidationError describes why a request or response does not match the spec. Its message never includes the
+// values checked, such as a password, as it is sent to clients and logged.
+type ValidationError struct {
+	description string
+	err         error
+}
+
+// Error returns the description of why the request or response does not match the spec.
+func (ve *ValidationError) Error() string {
+	return ve.description
+}
+
+// Unwrap returns the error of the validator, whose message may include the values checked.
+func (ve *ValidationError) Unwrap() error {
+	return ve.err
+}
+
+// newValidationError returns a ValidationError describing err, or nil if err is nil.
+func newValidationError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &ValidationError{description: describe(err), err: err}
+}
+
+// describe describes an error of the validator without the values checked, which the validator includes in
+// the message of some errors, such as those parsing a parameter.
+func describe(err error) string {
+	switch e := err.(type) {
+	case openapi3.MultiError:
+		descriptions := make([]string, len(e))
+		for i, inner := range e {
+			descriptions[i] = describe(inner)
+		}
+		return strings.Join(descriptions, "; ")
+	case *openapi3filter.RequestError:
+		reason := e.Reason
+		if e.Err != nil {
+			reason = joinReason(reason, describe(e.Err))
+		}
+		switch {
+		case e.Parameter != nil:
+			return fmt.Sprintf("parameter %q in %s has an error: %s", e.Parameter.Name, e.Parameter.In, reason)
+		case e.RequestBody != nil:
+			return "request body has an error: " + reason
+		}
+		return reason
+	case *openapi3filter.ResponseError:
+		if e.Err != nil {
+			return joinReason(e.Reason, describe(e.Err))
+		}
+		return e.Reason
+	case *openapi3filter.ParseError:
+		return joinReason("value could not be parsed", e.Reason)
+	case *openapi3.SchemaError:
+		if e.Origin != nil {
+			return describe(e.Origin)
+		}
+		reason := e.Reason
+		switch {
+		case e.SchemaField == "format" && e.Schema != nil:
+			// The reason given by the checker of a format may include the value
+			reason = fmt.Sprintf("string doesn't match the format %q", e.Schema.Format)
+		case len(reason) == 0:
+			reason = fmt.Sprintf("doesn't match schema %q", e.SchemaField)
+		}
+		if pointer := e.JSONPointer(); len(pointer) != 0 {
+			return fmt.Sprintf("error at %q: %s", "/"+strings.Join(pointer, "/"), reason)
+		}
+		return reason
+	}
+	return "does not match the spec"
+}
+
+// joinReason joins the reason for an error with the description of its cause.
+func joinReason(reason, cause string) string {
+	if len(reason) == 0 || reason == cause {
+		return cause
+	}
+	if len(cause) == 0 {
+		return reason
+	}
+	return reason + ": " + cause
+}
+
+// NewValidator loads and validates Spec, returning a Validator for it.
+func NewValidator() (*Validator, error) {
+	doc, errLFD := openapi3.NewLoader().LoadFromData(Spec)
+	if errLFD != nil {
+		return nil, errLFD
+	}
+	if errV := doc.Validate(context.Background()); errV != nil {
+		return nil, errV
+	}
+	// Requests are matched on path alone, as the host the gateway is reached at depends on where it is deployed
+	doc.Servers = nil
+	router, errNR := gorillamux.NewRouter(doc)
+	if errNR != nil {
+		return nil, errNR
+	}
+	return &Validator{router: router}, nil
+}
+
+// ValidateRequest checks r against the operation the spec describes for it, returning the matched route,
+// which is needed to check the response, and a ValidationError describing why r does not match, if it does not.
+//
+// If the spec does not describe the route, or the content type of the body, ErrRouteNotInSpec or
+// ErrContentTypeNotInSpec is returned. The body of r is read, but replaced so it can be read again.
+// Authentication is not checked, as that is left to the gateway.
+func (v *Validator) ValidateRequest(r *http.Request) (*routers.Route, error) {
+	route, pathParams, errFR := v.router.FindRoute(r)
+	if errFR != nil {
+		return nil, ErrRouteNotInSpec
+	}
+	if body := route.Operation.RequestBody; body != nil && body.Value != nil && r.ContentLength != 0 {
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if body.Value.Content.Get(mediaType) == nil {
+			return route, ErrContentTypeNotInSpec
+		}
+	}
+	input := &openapi3filter.RequestValidationInput{
+		Request:    r,
+		PathParams: pathParams,
+		Route:      route,
+		Options:    &openapi3filter.Options{AuthenticationFunc: openapi3filter.NoopAuthenticationFunc},
+	}
+	return route, newValidationError(openapi3filter.ValidateRequest(r.Context(), input))
+}
+
+// ValidateResponse checks the response to r, sent with the status, header, and body, against the operation
+// of route, as returned by ValidateRequest, returning a ValidationError if it does not match.
+// A status not described by the operation does not match.
+func (v *Validator) ValidateResponse(r *http.Request, route *routers.Route, status int, header http.Header,
+	body []byte) error {
+	input := &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: &openapi3filter.RequestValidationInput{
+			Request: r,
+			Route:   route,
+		},
+		Status:  status,
+		Header:  header,
+		Body:    io.NopCloser(bytes.NewReader(body)),
+		Options: &openapi3filter.Options{IncludeResponseStatus: true},
+	}
+	return newValidationError(openapi3filter.ValidateResponse(r.Context(), input))
+}
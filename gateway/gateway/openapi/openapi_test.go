@@ -0,0 +1,162 @@
+// +build all unit
+
+package openapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+func TestValidator_ValidateRequest(t *testing.T) {
+	validator, errNV := NewValidator()
+	if errNV != nil {
+		t.Fatalf("unexpected error loading the spec: %s\nHINT: the embedded spec must be a valid OpenAPI document",
+			errNV)
+	}
+	if openapi3.SchemaErrorDetailsDisabled {
+		t.Errorf("case: Load: expected the schema error details of kin-openapi to be left enabled\n" +
+			"HINT: the setting is global to the process, so values are left out of errors by the Validator instead")
+	}
+	cases := []struct {
+		name        string
+		hint        string
+		method      string
+		path        string
+		contentType string
+		body        string
+		expectErr   bool
+		expected    error
+		// secret must not be in the error, as errors are sent to clients and logged
+		secret string
+	}{
+		{
+			name:        "Valid New User",
+			hint:        "A request which matches the spec should be valid",
+			method:      http.MethodPost,
+			path:        "/api/v1/gateway/users",
+			contentType: "application/json",
+			body:        `{"username":"joeuser","displayName":"Joe","password":"really secure password!"}`,
+		},
+		{
+			name:        "Missing Display Name",
+			hint:        "A body missing a required property should not be valid",
+			method:      http.MethodPost,
+			path:        "/api/v1/gateway/users",
+			contentType: "application/json",
+			body:        `{"username":"joeuser","password":"really secure password!"}`,
+			expectErr:   true,
+		},
+		{
+			name:        "Short Password",
+			hint:        "A body which breaks the constraints of a property should not be valid",
+			method:      http.MethodPost,
+			path:        "/api/v1/gateway/users",
+			contentType: "application/json",
+			body:        `{"username":"joeuser","displayName":"Joe","password":"shrtpw"}`,
+			expectErr:   true,
+			secret:      "shrtpw",
+		},
+		{
+			name:        "Unauthenticated Session",
+			hint:        "An empty username starts a session which is not authenticated, so should be valid",
+			method:      http.MethodPost,
+			path:        "/api/v1/gateway/sessions",
+			contentType: "application/json",
+			body:        `{"username":"","password":""}`,
+		},
+		{
+			name:      "Activity Limit",
+			hint:      "A query parameter outside of its range should not be valid",
+			method:    http.MethodGet,
+			path:      "/api/v1/gateway/users/a3865f94-0c83-4e29-b6cc-1d295d062f50/activity?limit=1000",
+			expectErr: true,
+		},
+		{
+			name:      "Unparsable Parameter",
+			hint:      "A query parameter which is not a number should not be valid",
+			method:    http.MethodGet,
+			path:      "/api/v1/gateway/users/a3865f94-0c83-4e29-b6cc-1d295d062f50/activity?limit=hunter2",
+			expectErr: true,
+			secret:    "hunter2",
+		},
+		{
+			name:        "Wrong Type",
+			hint:        "A property of the wrong type should not be valid",
+			method:      http.MethodPost,
+			path:        "/api/v1/gateway/sessions",
+			contentType: "application/json",
+			body:        `{"username":"joeuser","password":8675309}`,
+			expectErr:   true,
+			secret:      "8675309",
+		},
+		{
+			name:     "Proxied Route",
+			hint:     "Requests the spec does not describe, such as to services, should be left unchecked",
+			method:   http.MethodGet,
+			path:     "/api/v1/anyquiz/quizzes",
+			expected: ErrRouteNotInSpec,
+		},
+		{
+			name:        "Not Json",
+			hint:        "A body of a type the spec does not describe should be left to the handler",
+			method:      http.MethodPost,
+			path:        "/api/v1/gateway/sessions",
+			contentType: "text/plain",
+			body:        "joeuser",
+			expected:    ErrContentTypeNotInSpec,
+		},
+	}
+
+	for _, c := range cases {
+		r := httptest.NewRequest(c.method, c.path, strings.NewReader(c.body))
+		if len(c.contentType) != 0 {
+			r.Header.Set("Content-Type", c.contentType)
+		}
+		_, errVR := validator.ValidateRequest(r)
+		switch {
+		case c.expectErr && errVR == nil:
+			t.Errorf("case: %s: expected an error but got none\nHINT: %s", c.name, c.hint)
+		case c.expectErr && (errVR == ErrRouteNotInSpec || errVR == ErrContentTypeNotInSpec):
+			t.Errorf("case: %s: expected an error describing the request but got %s\nHINT: %s", c.name, errVR,
+				c.hint)
+		case !c.expectErr && errVR != c.expected:
+			t.Errorf("case: %s: expected error %v but got %v\nHINT: %s", c.name, c.expected, errVR, c.hint)
+		}
+		if len(c.secret) != 0 && errVR != nil && strings.Contains(errVR.Error(), c.secret) {
+			t.Errorf("case: %s: expected the error not to include the value checked, but got %s\n"+
+				"HINT: errors are sent to clients and logged, so must not include passwords", c.name, errVR)
+		}
+	}
+}
+
+func TestValidator_ValidateResponse(t *testing.T) {
+	validator, errNV := NewValidator()
+	if errNV != nil {
+		t.Fatalf("unexpected error loading the spec: %s", errNV)
+	}
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/gateway/health/live", nil)
+	route, errVR := validator.ValidateRequest(r)
+	if errVR != nil {
+		t.Fatalf("unexpected error validating request: %s", errVR)
+	}
+	header := http.Header{"Content-Type": []string{"application/json"}}
+	if errVRe := validator.ValidateResponse(r, route, http.StatusOK, header,
+		[]byte(`{"status":"alive"}`)); errVRe != nil {
+		t.Errorf("case: Valid: expected no error but got %s\nHINT: a response which matches the spec is valid",
+			errVRe)
+	}
+	if errVRe := validator.ValidateResponse(r, route, http.StatusOK, header,
+		[]byte(`{"status":"sleeping"}`)); errVRe == nil {
+		t.Errorf("case: Invalid: expected an error but got none\n" +
+			"HINT: a response body which does not match the schema should be reported")
+	}
+	if errVRe := validator.ValidateResponse(r, route, http.StatusTeapot, header,
+		[]byte(`{"status":"alive"}`)); errVRe == nil {
+		t.Errorf("case: Undocumented Status: expected an error but got none\n" +
+			"HINT: a status the spec does not describe should be reported")
+	}
+}
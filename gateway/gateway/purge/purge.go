@@ -0,0 +1,188 @@
+// Package purge permanently deletes the accounts of users whose deletion can no longer be canceled.
+//
+// A deleted account is only marked pending deletion, so the user may restore it by signing in again within the
+// grace period. Once the grace period has passed, a Purger tells each service to delete the data it holds about
+// the user, then deletes the user. Every gateway runs a Purger, and purging a user twice does no harm.
+package purge
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	kitlog "github.com/go-kit/kit/log"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/audit"
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/service"
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/user"
+)
+
+// BatchSize is the most users purged by each pass of a Purger, so a pass does not hold up shutdown.
+// Any remaining users are purged on the next pass.
+const BatchSize = 100
+
+// RetryDelay is the time a user whose purge failed is skipped for, doubling with each failure in a row up to
+// MaxRetryDelay, so users who keep failing, such as when a service refuses to delete their data, do not stop
+// the users after them being purged.
+const (
+	RetryDelay    = time.Minute * 5
+	MaxRetryDelay = time.Hour * 24
+)
+
+// retry is when a user whose purge failed is next tried.
+type retry struct {
+	// failures is the number of passes in a row the purge of the user failed.
+	failures int
+	next     time.Time
+}
+
+// Purger purges the users whose deletion was requested longer ago than the grace period.
+type Purger struct {
+	userStore user.Store
+	services  *service.Registry
+	auditLog  *audit.Log
+	logger    kitlog.Logger
+	// gracePeriod is the time a user has to restore their account after requesting it be deleted.
+	gracePeriod time.Duration
+	// now returns the current time, so tests can control when failed purges are retried.
+	now func() time.Time
+
+	mx sync.Mutex
+	// retries are the users whose last purge failed, which are skipped until their next retry. They are kept in
+	// memory, as every gateway runs a Purger, and a gateway which restarts only tries each user once early.
+	retries map[uuid.UUID]*retry
+}
+
+// NewPurger constructs a new Purger, purging users from userStore, and telling each service in services
+// to delete their data, once gracePeriod has passed since they requested deletion.
+// If auditLog is nil, purges are not recorded.
+func NewPurger(userStore user.Store, services *service.Registry, auditLog *audit.Log, logger kitlog.Logger,
+	gracePeriod time.Duration) *Purger {
+	if userStore == nil || services == nil {
+		panic("no user store or services provided")
+	}
+	return &Purger{userStore: userStore, services: services, auditLog: auditLog, logger: logger,
+		gracePeriod: gracePeriod, now: time.Now, retries: make(map[uuid.UUID]*retry)}
+}
+
+// Run purges users every interval until ctx is done.
+func (p *Purger) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if purged, errP := p.Purge(ctx); errP != nil {
+			_ = p.logger.Log("msg", "unable to purge deleted users", "purged", purged, "error", errP)
+		} else if purged > 0 {
+			_ = p.logger.Log("msg", "purged deleted users", "purged", purged)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Purge purges up to BatchSize users whose grace period has passed, returning the number purged.
+//
+// A user is only deleted once every service has deleted their data. If any service fails, the user is left
+// pending deletion, the failure is recorded, and the user is skipped until RetryDelay passes, doubling with each
+// failure in a row, so the users after them are still purged. The error is returned after the others are purged.
+func (p *Purger) Purge(ctx context.Context) (int, error) {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	now := p.now()
+	// The users being skipped are read as well, so a whole batch of users to try is read
+	limit := BatchSize + len(p.retries)
+	due, errRUDR := p.userStore.ReadUsersDeletionRequested(ctx, now.UTC().Add(-p.gracePeriod), limit)
+	if errRUDR != nil {
+		return 0, errRUDR
+	}
+	if len(due) < limit {
+		p.forgetRetries(due)
+	}
+	purged := 0
+	tried := 0
+	var errs []error
+	for _, userUuid := range due {
+		if tried == BatchSize {
+			break
+		}
+		if r, ok := p.retries[userUuid]; ok && now.Before(r.next) {
+			continue
+		}
+		tried++
+		errPU := p.purgeUser(ctx, userUuid)
+		if ctx.Err() != nil {
+			// The pass was stopped, such as by shutdown, so the user did not fail
+			errs = append(errs, ctx.Err())
+			break
+		}
+		if errPU != nil {
+			p.failed(userUuid, now, errPU)
+			errs = append(errs, errPU)
+			continue
+		}
+		delete(p.retries, userUuid)
+		purged++
+	}
+	return purged, errors.Join(errs...)
+}
+
+// failed records that the purge of the user failed at now, and skips the user until their next retry.
+func (p *Purger) failed(userUuid uuid.UUID, now time.Time, err error) {
+	r, ok := p.retries[userUuid]
+	if !ok {
+		r = &retry{}
+		p.retries[userUuid] = r
+	}
+	r.failures++
+	delay := RetryDelay
+	for i := 1; i < r.failures && delay < MaxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > MaxRetryDelay {
+		delay = MaxRetryDelay
+	}
+	r.next = now.Add(delay)
+	_ = p.logger.Log("msg", "unable to purge deleted user", "userUuid", userUuid, "failures", r.failures,
+		"retry", r.next, "error", err)
+	p.auditLog.Record(&audit.Event{Type: audit.EventAccountPurgeFailed, UserUuid: userUuid,
+		Detail: "purge failed, so will be tried again after " + r.next.UTC().Format(time.RFC3339)})
+}
+
+// forgetRetries forgets the users being skipped who are not in due, every user pending deletion whose grace
+// period has passed, as they were restored, or purged by another gateway.
+func (p *Purger) forgetRetries(due []uuid.UUID) {
+	pending := make(map[uuid.UUID]bool, len(due))
+	for _, userUuid := range due {
+		pending[userUuid] = true
+	}
+	for userUuid := range p.retries {
+		if !pending[userUuid] {
+			delete(p.retries, userUuid)
+		}
+	}
+}
+
+// purgeUser tells each service to delete the data of the user, then deletes the user.
+func (p *Purger) purgeUser(ctx context.Context, userUuid uuid.UUID) error {
+	for _, svc := range p.services.Services {
+		if errDUD := svc.DeleteUserData(ctx, userUuid.String()); errDUD != nil {
+			return errDUD
+		}
+	}
+	errDU := p.userStore.DeleteUser(ctx, userUuid)
+	if errDU == user.ErrUserNotFound {
+		// Already purged by another gateway
+		return nil
+	}
+	if errDU != nil {
+		return errDU
+	}
+	p.auditLog.Record(&audit.Event{Type: audit.EventAccountPurged, UserUuid: userUuid,
+		Detail: "purged once the grace period to restore it passed"})
+	return nil
+}
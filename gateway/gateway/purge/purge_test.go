@@ -0,0 +1,231 @@
+// +build all unit
+
+package purge
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	kitlog "github.com/go-kit/kit/log"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/audit"
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/service"
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/user"
+)
+
+// newTestEncodedHash returns an encoded hash for the users created by createTestUser, which is created once, as
+// hashing is slow.
+func newTestEncodedHash(t *testing.T) string {
+	encodedHash, errCEH := user.CreateEncodedHash("TestIngPasswordHash")
+	if errCEH != nil {
+		t.Fatalf("unexpected error setting up test: %s", errCEH)
+	}
+	return encodedHash
+}
+
+// createTestUser creates a user with the username, whose deletion was requested at requested, if not zero.
+func createTestUser(t *testing.T, userStore user.Store, encodedHash string, username string,
+	requested time.Time) uuid.UUID {
+	ctx := context.Background()
+	usr, errCU := userStore.CreateUser(ctx, &user.NewUser{Username: username, FullName: "Purge Test",
+		DisplayName: "Purge", EncodedHash: encodedHash})
+	if errCU != nil {
+		t.Fatalf("unexpected error setting up test: %s", errCU)
+	}
+	if !requested.IsZero() {
+		if errUUDR := userStore.UpdateUserDeletionRequested(ctx, usr.Uuid, requested); errUUDR != nil {
+			t.Fatalf("unexpected error setting up test: %s", errUUDR)
+		}
+	}
+	return usr.Uuid
+}
+
+// countEvents returns the number of audit events of each type about the user.
+func countEvents(t *testing.T, auditLog *audit.Log, userUuid uuid.UUID) map[audit.EventType]int {
+	events, errUE := auditLog.UserEvents(context.Background(), userUuid, time.Time{}, audit.MaxLimit)
+	if errUE != nil {
+		t.Fatalf("unexpected error reading audit events: %s", errUE)
+	}
+	counts := make(map[audit.EventType]int)
+	for _, event := range events {
+		counts[event.Type]++
+	}
+	return counts
+}
+
+func TestPurger_Purge(t *testing.T) {
+	ctx := context.Background()
+	userStore := user.NewMemStore()
+	encodedHash := newTestEncodedHash(t)
+	createUser := func(username string, requested time.Time) uuid.UUID {
+		return createTestUser(t, userStore, encodedHash, username, requested)
+	}
+	due := createUser("purgedue", time.Now().UTC().Add(-time.Hour*2))
+	pending := createUser("purgepending", time.Now().UTC().Add(-time.Minute))
+	active := createUser("purgeactive", time.Time{})
+
+	failing := true
+	deleted := make(map[string]bool)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		deleted[r.Header.Get("Perceptia-User-Uuid")] = true
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer upstream.Close()
+	services, errNR := service.NewRegistry(&service.Service{Name: "anyquiz", Upstreams: []string{upstream.URL},
+		UserDeletion: service.UserDeletion{Path: "/users/{userUuid}"}})
+	if errNR != nil {
+		t.Fatalf("unexpected error setting up test: %s", errNR)
+	}
+	auditLog := audit.NewLog(audit.NewMemStore(), kitlog.NewNopLogger())
+	purger := NewPurger(userStore, services, auditLog, kitlog.NewNopLogger(), time.Hour)
+	now := time.Now()
+	purger.now = func() time.Time { return now }
+
+	purged, errP := purger.Purge(ctx)
+	if errP == nil || purged != 0 {
+		t.Errorf("case: service failing: expected an error and no users purged, but got %d purged, error: %v\n"+
+			"HINT: a user must not be purged until every service has deleted their data", purged, errP)
+	}
+	if _, errRUI := userStore.ReadUserInfo(ctx, due); errRUI != nil {
+		t.Errorf("case: service failing: expected the user to remain, but got %s\n"+
+			"HINT: the user should be left pending deletion, so is tried again", errRUI)
+	}
+
+	failing = false
+	purged, errP = purger.Purge(ctx)
+	if errP != nil || purged != 0 || len(deleted) != 0 {
+		t.Errorf("case: retry delay: expected nothing purged, but got %d purged, error: %v\n"+
+			"HINT: a user whose purge failed should be skipped until the retry delay passes", purged, errP)
+	}
+
+	now = now.Add(RetryDelay)
+	purged, errP = purger.Purge(ctx)
+	if errP != nil || purged != 1 {
+		t.Fatalf("case: purge: expected one user purged, but got %d purged, error: %v\n"+
+			"HINT: only the user whose grace period has passed should be purged", purged, errP)
+	}
+	if !deleted[due.String()] || len(deleted) != 1 {
+		t.Errorf("case: purge: expected the service to be told to delete only %s, but got %v\n"+
+			"HINT: the service should delete the data of each purged user", due, deleted)
+	}
+	if _, errRUI := userStore.ReadUserInfo(ctx, due); errRUI != user.ErrUserNotFound {
+		t.Errorf("case: purge: expected %s reading the purged user, but got %v\n"+
+			"HINT: the user should be deleted", user.ErrUserNotFound, errRUI)
+	}
+	for _, kept := range []uuid.UUID{pending, active} {
+		if _, errRUI := userStore.ReadUserInfo(ctx, kept); errRUI != nil {
+			t.Errorf("case: purge: expected user %s to remain, but got %s\n"+
+				"HINT: users within the grace period, or not deleted, must not be purged", kept, errRUI)
+		}
+	}
+	if counts := countEvents(t, auditLog, due); len(counts) != 2 || counts[audit.EventAccountPurgeFailed] != 1 ||
+		counts[audit.EventAccountPurged] != 1 {
+		t.Errorf("case: purge: expected an %s and an %s event, but got %v\n"+
+			"HINT: each purge, and each failed attempt, should be recorded", audit.EventAccountPurgeFailed,
+			audit.EventAccountPurged, counts)
+	}
+
+	purged, errP = purger.Purge(ctx)
+	if errP != nil || purged != 0 {
+		t.Errorf("case: purge again: expected nothing purged, but got %d purged, error: %v\n"+
+			"HINT: a purged user should no longer be pending deletion", purged, errP)
+	}
+}
+
+func TestPurger_Purge_BatchFailing(t *testing.T) {
+	ctx := context.Background()
+	userStore := user.NewMemStore()
+	encodedHash := newTestEncodedHash(t)
+	failing := make(map[string]bool)
+	requested := time.Now().UTC().Add(-time.Hour * 3)
+	for i := 0; i < BatchSize; i++ {
+		userUuid := createTestUser(t, userStore, encodedHash, fmt.Sprintf("purgefailing%d", i), requested.Add(time.Duration(i)))
+		failing[userUuid.String()] = true
+	}
+	later := createTestUser(t, userStore, encodedHash, "purgelater", requested.Add(time.Hour))
+
+	var mx sync.Mutex
+	attempts := make(map[string]int)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userUuid := r.Header.Get("Perceptia-User-Uuid")
+		mx.Lock()
+		attempts[userUuid]++
+		mx.Unlock()
+		if failing[userUuid] {
+			// Refused, rather than unavailable, so the upstream is not ejected
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer upstream.Close()
+	services, errNR := service.NewRegistry(&service.Service{Name: "anyquiz", Upstreams: []string{upstream.URL},
+		UserDeletion: service.UserDeletion{Path: "/users/{userUuid}"}})
+	if errNR != nil {
+		t.Fatalf("unexpected error setting up test: %s", errNR)
+	}
+	auditLog := audit.NewLog(audit.NewMemStore(), kitlog.NewNopLogger())
+	purger := NewPurger(userStore, services, auditLog, kitlog.NewNopLogger(), time.Hour)
+	now := time.Now()
+	purger.now = func() time.Time { return now }
+
+	purged, errP := purger.Purge(ctx)
+	if errP == nil || purged != 0 || len(attempts) != BatchSize {
+		t.Errorf("case: batch failing: expected an error, no users purged, and the oldest %d tried, but got %d "+
+			"purged, %d tried, error: %v\nHINT: users are purged oldest first, a batch at a time", BatchSize, purged,
+			len(attempts), errP)
+	}
+
+	purged, errP = purger.Purge(ctx)
+	if errP != nil || purged != 1 || attempts[later.String()] != 1 {
+		t.Errorf("case: later user: expected only %s to be purged, but got %d purged, error: %v\n"+
+			"HINT: users whose purge failed should be skipped, so they do not block the users after them", later,
+			purged, errP)
+	}
+	if _, errRUI := userStore.ReadUserInfo(ctx, later); errRUI != user.ErrUserNotFound {
+		t.Errorf("case: later user: expected %s reading the purged user, but got %v", user.ErrUserNotFound, errRUI)
+	}
+
+	now = now.Add(RetryDelay)
+	purged, errP = purger.Purge(ctx)
+	if errP == nil || purged != 0 || len(attempts) != BatchSize+1 {
+		t.Errorf("case: retry: expected an error and no users purged, but got %d purged, error: %v", purged, errP)
+	}
+	for userUuid := range failing {
+		if attempts[userUuid] != 2 {
+			t.Errorf("case: retry: expected user %s to be tried twice, but got %d\n"+
+				"HINT: users whose purge failed should be tried again once the retry delay passes", userUuid,
+				attempts[userUuid])
+			break
+		}
+	}
+
+	now = now.Add(RetryDelay)
+	purged, errP = purger.Purge(ctx)
+	if errP != nil || purged != 0 {
+		t.Errorf("case: back off: expected nothing purged, but got %d purged, error: %v", purged, errP)
+	}
+	for userUuid := range failing {
+		if attempts[userUuid] != 2 {
+			t.Errorf("case: back off: expected user %s not to be tried again, but got %d tries\n"+
+				"HINT: the retry delay should double with each failure in a row", userUuid, attempts[userUuid])
+			break
+		}
+		counts := countEvents(t, auditLog, uuid.FromStringOrNil(userUuid))
+		if counts[audit.EventAccountPurgeFailed] != 2 {
+			t.Errorf("case: back off: expected user %s to have 2 %s events, but got %v\n"+
+				"HINT: each failed purge should be recorded", userUuid, audit.EventAccountPurgeFailed, counts)
+			break
+		}
+	}
+}
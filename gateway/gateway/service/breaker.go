@@ -0,0 +1,183 @@
+package service
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// BreakerState is the state of a circuit breaker.
+type BreakerState string
+
+const (
+	// BreakerClosed lets every request through, counting consecutive failures.
+	BreakerClosed BreakerState = "closed"
+	// BreakerOpen rejects every request until the open duration has passed.
+	BreakerOpen BreakerState = "open"
+	// BreakerHalfOpen lets a limited number of trial requests through to decide whether to close again.
+	BreakerHalfOpen BreakerState = "half-open"
+)
+
+// Default values for the circuit breaker.
+const (
+	DefaultBreakerFailureThreshold = 5
+	DefaultBreakerOpenDuration     = time.Second * 30
+	DefaultBreakerHalfOpenRequests = 1
+)
+
+// ErrCircuitOpen is returned when a request is rejected because the circuit breaker of the service is open.
+var ErrCircuitOpen = errors.New("service: circuit breaker is open")
+
+// CircuitBreaker describes when requests to a service stop being sent, so a failing service fails fast.
+type CircuitBreaker struct {
+	// FailureThreshold is the number of consecutive failed requests after which the breaker opens.
+	FailureThreshold int `yaml:"failureThreshold" json:"failureThreshold"`
+	// OpenDuration is how long the breaker stays open before trial requests are let through.
+	OpenDuration Duration `yaml:"openDuration" json:"openDuration"`
+	// HalfOpenRequests is the number of trial requests which must succeed before the breaker closes.
+	HalfOpenRequests int `yaml:"halfOpenRequests" json:"halfOpenRequests"`
+}
+
+// Breaker is a circuit breaker guarding all the upstreams of a service.
+type Breaker struct {
+	cfg CircuitBreaker
+
+	mu               sync.Mutex
+	state            BreakerState
+	failures         int
+	openedAt         time.Time
+	halfOpenInFlight int
+	halfOpenPassed   int
+	// generation is incremented each time the state changes, so the outcome of a request is only counted
+	// in the state it was allowed in.
+	generation    uint64
+	onStateChange []func(from, to BreakerState)
+}
+
+// BreakerTicket identifies a request allowed by a Breaker. Its outcome is only counted if the breaker has not
+// changed state since it was allowed, so a request allowed while closed can never be counted as a trial.
+type BreakerTicket struct {
+	generation uint64
+	trial      bool
+}
+
+// newBreaker creates a closed Breaker using the provided config.
+func newBreaker(cfg CircuitBreaker) *Breaker {
+	return &Breaker{cfg: cfg, state: BreakerClosed}
+}
+
+// OnStateChange registers fn to be called each time the breaker changes state.
+// fn is called while the breaker is locked, so it must not call back into the breaker.
+func (b *Breaker) OnStateChange(fn func(from, to BreakerState)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.onStateChange = append(b.onStateChange, fn)
+}
+
+// State returns the current state of the breaker.
+func (b *Breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refresh(time.Now())
+	return b.state
+}
+
+// Allow reports if a request may be sent, returning the ticket its outcome is recorded with.
+// Returns ErrCircuitOpen if the breaker is open, or if it is half-open and all trial requests are in use.
+// Every allowed request must be followed by a call to Success, Failure, or Abandon with its ticket.
+func (b *Breaker) Allow() (BreakerTicket, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refresh(time.Now())
+	ticket := BreakerTicket{generation: b.generation}
+	switch b.state {
+	case BreakerOpen:
+		return ticket, ErrCircuitOpen
+	case BreakerHalfOpen:
+		if b.halfOpenInFlight >= b.cfg.HalfOpenRequests {
+			return ticket, ErrCircuitOpen
+		}
+		b.halfOpenInFlight++
+		ticket.trial = true
+	}
+	return ticket, nil
+}
+
+// current reports if the request of ticket was allowed in the current state of the breaker.
+// Must be called with the breaker locked.
+func (b *Breaker) current(ticket BreakerTicket) bool {
+	return ticket.generation == b.generation
+}
+
+// Success records that an allowed request succeeded.
+func (b *Breaker) Success(ticket BreakerTicket) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.current(ticket) {
+		return
+	}
+	switch b.state {
+	case BreakerClosed:
+		b.failures = 0
+	case BreakerHalfOpen:
+		b.halfOpenInFlight--
+		b.halfOpenPassed++
+		if b.halfOpenPassed >= b.cfg.HalfOpenRequests {
+			b.setState(BreakerClosed, time.Now())
+		}
+	}
+}
+
+// Failure records that an allowed request failed.
+// The breaker opens once the failure threshold is reached, or if any trial request fails while half-open.
+func (b *Breaker) Failure(ticket BreakerTicket) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.current(ticket) {
+		return
+	}
+	switch b.state {
+	case BreakerClosed:
+		b.failures++
+		if b.failures >= b.cfg.FailureThreshold {
+			b.setState(BreakerOpen, time.Now())
+		}
+	case BreakerHalfOpen:
+		b.setState(BreakerOpen, time.Now())
+	}
+}
+
+// Abandon records that an allowed request ended without saying anything about the health of the service,
+// such as when the client cancelled it.
+func (b *Breaker) Abandon(ticket BreakerTicket) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.current(ticket) && ticket.trial {
+		b.halfOpenInFlight--
+	}
+}
+
+// refresh moves an open breaker to half-open once the open duration has passed.
+// Must be called with the breaker locked.
+func (b *Breaker) refresh(now time.Time) {
+	if b.state == BreakerOpen && !now.Before(b.openedAt.Add(time.Duration(b.cfg.OpenDuration))) {
+		b.setState(BreakerHalfOpen, now)
+	}
+}
+
+// setState changes the state of the breaker, resetting its counters and notifying the registered observers.
+// Must be called with the breaker locked.
+func (b *Breaker) setState(to BreakerState, now time.Time) {
+	from := b.state
+	b.state = to
+	b.generation++
+	b.failures = 0
+	b.halfOpenInFlight = 0
+	b.halfOpenPassed = 0
+	if to == BreakerOpen {
+		b.openedAt = now
+	}
+	for _, fn := range b.onStateChange {
+		fn(from, to)
+	}
+}
@@ -0,0 +1,155 @@
+// +build all unit
+
+package service
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBreaker_Transitions(t *testing.T) {
+	breaker := newBreaker(CircuitBreaker{FailureThreshold: 2, OpenDuration: Duration(time.Millisecond * 20),
+		HalfOpenRequests: 1})
+	var transitions []string
+	breaker.OnStateChange(func(from, to BreakerState) {
+		transitions = append(transitions, string(from)+"->"+string(to))
+	})
+
+	for i := 0; i < 2; i++ {
+		ticket, err := breaker.Allow()
+		if err != nil {
+			t.Fatalf("case: closed: expected request to be allowed, got %s", err)
+		}
+		breaker.Failure(ticket)
+	}
+	if _, err := breaker.Allow(); err != ErrCircuitOpen {
+		t.Errorf("case: open: expected %s once the threshold was reached, got %v", ErrCircuitOpen, err)
+	}
+
+	time.Sleep(time.Millisecond * 30)
+	trial, err := breaker.Allow()
+	if err != nil {
+		t.Fatalf("case: half-open: expected trial request to be allowed, got %s", err)
+	}
+	if _, err := breaker.Allow(); err != ErrCircuitOpen {
+		t.Errorf("case: half-open: expected only one trial request to be allowed, got %v", err)
+	}
+	breaker.Failure(trial)
+	if state := breaker.State(); state != BreakerOpen {
+		t.Errorf("case: half-open failure: expected breaker to open again, got %s", state)
+	}
+
+	time.Sleep(time.Millisecond * 30)
+	trial, err = breaker.Allow()
+	if err != nil {
+		t.Fatalf("case: half-open: expected trial request to be allowed, got %s", err)
+	}
+	breaker.Success(trial)
+	if state := breaker.State(); state != BreakerClosed {
+		t.Errorf("case: half-open success: expected breaker to close, got %s", state)
+	}
+
+	expected := "closed->open,open->half-open,half-open->open,open->half-open,half-open->closed"
+	if got := strings.Join(transitions, ","); got != expected {
+		t.Errorf("case: transitions: expected %s, got %s", expected, got)
+	}
+}
+
+func TestBreaker_AbandonReleasesTrial(t *testing.T) {
+	breaker := newBreaker(CircuitBreaker{FailureThreshold: 1, OpenDuration: Duration(time.Millisecond),
+		HalfOpenRequests: 1})
+	ticket, _ := breaker.Allow()
+	breaker.Failure(ticket)
+	time.Sleep(time.Millisecond * 5)
+	trial, err := breaker.Allow()
+	if err != nil {
+		t.Fatalf("case: abandon: expected trial request to be allowed, got %s", err)
+	}
+	breaker.Abandon(trial)
+	if _, err := breaker.Allow(); err != nil {
+		t.Errorf("case: abandon: expected abandoned trial to be available again, got %s", err)
+	}
+}
+
+func TestBreaker_OnlyTrialsCounted(t *testing.T) {
+	breaker := newBreaker(CircuitBreaker{FailureThreshold: 1, OpenDuration: Duration(time.Millisecond),
+		HalfOpenRequests: 1})
+	// Allowed while closed, but still in flight when the breaker opens and goes half-open
+	slow, errA := breaker.Allow()
+	if errA != nil {
+		t.Fatalf("case: closed: expected request to be allowed, got %s", errA)
+	}
+	failing, _ := breaker.Allow()
+	breaker.Failure(failing)
+	time.Sleep(time.Millisecond * 5)
+	if state := breaker.State(); state != BreakerHalfOpen {
+		t.Fatalf("case: setup: expected breaker to be half-open, got %s", state)
+	}
+
+	breaker.Success(slow)
+	if state := breaker.State(); state != BreakerHalfOpen {
+		t.Errorf("case: stale success: expected breaker to stay half-open, got %s\n"+
+			"HINT: a request allowed before the breaker went half-open is not a trial, so must not close it", state)
+	}
+	breaker.Abandon(slow)
+	breaker.Failure(slow)
+	if state := breaker.State(); state != BreakerHalfOpen {
+		t.Errorf("case: stale failure: expected breaker to stay half-open, got %s\n"+
+			"HINT: the outcome of a request allowed in an earlier state must be ignored", state)
+	}
+	trial, errA := breaker.Allow()
+	if errA != nil {
+		t.Fatalf("case: trial: expected the trial request to be allowed, got %s\n"+
+			"HINT: a stale request must not use up, or release, a trial slot", errA)
+	}
+	if _, errA := breaker.Allow(); errA != ErrCircuitOpen {
+		t.Errorf("case: trial: expected only one trial request to be allowed, got %v\n"+
+			"HINT: a stale request must not release a trial slot", errA)
+	}
+	breaker.Success(trial)
+	if state := breaker.State(); state != BreakerClosed {
+		t.Errorf("case: trial success: expected breaker to close, got %s", state)
+	}
+}
+
+func TestRetry_Retryable(t *testing.T) {
+	cases := []struct {
+		name      string
+		hint      string
+		method    string
+		body      string
+		attempts  int
+		retryable bool
+	}{
+		{"Get", "idempotent methods without a body should be retried", http.MethodGet, "", 2, true},
+		{"Delete", "idempotent methods without a body should be retried", http.MethodDelete, "", 2, true},
+		{"Post", "non idempotent methods must never be retried", http.MethodPost, "", 2, false},
+		{"Put With Body", "a request body can only be read once", http.MethodPut, "{}", 2, false},
+		{"Single Attempt", "attempts of 1 disables retries", http.MethodGet, "", 1, false},
+	}
+	for _, c := range cases {
+		r, _ := http.NewRequest(c.method, "http://a/", nil)
+		if len(c.body) != 0 {
+			r, _ = http.NewRequest(c.method, "http://a/", strings.NewReader(c.body))
+		}
+		rt := Retry{Attempts: c.attempts}
+		if got := rt.Retryable(r); got != c.retryable {
+			t.Errorf("case: %s: expected retryable to be %t, got %t\nHINT: %s", c.name, c.retryable, got, c.hint)
+		}
+	}
+}
+
+func TestRetry_BackoffFor(t *testing.T) {
+	rt := Retry{Attempts: 5, Backoff: Duration(time.Millisecond * 10), MaxBackoff: Duration(time.Millisecond * 25)}
+	limits := []time.Duration{time.Millisecond * 10, time.Millisecond * 20, time.Millisecond * 25,
+		time.Millisecond * 25}
+	for i, limit := range limits {
+		for j := 0; j < 20; j++ {
+			if backoff := rt.BackoffFor(i + 1); backoff < 0 || backoff > limit {
+				t.Errorf("case: retry %d: expected backoff between 0 and %s, got %s", i+1, limit, backoff)
+			}
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultUserDeletionTimeout is the time allowed for a service to delete the data of a user, if not set.
+const DefaultUserDeletionTimeout = time.Second * 30
+
+// userUuidPlaceholder is replaced with the uuid of the user in the path of a UserDeletion.
+const userUuidPlaceholder = "{userUuid}"
+
+// headerUserUuid identifies the user being deleted, as the gateway does for proxied requests.
+const headerUserUuid = "Perceptia-User-Uuid"
+
+var (
+	ErrInvalidUserDeletion = errors.New("service: user deletion path must start with / and timeout must be positive")
+	ErrUserDeletionFailed  = errors.New("service: unable to delete the data of the user")
+)
+
+// UserDeletion describes how a service is told to delete the data of a user, once their account is purged.
+type UserDeletion struct {
+	// Path is the path, on an upstream of the service, a DELETE request is sent to when a user is purged,
+	// with "{userUuid}" replaced by the uuid of the user. The service is not told if not set.
+	Path string `yaml:"path" json:"path"`
+	// Timeout is the time allowed for the service to respond.
+	Timeout Duration `yaml:"timeout" json:"timeout"`
+}
+
+// configured reports if the service should be told when a user is purged.
+func (ud *UserDeletion) configured() bool {
+	return len(ud.Path) != 0
+}
+
+// DeleteUserData tells the service to delete the data of the user with the given uuid.
+//
+// The request is sent to one upstream of the service, and is successful if it responds with a 2xx status,
+// or 404 if the service has no data for the user. Does nothing if the service does not set UserDeletion.
+// Only valid after the service has been validated, such as by Registry.Validate.
+func (svc *Service) DeleteUserData(ctx context.Context, userUuid string) error {
+	if !svc.UserDeletion.configured() {
+		return nil
+	}
+	up, errN := svc.pool.Next()
+	if errN != nil {
+		return fmt.Errorf("%s: %s: %s", svc.Name, ErrUserDeletionFailed, errN)
+	}
+	svc.pool.Acquire(up)
+	defer svc.pool.Release(up)
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(svc.UserDeletion.Timeout))
+	defer cancel()
+	target := *up.Url()
+	target.Path = strings.TrimSuffix(target.Path, "/") +
+		strings.Replace(svc.UserDeletion.Path, userUuidPlaceholder, userUuid, -1)
+	req, errNR := http.NewRequest(http.MethodDelete, target.String(), nil)
+	if errNR != nil {
+		return fmt.Errorf("%s: %s: %s", svc.Name, ErrUserDeletionFailed, errNR)
+	}
+	req.Header.Set(headerUserUuid, userUuid)
+	resp, errD := svc.deletionClient.Do(req.WithContext(ctx))
+	if errD != nil {
+		svc.pool.ReportFailure(up, errD.Error())
+		return fmt.Errorf("%s: %s: %s", svc.Name, ErrUserDeletionFailed, errD)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		svc.pool.ReportFailure(up, resp.Status)
+	} else {
+		svc.pool.ReportSuccess(up)
+	}
+	if (resp.StatusCode < 200 || resp.StatusCode > 299) && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("%s: %s: unexpected status %s", svc.Name, ErrUserDeletionFailed, resp.Status)
+	}
+	return nil
+}
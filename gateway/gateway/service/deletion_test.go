@@ -0,0 +1,84 @@
+// +build all unit
+
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestService_DeleteUserData(t *testing.T) {
+	const userUuid = "f47ac10b-58cc-4372-a567-0e02b2c3d479"
+	status := http.StatusNoContent
+	var gotMethod, gotPath, gotUser string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotMethod, gotPath, gotUser = r.Method, r.URL.Path, r.Header.Get(headerUserUuid)
+		w.WriteHeader(status)
+	}))
+	defer upstream.Close()
+
+	cases := []struct {
+		name        string
+		hint        string
+		path        string
+		status      int
+		expectSent  bool
+		expectError bool
+	}{
+		{
+			name:       "Basic: data deleted",
+			hint:       "A DELETE should be sent to the path with the uuid of the user filled in",
+			path:       "/api/v1/anyquiz/users/{userUuid}",
+			status:     http.StatusNoContent,
+			expectSent: true,
+		},
+		{
+			name:       "No data",
+			hint:       "A service with no data for the user has nothing to delete, which is not an error",
+			path:       "/api/v1/anyquiz/users/{userUuid}",
+			status:     http.StatusNotFound,
+			expectSent: true,
+		},
+		{
+			name:        "Service error",
+			hint:        "The user must not be purged until the service has deleted their data",
+			path:        "/api/v1/anyquiz/users/{userUuid}",
+			status:      http.StatusServiceUnavailable,
+			expectSent:  true,
+			expectError: true,
+		},
+		{
+			name:       "Not configured",
+			hint:       "A service without a user deletion path is not told",
+			path:       "",
+			expectSent: false,
+		},
+	}
+
+	for _, c := range cases {
+		gotMethod, gotPath, gotUser = "", "", ""
+		status = c.status
+		svc := &Service{Name: "anyquiz", Upstreams: []string{upstream.URL}, UserDeletion: UserDeletion{Path: c.path}}
+		if _, errNR := NewRegistry(svc); errNR != nil {
+			t.Fatalf("case: %s: unexpected error in test setup: %s", c.name, errNR)
+		}
+		errDUD := svc.DeleteUserData(context.Background(), userUuid)
+		if errDUD != nil && !c.expectError {
+			t.Errorf("case: %s: error not expected but got %s\nHINT: %s", c.name, errDUD, c.hint)
+		} else if errDUD == nil && c.expectError {
+			t.Errorf("case: %s: expected error but got nil\nHINT: %s", c.name, c.hint)
+		}
+		if !c.expectSent {
+			if len(gotMethod) != 0 {
+				t.Errorf("case: %s: expected no request but got %s %s\nHINT: %s", c.name, gotMethod, gotPath, c.hint)
+			}
+			continue
+		}
+		if gotMethod != http.MethodDelete || gotPath != "/api/v1/anyquiz/users/"+userUuid || gotUser != userUuid {
+			t.Errorf("case: %s: expected DELETE /api/v1/anyquiz/users/%s for user %s but got %s %s for user %q"+
+				"\nHINT: %s", c.name, userUuid, userUuid, gotMethod, gotPath, gotUser, c.hint)
+		}
+	}
+}
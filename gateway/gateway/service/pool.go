@@ -0,0 +1,260 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	kitlog "github.com/go-kit/kit/log"
+)
+
+// Load balancing strategies used to pick the upstream a request is sent to.
+const (
+	StrategyRoundRobin       = "round-robin"
+	StrategyLeastConnections = "least-connections"
+)
+
+// Default values for load balancing and health checking.
+const (
+	DefaultStrategy                    = StrategyRoundRobin
+	DefaultHealthCheckInterval         = time.Second * 10
+	DefaultHealthCheckTimeout          = time.Second * 2
+	DefaultEjectionConsecutiveFailures = 5
+	DefaultEjectionDuration            = time.Second * 30
+)
+
+// ErrNoHealthyUpstream is returned when every upstream of a service is unhealthy or ejected.
+var ErrNoHealthyUpstream = errors.New("service: no healthy upstream available")
+
+// HealthCheck describes the active health probe sent periodically to each upstream of a service.
+type HealthCheck struct {
+	// Path is requested on each upstream, a 2xx or 3xx response marks the upstream healthy.
+	// Active health checking is disabled if Path is empty.
+	Path string `yaml:"path" json:"path"`
+	// Interval is the time between probes.
+	Interval Duration `yaml:"interval" json:"interval"`
+	// Timeout is the maximum time to wait for the probe response.
+	Timeout Duration `yaml:"timeout" json:"timeout"`
+}
+
+// Ejection describes when an upstream is passively removed from rotation based on proxied responses.
+type Ejection struct {
+	// ConsecutiveFailures is the number of consecutive 5xx responses or connection errors
+	// after which the upstream is ejected.
+	ConsecutiveFailures int `yaml:"consecutiveFailures" json:"consecutiveFailures"`
+	// Duration is how long the upstream is ejected for before it is tried again.
+	Duration Duration `yaml:"duration" json:"duration"`
+}
+
+// LoadBalancing describes how requests are spread across the upstreams of a service.
+type LoadBalancing struct {
+	// Strategy is either round-robin or least-connections.
+	Strategy    string      `yaml:"strategy" json:"strategy"`
+	HealthCheck HealthCheck `yaml:"healthCheck" json:"healthCheck"`
+	Ejection    Ejection    `yaml:"ejection" json:"ejection"`
+}
+
+// Upstream represents a single instance of a service.
+type Upstream struct {
+	url *url.URL
+
+	activeConns int64
+
+	mu                  sync.Mutex
+	probeHealthy        bool
+	consecutiveFailures int
+	ejectedUntil        time.Time
+	lastError           string
+	lastChecked         time.Time
+}
+
+// Url returns the base url of the upstream.
+func (up *Upstream) Url() *url.URL {
+	return up.url
+}
+
+// available reports if the upstream can be sent requests at the given time.
+func (up *Upstream) available(now time.Time) bool {
+	up.mu.Lock()
+	defer up.mu.Unlock()
+	return up.probeHealthy && !now.Before(up.ejectedUntil)
+}
+
+// UpstreamStatus is a snapshot of the state of an upstream, used for reporting.
+type UpstreamStatus struct {
+	Url                 string    `json:"url"`
+	Healthy             bool      `json:"healthy"`
+	Ejected             bool      `json:"ejected"`
+	ActiveConnections   int64     `json:"activeConnections"`
+	ConsecutiveFailures int       `json:"consecutiveFailures"`
+	LastError           string    `json:"lastError,omitempty"`
+	LastChecked         time.Time `json:"lastChecked,omitempty"`
+}
+
+// Pool holds the upstreams of a service and picks which one each request is sent to.
+type Pool struct {
+	upstreams []*Upstream
+	lb        LoadBalancing
+	next      uint32
+}
+
+// newPool creates a pool for the provided upstream urls.
+// Every upstream starts healthy, until a probe or proxied request shows otherwise.
+func newPool(urls []*url.URL, lb LoadBalancing) *Pool {
+	pool := &Pool{lb: lb, upstreams: make([]*Upstream, 0, len(urls))}
+	for _, u := range urls {
+		pool.upstreams = append(pool.upstreams, &Upstream{url: u, probeHealthy: true})
+	}
+	return pool
+}
+
+// Next picks the upstream the next request should be sent to, using the configured strategy.
+// Only healthy upstreams which are not ejected are considered.
+// Returns ErrNoHealthyUpstream if none are available.
+func (pool *Pool) Next() (*Upstream, error) {
+	now := time.Now()
+	count := len(pool.upstreams)
+	start := int(atomic.AddUint32(&pool.next, 1)-1) % count
+	var picked *Upstream
+	for i := 0; i < count; i++ {
+		up := pool.upstreams[(start+i)%count]
+		if !up.available(now) {
+			continue
+		}
+		if pool.lb.Strategy != StrategyLeastConnections {
+			return up, nil
+		}
+		if picked == nil || atomic.LoadInt64(&up.activeConns) < atomic.LoadInt64(&picked.activeConns) {
+			picked = up
+		}
+	}
+	if picked == nil {
+		return nil, ErrNoHealthyUpstream
+	}
+	return picked, nil
+}
+
+// Acquire records that a request has been sent to the upstream.
+// Release must be called once the request completes.
+func (pool *Pool) Acquire(up *Upstream) {
+	atomic.AddInt64(&up.activeConns, 1)
+}
+
+// Release records that a request sent to the upstream has completed.
+func (pool *Pool) Release(up *Upstream) {
+	atomic.AddInt64(&up.activeConns, -1)
+}
+
+// ReportSuccess records a successful response from the upstream, resetting its failure count.
+func (pool *Pool) ReportSuccess(up *Upstream) {
+	up.mu.Lock()
+	defer up.mu.Unlock()
+	up.consecutiveFailures = 0
+}
+
+// ReportFailure records a 5xx response or connection error from the upstream.
+// The upstream is ejected once the configured number of consecutive failures is reached.
+func (pool *Pool) ReportFailure(up *Upstream, cause string) {
+	up.mu.Lock()
+	defer up.mu.Unlock()
+	up.consecutiveFailures++
+	up.lastError = cause
+	if up.consecutiveFailures >= pool.lb.Ejection.ConsecutiveFailures {
+		up.ejectedUntil = time.Now().Add(time.Duration(pool.lb.Ejection.Duration))
+		up.consecutiveFailures = 0
+	}
+}
+
+// Status returns a snapshot of the state of each upstream in the pool.
+func (pool *Pool) Status() []UpstreamStatus {
+	now := time.Now()
+	statuses := make([]UpstreamStatus, 0, len(pool.upstreams))
+	for _, up := range pool.upstreams {
+		up.mu.Lock()
+		statuses = append(statuses, UpstreamStatus{
+			Url:                 up.url.String(),
+			Healthy:             up.probeHealthy,
+			Ejected:             now.Before(up.ejectedUntil),
+			ActiveConnections:   atomic.LoadInt64(&up.activeConns),
+			ConsecutiveFailures: up.consecutiveFailures,
+			LastError:           up.lastError,
+			LastChecked:         up.lastChecked,
+		})
+		up.mu.Unlock()
+	}
+	return statuses
+}
+
+// Healthy reports if at least one upstream in the pool can be sent requests.
+func (pool *Pool) Healthy() bool {
+	now := time.Now()
+	for _, up := range pool.upstreams {
+		if up.available(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// RunHealthChecks probes each upstream of the pool at the configured interval until ctx is done.
+// Does nothing if active health checking is not configured for the service.
+func (pool *Pool) RunHealthChecks(ctx context.Context, client *http.Client, logger kitlog.Logger) {
+	hc := pool.lb.HealthCheck
+	if len(hc.Path) == 0 {
+		return
+	}
+	ticker := time.NewTicker(time.Duration(hc.Interval))
+	defer ticker.Stop()
+	for {
+		for _, up := range pool.upstreams {
+			pool.probe(ctx, client, up, logger)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// probe sends a single health check request to the upstream, recording the result.
+func (pool *Pool) probe(ctx context.Context, client *http.Client, up *Upstream, logger kitlog.Logger) {
+	hc := pool.lb.HealthCheck
+	probeCtx, cancel := context.WithTimeout(ctx, time.Duration(hc.Timeout))
+	defer cancel()
+	probeErr := ""
+	probeUrl := *up.url
+	probeUrl.Path = strings.TrimSuffix(up.url.Path, "/") + "/" + strings.TrimPrefix(hc.Path, "/")
+	req, errNR := http.NewRequest(http.MethodGet, probeUrl.String(), nil)
+	if errNR != nil {
+		probeErr = errNR.Error()
+	} else {
+		resp, errDo := client.Do(req.WithContext(probeCtx))
+		if errDo != nil {
+			probeErr = errDo.Error()
+		} else {
+			_ = resp.Body.Close()
+			if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+				probeErr = "health check returned status " + resp.Status
+			}
+		}
+	}
+
+	up.mu.Lock()
+	defer up.mu.Unlock()
+	wasHealthy := up.probeHealthy
+	up.probeHealthy = len(probeErr) == 0
+	up.lastChecked = time.Now()
+	if !up.probeHealthy {
+		up.lastError = probeErr
+	}
+	if wasHealthy != up.probeHealthy {
+		_ = logger.Log("msg", "upstream health changed", "upstream", up.url.String(),
+			"healthy", up.probeHealthy, "error", probeErr)
+	}
+}
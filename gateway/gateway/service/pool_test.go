@@ -0,0 +1,106 @@
+// +build all unit
+
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	kitlog "github.com/go-kit/kit/log"
+)
+
+func newTestPool(t *testing.T, strategy string, upstreams ...string) *Pool {
+	svc := &Service{Name: "test", Upstreams: upstreams, LoadBalancing: LoadBalancing{Strategy: strategy}}
+	if _, err := NewRegistry(svc); err != nil {
+		t.Fatalf("case: N/A: unexpected error in test setup: %s", err)
+	}
+	return svc.Pool()
+}
+
+func TestPool_NextRoundRobin(t *testing.T) {
+	pool := newTestPool(t, StrategyRoundRobin, "http://a:80", "http://b:80", "http://c:80")
+	seen := make(map[string]int)
+	for i := 0; i < 6; i++ {
+		up, err := pool.Next()
+		if err != nil {
+			t.Fatalf("case: round robin: unexpected error: %s", err)
+		}
+		seen[up.Url().Host]++
+	}
+	for host, count := range seen {
+		if count != 2 {
+			t.Errorf("case: round robin: expected each upstream to be picked twice, %s picked %d times", host, count)
+		}
+	}
+}
+
+func TestPool_NextLeastConnections(t *testing.T) {
+	pool := newTestPool(t, StrategyLeastConnections, "http://a:80", "http://b:80")
+	busy, _ := pool.Next()
+	pool.Acquire(busy)
+	for i := 0; i < 3; i++ {
+		up, err := pool.Next()
+		if err != nil {
+			t.Fatalf("case: least connections: unexpected error: %s", err)
+		}
+		if up == busy {
+			t.Errorf("case: least connections: expected the idle upstream to be picked, got %s", up.Url())
+		}
+	}
+	pool.Release(busy)
+}
+
+func TestPool_Ejection(t *testing.T) {
+	pool := newTestPool(t, StrategyRoundRobin, "http://a:80")
+	up, _ := pool.Next()
+	for i := 0; i < DefaultEjectionConsecutiveFailures; i++ {
+		pool.ReportFailure(up, "connection refused")
+	}
+	if _, err := pool.Next(); err != ErrNoHealthyUpstream {
+		t.Errorf("case: ejection: expected %s after consecutive failures, got %v", ErrNoHealthyUpstream, err)
+	}
+	if pool.Healthy() {
+		t.Errorf("case: ejection: expected pool to be unhealthy once its only upstream was ejected")
+	}
+	status := pool.Status()
+	if len(status) != 1 || !status[0].Ejected || status[0].LastError != "connection refused" {
+		t.Errorf("case: ejection: status does not report the ejection: %+v", status)
+	}
+}
+
+func TestPool_RunHealthChecks(t *testing.T) {
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer healthy.Close()
+	unhealthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unhealthy.Close()
+
+	healthyUrl, _ := url.Parse(healthy.URL)
+	unhealthyUrl, _ := url.Parse(unhealthy.URL)
+	pool := newPool([]*url.URL{healthyUrl, unhealthyUrl}, LoadBalancing{
+		Strategy:    StrategyRoundRobin,
+		HealthCheck: HealthCheck{Path: "/health", Interval: Duration(time.Hour), Timeout: Duration(time.Second)},
+		Ejection:    Ejection{ConsecutiveFailures: 1, Duration: Duration(time.Minute)},
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for _, up := range pool.upstreams {
+		pool.probe(ctx, http.DefaultClient, up, kitlog.NewNopLogger())
+	}
+	for i := 0; i < 4; i++ {
+		up, err := pool.Next()
+		if err != nil {
+			t.Fatalf("case: health checks: unexpected error: %s", err)
+		}
+		if up.Url().Host != healthyUrl.Host {
+			t.Errorf("case: health checks: expected only the healthy upstream to be picked, got %s", up.Url())
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	kitlog "github.com/go-kit/kit/log"
+	"gopkg.in/yaml.v2"
+)
+
+// Registry represents the set of backend services the gateway proxies requests to.
+type Registry struct {
+	Services []*Service `yaml:"services" json:"services"`
+}
+
+// NewRegistry creates a Registry from the provided services.
+// The registry is validated before being returned, and an error is returned if it is not valid.
+func NewRegistry(services ...*Service) (*Registry, error) {
+	reg := &Registry{Services: services}
+	if err := reg.Validate(); err != nil {
+		return nil, err
+	}
+	return reg, nil
+}
+
+// LoadRegistry reads the registry file at the given path.
+//
+// The format of the file is identified by its extension, either .yaml, .yml, or .json.
+// The registry is validated before being returned, and an error is returned if it is not valid.
+func LoadRegistry(path string) (*Registry, error) {
+	data, errRF := ioutil.ReadFile(path)
+	if errRF != nil {
+		return nil, fmt.Errorf("service: unable to read registry file: %s", errRF)
+	}
+	var errU error
+	reg := &Registry{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		errU = yaml.UnmarshalStrict(data, reg)
+	case ".json":
+		errU = json.Unmarshal(data, reg)
+	default:
+		return nil, ErrUnsupportedFileFormat
+	}
+	if errU != nil {
+		return nil, fmt.Errorf("service: unable to parse registry file: %s", errU)
+	}
+	if err := reg.Validate(); err != nil {
+		return nil, err
+	}
+	return reg, nil
+}
+
+// Validate applies default values to each service and ensures the registry is usable.
+// Returns an error describing the first problem found.
+func (reg *Registry) Validate() error {
+	if reg == nil || len(reg.Services) == 0 {
+		return ErrNoServices
+	}
+	names := make(map[string]bool, len(reg.Services))
+	prefixes := make(map[string]bool, len(reg.Services))
+	for _, svc := range reg.Services {
+		if svc == nil {
+			return ErrServiceNameMissing
+		}
+		svc.applyDefaults()
+		if err := svc.validate(); err != nil {
+			return err
+		}
+		if names[svc.Name] {
+			return fmt.Errorf("%s: %s", svc.Name, ErrDuplicateServiceName)
+		}
+		names[svc.Name] = true
+		if prefixes[svc.PathPrefix] {
+			return fmt.Errorf("%s: %s", svc.Name, ErrDuplicatePathPrefix)
+		}
+		prefixes[svc.PathPrefix] = true
+	}
+	return nil
+}
+
+// Get returns the service with the given name, or nil if no such service is registered.
+func (reg *Registry) Get(name string) *Service {
+	for _, svc := range reg.Services {
+		if svc.Name == name {
+			return svc
+		}
+	}
+	return nil
+}
+
+// ObserveBreakers registers fn to be called each time the circuit breaker of any service changes state.
+func (reg *Registry) ObserveBreakers(fn func(svc *Service, from, to BreakerState)) {
+	for _, svc := range reg.Services {
+		svc := svc
+		svc.Breaker().OnStateChange(func(from, to BreakerState) {
+			fn(svc, from, to)
+		})
+	}
+}
+
+// RunHealthChecks starts the active health checks for every service that has them configured.
+// The checks stop once ctx is done.
+func (reg *Registry) RunHealthChecks(ctx context.Context, logger kitlog.Logger) {
+	for _, svc := range reg.Services {
+		client := &http.Client{
+			// Probes to https upstreams are verified and authenticated the same as proxied requests.
+			Transport: &http.Transport{TLSClientConfig: svc.TLSConfig()},
+			// Health checks should report the status of the upstream itself, not where it redirects to.
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+		go svc.Pool().RunHealthChecks(ctx, client, kitlog.With(logger, "service", svc.Name))
+	}
+}
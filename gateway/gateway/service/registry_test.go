@@ -0,0 +1,155 @@
+// +build all unit
+
+package service
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadRegistry(t *testing.T) {
+	cases := []struct {
+		name        string
+		hint        string
+		fileName    string
+		contents    string
+		expectError bool
+	}{
+		{
+			name:     "Basic: yaml registry",
+			hint:     "A valid yaml registry should load without error",
+			fileName: "services.yaml",
+			contents: "services:\n" +
+				"  - name: anyquiz\n" +
+				"    upstreams: [\"http://aqrest:80\"]\n" +
+				"    timeouts:\n" +
+				"      dial: 5s\n",
+			expectError: false,
+		},
+		{
+			name:        "Basic: json registry",
+			hint:        "A valid json registry should load without error",
+			fileName:    "services.json",
+			contents:    `{"services": [{"name": "anyquiz", "upstreams": ["http://aqrest:80"], "auth": "session"}]}`,
+			expectError: false,
+		},
+		{
+			name:        "Unknown field",
+			hint:        "Unknown fields in a yaml registry should be reported, they are likely typos",
+			fileName:    "services.yaml",
+			contents:    "services:\n  - name: anyquiz\n    upstream: [\"http://aqrest:80\"]\n",
+			expectError: true,
+		},
+		{
+			name:        "Unsupported format",
+			hint:        "Only yaml and json registry files are supported",
+			fileName:    "services.toml",
+			contents:    "",
+			expectError: true,
+		},
+	}
+	dir, errTD := ioutil.TempDir("", "registry")
+	if errTD != nil {
+		t.Fatalf("case: N/A: unexpected error in test setup: %s", errTD)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, c := range cases {
+		path := filepath.Join(dir, c.fileName)
+		if err := ioutil.WriteFile(path, []byte(c.contents), 0600); err != nil {
+			t.Fatalf("case: %s: unexpected error in test setup: %s", c.name, err)
+		}
+		reg, errLR := LoadRegistry(path)
+		if errLR != nil && !c.expectError {
+			t.Errorf("case: %s: error not expected but got %s\nHINT: %s", c.name, errLR, c.hint)
+		} else if errLR == nil && c.expectError {
+			t.Errorf("case: %s: expected error but got nil\nHINT: %s", c.name, c.hint)
+		} else if errLR == nil && reg.Get("anyquiz") == nil {
+			t.Errorf("case: %s: expected service anyquiz to be registered\nHINT: %s", c.name, c.hint)
+		}
+	}
+}
+
+func TestRegistry_Validate(t *testing.T) {
+	cases := []struct {
+		name        string
+		hint        string
+		services    []*Service
+		expectError bool
+	}{
+		{
+			name:        "Basic: defaults applied",
+			hint:        "A service with a name and upstream is valid, all other values have defaults",
+			services:    []*Service{{Name: "anyquiz", Upstreams: []string{"http://aqrest:80"}}},
+			expectError: false,
+		},
+		{
+			name:        "No services",
+			hint:        "A registry must contain at least one service",
+			services:    nil,
+			expectError: true,
+		},
+		{
+			name:        "No upstreams",
+			hint:        "A service must have at least one upstream",
+			services:    []*Service{{Name: "anyquiz"}},
+			expectError: true,
+		},
+		{
+			name:        "Invalid upstream scheme",
+			hint:        "Upstreams must use the http or https scheme",
+			services:    []*Service{{Name: "anyquiz", Upstreams: []string{"ftp://aqrest:80"}}},
+			expectError: true,
+		},
+		{
+			name:        "Reserved path prefix",
+			hint:        "Services may not be exposed under the gateway path prefix",
+			services:    []*Service{{Name: "gateway", Upstreams: []string{"http://aqrest:80"}}},
+			expectError: true,
+		},
+		{
+			name:        "Invalid auth",
+			hint:        "Auth must be anonymous, session, or authenticated",
+			services:    []*Service{{Name: "anyquiz", Upstreams: []string{"http://aqrest:80"}, Auth: "admin"}},
+			expectError: true,
+		},
+		{
+			name: "Relative user deletion path",
+			hint: "The user deletion path is appended to the upstream url, so must start with /",
+			services: []*Service{{Name: "anyquiz", Upstreams: []string{"http://aqrest:80"},
+				UserDeletion: UserDeletion{Path: "users/{userUuid}"}}},
+			expectError: true,
+		},
+		{
+			name: "Duplicate path prefix",
+			hint: "Two services may not share a path prefix",
+			services: []*Service{
+				{Name: "anyquiz", Upstreams: []string{"http://aqrest:80"}},
+				{Name: "search", PathPrefix: "anyquiz", Upstreams: []string{"http://search:80"}},
+			},
+			expectError: true,
+		},
+	}
+
+	for _, c := range cases {
+		reg := &Registry{Services: c.services}
+		errV := reg.Validate()
+		if errV != nil && !c.expectError {
+			t.Errorf("case: %s: error not expected but got %s\nHINT: %s", c.name, errV, c.hint)
+		} else if errV == nil && c.expectError {
+			t.Errorf("case: %s: expected error but got nil\nHINT: %s", c.name, c.hint)
+		}
+	}
+
+	reg, errNR := NewRegistry(&Service{Name: "anyquiz", Upstreams: []string{"http://aqrest:80"}})
+	if errNR != nil {
+		t.Fatalf("case: defaults: unexpected error: %s", errNR)
+	}
+	svc := reg.Get("anyquiz")
+	if svc.PathPrefix != "anyquiz" || svc.Auth != AuthAnonymous || !svc.Headers.ForwardsIdentity() ||
+		len(svc.UpstreamUrls()) != 1 {
+		t.Errorf("case: defaults: defaults not applied as expected: %+v", svc)
+	}
+}
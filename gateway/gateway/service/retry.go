@@ -0,0 +1,60 @@
+package service
+
+import (
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// Default values for retrying proxied requests.
+const (
+	DefaultRetryAttempts   = 2
+	DefaultRetryBackoff    = time.Millisecond * 50
+	DefaultRetryMaxBackoff = time.Second
+)
+
+// Retry describes how requests which fail to reach a service are retried.
+//
+// Only requests using an idempotent method and without a body are ever retried,
+// since they can safely be sent more than once.
+type Retry struct {
+	// Attempts is the maximum number of times a request is sent, including the first attempt.
+	// Set to 1 to disable retries.
+	Attempts int `yaml:"attempts" json:"attempts"`
+	// Backoff is the base delay before a retry, doubled for each following retry.
+	Backoff Duration `yaml:"backoff" json:"backoff"`
+	// MaxBackoff caps the delay before a retry.
+	MaxBackoff Duration `yaml:"maxBackoff" json:"maxBackoff"`
+}
+
+// idempotentMethods are the request methods which may be retried.
+var idempotentMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+	http.MethodPut:     true,
+	http.MethodDelete:  true,
+}
+
+// Retryable reports if the request can safely be sent more than once.
+func (rt *Retry) Retryable(r *http.Request) bool {
+	return rt.Attempts > 1 && idempotentMethods[r.Method] && (r.Body == nil || r.Body == http.NoBody)
+}
+
+// BackoffFor returns the delay before the given retry, starting at 1 for the first retry.
+// The delay is picked at random between zero and the exponential backoff ("full jitter"),
+// so clients retrying at the same time do not all hit the service together.
+func (rt *Retry) BackoffFor(retry int) time.Duration {
+	backoff := time.Duration(rt.Backoff)
+	for i := 1; i < retry && backoff < time.Duration(rt.MaxBackoff); i++ {
+		backoff *= 2
+	}
+	if backoff > time.Duration(rt.MaxBackoff) {
+		backoff = time.Duration(rt.MaxBackoff)
+	}
+	if backoff <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(backoff) + 1))
+}
@@ -0,0 +1,349 @@
+// Package service provides the registry of backend services the gateway proxies requests to.
+package service
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// AuthRequirement identifies the level of authentication a request must have
+// before the gateway will proxy it to a service.
+type AuthRequirement string
+
+const (
+	// AuthAnonymous allows any request to be proxied, with or without a session.
+	AuthAnonymous AuthRequirement = "anonymous"
+	// AuthSession requires the request to be part of a session (authenticated or not).
+	AuthSession AuthRequirement = "session"
+	// AuthAuthenticated requires the request to be part of an authenticated session.
+	AuthAuthenticated AuthRequirement = "authenticated"
+)
+
+// Default values used when a service does not specify them.
+const (
+	DefaultDialTimeout           = time.Second * 10
+	DefaultResponseHeaderTimeout = time.Second * 30
+	DefaultAuthRequirement       = AuthAnonymous
+	DefaultStreamIdleTimeout     = time.Minute * 5
+	DefaultStreamsPerUser        = 10
+	DefaultCacheMaxTTL           = time.Minute * 5
+	DefaultCacheMaxBodyBytes     = 1 << 20
+)
+
+// reservedPathPrefixes are path prefixes used by the gateway itself, which services may not use.
+var reservedPathPrefixes = map[string]bool{"gateway": true}
+
+var (
+	ErrNoServices            = errors.New("service: at least one service must be defined")
+	ErrServiceNameMissing    = errors.New("service: name must be set")
+	ErrNoUpstreams           = errors.New("service: at least one upstream must be defined")
+	ErrInvalidUpstream       = errors.New("service: upstream must be an absolute http or https url")
+	ErrInvalidPathPrefix     = errors.New("service: path prefix must be a single path segment")
+	ErrReservedPathPrefix    = errors.New("service: path prefix is reserved by the gateway")
+	ErrInvalidAuth           = errors.New("service: auth must be one of anonymous, session, or authenticated")
+	ErrDuplicateServiceName  = errors.New("service: service name already defined")
+	ErrDuplicatePathPrefix   = errors.New("service: path prefix already used by another service")
+	ErrInvalidTimeout        = errors.New("service: timeouts must not be negative")
+	ErrUnsupportedFileFormat = errors.New("service: registry file must be .yaml, .yml, or .json")
+	ErrInvalidStrategy       = errors.New("service: load balancing strategy must be round-robin or least-connections")
+	ErrInvalidHealthCheck    = errors.New("service: health check interval and timeout must be positive")
+	ErrInvalidEjection       = errors.New("service: ejection consecutive failures and duration must be positive")
+	ErrInvalidRetry          = errors.New("service: retry attempts must be positive and backoffs must not be negative")
+	ErrInvalidStreaming      = errors.New("service: streaming idle timeout and max streams per user must be positive")
+	ErrInvalidCache          = errors.New("service: cache max ttl and max body bytes must be positive")
+	ErrInvalidBreaker        = errors.New("service: circuit breaker threshold, open duration and half-open requests must be positive")
+)
+
+// Duration is a time.Duration that can be read from a config file as a string, such as "10s".
+type Duration time.Duration
+
+// UnmarshalJSON parses a Duration from a JSON string such as "1m30s".
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	return d.parse(s)
+}
+
+// UnmarshalYAML parses a Duration from a YAML string such as "1m30s".
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	return d.parse(s)
+}
+
+// MarshalJSON encodes the Duration as a string, such as "1m30s".
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) parse(s string) error {
+	dur, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(dur)
+	return nil
+}
+
+// Timeouts holds the timeouts used when proxying requests to a service.
+type Timeouts struct {
+	// Dial is the maximum time to wait for a connection to an upstream to be established.
+	Dial Duration `yaml:"dial" json:"dial"`
+	// ResponseHeader is the maximum time to wait for an upstream to send its response headers.
+	ResponseHeader Duration `yaml:"responseHeader" json:"responseHeader"`
+}
+
+// Streaming describes the limits placed on long lived requests proxied to a service,
+// which are upgraded connections, such as WebSockets, and Server-Sent Events streams.
+type Streaming struct {
+	// IdleTimeout is the time after which a stream is closed if no data has been sent in either direction.
+	IdleTimeout Duration `yaml:"idleTimeout" json:"idleTimeout"`
+	// MaxPerUser is the maximum number of streams a single user, or client if not in a session,
+	// may have open to the service at once.
+	MaxPerUser int `yaml:"maxPerUser" json:"maxPerUser"`
+}
+
+// ResponseCache describes how responses from a service are cached by the gateway.
+//
+// Only responses the service marks as cacheable, using the Cache-Control max-age or s-maxage directives,
+// are cached, and they are cached per user unless marked public.
+type ResponseCache struct {
+	// Enabled turns on caching of responses from the service. Defaults to false.
+	Enabled bool `yaml:"enabled" json:"enabled"`
+	// MaxTTL caps how long a response is cached, whatever the service asks for.
+	MaxTTL Duration `yaml:"maxTTL" json:"maxTTL"`
+	// MaxBodyBytes is the size of the largest response body which is cached.
+	MaxBodyBytes int64 `yaml:"maxBodyBytes" json:"maxBodyBytes"`
+}
+
+// HeaderPolicy describes how request headers are modified before being sent to a service.
+type HeaderPolicy struct {
+	// ForwardIdentity controls if the Perceptia-User-Uuid and Perceptia-Session-Uuid headers are
+	// sent to the service. Defaults to true.
+	ForwardIdentity *bool `yaml:"forwardIdentity" json:"forwardIdentity"`
+	// Remove lists request headers that are removed before the request is proxied.
+	Remove []string `yaml:"remove" json:"remove"`
+	// Set lists request headers, and their values, that are set before the request is proxied.
+	Set map[string]string `yaml:"set" json:"set"`
+}
+
+// ForwardsIdentity reports if the user and session identity headers should be sent to the service.
+func (hp *HeaderPolicy) ForwardsIdentity() bool {
+	if hp == nil || hp.ForwardIdentity == nil {
+		return true
+	}
+	return *hp.ForwardIdentity
+}
+
+// Service describes a backend service the gateway proxies requests to.
+type Service struct {
+	// Name identifies the service, such as "anyquiz".
+	Name string `yaml:"name" json:"name"`
+	// Upstreams lists the base urls of the instances of the service, such as "http://aqrest:80".
+	Upstreams []string `yaml:"upstreams" json:"upstreams"`
+	// PathPrefix is the path segment the service is exposed under, "/api/{majorVersion}/{pathPrefix}/".
+	// Defaults to the Name of the service.
+	PathPrefix string `yaml:"pathPrefix" json:"pathPrefix"`
+	// Auth is the authentication a request must have to be proxied to the service.
+	Auth AuthRequirement `yaml:"auth" json:"auth"`
+	// Timeouts are the timeouts used when proxying requests to the service.
+	Timeouts Timeouts `yaml:"timeouts" json:"timeouts"`
+	// Headers is the policy applied to request headers before they are proxied.
+	Headers HeaderPolicy `yaml:"headers" json:"headers"`
+	// Streaming describes the limits placed on WebSocket and Server-Sent Events requests.
+	Streaming Streaming `yaml:"streaming" json:"streaming"`
+	// Cache describes how responses from the service are cached.
+	Cache ResponseCache `yaml:"cache" json:"cache"`
+	// LoadBalancing describes how requests are spread across the upstreams.
+	LoadBalancing LoadBalancing `yaml:"loadBalancing" json:"loadBalancing"`
+	// Retry describes how requests which fail to reach the service are retried.
+	Retry Retry `yaml:"retry" json:"retry"`
+	// CircuitBreaker describes when requests stop being sent to the service.
+	CircuitBreaker CircuitBreaker `yaml:"circuitBreaker" json:"circuitBreaker"`
+	// TLS describes how connections to https upstreams are verified and authenticated.
+	TLS UpstreamTLS `yaml:"tls" json:"tls"`
+	// UserDeletion describes how the service is told to delete the data of a user whose account is purged.
+	UserDeletion UserDeletion `yaml:"userDeletion" json:"userDeletion"`
+
+	upstreamUrls   []*url.URL
+	pool           *Pool
+	breaker        *Breaker
+	tlsConfig      *tls.Config
+	deletionClient *http.Client
+}
+
+// UpstreamUrls returns the parsed Upstreams of the service.
+// Only valid after the service has been validated, such as by Registry.Validate.
+func (svc *Service) UpstreamUrls() []*url.URL {
+	return svc.upstreamUrls
+}
+
+// Pool returns the pool of upstreams requests to the service are balanced across.
+// Only valid after the service has been validated, such as by Registry.Validate.
+func (svc *Service) Pool() *Pool {
+	return svc.pool
+}
+
+// Breaker returns the circuit breaker guarding requests to the service.
+// Only valid after the service has been validated, such as by Registry.Validate.
+func (svc *Service) Breaker() *Breaker {
+	return svc.breaker
+}
+
+// TLSConfig returns the tls config used to connect to the https upstreams of the service.
+// Only valid after the service has been validated, such as by Registry.Validate.
+func (svc *Service) TLSConfig() *tls.Config {
+	return svc.tlsConfig
+}
+
+// applyDefaults sets any values not provided by the config to their default values.
+func (svc *Service) applyDefaults() {
+	svc.Name = strings.TrimSpace(svc.Name)
+	if len(svc.PathPrefix) == 0 {
+		svc.PathPrefix = svc.Name
+	}
+	svc.PathPrefix = strings.Trim(svc.PathPrefix, "/")
+	if len(svc.Auth) == 0 {
+		svc.Auth = DefaultAuthRequirement
+	}
+	if svc.Timeouts.Dial == 0 {
+		svc.Timeouts.Dial = Duration(DefaultDialTimeout)
+	}
+	if svc.Timeouts.ResponseHeader == 0 {
+		svc.Timeouts.ResponseHeader = Duration(DefaultResponseHeaderTimeout)
+	}
+	if svc.Streaming.IdleTimeout == 0 {
+		svc.Streaming.IdleTimeout = Duration(DefaultStreamIdleTimeout)
+	}
+	if svc.Streaming.MaxPerUser == 0 {
+		svc.Streaming.MaxPerUser = DefaultStreamsPerUser
+	}
+	if svc.Cache.MaxTTL == 0 {
+		svc.Cache.MaxTTL = Duration(DefaultCacheMaxTTL)
+	}
+	if svc.Cache.MaxBodyBytes == 0 {
+		svc.Cache.MaxBodyBytes = DefaultCacheMaxBodyBytes
+	}
+	lb := &svc.LoadBalancing
+	if len(lb.Strategy) == 0 {
+		lb.Strategy = DefaultStrategy
+	}
+	if lb.HealthCheck.Interval == 0 {
+		lb.HealthCheck.Interval = Duration(DefaultHealthCheckInterval)
+	}
+	if lb.HealthCheck.Timeout == 0 {
+		lb.HealthCheck.Timeout = Duration(DefaultHealthCheckTimeout)
+	}
+	if lb.Ejection.ConsecutiveFailures == 0 {
+		lb.Ejection.ConsecutiveFailures = DefaultEjectionConsecutiveFailures
+	}
+	if lb.Ejection.Duration == 0 {
+		lb.Ejection.Duration = Duration(DefaultEjectionDuration)
+	}
+	if svc.Retry.Attempts == 0 {
+		svc.Retry.Attempts = DefaultRetryAttempts
+	}
+	if svc.Retry.Backoff == 0 {
+		svc.Retry.Backoff = Duration(DefaultRetryBackoff)
+	}
+	if svc.Retry.MaxBackoff == 0 {
+		svc.Retry.MaxBackoff = Duration(DefaultRetryMaxBackoff)
+	}
+	cb := &svc.CircuitBreaker
+	if cb.FailureThreshold == 0 {
+		cb.FailureThreshold = DefaultBreakerFailureThreshold
+	}
+	if cb.OpenDuration == 0 {
+		cb.OpenDuration = Duration(DefaultBreakerOpenDuration)
+	}
+	if cb.HalfOpenRequests == 0 {
+		cb.HalfOpenRequests = DefaultBreakerHalfOpenRequests
+	}
+	if svc.UserDeletion.Timeout == 0 {
+		svc.UserDeletion.Timeout = Duration(DefaultUserDeletionTimeout)
+	}
+}
+
+// validate ensures the service is usable, parsing the upstream urls and creating the upstream pool and breaker.
+// Returns an error describing the first problem found.
+func (svc *Service) validate() error {
+	if len(svc.Name) == 0 {
+		return ErrServiceNameMissing
+	}
+	if len(svc.PathPrefix) == 0 || strings.Contains(svc.PathPrefix, "/") {
+		return fmt.Errorf("%s: %s", svc.Name, ErrInvalidPathPrefix)
+	}
+	if reservedPathPrefixes[svc.PathPrefix] {
+		return fmt.Errorf("%s: %s", svc.Name, ErrReservedPathPrefix)
+	}
+	switch svc.Auth {
+	case AuthAnonymous, AuthSession, AuthAuthenticated:
+	default:
+		return fmt.Errorf("%s: %s", svc.Name, ErrInvalidAuth)
+	}
+	if svc.Timeouts.Dial < 0 || svc.Timeouts.ResponseHeader < 0 {
+		return fmt.Errorf("%s: %s", svc.Name, ErrInvalidTimeout)
+	}
+	if svc.Streaming.IdleTimeout <= 0 || svc.Streaming.MaxPerUser <= 0 {
+		return fmt.Errorf("%s: %s", svc.Name, ErrInvalidStreaming)
+	}
+	if svc.Cache.MaxTTL <= 0 || svc.Cache.MaxBodyBytes <= 0 {
+		return fmt.Errorf("%s: %s", svc.Name, ErrInvalidCache)
+	}
+	lb := svc.LoadBalancing
+	if lb.Strategy != StrategyRoundRobin && lb.Strategy != StrategyLeastConnections {
+		return fmt.Errorf("%s: %s", svc.Name, ErrInvalidStrategy)
+	}
+	if lb.HealthCheck.Interval <= 0 || lb.HealthCheck.Timeout <= 0 {
+		return fmt.Errorf("%s: %s", svc.Name, ErrInvalidHealthCheck)
+	}
+	if lb.Ejection.ConsecutiveFailures <= 0 || lb.Ejection.Duration <= 0 {
+		return fmt.Errorf("%s: %s", svc.Name, ErrInvalidEjection)
+	}
+	if svc.Retry.Attempts <= 0 || svc.Retry.Backoff < 0 || svc.Retry.MaxBackoff < 0 {
+		return fmt.Errorf("%s: %s", svc.Name, ErrInvalidRetry)
+	}
+	cb := svc.CircuitBreaker
+	if cb.FailureThreshold <= 0 || cb.OpenDuration <= 0 || cb.HalfOpenRequests <= 0 {
+		return fmt.Errorf("%s: %s", svc.Name, ErrInvalidBreaker)
+	}
+	if svc.UserDeletion.configured() && !strings.HasPrefix(svc.UserDeletion.Path, "/") ||
+		svc.UserDeletion.Timeout <= 0 {
+		return fmt.Errorf("%s: %s", svc.Name, ErrInvalidUserDeletion)
+	}
+	if len(svc.Upstreams) == 0 {
+		return fmt.Errorf("%s: %s", svc.Name, ErrNoUpstreams)
+	}
+	svc.upstreamUrls = make([]*url.URL, 0, len(svc.Upstreams))
+	usesHttps := false
+	for _, upstream := range svc.Upstreams {
+		upUrl, errP := url.Parse(upstream)
+		if errP != nil || (upUrl.Scheme != "http" && upUrl.Scheme != "https") || len(upUrl.Host) == 0 {
+			return fmt.Errorf("%s: %s: %s", svc.Name, ErrInvalidUpstream, upstream)
+		}
+		usesHttps = usesHttps || upUrl.Scheme == "https"
+		svc.upstreamUrls = append(svc.upstreamUrls, upUrl)
+	}
+	if svc.TLS.configured() && !usesHttps {
+		return fmt.Errorf("%s: %s", svc.Name, ErrTLSWithoutHttps)
+	}
+	tlsConfig, errB := svc.TLS.build()
+	if errB != nil {
+		return fmt.Errorf("%s: %s", svc.Name, errB)
+	}
+	svc.tlsConfig = tlsConfig
+	svc.pool = newPool(svc.upstreamUrls, lb)
+	svc.breaker = newBreaker(cb)
+	svc.deletionClient = &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	return nil
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+var (
+	ErrTLSWithoutHttps   = errors.New("service: tls is configured but no upstream uses https")
+	ErrIncompleteTLSCert = errors.New("service: tls certFile and keyFile must be set together")
+	ErrInvalidCABundle   = errors.New("service: tls caFile contains no PEM encoded certificates")
+)
+
+// UpstreamTLS describes how the gateway connects to upstreams which use https.
+// Applies only to upstreams with the https scheme.
+type UpstreamTLS struct {
+	// CAFile is the path of a PEM bundle of the certificate authorities trusted to sign upstream certificates.
+	// The system roots are trusted if not set.
+	CAFile string `yaml:"caFile" json:"caFile"`
+	// CertFile and KeyFile are the paths of the PEM encoded client certificate, and its key,
+	// the gateway authenticates itself to upstreams with (mutual TLS). No client certificate is sent if not set.
+	CertFile string `yaml:"certFile" json:"certFile"`
+	KeyFile  string `yaml:"keyFile" json:"keyFile"`
+	// ServerName is the name upstream certificates are verified against,
+	// such as when upstreams are addressed by ip. Defaults to the host of each upstream url.
+	ServerName string `yaml:"serverName" json:"serverName"`
+}
+
+// configured reports if any tls setting has been provided.
+func (ut *UpstreamTLS) configured() bool {
+	return len(ut.CAFile) != 0 || len(ut.CertFile) != 0 || len(ut.KeyFile) != 0 || len(ut.ServerName) != 0
+}
+
+// build loads the files of the tls settings, creating the tls config used to connect to upstreams.
+func (ut *UpstreamTLS) build() (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12, ServerName: ut.ServerName}
+	if len(ut.CAFile) != 0 {
+		pem, errRF := ioutil.ReadFile(ut.CAFile)
+		if errRF != nil {
+			return nil, fmt.Errorf("service: unable to read tls caFile: %s", errRF)
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, ErrInvalidCABundle
+		}
+	}
+	if (len(ut.CertFile) == 0) != (len(ut.KeyFile) == 0) {
+		return nil, ErrIncompleteTLSCert
+	}
+	if len(ut.CertFile) != 0 {
+		cert, errLKP := tls.LoadX509KeyPair(ut.CertFile, ut.KeyFile)
+		if errLKP != nil {
+			return nil, fmt.Errorf("service: unable to load tls client certificate: %s", errLKP)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
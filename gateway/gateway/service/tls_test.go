@@ -0,0 +1,153 @@
+// +build all unit
+
+package service
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeClientCert writes a new self signed client certificate, and its key, to dir.
+func writeClientCert(t *testing.T, dir string) (certPath, keyPath string) {
+	key, errGK := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if errGK != nil {
+		t.Fatalf("case: N/A: unexpected error generating key: %s", errGK)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "gateway"},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, errCC := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if errCC != nil {
+		t.Fatalf("case: N/A: unexpected error creating certificate: %s", errCC)
+	}
+	keyDer, errMK := x509.MarshalECPrivateKey(key)
+	if errMK != nil {
+		t.Fatalf("case: N/A: unexpected error encoding key: %s", errMK)
+	}
+	certPath, keyPath = filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+	if errW := ioutil.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		0600); errW != nil {
+		t.Fatalf("case: N/A: unexpected error writing certificate: %s", errW)
+	}
+	if errW := ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}),
+		0600); errW != nil {
+		t.Fatalf("case: N/A: unexpected error writing key: %s", errW)
+	}
+	return certPath, keyPath
+}
+
+func TestUpstreamTLS(t *testing.T) {
+	dir, errTD := ioutil.TempDir("", "upstreamtls")
+	if errTD != nil {
+		t.Fatalf("case: N/A: unexpected error in test setup: %s", errTD)
+	}
+	defer os.RemoveAll(dir)
+
+	// The upstream requires a client certificate, and its certificate is only trusted through the CA file.
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	upstream.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	upstream.StartTLS()
+	defer upstream.Close()
+	caPath := filepath.Join(dir, "ca.pem")
+	caPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: upstream.Certificate().Raw})
+	if errW := ioutil.WriteFile(caPath, caPem, 0600); errW != nil {
+		t.Fatalf("case: N/A: unexpected error in test setup: %s", errW)
+	}
+	certPath, keyPath := writeClientCert(t, dir)
+
+	cases := []struct {
+		name          string
+		hint          string
+		tls           UpstreamTLS
+		upstream      string
+		expectInvalid bool
+		expectReached bool
+	}{
+		{
+			name:          "Basic: mutual tls",
+			hint:          "The upstream should be trusted using the CA file, and accept the client certificate",
+			tls:           UpstreamTLS{CAFile: caPath, CertFile: certPath, KeyFile: keyPath},
+			upstream:      upstream.URL,
+			expectReached: true,
+		},
+		{
+			name:          "Wrong server name",
+			hint:          "The upstream certificate must be valid for the configured server name",
+			tls:           UpstreamTLS{CAFile: caPath, CertFile: certPath, KeyFile: keyPath, ServerName: "search"},
+			upstream:      upstream.URL,
+			expectReached: false,
+		},
+		{
+			name:          "Untrusted upstream",
+			hint:          "Without the CA file the upstream certificate is not trusted",
+			tls:           UpstreamTLS{CertFile: certPath, KeyFile: keyPath},
+			upstream:      upstream.URL,
+			expectReached: false,
+		},
+		{
+			name:          "Missing key",
+			hint:          "A client certificate requires its key",
+			tls:           UpstreamTLS{CAFile: caPath, CertFile: certPath},
+			upstream:      upstream.URL,
+			expectInvalid: true,
+		},
+		{
+			name:          "Invalid CA file",
+			hint:          "The CA file must contain PEM encoded certificates",
+			tls:           UpstreamTLS{CAFile: keyPath},
+			upstream:      upstream.URL,
+			expectInvalid: true,
+		},
+		{
+			name:          "Http upstream",
+			hint:          "TLS settings are a mistake if no upstream uses https",
+			tls:           UpstreamTLS{CAFile: caPath},
+			upstream:      "http://aqrest:80",
+			expectInvalid: true,
+		},
+	}
+
+	for _, c := range cases {
+		svc := &Service{Name: "anyquiz", Upstreams: []string{c.upstream}, TLS: c.tls}
+		_, errNR := NewRegistry(svc)
+		if (errNR != nil) != c.expectInvalid {
+			t.Errorf("case: %s: expected invalid %t but got error %v\nHINT: %s", c.name, c.expectInvalid, errNR,
+				c.hint)
+			continue
+		}
+		if errNR != nil {
+			continue
+		}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: svc.TLSConfig()}}
+		resp, errG := client.Get(c.upstream)
+		reached := errG == nil && resp.StatusCode == http.StatusOK
+		if errG == nil {
+			_ = resp.Body.Close()
+		}
+		if reached != c.expectReached {
+			t.Errorf("case: %s: expected reached %t but got error %v\nHINT: %s", c.name, c.expectReached, errG,
+				c.hint)
+		}
+	}
+}
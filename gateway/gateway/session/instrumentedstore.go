@@ -0,0 +1,69 @@
+package session
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/kit/metrics"
+	uuid "github.com/satori/go.uuid"
+)
+
+// InstrumentedStore represents a session.Store which records the duration of each call to the wrapped Store.
+type InstrumentedStore struct {
+	next Store
+	// Observes the duration of each call in seconds, labeled by method and success.
+	duration metrics.Histogram
+}
+
+// NewInstrumentedStore constructs a new InstrumentedStore wrapping next.
+// duration must accept the labels "method" and "success".
+func NewInstrumentedStore(next Store, duration metrics.Histogram) *InstrumentedStore {
+	if next == nil {
+		panic("No store provided!")
+	}
+	return &InstrumentedStore{next: next, duration: duration}
+}
+
+// Store implementation
+
+// Save saves the provided `sessionState` and associated SessionID to the wrapped store.
+func (is *InstrumentedStore) Save(ctx context.Context, sid SessionID, suuid uuid.UUID, sessionState interface{}) (err error) {
+	defer is.observe("Save", time.Now(), &err)
+	return is.next.Save(ctx, sid, suuid, sessionState)
+}
+
+// Get populates `sessionState` with the data previously saved for the given SessionID.
+// A session which is not found is not counted as a failure.
+func (is *InstrumentedStore) Get(ctx context.Context, sid SessionID, sessionState interface{}) (err error) {
+	defer func(begin time.Time) {
+		success := err == nil || err == ErrStateNotFound
+		is.duration.With("method", "Get", "success", strconv.FormatBool(success)).
+			Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return is.next.Get(ctx, sid, sessionState)
+}
+
+// GetSessionId retrieves the SessionId based on the Session Uuid.
+func (is *InstrumentedStore) GetSessionId(ctx context.Context, suuid uuid.UUID) (sid SessionID, err error) {
+	defer is.observe("GetSessionId", time.Now(), &err)
+	return is.next.GetSessionId(ctx, suuid)
+}
+
+// Exists tests if the given key is set.
+func (is *InstrumentedStore) Exists(ctx context.Context, sid SessionID) (exists bool, err error) {
+	defer is.observe("Exists", time.Now(), &err)
+	return is.next.Exists(ctx, sid)
+}
+
+// Delete deletes all state data associated with the SessionID from the wrapped store.
+func (is *InstrumentedStore) Delete(ctx context.Context, sid SessionID) (err error) {
+	defer is.observe("Delete", time.Now(), &err)
+	return is.next.Delete(ctx, sid)
+}
+
+// observe records the duration of a call to method which began at begin, and whether it returned an error.
+func (is *InstrumentedStore) observe(method string, begin time.Time, err *error) {
+	is.duration.With("method", method, "success", strconv.FormatBool(*err == nil)).
+		Observe(time.Since(begin).Seconds())
+}
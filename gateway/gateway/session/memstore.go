@@ -1,10 +1,12 @@
 package session
 
 import (
+	"context"
 	"encoding/json"
 	"time"
 
 	"github.com/patrickmn/go-cache"
+	uuid "github.com/satori/go.uuid"
 )
 
 // MemStore represents an in-process memory session store.
@@ -12,46 +14,83 @@ import (
 // Production systems should use a shared server store like redis.
 type MemStore struct {
 	entries *cache.Cache
+	// sessionIds holds the SessionID of each session uuid.
+	sessionIds *cache.Cache
 }
 
 // NewMemStore constructs and returns a new MemStore.
 func NewMemStore(sessionDuration time.Duration, purgeInterval time.Duration) *MemStore {
 	return &MemStore{
-		entries: cache.New(sessionDuration, purgeInterval),
+		entries:    cache.New(sessionDuration, purgeInterval),
+		sessionIds: cache.New(sessionDuration, purgeInterval),
 	}
 }
 
 // Save saves the provided `sessionState` and associated SessionID to the store.
 // The `sessionState` parameter is typically a pointer to a struct containing all the data you want to be
 // associated with the given SessionID.
-func (ms *MemStore) Save(sid SessionID, state interface{}) error {
+func (ms *MemStore) Save(_ context.Context, sid SessionID, sessionUuid uuid.UUID, state interface{}) error {
 	j, err := json.Marshal(state)
 	if nil != err {
 		return err
 	}
 	ms.entries.Set(sid.String(), j, cache.DefaultExpiration)
+	ms.sessionIds.Set(sessionUuid.String(), sid, cache.DefaultExpiration)
 	return nil
 }
 
 // Get populates `sessionState` with the data previously saved for the given SessionID.
-func (ms *MemStore) Get(sid SessionID, state interface{}) error {
+func (ms *MemStore) Get(_ context.Context, sid SessionID, state interface{}) error {
 	j, found := ms.entries.Get(sid.String())
 	if !found {
 		return ErrStateNotFound
 	}
 	//reset TTL
-	ms.entries.Set(sid.String(), j, 0)
+	ms.entries.Set(sid.String(), j, cache.DefaultExpiration)
 	return json.Unmarshal(j.([]byte), state)
 }
 
+// GetSessionId retrieves the SessionId based on the Session Uuid.
+func (ms *MemStore) GetSessionId(_ context.Context, sessionUuid uuid.UUID) (SessionID, error) {
+	sid, found := ms.sessionIds.Get(sessionUuid.String())
+	if !found {
+		return InvalidSessionID, ErrUnexpected
+	}
+	return sid.(SessionID), nil
+}
+
+// Peek populates `sessionState` like Get, but without extending the expiry of the session.
+func (ms *MemStore) Peek(_ context.Context, sid SessionID, state interface{}) error {
+	j, found := ms.entries.Get(sid.String())
+	if !found {
+		return ErrStateNotFound
+	}
+	return json.Unmarshal(j.([]byte), state)
+}
+
+// Exists determines if the session id is in the session store.
+func (ms *MemStore) Exists(_ context.Context, sid SessionID) (bool, error) {
+	_, found := ms.entries.Get(sid.String())
+	return found, nil
+}
+
 // Delete deletes all state data associated with the SessionID from the store.
-func (ms *MemStore) Delete(sid SessionID) error {
+func (ms *MemStore) Delete(_ context.Context, sid SessionID) error {
 	ms.entries.Delete(sid.String())
 	return nil
 }
 
-// Delete deletes all state data associated with the SessionID from the store.
-func (ms *MemStore) Exists(sid SessionID) (bool, error) {
-	ms.entries.Delete(sid.String())
-	return false, nil
+// Count returns the number of sessions in the store which have not expired.
+func (ms *MemStore) Count(_ context.Context) (int, error) {
+	return len(ms.entries.Items()), nil
+}
+
+// SessionIds returns the id of every session in the store which has not expired.
+func (ms *MemStore) SessionIds(_ context.Context) ([]SessionID, error) {
+	items := ms.entries.Items()
+	sids := make([]SessionID, 0, len(items))
+	for sid := range items {
+		sids = append(sids, SessionID(sid))
+	}
+	return sids, nil
 }
@@ -1,8 +1,17 @@
-// +build none
+// +build all unit
 
 package session
 
-// TODO: Update to use new session structure
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
 /*
 TestMemStore tests the MemStore object
 
@@ -10,64 +19,82 @@ Since a Store is like a database, you can't really test methods like Get()
 or Delete() without also calling (and therefore testing) methods like Save(),
 so instead of testing individual methods in isolation, this test runs through
 a full CRUD cycle, ensuring the correct behavior occurs at each point in that
-cycle. You should use a similar approach when testing your RedisStore implementation.
+cycle.
 */
-//func TestMemStore(t *testing.T) {
-//	type sessionState struct {
-//		Sval string
-//		Ival int
-//	}
-//
-//	state := &sessionState{
-//		Sval: "testing",
-//		Ival: 99,
-//	}
-//	stateRet := &sessionState{}
-//
-//	sid, err := NewSessionID("test key")
-//	if err != nil {
-//		t.Fatalf("error generating new SessionID: %v", err)
-//	}
-//
-//	store := NewMemStore(time.Hour, time.Minute)
-//
-//	if err := store.Get(sid, stateRet); err != ErrStateNotFound {
-//		t.Errorf("incorrect error when getting state that was never stored: expected %v but got %v", ErrStateNotFound, err)
-//	}
-//
-//	if err := store.Save(sid, &state); err != nil {
-//		t.Fatalf("error saving state: %v", err)
-//	}
-//
-//	if err := store.Get(sid, &stateRet); err != nil {
-//		t.Fatalf("error getting state: %v", err)
-//	}
-//	if !reflect.DeepEqual(state, stateRet) {
-//		jexp, _ := json.MarshalIndent(state, "", "  ")
-//		jact, _ := json.MarshalIndent(state, "", "  ")
-//		t.Errorf("incorrect state retrieved:\nEXPECTED\n%s\nACTUAL\n%s", string(jexp), string(jact))
-//	}
-//
-//	if err := store.Delete(sid); err != nil {
-//		t.Errorf("error deleting state: %v", err)
-//	}
-//
-//	if err := store.Get(sid, &stateRet); err != ErrStateNotFound {
-//		t.Fatalf("incorrect error when getting state that was deleted: expected %v but got %v", ErrStateNotFound, err)
-//	}
-//}
-//
-//func TestMemStoreSaveUnmarshalble(t *testing.T) {
-//	//verify that saving an umarshalalbe session state
-//	//generates an error
-//	state := func() {} //function values can't be marshaled into JSON
-//
-//	sid, err := NewSessionID("test key")
-//	if err != nil {
-//		t.Fatalf("error generating new SessionID: %v", err)
-//	}
-//	store := NewMemStore(time.Hour, time.Minute)
-//	if err := store.Save(sid, state); err == nil {
-//		t.Error("expected error when attempting to save a session state with an unmarshalable field")
-//	}
-//}
+func TestMemStore(t *testing.T) {
+	type sessionState struct {
+		Sval string
+		Ival int
+	}
+
+	ctx := context.Background()
+	state := &sessionState{
+		Sval: "testing",
+		Ival: 99,
+	}
+	stateRet := &sessionState{}
+
+	sid, err := NewSessionID("test key")
+	if err != nil {
+		t.Fatalf("error generating new SessionID: %v", err)
+	}
+	suuid := uuid.NewV4()
+
+	var store Lister = NewMemStore(time.Hour, time.Minute)
+
+	if err := store.Get(ctx, sid, stateRet); err != ErrStateNotFound {
+		t.Errorf("incorrect error when getting state that was never stored: expected %v but got %v", ErrStateNotFound, err)
+	}
+	if exists, _ := store.Exists(ctx, sid); exists {
+		t.Errorf("expected state that was never stored not to exist")
+	}
+
+	if err := store.Save(ctx, sid, suuid, state); err != nil {
+		t.Fatalf("error saving state: %v", err)
+	}
+
+	if err := store.Get(ctx, sid, stateRet); err != nil {
+		t.Fatalf("error getting state: %v", err)
+	}
+	if !reflect.DeepEqual(state, stateRet) {
+		jexp, _ := json.MarshalIndent(state, "", "  ")
+		jact, _ := json.MarshalIndent(stateRet, "", "  ")
+		t.Errorf("incorrect state retrieved:\nEXPECTED\n%s\nACTUAL\n%s", string(jexp), string(jact))
+	}
+	if exists, _ := store.Exists(ctx, sid); !exists {
+		t.Errorf("expected saved state to exist, and to still exist after checking")
+	}
+	if sidRet, err := store.GetSessionId(ctx, suuid); err != nil || sidRet != sid {
+		t.Errorf("expected session id %s for the session uuid but got %s, error: %v", sid, sidRet, err)
+	}
+	if sids, err := store.SessionIds(ctx); err != nil || len(sids) != 1 || sids[0] != sid {
+		t.Errorf("expected the session ids to be [%s] but got %v, error: %v", sid, sids, err)
+	}
+	peeked := &sessionState{}
+	if err := store.Peek(ctx, sid, peeked); err != nil || !reflect.DeepEqual(state, peeked) {
+		t.Errorf("expected to peek the saved state %+v but got %+v, error: %v", state, peeked, err)
+	}
+
+	if err := store.Delete(ctx, sid); err != nil {
+		t.Errorf("error deleting state: %v", err)
+	}
+
+	if err := store.Get(ctx, sid, stateRet); err != ErrStateNotFound {
+		t.Fatalf("incorrect error when getting state that was deleted: expected %v but got %v", ErrStateNotFound, err)
+	}
+}
+
+func TestMemStoreSaveUnmarshalble(t *testing.T) {
+	//verify that saving an umarshalalbe session state
+	//generates an error
+	state := func() {} //function values can't be marshaled into JSON
+
+	sid, err := NewSessionID("test key")
+	if err != nil {
+		t.Fatalf("error generating new SessionID: %v", err)
+	}
+	store := NewMemStore(time.Hour, time.Minute)
+	if err := store.Save(context.Background(), sid, uuid.NewV4(), state); err == nil {
+		t.Error("expected error when attempting to save a session state with an unmarshalable field")
+	}
+}
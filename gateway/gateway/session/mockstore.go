@@ -1,8 +1,11 @@
 package session
 
 import (
+	"context"
 	"fmt"
 	"testing"
+
+	uuid "github.com/satori/go.uuid"
 )
 
 // MethodName is used to reference methods exported by MockStore.
@@ -16,9 +19,11 @@ func (m MethodName) String() string {
 // These MethodName constants provide easy access to the methods exported by MockStore to use when
 // building the map of functions to pass to the MockStore.
 const (
-	FNSave   MethodName = "Save"
-	FNGet    MethodName = "Get"
-	FNDelete MethodName = "Delete"
+	FNSave         MethodName = "Save"
+	FNGet          MethodName = "Get"
+	FNGetSessionId MethodName = "GetSessionId"
+	FNExists       MethodName = "Exists"
+	FNDelete       MethodName = "Delete"
 )
 
 // MockStore represents a sessions.Store to be used in testing functions that rely on a session Store.
@@ -28,9 +33,11 @@ const (
 type MockStore struct {
 	t                  *testing.T
 	testingErrorPrefix string
-	fnSave             func(SessionID, interface{}) error
-	fnGet              func(SessionID, interface{}) error
-	fnDelete           func(SessionID) error
+	fnSave             func(context.Context, SessionID, uuid.UUID, interface{}) error
+	fnGet              func(context.Context, SessionID, interface{}) error
+	fnGetSessionId     func(context.Context, uuid.UUID) (SessionID, error)
+	fnExists           func(context.Context, SessionID) (bool, error)
+	fnDelete           func(context.Context, SessionID) error
 }
 
 // NewMockStore constructs a new MockStore.
@@ -59,29 +66,47 @@ func (ms *MockStore) UpdateErrorPrefix(tErrPrefix string) {
 
 // Save calls the mock Save function, if this function was not mocked will cause the current test to
 // log an error and fail.
-func (ms *MockStore) Save(sid SessionID, sessionState interface{}) error {
+func (ms *MockStore) Save(ctx context.Context, sid SessionID, suuid uuid.UUID, sessionState interface{}) error {
 	if ms.fnSave == nil {
 		ms.testingError("the function (Save) was not mocked")
 	}
-	return ms.fnSave(sid, sessionState)
+	return ms.fnSave(ctx, sid, suuid, sessionState)
 }
 
 // Get calls the mock Get function, if this function was not mocked will cause the current test to
 // log an error and fail.
-func (ms *MockStore) Get(sid SessionID, sessionState interface{}) error {
+func (ms *MockStore) Get(ctx context.Context, sid SessionID, sessionState interface{}) error {
 	if ms.fnGet == nil {
 		ms.testingError("the function (Get) was not mocked")
 	}
-	return ms.fnGet(sid, sessionState)
+	return ms.fnGet(ctx, sid, sessionState)
+}
+
+// GetSessionId calls the mock GetSessionId function, if this function was not mocked will cause the current test to
+// log an error and fail.
+func (ms *MockStore) GetSessionId(ctx context.Context, suuid uuid.UUID) (SessionID, error) {
+	if ms.fnGetSessionId == nil {
+		ms.testingError("the function (GetSessionId) was not mocked")
+	}
+	return ms.fnGetSessionId(ctx, suuid)
+}
+
+// Exists calls the mock Exists function, if this function was not mocked will cause the current test to
+// log an error and fail.
+func (ms *MockStore) Exists(ctx context.Context, sid SessionID) (bool, error) {
+	if ms.fnExists == nil {
+		ms.testingError("the function (Exists) was not mocked")
+	}
+	return ms.fnExists(ctx, sid)
 }
 
 // Delete calls the mock Delete function, if this function was not mocked will cause the current test to
 // log an error and fail.
-func (ms *MockStore) Delete(sid SessionID) error {
+func (ms *MockStore) Delete(ctx context.Context, sid SessionID) error {
 	if ms.fnDelete == nil {
 		ms.testingError("the function (Delete) was not mocked")
 	}
-	return ms.fnDelete(sid)
+	return ms.fnDelete(ctx, sid)
 }
 
 // addFunctions will take a map of functions and add them to this MockStore. If a provided function
@@ -93,24 +118,38 @@ func (ms *MockStore) addFunctions(funcs map[MethodName]interface{}) *MockStore {
 	for fnName, fn := range funcs {
 		switch fnName {
 		case FNSave:
-			fnAdd, ok := fn.(func(SessionID, interface{}) error)
+			fnAdd, ok := fn.(func(context.Context, SessionID, uuid.UUID, interface{}) error)
 			if !ok {
-				ms.testingError(fmt.Sprintf("the function supplied for %s must match: 'func(SessionID, "+
-					"interface{}) error'", FNSave))
+				ms.testingError(fmt.Sprintf("the function supplied for %s must match: 'func(context.Context, "+
+					"SessionID, uuid.UUID, interface{}) error'", FNSave))
 			}
 			ms.fnSave = fnAdd
 		case FNGet:
-			fnAdd, ok := fn.(func(SessionID, interface{}) error)
+			fnAdd, ok := fn.(func(context.Context, SessionID, interface{}) error)
 			if !ok {
-				ms.testingError(fmt.Sprintf("the function supplied for %s must match: 'func(SessionID, "+
-					"interface{}) error'", FNGet))
+				ms.testingError(fmt.Sprintf("the function supplied for %s must match: 'func(context.Context, "+
+					"SessionID, interface{}) error'", FNGet))
 			}
 			ms.fnGet = fnAdd
+		case FNGetSessionId:
+			fnAdd, ok := fn.(func(context.Context, uuid.UUID) (SessionID, error))
+			if !ok {
+				ms.testingError(fmt.Sprintf("the function supplied for %s must match: 'func(context.Context, "+
+					"uuid.UUID) (SessionID, error)'", FNGetSessionId))
+			}
+			ms.fnGetSessionId = fnAdd
+		case FNExists:
+			fnAdd, ok := fn.(func(context.Context, SessionID) (bool, error))
+			if !ok {
+				ms.testingError(fmt.Sprintf("the function supplied for %s must match: 'func(context.Context, "+
+					"SessionID) (bool, error)'", FNExists))
+			}
+			ms.fnExists = fnAdd
 		case FNDelete:
-			fnAdd, ok := fn.(func(SessionID) error)
+			fnAdd, ok := fn.(func(context.Context, SessionID) error)
 			if !ok {
-				ms.testingError(fmt.Sprintf("the function supplied for %s must match: 'func(SessionID, "+
-					"interface{}) error'", FNDelete))
+				ms.testingError(fmt.Sprintf("the function supplied for %s must match: 'func(context.Context, "+
+					"SessionID) error'", FNDelete))
 			}
 			ms.fnDelete = fnAdd
 		default:
@@ -1,12 +1,14 @@
 package session
 
 import (
+	"context"
 	"time"
 
 	uuid "github.com/satori/go.uuid"
 
 	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/go-redis/redis"
 )
@@ -34,30 +36,73 @@ func NewRedisStore(client *redis.Client, sessionDuration time.Duration) *RedisSt
 //
 // The `sessionState` parameter is typically a pointer to a struct containing all the data you want to be
 // associated with the given SessionID.
-func (rs *RedisStore) Save(sid SessionID, sessionUuid uuid.UUID, sessionState interface{}) error {
+func (rs *RedisStore) Save(ctx context.Context, sid SessionID, sessionUuid uuid.UUID, sessionState interface{}) error {
 	sesJson, err := json.Marshal(sessionState)
 	if err != nil {
 		return fmt.Errorf("error marshaling sessionState into json:\n%s", err.Error())
 	}
-	err = rs.Client.Set(getRedisKey(sid), sesJson, rs.SessionDuration).Err()
+	client := rs.Client.WithContext(ctx)
+	err = do(ctx, func() error {
+		return client.Set(getRedisKey(sid), sesJson, rs.SessionDuration).Err()
+	})
 	if err != nil {
 		return fmt.Errorf("error setting session state:\n%s", err.Error())
 	}
-	err = rs.Client.Set(getRedisUuidKey(sessionUuid), sid.String(), 0).Err()
+	err = do(ctx, func() error {
+		return client.Set(getRedisUuidKey(sessionUuid), sid.String(), 0).Err()
+	})
 	if err != nil {
 		return fmt.Errorf("error setting session id refference:\n%s", err.Error())
 	}
+	if owned, ok := sessionState.(Owned); ok {
+		if userUuid, isOwned := owned.SessionOwner(); isOwned {
+			if err = rs.addUserSession(ctx, sid, userUuid); err != nil {
+				return fmt.Errorf("error adding session to the sessions of the user:\n%s", err.Error())
+			}
+		}
+	}
 	return nil
 }
 
+// addUserSession adds the session to the sessions of the user, and removes the sessions of the user which
+// expired, so the sessions kept for each user do not grow without bound.
+func (rs *RedisStore) addUserSession(ctx context.Context, sid SessionID, userUuid uuid.UUID) error {
+	client := rs.Client.WithContext(ctx)
+	err := do(ctx, func() error {
+		pipe := client.TxPipeline()
+		pipe.SAdd(getRedisUserKey(userUuid.String()), sid.String())
+		pipe.Set(getRedisOwnerKey(sid), userUuid.String(), rs.SessionDuration)
+		_, err := pipe.Exec()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	_, err = rs.UserSessionIds(ctx, userUuid)
+	return err
+}
+
 // Get populates `sessionState` with the data previously saved for the given SessionID.
-func (rs *RedisStore) Get(sid SessionID, sessionState interface{}) error {
-	pipe := rs.Client.Pipeline()
-	res := pipe.Get(getRedisKey(sid))
-	expErr := pipe.Expire(getRedisKey(sid), rs.SessionDuration).Err()
-	_, pipeErr := pipe.Exec()
-	if res.Err() != nil {
+func (rs *RedisStore) Get(ctx context.Context, sid SessionID, sessionState interface{}) error {
+	var res *redis.StringCmd
+	var expErr, pipeErr error
+	errDo := do(ctx, func() error {
+		pipe := rs.Client.WithContext(ctx).Pipeline()
+		res = pipe.Get(getRedisKey(sid))
+		expire := pipe.Expire(getRedisKey(sid), rs.SessionDuration)
+		// The owner is kept as long as the session, so it can be removed from the sessions of the user
+		pipe.Expire(getRedisOwnerKey(sid), rs.SessionDuration)
+		_, pipeErr = pipe.Exec()
+		expErr = expire.Err()
+		return nil
+	})
+	if errDo != nil {
+		return fmt.Errorf("error getting sid <%s>:\n%w", string(sid), errDo)
+	}
+	if res.Err() == redis.Nil {
 		return ErrStateNotFound
+	} else if res.Err() != nil {
+		return fmt.Errorf("error getting sid <%s>:\n%w", string(sid), res.Err())
 	}
 	if expErr != nil {
 		return fmt.Errorf("error changing expiration of session <%s>:\n%s", sid, expErr.Error())
@@ -72,35 +117,178 @@ func (rs *RedisStore) Get(sid SessionID, sessionState interface{}) error {
 	return nil
 }
 
-func (rs *RedisStore) GetSessionId(sessionUuid uuid.UUID) (SessionID, error) {
-	res := rs.Client.Get(getRedisUuidKey(sessionUuid))
-	if res.Err() != nil {
+// Peek populates `sessionState` like Get, but without extending the expiry of the session,
+// so reading sessions for administration does not keep them alive.
+func (rs *RedisStore) Peek(ctx context.Context, sid SessionID, sessionState interface{}) error {
+	var res string
+	err := do(ctx, func() (err error) {
+		res, err = rs.Client.WithContext(ctx).Get(getRedisKey(sid)).Result()
+		return err
+	})
+	if err == redis.Nil {
+		return ErrStateNotFound
+	} else if err != nil {
+		return fmt.Errorf("error getting sid <%s>:\n%v", string(sid), err.Error())
+	}
+	err = json.Unmarshal([]byte(res), sessionState)
+	if err != nil {
+		return fmt.Errorf("error unmarshaling sessionState: %s", err.Error())
+	}
+	return nil
+}
+
+func (rs *RedisStore) GetSessionId(ctx context.Context, sessionUuid uuid.UUID) (SessionID, error) {
+	var res string
+	err := do(ctx, func() (err error) {
+		res, err = rs.Client.WithContext(ctx).Get(getRedisUuidKey(sessionUuid)).Result()
+		return err
+	})
+	if err != nil {
 		return InvalidSessionID, ErrUnexpected
 	}
-	return SessionID(res.Val()), nil
+	return SessionID(res), nil
 }
 
 // Exists determines if the session id is in the session store.
-func (rs *RedisStore) Exists(sid SessionID) (bool, error) {
-
-	res := rs.Client.Exists(getRedisKey(sid))
-
-	if res.Err() != nil {
-		return false, res.Err()
+func (rs *RedisStore) Exists(ctx context.Context, sid SessionID) (bool, error) {
+	var exRes int64
+	err := do(ctx, func() (err error) {
+		exRes, err = rs.Client.WithContext(ctx).Exists(getRedisKey(sid)).Result()
+		return err
+	})
+	if err != nil {
+		return false, err
 	}
-	exRes := res.Val()
 	return exRes == 1, nil
 }
 
-// Delete deletes all state data associated with the SessionID from the store.
-func (rs *RedisStore) Delete(sid SessionID) error {
-	err := rs.Client.Del(getRedisKey(sid)).Err()
+// Delete deletes all state data associated with the SessionID from the store,
+// and removes the session from the sessions of the user it belongs to.
+func (rs *RedisStore) Delete(ctx context.Context, sid SessionID) error {
+	client := rs.Client.WithContext(ctx)
+	err := do(ctx, func() error {
+		owner, err := client.Get(getRedisOwnerKey(sid)).Result()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		pipe := client.TxPipeline()
+		pipe.Del(getRedisKey(sid), getRedisOwnerKey(sid))
+		if err == nil {
+			pipe.SRem(getRedisUserKey(owner), sid.String())
+		}
+		_, err = pipe.Exec()
+		return err
+	})
 	if err != nil {
 		return fmt.Errorf("error deleting the session <%s>:\n%s", sid, err.Error())
 	}
 	return nil
 }
 
+// Count returns the number of sessions in the store which have not expired.
+func (rs *RedisStore) Count(ctx context.Context) (int, error) {
+	count := 0
+	err := rs.scanSessions(ctx, func(keys []string) {
+		count += len(keys)
+	})
+	return count, err
+}
+
+// SessionIds returns the id of every session in the store which has not expired.
+// Every session is scanned, so it is meant for occasional administrative use, not for serving requests.
+func (rs *RedisStore) SessionIds(ctx context.Context) ([]SessionID, error) {
+	var sids []SessionID
+	err := rs.scanSessions(ctx, func(keys []string) {
+		for _, key := range keys {
+			sids = append(sids, SessionID(strings.TrimPrefix(key, getRedisKey(""))))
+		}
+	})
+	return sids, err
+}
+
+// UserSessionIds returns the id of every session of the user which has not expired, removing the sessions of the
+// user which expired.
+func (rs *RedisStore) UserSessionIds(ctx context.Context, userUuid uuid.UUID) ([]SessionID, error) {
+	client := rs.Client.WithContext(ctx)
+	key := getRedisUserKey(userUuid.String())
+	var sids []SessionID
+	err := do(ctx, func() error {
+		members, err := client.SMembers(key).Result()
+		if err != nil || len(members) == 0 {
+			return err
+		}
+		pipe := client.Pipeline()
+		exists := make([]*redis.IntCmd, len(members))
+		for i, member := range members {
+			exists[i] = pipe.Exists(getRedisKey(SessionID(member)))
+		}
+		if _, err = pipe.Exec(); err != nil {
+			return err
+		}
+		live := make([]SessionID, 0, len(members))
+		expired := make([]interface{}, 0)
+		for i, member := range members {
+			if exists[i].Val() == 1 {
+				live = append(live, SessionID(member))
+			} else {
+				expired = append(expired, member)
+			}
+		}
+		if len(expired) != 0 {
+			if err = client.SRem(key, expired...).Err(); err != nil {
+				return err
+			}
+		}
+		sids = live
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading the sessions of the user <%s>:\n%s", userUuid, err.Error())
+	}
+	return sids, nil
+}
+
+// scanSessions calls fn with each batch of session keys in the store.
+func (rs *RedisStore) scanSessions(ctx context.Context, fn func(keys []string)) error {
+	client := rs.Client.WithContext(ctx)
+	var cursor uint64
+	for {
+		var keys []string
+		var next uint64
+		err := do(ctx, func() (err error) {
+			keys, next, err = client.Scan(cursor, getRedisKey("*"), 1000).Result()
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("error scanning sessions:\n%s", err.Error())
+		}
+		fn(keys)
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// do runs cmd, returning the error of ctx if ctx is done before cmd completes.
+// The redis client does not stop a command when its context is done, so cmd is left to complete in the background,
+// and must not write to anything read after do returns early.
+func do(ctx context.Context, cmd func() error) error {
+	if ctx.Done() == nil {
+		return cmd()
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 // getRedisKey() returns the redis key to use for the SessionID.
 func getRedisKey(sid SessionID) string {
 	// convert the SessionID to a string and add the prefix "sid:" to keep
@@ -109,6 +297,16 @@ func getRedisKey(sid SessionID) string {
 	return "sid:" + sid.String()
 }
 
+// getRedisUserKey() returns the redis key of the set of the SessionID of each session of the user.
+func getRedisUserKey(userUuid string) string {
+	return "suser:" + userUuid
+}
+
+// getRedisOwnerKey() returns the redis key of the uuid of the user the session belongs to.
+func getRedisOwnerKey(sid SessionID) string {
+	return "sowner:" + sid.String()
+}
+
 // getRedisUuidKey() returns the redis key to use for the SessionID.
 func getRedisUuidKey(suuid uuid.UUID) string {
 	// convert the SessionID to a string and add the prefix "sid:" to keep
@@ -3,6 +3,7 @@
 package session
 
 import (
+	"context"
 	"encoding/json"
 	"reflect"
 	"testing"
@@ -11,10 +12,32 @@ import (
 	"os"
 
 	"github.com/go-redis/redis"
+	uuid "github.com/satori/go.uuid"
 )
 
 // TODO: Update with env var for redis service
 
+// newTestRedisClient returns a client of the redis at REDISADDR, or the local instance on its default port.
+func newTestRedisClient() *redis.Client {
+	redisaddr := os.Getenv("REDISADDR")
+	if len(redisaddr) == 0 {
+		redisaddr = "127.0.0.1:6379"
+	}
+	return redis.NewClient(&redis.Options{
+		Addr: redisaddr,
+	})
+}
+
+// ownedState is a session state which belongs to the user Owner, if set.
+type ownedState struct {
+	Owner uuid.UUID
+}
+
+// SessionOwner returns Owner, if set.
+func (st *ownedState) SessionOwner() (uuid.UUID, bool) {
+	return st.Owner, !uuid.Equal(st.Owner, uuid.Nil)
+}
+
 /*
 TestRedisStore tests the RedisStore object
 Because the redis.Client is a struct and not an interface, this is really more of an integration than a unit test.
@@ -40,32 +63,25 @@ func TestRedisStore(t *testing.T) {
 		t.Fatalf("error generating new SessionID: %v", err)
 	}
 
-	redisaddr := os.Getenv("REDISADDR")
-	if len(redisaddr) == 0 {
-		redisaddr = "127.0.0.1:6379"
-	}
-
-	client := redis.NewClient(&redis.Options{
-		Addr: redisaddr,
-	})
-
-	store := NewRedisStore(client, time.Hour)
+	store := NewRedisStore(newTestRedisClient(), time.Hour)
+	ctx := context.Background()
+	suuid := uuid.NewV4()
 
-	if err := store.Get(sid, stateRet); err != ErrStateNotFound {
+	if err := store.Get(ctx, sid, stateRet); err != ErrStateNotFound {
 		t.Errorf("incorrect error when getting state that was never stored: expected %v but got %v", ErrStateNotFound, err)
 	}
 
-	if err := store.Save(sid, &state); err != nil {
+	if err := store.Save(ctx, sid, suuid, &state); err != nil {
 		t.Fatalf("error saving state: %v", err)
 	}
 
 	//verify that trying to save an unmarshalable session state
 	//generates an error (function values can't be encoded in JSON)
-	if err := store.Save(sid, func() {}); err == nil {
+	if err := store.Save(ctx, sid, suuid, func() {}); err == nil {
 		t.Error("expected erorr when attempting to save an unmarshalable session state")
 	}
 
-	if err := store.Get(sid, &stateRet); err != nil {
+	if err := store.Get(ctx, sid, &stateRet); err != nil {
 		t.Fatalf("error getting state: %v", err)
 	}
 	if !reflect.DeepEqual(state, stateRet) {
@@ -74,11 +90,75 @@ func TestRedisStore(t *testing.T) {
 		t.Errorf("incorrect state retrieved:\nEXPECTED\n%s\nACTUAL\n%s", string(jexp), string(jact))
 	}
 
-	if err := store.Delete(sid); err != nil {
+	if err := store.Delete(ctx, sid); err != nil {
 		t.Errorf("error deleting state: %v", err)
 	}
 
-	if err := store.Get(sid, &stateRet); err != ErrStateNotFound {
+	if err := store.Get(ctx, sid, &stateRet); err != ErrStateNotFound {
 		t.Fatalf("incorrect error when getting state that was deleted: expected %v but got %v", ErrStateNotFound, err)
 	}
 }
+
+func TestRedisStore_UserSessionIds(t *testing.T) {
+	ctx := context.Background()
+	client := newTestRedisClient()
+	store := NewRedisStore(client, time.Hour)
+	userUuid := uuid.NewV4()
+	save := func(owner uuid.UUID) SessionID {
+		sid, errNSI := NewSessionID("test key")
+		if errNSI != nil {
+			t.Fatalf("unexpected error setting up test: %s", errNSI)
+		}
+		if errS := store.Save(ctx, sid, uuid.NewV4(), &ownedState{Owner: owner}); errS != nil {
+			t.Fatalf("unexpected error setting up test: %s", errS)
+		}
+		return sid
+	}
+	first := save(userUuid)
+	second := save(userUuid)
+	expired := save(userUuid)
+	save(uuid.NewV4())
+	save(uuid.Nil)
+	// The session expiring is simulated by deleting its state
+	if errD := client.Del(getRedisKey(expired)).Err(); errD != nil {
+		t.Fatalf("unexpected error setting up test: %s", errD)
+	}
+
+	sids, errUSI := store.UserSessionIds(ctx, userUuid)
+	if errUSI != nil || len(sids) != 2 || !containsSessionId(sids, first) || !containsSessionId(sids, second) {
+		t.Errorf("case: Sessions Of User: expected %s and %s, but got %v, error: %v\n"+
+			"HINT: only the sessions which belong to the user and have not expired should be returned", first,
+			second, sids, errUSI)
+	}
+	if members := client.SMembers(getRedisUserKey(userUuid.String())).Val(); len(members) != 2 {
+		t.Errorf("case: Expired Removed: expected 2 sessions kept for the user, but got %v\n"+
+			"HINT: sessions which expired should be removed from the sessions of the user", members)
+	}
+
+	if errD := store.Delete(ctx, first); errD != nil {
+		t.Fatalf("case: Deleted: unexpected error deleting session: %s", errD)
+	}
+	if members := client.SMembers(getRedisUserKey(userUuid.String())).Val(); len(members) != 1 ||
+		members[0] != second.String() {
+		t.Errorf("case: Deleted: expected only %s kept for the user, but got %v\n"+
+			"HINT: a deleted session should be removed from the sessions of the user", second, members)
+	}
+	if exists := client.Exists(getRedisOwnerKey(first)).Val(); exists != 0 {
+		t.Errorf("case: Deleted: expected the owner of the deleted session to be deleted")
+	}
+
+	sids, errUSI = store.UserSessionIds(ctx, uuid.NewV4())
+	if errUSI != nil || len(sids) != 0 {
+		t.Errorf("case: No Sessions: expected no sessions, but got %v, error: %v", sids, errUSI)
+	}
+}
+
+// containsSessionId reports if sids contains sid.
+func containsSessionId(sids []SessionID, sid SessionID) bool {
+	for _, s := range sids {
+		if s == sid {
+			return true
+		}
+	}
+	return false
+}
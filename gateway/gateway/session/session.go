@@ -2,6 +2,7 @@
 package session
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"strings"
@@ -45,11 +46,11 @@ func CreateSession(signingKey string) (SessionID, uuid.UUID, error) {
 
 // BeginSession saves the `sessionState` to the store, adds an
 // Authorization header to the response with the SessionID, and returns the new SessionID.
-func BeginSession(sessionId SessionID, sessionUuid uuid.UUID, store Store, sessionState interface{}, w http.ResponseWriter) error {
+func BeginSession(ctx context.Context, sessionId SessionID, sessionUuid uuid.UUID, store Store, sessionState interface{}, w http.ResponseWriter) error {
 
-	errSS := store.Save(sessionId, sessionUuid, sessionState)
+	errSS := store.Save(ctx, sessionId, sessionUuid, sessionState)
 	if errSS != nil {
-		return ErrUnexpected
+		return unexpected(errSS)
 	}
 	w.Header().Add(HeaderAuthorization, AuthHeaderSchemeBearerPrefix+string(sessionId))
 	return nil
@@ -77,22 +78,22 @@ func GetSessionID(r *http.Request, signingKey string) (SessionID, error) {
 	return sesID, nil
 }
 
-func GetSessionIDByUuid(sessionUuid uuid.UUID, store Store) (SessionID, error) {
-	sesId, err := store.GetSessionId(sessionUuid)
+func GetSessionIDByUuid(ctx context.Context, sessionUuid uuid.UUID, store Store) (SessionID, error) {
+	sesId, err := store.GetSessionId(ctx, sessionUuid)
 	if err != nil {
-		return InvalidSessionID, ErrUnexpected
+		return InvalidSessionID, unexpected(err)
 	}
 	return sesId, nil
 }
 
 // GetState extracts the SessionID from the request, gets the associated state from the provided store into
-// the `sessionState` parameter, and returns the SessionID.
+// the `sessionState` parameter, and returns the SessionID. The state is read as part of the context of the request.
 func GetState(r *http.Request, signingKey string, store Store, sessionState interface{}) (SessionID, error) {
 	sesID, errGSID := GetSessionID(r, signingKey)
 	if errGSID != nil {
 		return InvalidSessionID, errGSID
 	}
-	errSG := store.Get(sesID, sessionState)
+	errSG := store.Get(r.Context(), sesID, sessionState)
 	if errSG != nil {
 		return sesID, errSG
 	}
@@ -101,10 +102,19 @@ func GetState(r *http.Request, signingKey string, store Store, sessionState inte
 
 // EndSession extracts the SessionID from the request, and deletes the associated data in the provided store,
 // returning the extracted SessionID.
-func EndSession(sessionId SessionID, store Store) error {
-	errSD := store.Delete(sessionId)
+func EndSession(ctx context.Context, sessionId SessionID, store Store) error {
+	errSD := store.Delete(ctx, sessionId)
 	if errSD != nil {
 		return errSD
 	}
 	return nil
 }
+
+// unexpected returns ErrUnexpected in place of err, unless the call did not complete because its context was done,
+// so the caller can still tell a timeout or cancellation apart.
+func unexpected(err error) error {
+	if err == ErrTimeout || err == ErrCanceled {
+		return err
+	}
+	return ErrUnexpected
+}
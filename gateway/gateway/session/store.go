@@ -1,6 +1,7 @@
 package session
 
 import (
+	"context"
 	"errors"
 
 	uuid "github.com/satori/go.uuid"
@@ -9,23 +10,60 @@ import (
 // ErrStateNotFound is returned from Store.Get() when the requested session id was not found in the store.
 var ErrStateNotFound = errors.New("no session state was found in the session store")
 
+// ErrTimeout is returned when the deadline of a call passed before the operation completed.
+var ErrTimeout = errors.New("session store: operation timed out")
+
+// ErrCanceled is returned when the context of a call was canceled before the operation completed,
+// such as when the client of the request closed the connection.
+var ErrCanceled = errors.New("session store: operation canceled")
+
 // Store represents a session data store.
 // This is an abstract interface that can be implemented against several different types of data stores.
+//
+// Every operation takes the context of the request it is made for, and should stop when the context is done.
 type Store interface {
 	// Save saves the provided `sessionState` and associated SessionID to the store.
 	// The `sessionState` parameter is typically a pointer to a struct containing all the data you want to be
 	// associated with the given SessionID.
-	Save(sid SessionID, suuid uuid.UUID, sessionState interface{}) error
+	Save(ctx context.Context, sid SessionID, suuid uuid.UUID, sessionState interface{}) error
 
 	// Get populates `sessionState` with the data previously saved for the given SessionID
-	Get(sid SessionID, sessionState interface{}) error
+	Get(ctx context.Context, sid SessionID, sessionState interface{}) error
 
 	// GetSessionId retrieves the SessionId based on the Session Uuid
-	GetSessionId(suuid uuid.UUID) (SessionID, error)
+	GetSessionId(ctx context.Context, suuid uuid.UUID) (SessionID, error)
 
 	// Exists tests if the given key is set
-	Exists(sid SessionID) (bool, error)
+	Exists(ctx context.Context, sid SessionID) (bool, error)
 
 	// Delete deletes all state data associated with the SessionID from the store.
-	Delete(sid SessionID) error
+	Delete(ctx context.Context, sid SessionID) error
+}
+
+// Lister represents a Store which can list the sessions it holds. Sessions are only found by their SessionID,
+// so unless the store is a UserLister, every session must be read to find those of a user, such as to end them all
+// when the user deletes their account. Listing is meant for rare operations, not for serving each request.
+type Lister interface {
+	Store
+
+	// SessionIds returns the id of every session in the store which has not expired.
+	SessionIds(ctx context.Context) ([]SessionID, error)
+
+	// Peek populates `sessionState` like Get, but without extending the expiry of the session.
+	Peek(ctx context.Context, sid SessionID, sessionState interface{}) error
+}
+
+// Owned is implemented by session states which belong to a user, so a UserLister can find the sessions of the user.
+type Owned interface {
+	// SessionOwner returns the uuid of the user the session belongs to, or false if it belongs to no user.
+	SessionOwner() (uuid.UUID, bool)
+}
+
+// UserLister represents a Lister which keeps the sessions saved with an Owned state by the user they belong to,
+// so the sessions of a user are found without reading every session.
+type UserLister interface {
+	Lister
+
+	// UserSessionIds returns the id of every session of the user which has not expired.
+	UserSessionIds(ctx context.Context, userUuid uuid.UUID) ([]SessionID, error)
 }
@@ -0,0 +1,120 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// operations are the names of the operations of a Store, which may be given their own timeout.
+var operations = map[string]bool{"Save": true, "Get": true, "GetSessionId": true, "Exists": true, "Delete": true}
+
+// Timeouts are the time allowed for calls to a Store, by operation.
+type Timeouts struct {
+	// Default is the time allowed for an operation which is not in Operations.
+	// Zero allows a call as long as its context does.
+	Default time.Duration
+	// Operations are the time allowed for each operation, by method name, such as "Get".
+	Operations map[string]time.Duration
+}
+
+// Validate returns an error if a timeout of an operation is negative, or is given for an operation the Store
+// does not have.
+func (t Timeouts) Validate() error {
+	for operation, timeout := range t.Operations {
+		if !operations[operation] {
+			return fmt.Errorf("unknown operation %s", operation)
+		}
+		if timeout < 0 {
+			return fmt.Errorf("timeout of %s must not be negative", operation)
+		}
+	}
+	return nil
+}
+
+// For returns the time allowed for a call to operation.
+func (t Timeouts) For(operation string) time.Duration {
+	if timeout, ok := t.Operations[operation]; ok {
+		return timeout
+	}
+	return t.Default
+}
+
+// TimeoutStore represents a session.Store which gives each call to the wrapped Store a deadline,
+// and returns ErrTimeout or ErrCanceled for a call which failed because its context was done.
+type TimeoutStore struct {
+	next     Store
+	timeouts Timeouts
+}
+
+// NewTimeoutStore constructs a new TimeoutStore wrapping next, with the deadline of each call set by timeouts.
+func NewTimeoutStore(next Store, timeouts Timeouts) *TimeoutStore {
+	if next == nil {
+		panic("No store provided!")
+	}
+	return &TimeoutStore{next: next, timeouts: timeouts}
+}
+
+// Store implementation
+
+// Save saves the provided `sessionState` and associated SessionID to the wrapped store.
+func (ts *TimeoutStore) Save(ctx context.Context, sid SessionID, suuid uuid.UUID, sessionState interface{}) error {
+	ctx, cancel := ts.withTimeout(ctx, "Save")
+	defer cancel()
+	return contextError(ctx, ts.next.Save(ctx, sid, suuid, sessionState))
+}
+
+// Get populates `sessionState` with the data previously saved for the given SessionID.
+func (ts *TimeoutStore) Get(ctx context.Context, sid SessionID, sessionState interface{}) error {
+	ctx, cancel := ts.withTimeout(ctx, "Get")
+	defer cancel()
+	return contextError(ctx, ts.next.Get(ctx, sid, sessionState))
+}
+
+// GetSessionId retrieves the SessionId based on the Session Uuid.
+func (ts *TimeoutStore) GetSessionId(ctx context.Context, suuid uuid.UUID) (SessionID, error) {
+	ctx, cancel := ts.withTimeout(ctx, "GetSessionId")
+	defer cancel()
+	sid, err := ts.next.GetSessionId(ctx, suuid)
+	return sid, contextError(ctx, err)
+}
+
+// Exists tests if the given key is set.
+func (ts *TimeoutStore) Exists(ctx context.Context, sid SessionID) (bool, error) {
+	ctx, cancel := ts.withTimeout(ctx, "Exists")
+	defer cancel()
+	exists, err := ts.next.Exists(ctx, sid)
+	return exists, contextError(ctx, err)
+}
+
+// Delete deletes all state data associated with the SessionID from the wrapped store.
+func (ts *TimeoutStore) Delete(ctx context.Context, sid SessionID) error {
+	ctx, cancel := ts.withTimeout(ctx, "Delete")
+	defer cancel()
+	return contextError(ctx, ts.next.Delete(ctx, sid))
+}
+
+// withTimeout returns ctx with the deadline of a call to operation, if it has a timeout.
+func (ts *TimeoutStore) withTimeout(ctx context.Context, operation string) (context.Context, context.CancelFunc) {
+	if timeout := ts.timeouts.For(operation); timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// contextError returns ErrTimeout or ErrCanceled in place of err if the call failed because ctx is done,
+// as the error returned by the wrapped store may not say so.
+func contextError(ctx context.Context, err error) error {
+	if err == nil || err == ErrStateNotFound {
+		return err
+	}
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		return ErrTimeout
+	case context.Canceled:
+		return ErrCanceled
+	}
+	return err
+}
@@ -0,0 +1,154 @@
+// +build all unit
+
+package session
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// slowStore is a Store whose Get waits until its context is done, or delay passes, before returning err.
+type slowStore struct {
+	delay time.Duration
+	err   error
+}
+
+func (ss *slowStore) Save(ctx context.Context, sid SessionID, suuid uuid.UUID, sessionState interface{}) error {
+	return ss.err
+}
+
+func (ss *slowStore) Get(ctx context.Context, sid SessionID, sessionState interface{}) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(ss.delay):
+		return ss.err
+	}
+}
+
+func (ss *slowStore) GetSessionId(ctx context.Context, suuid uuid.UUID) (SessionID, error) {
+	return InvalidSessionID, ss.err
+}
+
+func (ss *slowStore) Exists(ctx context.Context, sid SessionID) (bool, error) {
+	return false, ss.err
+}
+
+func (ss *slowStore) Delete(ctx context.Context, sid SessionID) error {
+	return ss.err
+}
+
+func TestTimeoutStore_Get(t *testing.T) {
+	errStore := errors.New("store failed")
+	cases := []struct {
+		name     string
+		hint     string
+		store    *slowStore
+		timeouts Timeouts
+		cancel   bool
+		expected error
+	}{
+		{
+			"Completes In Time",
+			"Remember to return the result of the wrapped store when it completes before the deadline",
+			&slowStore{delay: 0},
+			Timeouts{Default: time.Second},
+			false,
+			nil,
+		},
+		{
+			"Not Found In Time",
+			"Remember that a session which is not found is an outcome, not a timeout",
+			&slowStore{delay: 0, err: ErrStateNotFound},
+			Timeouts{Default: time.Second},
+			false,
+			ErrStateNotFound,
+		},
+		{
+			"Fails In Time",
+			"Remember to return the error of the wrapped store when its context is not done",
+			&slowStore{delay: 0, err: errStore},
+			Timeouts{Default: time.Second},
+			false,
+			errStore,
+		},
+		{
+			"Default Timeout",
+			"Remember to give the call the default deadline, and return ErrTimeout when it passes",
+			&slowStore{delay: time.Second},
+			Timeouts{Default: time.Millisecond},
+			false,
+			ErrTimeout,
+		},
+		{
+			"Operation Timeout",
+			"Remember the timeout of an operation replaces the default",
+			&slowStore{delay: time.Second},
+			Timeouts{Default: time.Minute, Operations: map[string]time.Duration{"Get": time.Millisecond}},
+			false,
+			ErrTimeout,
+		},
+		{
+			"Canceled",
+			"Remember to return ErrCanceled when the context of the call is canceled",
+			&slowStore{delay: time.Second},
+			Timeouts{},
+			true,
+			ErrCanceled,
+		},
+	}
+
+	for _, c := range cases {
+		ctx, cancel := context.WithCancel(context.Background())
+		if c.cancel {
+			cancel()
+		}
+		err := NewTimeoutStore(c.store, c.timeouts).Get(ctx, InvalidSessionID, &struct{}{})
+		cancel()
+		if err != c.expected {
+			t.Errorf("case %s: expected error %v but got %v\nHINT: %s", c.name, c.expected, err, c.hint)
+		}
+	}
+}
+
+func TestTimeouts_Validate(t *testing.T) {
+	cases := []struct {
+		name        string
+		hint        string
+		timeouts    Timeouts
+		expectError bool
+	}{
+		{
+			"Valid Timeouts",
+			"Remember operations of the Store may be given a timeout",
+			Timeouts{Default: time.Second, Operations: map[string]time.Duration{"Get": time.Second, "Save": 0}},
+			false,
+		},
+		{
+			"Unknown Operation",
+			"Remember to return an error for an operation the Store does not have, such as a typo",
+			Timeouts{Operations: map[string]time.Duration{"Gte": time.Second}},
+			true,
+		},
+		{
+			"Negative Timeout",
+			"Remember to return an error for a negative timeout",
+			Timeouts{Operations: map[string]time.Duration{"Get": -time.Second}},
+			true,
+		},
+	}
+
+	for _, c := range cases {
+		err := c.timeouts.Validate()
+		if err != nil && !c.expectError {
+			t.Errorf("case %s: unexpected error: %v\nHINT: %s", c.name, err, c.hint)
+		}
+		if err == nil && c.expectError {
+			t.Errorf("case %s: expected error but didn't get one\nHINT: %s", c.name, c.hint)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package session
+
+import (
+	"context"
+
+	uuid "github.com/satori/go.uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName identifies the spans created by this package.
+const tracerName = "github.com/uw-thalesians/perceptia-servers/gateway/gateway/session"
+
+// TracedStore represents a session.Store which records a span for each call to the wrapped Store,
+// as a child of the span in the context of the call.
+type TracedStore struct {
+	next Store
+}
+
+// NewTracedStore constructs a new TracedStore wrapping next.
+func NewTracedStore(next Store) *TracedStore {
+	if next == nil {
+		panic("No store provided!")
+	}
+	return &TracedStore{next: next}
+}
+
+// Store implementation
+
+// Save saves the provided `sessionState` and associated SessionID to the wrapped store.
+func (ts *TracedStore) Save(ctx context.Context, sid SessionID, suuid uuid.UUID, sessionState interface{}) (err error) {
+	ctx, span := ts.start(ctx, "Save")
+	defer end(span, &err)
+	return ts.next.Save(ctx, sid, suuid, sessionState)
+}
+
+// Get populates `sessionState` with the data previously saved for the given SessionID.
+func (ts *TracedStore) Get(ctx context.Context, sid SessionID, sessionState interface{}) (err error) {
+	ctx, span := ts.start(ctx, "Get")
+	defer func() {
+		if err == ErrStateNotFound {
+			span.End()
+			return
+		}
+		end(span, &err)
+	}()
+	return ts.next.Get(ctx, sid, sessionState)
+}
+
+// GetSessionId retrieves the SessionId based on the Session Uuid.
+func (ts *TracedStore) GetSessionId(ctx context.Context, suuid uuid.UUID) (sid SessionID, err error) {
+	ctx, span := ts.start(ctx, "GetSessionId")
+	defer end(span, &err)
+	return ts.next.GetSessionId(ctx, suuid)
+}
+
+// Exists tests if the given key is set.
+func (ts *TracedStore) Exists(ctx context.Context, sid SessionID) (exists bool, err error) {
+	ctx, span := ts.start(ctx, "Exists")
+	defer end(span, &err)
+	return ts.next.Exists(ctx, sid)
+}
+
+// Delete deletes all state data associated with the SessionID from the wrapped store.
+func (ts *TracedStore) Delete(ctx context.Context, sid SessionID) (err error) {
+	ctx, span := ts.start(ctx, "Delete")
+	defer end(span, &err)
+	return ts.next.Delete(ctx, sid)
+}
+
+// start begins a span for a call to method, returning it and the context to make the call with, so work done
+// by the call is part of the span.
+func (ts *TracedStore) start(ctx context.Context, method string) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, "session.Store/"+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemRedis, semconv.DBOperation(method)))
+}
+
+// end records err on the span, if there was one, and ends it.
+func end(span trace.Span, err *error) {
+	if *err != nil {
+		span.RecordError(*err)
+		span.SetStatus(codes.Error, (*err).Error())
+	}
+	span.End()
+}
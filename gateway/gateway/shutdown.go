@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	kitlog "github.com/go-kit/kit/log"
+
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/handler"
+)
+
+// Timeouts applied to every connection of the gateway servers.
+const (
+	serverReadHeaderTimeout = time.Second * 10
+	serverIdleTimeout       = time.Minute * 2
+)
+
+// drainServers stops the servers accepting connections, and waits for in-flight requests and proxied streams
+// to complete until ctx is done. Anything still open once ctx is done is closed.
+func drainServers(ctx context.Context, logger kitlog.Logger, hcx *handler.Context, servers ...*http.Server) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if errCS := hcx.CloseStreams(ctx); errCS != nil {
+			_ = logger.Log("msg", "streams did not close before the shutdown timeout", "error", errCS)
+		}
+	}()
+	for _, server := range servers {
+		wg.Add(1)
+		go func(server *http.Server) {
+			defer wg.Done()
+			if errSD := server.Shutdown(ctx); errSD != nil {
+				_ = logger.Log("msg", "requests did not complete before the shutdown timeout", "addr", server.Addr,
+					"error", errSD)
+				_ = server.Close()
+			}
+		}(server)
+	}
+	wg.Wait()
+}
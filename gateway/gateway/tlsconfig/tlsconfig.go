@@ -0,0 +1,201 @@
+// Package tlsconfig builds the tls.Config used by the gateway, serving certificates which are
+// reloaded from disk when they change, so renewing a certificate does not require a restart.
+package tlsconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	kitlog "github.com/go-kit/kit/log"
+)
+
+// DefaultReloadInterval is the default time between checks for changed certificate files.
+const DefaultReloadInterval = time.Second * 30
+
+var (
+	ErrNoCertificates     = errors.New("tlsconfig: at least one certificate must be provided")
+	ErrUnknownVersion     = errors.New("tlsconfig: minimum version must be one of 1.0, 1.1, 1.2, or 1.3")
+	ErrUnknownCipherSuite = errors.New("tlsconfig: unknown or insecure cipher suite")
+)
+
+// KeyPair identifies the files holding a PEM encoded certificate chain and its private key.
+type KeyPair struct {
+	CertPath string
+	KeyPath  string
+}
+
+// fileState identifies a version of a file, so changes to it can be detected.
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// loaded is a set of certificates, and the state of the files they were loaded from.
+type loaded struct {
+	certs []tls.Certificate
+	files map[string]fileState
+}
+
+// Reloader serves certificates loaded from KeyPairs, reloading them when their files change.
+// Every certificate is swapped at once, so a handshake never sees a certificate without its key.
+type Reloader struct {
+	pairs   []KeyPair
+	current atomic.Value
+	logger  kitlog.Logger
+}
+
+// NewReloader loads the certificate of each pair, returning an error if any can not be loaded.
+// The first pair is served to clients which do not send a server name, or whose server name
+// does not match any certificate.
+func NewReloader(pairs []KeyPair, logger kitlog.Logger) (*Reloader, error) {
+	if len(pairs) == 0 {
+		return nil, ErrNoCertificates
+	}
+	rl := &Reloader{pairs: pairs, logger: logger}
+	l, errL := rl.load()
+	if errL != nil {
+		return nil, errL
+	}
+	rl.current.Store(l)
+	return rl, nil
+}
+
+// load reads every certificate from disk.
+func (rl *Reloader) load() (*loaded, error) {
+	l := &loaded{files: make(map[string]fileState)}
+	for _, pair := range rl.pairs {
+		// The state is read before the file, so a change made while loading is seen by the next check.
+		for _, path := range []string{pair.CertPath, pair.KeyPath} {
+			state, errS := stat(path)
+			if errS != nil {
+				return nil, errS
+			}
+			l.files[path] = state
+		}
+		cert, errLKP := tls.LoadX509KeyPair(pair.CertPath, pair.KeyPath)
+		if errLKP != nil {
+			return nil, fmt.Errorf("tlsconfig: unable to load %s: %v", pair.CertPath, errLKP)
+		}
+		l.certs = append(l.certs, cert)
+	}
+	return l, nil
+}
+
+func stat(path string) (fileState, error) {
+	info, errS := os.Stat(path)
+	if errS != nil {
+		return fileState{}, errS
+	}
+	return fileState{modTime: info.ModTime(), size: info.Size()}, nil
+}
+
+// changed reports if any certificate file differs from when it was loaded.
+func (rl *Reloader) changed() bool {
+	l := rl.current.Load().(*loaded)
+	for path, state := range l.files {
+		if now, errS := stat(path); errS != nil || now != state {
+			return true
+		}
+	}
+	return false
+}
+
+// Reload loads the certificates again if any of their files have changed.
+// If they can not be loaded, such as when a file is only partly written, the current certificates
+// are kept and the error returned, so the reload is tried again on the next call.
+func (rl *Reloader) Reload() error {
+	if !rl.changed() {
+		return nil
+	}
+	l, errL := rl.load()
+	if errL != nil {
+		return errL
+	}
+	rl.current.Store(l)
+	_ = rl.logger.Log("msg", "tls certificates reloaded", "certificates", len(l.certs))
+	return nil
+}
+
+// Watch calls Reload every interval until ctx is done, logging any failure.
+func (rl *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if errR := rl.Reload(); errR != nil {
+			_ = rl.logger.Log("msg", "unable to reload tls certificates, keeping current certificates",
+				"error", errR)
+		}
+	}
+}
+
+// GetCertificate returns the first certificate which is valid for the server name requested by the client,
+// or the first certificate if none are. Used as tls.Config.GetCertificate.
+func (rl *Reloader) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	certs := rl.current.Load().(*loaded).certs
+	if len(hello.ServerName) != 0 {
+		for i := range certs {
+			if hello.SupportsCertificate(&certs[i]) == nil {
+				return &certs[i], nil
+			}
+		}
+	}
+	return &certs[0], nil
+}
+
+// ParseVersion converts a TLS version, such as "1.2", to its tls package constant.
+func ParseVersion(version string) (uint16, error) {
+	switch strings.TrimSpace(version) {
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, ErrUnknownVersion
+}
+
+// ParseCipherSuites converts the names of cipher suites, such as "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+// to their ids. Only suites the tls package considers secure are accepted.
+// Cipher suites only apply to TLS 1.2 and earlier, TLS 1.3 suites are not configurable.
+func ParseCipherSuites(names []string) ([]uint16, error) {
+	secure := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		secure[suite.Name] = suite.ID
+	}
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := secure[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownCipherSuite, name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// New creates a tls.Config which serves the certificates of the reloader, allowing only the given
+// minimum version and cipher suites. If cipherSuites is empty, the tls package defaults are used.
+func New(rl *Reloader, minVersion uint16, cipherSuites []uint16) *tls.Config {
+	cfg := &tls.Config{
+		GetCertificate: rl.GetCertificate,
+		MinVersion:     minVersion,
+	}
+	if len(cipherSuites) != 0 {
+		cfg.CipherSuites = cipherSuites
+	}
+	return cfg
+}
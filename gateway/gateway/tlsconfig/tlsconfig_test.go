@@ -0,0 +1,195 @@
+// +build all unit
+
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	kitlog "github.com/go-kit/kit/log"
+)
+
+// writeKeyPair writes a new self signed certificate for the host, and its key, to dir.
+func writeKeyPair(t *testing.T, dir, name, host string) KeyPair {
+	key, errGK := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if errGK != nil {
+		t.Fatalf("case: N/A: unexpected error generating key: %s", errGK)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, errCC := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if errCC != nil {
+		t.Fatalf("case: N/A: unexpected error creating certificate: %s", errCC)
+	}
+	keyDer, errMK := x509.MarshalECPrivateKey(key)
+	if errMK != nil {
+		t.Fatalf("case: N/A: unexpected error encoding key: %s", errMK)
+	}
+	pair := KeyPair{CertPath: filepath.Join(dir, name+".crt"), KeyPath: filepath.Join(dir, name+".key")}
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	if errW := ioutil.WriteFile(pair.CertPath, certPem, 0600); errW != nil {
+		t.Fatalf("case: N/A: unexpected error writing certificate: %s", errW)
+	}
+	if errW := ioutil.WriteFile(pair.KeyPath, keyPem, 0600); errW != nil {
+		t.Fatalf("case: N/A: unexpected error writing key: %s", errW)
+	}
+	return pair
+}
+
+func servedHost(t *testing.T, rl *Reloader, serverName string) string {
+	hello := &tls.ClientHelloInfo{ServerName: serverName, SupportedVersions: []uint16{tls.VersionTLS13},
+		SignatureSchemes: []tls.SignatureScheme{tls.ECDSAWithP256AndSHA256}}
+	cert, errGC := rl.GetCertificate(hello)
+	if errGC != nil {
+		t.Fatalf("case: N/A: unexpected error getting certificate: %s", errGC)
+	}
+	leaf, errPC := x509.ParseCertificate(cert.Certificate[0])
+	if errPC != nil {
+		t.Fatalf("case: N/A: unexpected error parsing certificate: %s", errPC)
+	}
+	return leaf.Subject.CommonName
+}
+
+func TestReloader_GetCertificate(t *testing.T) {
+	dir, errTD := ioutil.TempDir("", "tlsconfig")
+	if errTD != nil {
+		t.Fatalf("case: N/A: unexpected error in test setup: %s", errTD)
+	}
+	defer os.RemoveAll(dir)
+	rl, errNR := NewReloader([]KeyPair{
+		writeKeyPair(t, dir, "default", "localhost"),
+		writeKeyPair(t, dir, "other", "other.example.com"),
+	}, kitlog.NewNopLogger())
+	if errNR != nil {
+		t.Fatalf("case: N/A: unexpected error creating reloader: %s", errNR)
+	}
+
+	cases := []struct {
+		name       string
+		hint       string
+		serverName string
+		expectHost string
+	}{
+		{
+			name:       "Basic: default certificate",
+			hint:       "The first certificate is served when it matches the server name",
+			serverName: "localhost",
+			expectHost: "localhost",
+		},
+		{
+			name:       "SNI",
+			hint:       "The certificate matching the server name requested by the client should be served",
+			serverName: "other.example.com",
+			expectHost: "other.example.com",
+		},
+		{
+			name:       "Unknown server name",
+			hint:       "The first certificate is served if none match the server name",
+			serverName: "unknown.example.com",
+			expectHost: "localhost",
+		},
+		{
+			name:       "No server name",
+			hint:       "The first certificate is served to clients which do not use SNI",
+			serverName: "",
+			expectHost: "localhost",
+		},
+	}
+	for _, c := range cases {
+		if host := servedHost(t, rl, c.serverName); host != c.expectHost {
+			t.Errorf("case: %s: expected certificate for %s but got %s\nHINT: %s", c.name, c.expectHost, host, c.hint)
+		}
+	}
+}
+
+func TestReloader_Reload(t *testing.T) {
+	dir, errTD := ioutil.TempDir("", "tlsconfig")
+	if errTD != nil {
+		t.Fatalf("case: N/A: unexpected error in test setup: %s", errTD)
+	}
+	defer os.RemoveAll(dir)
+	pair := writeKeyPair(t, dir, "default", "before.example.com")
+	rl, errNR := NewReloader([]KeyPair{pair}, kitlog.NewNopLogger())
+	if errNR != nil {
+		t.Fatalf("case: N/A: unexpected error creating reloader: %s", errNR)
+	}
+
+	// A renewed certificate is served once reloaded.
+	writeKeyPair(t, dir, "default", "after.example.com")
+	future := time.Now().Add(time.Minute)
+	_ = os.Chtimes(pair.CertPath, future, future)
+	if errR := rl.Reload(); errR != nil {
+		t.Fatalf("case: renewed: unexpected error reloading: %s", errR)
+	}
+	if host := servedHost(t, rl, ""); host != "after.example.com" {
+		t.Errorf("case: renewed: expected the renewed certificate but got %s\n"+
+			"HINT: changed certificate files should be reloaded", host)
+	}
+
+	// A partly written certificate is not served, the last valid certificate is kept.
+	if errW := ioutil.WriteFile(pair.CertPath, []byte("-----BEGIN CERTIFICATE-----\n"), 0600); errW != nil {
+		t.Fatalf("case: N/A: unexpected error in test setup: %s", errW)
+	}
+	if errR := rl.Reload(); errR == nil {
+		t.Errorf("case: invalid: expected an error reloading an invalid certificate")
+	}
+	if host := servedHost(t, rl, ""); host != "after.example.com" {
+		t.Errorf("case: invalid: expected the last valid certificate but got %s\n"+
+			"HINT: a certificate which fails to load should not replace the current one", host)
+	}
+}
+
+func TestParseCipherSuites(t *testing.T) {
+	cases := []struct {
+		name        string
+		hint        string
+		suites      []string
+		expectError error
+	}{
+		{
+			name:        "Basic: secure suites",
+			hint:        "Secure suites should be accepted",
+			suites:      []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256", "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384"},
+			expectError: nil,
+		},
+		{
+			name:        "Insecure suite",
+			hint:        "Suites the tls package considers insecure should be rejected",
+			suites:      []string{"TLS_RSA_WITH_RC4_128_SHA"},
+			expectError: ErrUnknownCipherSuite,
+		},
+		{
+			name:        "Unknown suite",
+			hint:        "Misspelt suites should be rejected",
+			suites:      []string{"TLS_ECDHE_RSA_WITH_AES_256"},
+			expectError: ErrUnknownCipherSuite,
+		},
+	}
+	for _, c := range cases {
+		ids, errPCS := ParseCipherSuites(c.suites)
+		if !errors.Is(errPCS, c.expectError) {
+			t.Errorf("case: %s: expected error %v but got %v\nHINT: %s", c.name, c.expectError, errPCS, c.hint)
+		}
+		if errPCS == nil && len(ids) != len(c.suites) {
+			t.Errorf("case: %s: expected %d suites but got %d", c.name, len(c.suites), len(ids))
+		}
+	}
+}
@@ -0,0 +1,104 @@
+// Package tracing configures OpenTelemetry distributed tracing for the gateway.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+)
+
+// Exporters spans can be sent to.
+const (
+	// ExporterNone records no spans, but still propagates incoming trace context to services.
+	ExporterNone = "none"
+	// ExporterOtlp sends spans to an OTLP collector over http, configured using the standard
+	// OTEL_EXPORTER_OTLP_* environment variables.
+	ExporterOtlp = "otlp"
+	// ExporterStdout writes spans as json to standard output.
+	ExporterStdout = "stdout"
+	// ExporterFile writes spans as json to the file at Config.FilePath.
+	ExporterFile = "file"
+)
+
+var (
+	ErrUnknownExporter    = errors.New("tracing: exporter must be one of none, otlp, stdout, or file")
+	ErrFilePathMissing    = errors.New("tracing: file path must be set to use the file exporter")
+	ErrInvalidSampleRatio = errors.New("tracing: sample ratio must be between 0 and 1")
+)
+
+// Config describes how spans are sampled and exported.
+type Config struct {
+	// Exporter is one of the Exporter constants.
+	Exporter string
+	// FilePath is the file spans are appended to when using ExporterFile.
+	FilePath string
+	// SampleRatio is the fraction of new traces which are recorded. Traces started by a caller
+	// follow the sampling decision of the caller.
+	SampleRatio float64
+	// ServiceName and ServiceVersion identify the gateway in exported spans.
+	ServiceName    string
+	ServiceVersion string
+}
+
+// Setup installs the global tracer provider and W3C trace context propagator described by cfg.
+// The returned shutdown function flushes any spans not yet exported, and must be called before exiting.
+func Setup(ctx context.Context, cfg Config) (shutdown func(context.Context) error, err error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{}))
+	if cfg.SampleRatio < 0 || cfg.SampleRatio > 1 {
+		return nil, ErrInvalidSampleRatio
+	}
+
+	var exporter sdktrace.SpanExporter
+	var closer io.Closer
+	switch cfg.Exporter {
+	case ExporterNone, "":
+		return func(context.Context) error { return nil }, nil
+	case ExporterOtlp:
+		exporter, err = otlptracehttp.New(ctx)
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterFile:
+		if len(cfg.FilePath) == 0 {
+			return nil, ErrFilePathMissing
+		}
+		file, errOF := os.OpenFile(cfg.FilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if errOF != nil {
+			return nil, fmt.Errorf("tracing: unable to open span file: %s", errOF)
+		}
+		closer = file
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(file))
+	default:
+		return nil, ErrUnknownExporter
+	}
+	if err != nil {
+		return nil, fmt.Errorf("tracing: unable to create %s exporter: %s", cfg.Exporter, err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL,
+			semconv.ServiceName(cfg.ServiceName), semconv.ServiceVersion(cfg.ServiceVersion))),
+	)
+	otel.SetTracerProvider(provider)
+	return func(ctx context.Context) error {
+		errS := provider.Shutdown(ctx)
+		if closer != nil {
+			if errC := closer.Close(); errS == nil {
+				errS = errC
+			}
+		}
+		return errS
+	}, nil
+}
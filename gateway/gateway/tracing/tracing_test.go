@@ -0,0 +1,95 @@
+// +build all unit
+
+package tracing
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+func TestSetup_Config(t *testing.T) {
+	cases := []struct {
+		name        string
+		hint        string
+		cfg         Config
+		expectError bool
+	}{
+		{
+			name:        "Basic: no exporter",
+			hint:        "Tracing is disabled by default, which is not an error",
+			cfg:         Config{SampleRatio: 1},
+			expectError: false,
+		},
+		{
+			name:        "Unknown exporter",
+			hint:        "Exporter must be one of none, otlp, stdout, or file",
+			cfg:         Config{Exporter: "jaeger", SampleRatio: 1},
+			expectError: true,
+		},
+		{
+			name:        "File exporter without path",
+			hint:        "The file exporter needs a file to write to",
+			cfg:         Config{Exporter: ExporterFile, SampleRatio: 1},
+			expectError: true,
+		},
+		{
+			name:        "Sample ratio out of range",
+			hint:        "Sample ratio is a fraction, so must be between 0 and 1",
+			cfg:         Config{Exporter: ExporterStdout, SampleRatio: 1.5},
+			expectError: true,
+		},
+	}
+
+	for _, c := range cases {
+		shutdown, errS := Setup(context.Background(), c.cfg)
+		if errS != nil && !c.expectError {
+			t.Errorf("case: %s: error not expected but got %s\nHINT: %s", c.name, errS, c.hint)
+		} else if errS == nil && c.expectError {
+			t.Errorf("case: %s: expected error but got nil\nHINT: %s", c.name, c.hint)
+		}
+		if errS == nil {
+			_ = shutdown(context.Background())
+		}
+	}
+}
+
+func TestSetup_FileExporter(t *testing.T) {
+	dir, errTD := ioutil.TempDir("", "tracing")
+	if errTD != nil {
+		t.Fatalf("case: N/A: unexpected error in test setup: %s", errTD)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "spans.json")
+
+	shutdown, errS := Setup(context.Background(), Config{Exporter: ExporterFile, FilePath: path,
+		SampleRatio: 1, ServiceName: "gateway", ServiceVersion: "1.0.0"})
+	if errS != nil {
+		t.Fatalf("case: file exporter: unexpected error: %s", errS)
+	}
+
+	// A span continuing the trace of a caller should be written with the trace id of the caller.
+	traceId := "4bf92f3577b34da6a3ce929d0e0e4736"
+	carrier := propagation.MapCarrier{"traceparent": "00-" + traceId + "-00f067aa0ba902b7-01"}
+	ctx := otel.GetTextMapPropagator().Extract(context.Background(), carrier)
+	_, span := otel.Tracer("test").Start(ctx, "test span")
+	span.End()
+
+	if errSD := shutdown(context.Background()); errSD != nil {
+		t.Fatalf("case: file exporter: unexpected error on shutdown: %s", errSD)
+	}
+	spans, errRF := ioutil.ReadFile(path)
+	if errRF != nil {
+		t.Fatalf("case: file exporter: unable to read span file: %s", errRF)
+	}
+	if !strings.Contains(string(spans), "test span") || !strings.Contains(string(spans), traceId) {
+		t.Errorf("case: file exporter: expected span continuing trace %s to be written, got %s\n"+
+			"HINT: spans should be flushed to the file on shutdown", traceId, spans)
+	}
+}
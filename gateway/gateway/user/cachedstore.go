@@ -0,0 +1,259 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+	uuid "github.com/satori/go.uuid"
+)
+
+// InvalidationChannel is the redis channel the uuid of each user changed through a CachedStore is published to.
+const InvalidationChannel = "user:invalidations"
+
+// CachedStore represents a user.Store which caches the information and uuid of users read from the wrapped Store
+// in redis, so each is only read from the database once in ttl.
+//
+// Cached users are deleted by every update or delete, and the uuid of the user is published to
+// InvalidationChannel, so gateways sharing the redis server can read copies of the user they keep again, such as
+// in session state. The cache is only an optimization, so if redis fails the wrapped Store is used instead.
+// A user read before an update may be cached after it, in which case it is replaced once ttl passes.
+type CachedStore struct {
+	next   Store
+	client *redis.Client
+	ttl    time.Duration
+}
+
+// NewCachedStore constructs a new CachedStore wrapping next, caching users in client for ttl.
+func NewCachedStore(next Store, client *redis.Client, ttl time.Duration) *CachedStore {
+	if next == nil || client == nil {
+		panic("no store or client provided")
+	}
+	return &CachedStore{next: next, client: client, ttl: ttl}
+}
+
+// CreateUser will add the new user to the wrapped store.
+func (cs *CachedStore) CreateUser(ctx context.Context, newUser *NewUser) (*User, error) {
+	return cs.next.CreateUser(ctx, newUser)
+}
+
+// CreateUserRole grants the role to the given user in the wrapped store. Roles are not cached.
+func (cs *CachedStore) CreateUserRole(ctx context.Context, userUuid uuid.UUID, role string) error {
+	return cs.next.CreateUserRole(ctx, userUuid, role)
+}
+
+// ReadUserEncodedHash gets the encoded hash of the users password from the wrapped store, it is never cached.
+func (cs *CachedStore) ReadUserEncodedHash(ctx context.Context, username string) (string, error) {
+	return cs.next.ReadUserEncodedHash(ctx, username)
+}
+
+// ReadUserInfo gets the basic information about the user, from the cache if it was read in the last ttl.
+func (cs *CachedStore) ReadUserInfo(ctx context.Context, userUuid uuid.UUID) (*User, error) {
+	client := cs.client.WithContext(ctx)
+	var cached []byte
+	errG := do(ctx, func() (err error) {
+		cached, err = client.Get(infoKey(userUuid)).Bytes()
+		return err
+	})
+	if errG == nil {
+		user := &User{}
+		if errU := json.Unmarshal(cached, user); errU == nil {
+			return user, nil
+		}
+	}
+	user, err := cs.next.ReadUserInfo(ctx, userUuid)
+	if err != nil {
+		return user, err
+	}
+	if encoded, errM := json.Marshal(user); errM == nil {
+		_ = do(ctx, func() error {
+			return client.Set(infoKey(userUuid), encoded, cs.ttl).Err()
+		})
+	}
+	return user, nil
+}
+
+// ReadUserPersonalData gets the personal data held about the user from the wrapped store, it is never cached.
+func (cs *CachedStore) ReadUserPersonalData(ctx context.Context, userUuid uuid.UUID) (*PersonalData, error) {
+	return cs.next.ReadUserPersonalData(ctx, userUuid)
+}
+
+// ReadUserRoles gets the roles granted to the user from the wrapped store. Roles are not cached, so a role
+// is never granted for longer than it is in the database.
+func (cs *CachedStore) ReadUserRoles(ctx context.Context, userUuid uuid.UUID) ([]string, error) {
+	return cs.next.ReadUserRoles(ctx, userUuid)
+}
+
+// ReadUserUuid gets the uuid for the user based on the given username, from the cache if it was read in the
+// last ttl.
+func (cs *CachedStore) ReadUserUuid(ctx context.Context, username string) (*uuid.UUID, error) {
+	client := cs.client.WithContext(ctx)
+	var cached string
+	errG := do(ctx, func() (err error) {
+		cached, err = client.Get(uuidKey(username)).Result()
+		return err
+	})
+	if errG == nil {
+		if userUuid, errFS := uuid.FromString(cached); errFS == nil {
+			return &userUuid, nil
+		}
+	}
+	userUuid, err := cs.next.ReadUserUuid(ctx, username)
+	if err != nil {
+		return userUuid, err
+	}
+	_ = do(ctx, func() error {
+		return client.Set(uuidKey(username), userUuid.String(), cs.ttl).Err()
+	})
+	return userUuid, nil
+}
+
+// ReadUsersDeletionRequested gets the uuids of the users who requested their account be deleted from the
+// wrapped store. Deletions are not cached, so a user is never purged once their deletion was canceled.
+func (cs *CachedStore) ReadUsersDeletionRequested(ctx context.Context, requestedBefore time.Time,
+	limit int) ([]uuid.UUID, error) {
+	return cs.next.ReadUsersDeletionRequested(ctx, requestedBefore, limit)
+}
+
+// UpdateUserDeletionRequested sets the time the user requested their account be deleted in the wrapped store.
+// The cached user does not hold the time, so is kept.
+func (cs *CachedStore) UpdateUserDeletionRequested(ctx context.Context, userUuid uuid.UUID,
+	requested time.Time) error {
+	return cs.next.UpdateUserDeletionRequested(ctx, userUuid, requested)
+}
+
+// UpdateUserEncodedHash updates the encoded hash associated with the user in the wrapped store,
+// and invalidates the user.
+func (cs *CachedStore) UpdateUserEncodedHash(ctx context.Context, userUuid uuid.UUID, encodedHash string) error {
+	err := cs.next.UpdateUserEncodedHash(ctx, userUuid, encodedHash)
+	if err == nil {
+		cs.invalidate(ctx, userUuid, "")
+	}
+	return err
+}
+
+// DeleteUser removes the user from the wrapped store, and invalidates the user.
+func (cs *CachedStore) DeleteUser(ctx context.Context, userUuid uuid.UUID) error {
+	// The username is needed to delete the cached uuid of the user, and can't be read once the user is deleted
+	username := ""
+	if user, errRUI := cs.next.ReadUserInfo(ctx, userUuid); errRUI == nil {
+		username = user.Username
+	}
+	err := cs.next.DeleteUser(ctx, userUuid)
+	if err == nil {
+		cs.invalidate(ctx, userUuid, username)
+	}
+	return err
+}
+
+// DeleteUserDeletionRequested cancels the deletion the user requested in the wrapped store.
+// The cached user does not hold the time deletion was requested, so is kept.
+func (cs *CachedStore) DeleteUserDeletionRequested(ctx context.Context, userUuid uuid.UUID,
+	requestedAfter time.Time) (bool, error) {
+	return cs.next.DeleteUserDeletionRequested(ctx, userUuid, requestedAfter)
+}
+
+// Subscribe calls fn with the uuid of each user invalidated by a CachedStore sharing the redis server,
+// including this one, until ctx is done. Returns an error if the subscription can not be made.
+func (cs *CachedStore) Subscribe(ctx context.Context, fn func(userUuid uuid.UUID)) error {
+	pubSub := cs.client.Subscribe(InvalidationChannel)
+	defer pubSub.Close()
+	// Wait for the subscription to be confirmed, so no invalidation published after Subscribe returns is missed
+	if _, errR := pubSub.Receive(); errR != nil {
+		return errR
+	}
+	messages := pubSub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case message, ok := <-messages:
+			if !ok {
+				return nil
+			}
+			if userUuid, errFS := uuid.FromString(message.Payload); errFS == nil {
+				fn(userUuid)
+			}
+		}
+	}
+}
+
+// invalidate deletes the cached information of the user, and their cached uuid if username is not empty,
+// and publishes the uuid of the user to InvalidationChannel.
+// If ctx is done first, the invalidation is left to complete in the background.
+func (cs *CachedStore) invalidate(ctx context.Context, userUuid uuid.UUID, username string) {
+	keys := []string{infoKey(userUuid)}
+	if len(username) != 0 {
+		keys = append(keys, uuidKey(username))
+	}
+	client := cs.client.WithContext(ctx)
+	_ = do(ctx, func() error {
+		_ = client.Del(keys...).Err()
+		return client.Publish(InvalidationChannel, userUuid.String()).Err()
+	})
+}
+
+// do runs cmd, returning the error of ctx if ctx is done before cmd completes, so a redis server which does not
+// respond only delays a call for as long as its context allows.
+// The redis client does not stop a command when its context is done, so cmd is left to complete in the background,
+// and must not write to anything read after do returns early.
+func do(ctx context.Context, cmd func() error) error {
+	if ctx.Done() == nil {
+		return cmd()
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// infoKey returns the redis key the information of the user is cached at.
+func infoKey(userUuid uuid.UUID) string {
+	return "user:info:" + userUuid.String()
+}
+
+// uuidKey returns the redis key the uuid of the user with the username is cached at.
+// Usernames are found ignoring case, so the key is the same for any case of the username.
+func uuidKey(username string) string {
+	return "user:uuid:" + strings.ToLower(username)
+}
+
+// Invalidations records when each user was last invalidated, such as by the Subscribe method of a CachedStore,
+// so copies of a user kept elsewhere, such as in session state, can be read again once the user changes.
+//
+// A user is recorded for as long as the process runs, as a copy may be kept for as long as a session lasts.
+// Users are rarely changed, so few are recorded.
+type Invalidations struct {
+	mx          sync.RWMutex
+	invalidated map[uuid.UUID]time.Time
+}
+
+// NewInvalidations constructs a new Invalidations, with no user invalidated.
+func NewInvalidations() *Invalidations {
+	return &Invalidations{invalidated: make(map[uuid.UUID]time.Time)}
+}
+
+// Invalidate records that the user was changed now.
+func (in *Invalidations) Invalidate(userUuid uuid.UUID) {
+	in.mx.Lock()
+	defer in.mx.Unlock()
+	in.invalidated[userUuid] = time.Now()
+}
+
+// InvalidatedSince returns true if the user was invalidated after the given time, so a copy of the user read
+// at that time may be out of date.
+func (in *Invalidations) InvalidatedSince(userUuid uuid.UUID, read time.Time) bool {
+	in.mx.RLock()
+	defer in.mx.RUnlock()
+	invalidated, ok := in.invalidated[userUuid]
+	return ok && invalidated.After(read)
+}
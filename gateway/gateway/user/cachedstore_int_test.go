@@ -0,0 +1,71 @@
+// +build all integration
+
+package user
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis"
+	uuid "github.com/satori/go.uuid"
+)
+
+// TestCachedStore runs the basic CRUD cycle through a CachedStore wrapping a MemStore, and checks that users
+// deleted through it are no longer read from the cache, and are published as invalidated.
+//
+// By default, the test will try to use a local instance of redis running on its default port (6379). If you want to
+// use a different address, set the REDISADDR environment variable.
+func TestCachedStore(t *testing.T) {
+	redisaddr := os.Getenv("REDISADDR")
+	if len(redisaddr) == 0 {
+		redisaddr = "127.0.0.1:6379"
+	}
+	client := redis.NewClient(&redis.Options{Addr: redisaddr})
+	defer client.Close()
+	cachedStore := NewCachedStore(NewMemStore(), client, time.Minute)
+
+	t.Run("TestCachedStore_BasicCRUD", testStoreBasicCRUD(cachedStore))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	invalidated := make(chan uuid.UUID, 1)
+	subscribed := make(chan error, 1)
+	go func() {
+		subscribed <- cachedStore.Subscribe(ctx, func(userUuid uuid.UUID) { invalidated <- userUuid })
+	}()
+	// Allow the subscription to be made before anything is published
+	time.Sleep(time.Millisecond * 100)
+
+	usr, errCU := cachedStore.CreateUser(ctx, &NewUser{Username: "cached" + uuid.NewV4().String()[:8],
+		FullName: "Cached User", DisplayName: "Cached", EncodedHash: "hash"})
+	if errCU != nil {
+		t.Fatalf("unexpected error creating user: %s", errCU)
+	}
+	if _, errRUI := cachedStore.ReadUserInfo(ctx, usr.Uuid); errRUI != nil {
+		t.Fatalf("unexpected error reading user: %s", errRUI)
+	}
+	if _, errRUU := cachedStore.ReadUserUuid(ctx, usr.Username); errRUU != nil {
+		t.Fatalf("unexpected error reading user uuid: %s", errRUU)
+	}
+	if errDU := cachedStore.DeleteUser(ctx, usr.Uuid); errDU != nil {
+		t.Fatalf("unexpected error deleting user: %s", errDU)
+	}
+	if _, errRUI := cachedStore.ReadUserInfo(ctx, usr.Uuid); errRUI != ErrUserNotFound {
+		t.Errorf("expected ErrUserNotFound reading a deleted user, but got: %v", errRUI)
+	}
+	if _, errRUU := cachedStore.ReadUserUuid(ctx, usr.Username); errRUU != ErrUserNotFound {
+		t.Errorf("expected ErrUserNotFound reading the uuid of a deleted user, but got: %v", errRUU)
+	}
+	select {
+	case userUuid := <-invalidated:
+		if userUuid != usr.Uuid {
+			t.Errorf("expected the deleted user %s to be invalidated, but got %s", usr.Uuid, userUuid)
+		}
+	case errS := <-subscribed:
+		t.Fatalf("unexpected error subscribing to invalidations: %v", errS)
+	case <-time.After(time.Second * 5):
+		t.Errorf("expected the deleted user to be published as invalidated")
+	}
+}
@@ -0,0 +1,144 @@
+// +build all unit
+
+package user
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis"
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestInvalidations(t *testing.T) {
+	invalidations := NewInvalidations()
+	userUuid := uuid.NewV4()
+	read := time.Now()
+	if invalidations.InvalidatedSince(userUuid, time.Time{}) {
+		t.Errorf("case: Never Invalidated: expected the user not to be invalidated\n" +
+			"HINT: a user is only invalidated once Invalidate is called")
+	}
+	invalidations.Invalidate(userUuid)
+	if !invalidations.InvalidatedSince(userUuid, read) {
+		t.Errorf("case: Invalidated After Read: expected the user to be invalidated\n" +
+			"HINT: a copy read before the user was invalidated may be out of date")
+	}
+	if invalidations.InvalidatedSince(userUuid, time.Now().Add(time.Second)) {
+		t.Errorf("case: Read After Invalidated: expected the user not to be invalidated\n" +
+			"HINT: a copy read after the user was invalidated is up to date")
+	}
+	if invalidations.InvalidatedSince(uuid.NewV4(), time.Time{}) {
+		t.Errorf("case: Other User: expected the user not to be invalidated\n" +
+			"HINT: only the user given to Invalidate is invalidated")
+	}
+}
+
+// newHungRedis starts a server which accepts connections but never responds, as a redis server which hangs does.
+func newHungRedis(t *testing.T) string {
+	listener, errL := net.Listen("tcp", "127.0.0.1:0")
+	if errL != nil {
+		t.Fatalf("unexpected error setting up test: %s", errL)
+	}
+	var mx sync.Mutex
+	var conns []net.Conn
+	go func() {
+		for {
+			conn, errA := listener.Accept()
+			if errA != nil {
+				return
+			}
+			mx.Lock()
+			conns = append(conns, conn)
+			mx.Unlock()
+		}
+	}()
+	t.Cleanup(func() {
+		_ = listener.Close()
+		mx.Lock()
+		defer mx.Unlock()
+		for _, conn := range conns {
+			_ = conn.Close()
+		}
+	})
+	return listener.Addr().String()
+}
+
+func TestCachedStore_ContextDone(t *testing.T) {
+	memStore := NewMemStore()
+	encodedHash, errCEH := CreateEncodedHash("TestIngPasswordHash")
+	if errCEH != nil {
+		t.Fatalf("unexpected error setting up test: %s", errCEH)
+	}
+	usr, errCU := memStore.CreateUser(context.Background(), &NewUser{Username: "cached", FullName: "Cached User",
+		DisplayName: "Cached", EncodedHash: encodedHash})
+	if errCU != nil {
+		t.Fatalf("unexpected error setting up test: %s", errCU)
+	}
+	client := redis.NewClient(&redis.Options{Addr: newHungRedis(t), ReadTimeout: time.Minute,
+		WriteTimeout: time.Minute})
+	defer client.Close()
+	cachedStore := NewCachedStore(memStore, client, time.Minute)
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	deadline, cancelDeadline := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancelDeadline()
+	cases := []struct {
+		name string
+		hint string
+		ctx  context.Context
+		call func(ctx context.Context) error
+	}{
+		{
+			name: "ReadUserInfo Canceled",
+			hint: "A call whose context is canceled should not wait for redis to respond",
+			ctx:  canceled,
+			call: func(ctx context.Context) error {
+				_, err := cachedStore.ReadUserInfo(ctx, usr.Uuid)
+				return err
+			},
+		},
+		{
+			name: "ReadUserInfo Deadline",
+			hint: "Once its deadline passes, the user should be read from the wrapped store instead",
+			ctx:  deadline,
+			call: func(ctx context.Context) error {
+				_, err := cachedStore.ReadUserInfo(ctx, usr.Uuid)
+				return err
+			},
+		},
+		{
+			name: "ReadUserUuid Canceled",
+			hint: "A call whose context is canceled should not wait for redis to respond",
+			ctx:  canceled,
+			call: func(ctx context.Context) error {
+				_, err := cachedStore.ReadUserUuid(ctx, usr.Username)
+				return err
+			},
+		},
+		{
+			name: "Invalidate Canceled",
+			hint: "Invalidating a user should not wait for redis to respond once the context is canceled",
+			ctx:  canceled,
+			call: func(ctx context.Context) error {
+				return cachedStore.UpdateUserEncodedHash(ctx, usr.Uuid, encodedHash)
+			},
+		},
+	}
+
+	for _, c := range cases {
+		started := time.Now()
+		errC := c.call(c.ctx)
+		if elapsed := time.Since(started); elapsed > time.Second {
+			t.Errorf("case: %s: expected the call to return once its context was done, but it took %s\nHINT: %s",
+				c.name, elapsed, c.hint)
+		}
+		if errC != nil {
+			t.Errorf("case: %s: unexpected error: %s\nHINT: the wrapped store should be used when redis does "+
+				"not respond", c.name, errC)
+		}
+	}
+}
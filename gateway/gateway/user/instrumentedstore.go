@@ -0,0 +1,112 @@
+package user
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/kit/metrics"
+	uuid "github.com/satori/go.uuid"
+)
+
+// InstrumentedStore represents a user.Store which records the duration of each call to the wrapped Store.
+type InstrumentedStore struct {
+	next Store
+	// Observes the duration of each call in seconds, labeled by method and success.
+	duration metrics.Histogram
+}
+
+// NewInstrumentedStore constructs a new InstrumentedStore wrapping next.
+// duration must accept the labels "method" and "success".
+func NewInstrumentedStore(next Store, duration metrics.Histogram) *InstrumentedStore {
+	if next == nil {
+		panic("no store provided")
+	}
+	return &InstrumentedStore{next: next, duration: duration}
+}
+
+// CreateUser will add the new user to the wrapped store.
+func (is *InstrumentedStore) CreateUser(ctx context.Context, newUser *NewUser) (usr *User, err error) {
+	defer is.observe("CreateUser", time.Now(), &err)
+	return is.next.CreateUser(ctx, newUser)
+}
+
+// CreateUserRole grants the role to the given user in the wrapped store.
+func (is *InstrumentedStore) CreateUserRole(ctx context.Context, userUuid uuid.UUID, role string) (err error) {
+	defer is.observe("CreateUserRole", time.Now(), &err)
+	return is.next.CreateUserRole(ctx, userUuid, role)
+}
+
+// ReadUserEncodedHash gets the encoded hash of the users password.
+func (is *InstrumentedStore) ReadUserEncodedHash(ctx context.Context, username string) (encodedHash string, err error) {
+	defer is.observe("ReadUserEncodedHash", time.Now(), &err)
+	return is.next.ReadUserEncodedHash(ctx, username)
+}
+
+// ReadUserInfo gets the basic information about the user.
+func (is *InstrumentedStore) ReadUserInfo(ctx context.Context, userUuid uuid.UUID) (usr *User, err error) {
+	defer is.observe("ReadUserInfo", time.Now(), &err)
+	return is.next.ReadUserInfo(ctx, userUuid)
+}
+
+// ReadUserPersonalData gets the personal data held about the user.
+func (is *InstrumentedStore) ReadUserPersonalData(ctx context.Context, userUuid uuid.UUID) (data *PersonalData, err error) {
+	defer is.observe("ReadUserPersonalData", time.Now(), &err)
+	return is.next.ReadUserPersonalData(ctx, userUuid)
+}
+
+// ReadUserRoles gets the roles granted to the user, ordered by name.
+func (is *InstrumentedStore) ReadUserRoles(ctx context.Context, userUuid uuid.UUID) (roles []string, err error) {
+	defer is.observe("ReadUserRoles", time.Now(), &err)
+	return is.next.ReadUserRoles(ctx, userUuid)
+}
+
+// ReadUserUuid gets the uuid for the user based on the given username.
+func (is *InstrumentedStore) ReadUserUuid(ctx context.Context, username string) (userUuid *uuid.UUID, err error) {
+	defer is.observe("ReadUserUuid", time.Now(), &err)
+	return is.next.ReadUserUuid(ctx, username)
+}
+
+// ReadUsersDeletionRequested gets the uuids of up to limit users who requested their account be deleted
+// before requestedBefore, oldest request first.
+func (is *InstrumentedStore) ReadUsersDeletionRequested(ctx context.Context, requestedBefore time.Time,
+	limit int) (userUuids []uuid.UUID, err error) {
+	defer is.observe("ReadUsersDeletionRequested", time.Now(), &err)
+	return is.next.ReadUsersDeletionRequested(ctx, requestedBefore, limit)
+}
+
+// UpdateUserDeletionRequested sets the time the user requested their account be deleted in the wrapped store.
+func (is *InstrumentedStore) UpdateUserDeletionRequested(ctx context.Context, userUuid uuid.UUID,
+	requested time.Time) (err error) {
+	defer is.observe("UpdateUserDeletionRequested", time.Now(), &err)
+	return is.next.UpdateUserDeletionRequested(ctx, userUuid, requested)
+}
+
+// UpdateUserEncodedHash updates the encoded hash associated with the user in the wrapped store.
+func (is *InstrumentedStore) UpdateUserEncodedHash(ctx context.Context, userUuid uuid.UUID, encodedHash string) (err error) {
+	defer is.observe("UpdateUserEncodedHash", time.Now(), &err)
+	return is.next.UpdateUserEncodedHash(ctx, userUuid, encodedHash)
+}
+
+// DeleteUser removes the user from the wrapped store.
+func (is *InstrumentedStore) DeleteUser(ctx context.Context, userUuid uuid.UUID) (err error) {
+	defer is.observe("DeleteUser", time.Now(), &err)
+	return is.next.DeleteUser(ctx, userUuid)
+}
+
+// DeleteUserDeletionRequested cancels the deletion the user requested in the wrapped store.
+func (is *InstrumentedStore) DeleteUserDeletionRequested(ctx context.Context, userUuid uuid.UUID,
+	requestedAfter time.Time) (canceled bool, err error) {
+	defer is.observe("DeleteUserDeletionRequested", time.Now(), &err)
+	return is.next.DeleteUserDeletionRequested(ctx, userUuid, requestedAfter)
+}
+
+// observe records the duration of a call to method which began at begin, and whether it failed.
+// A user which is not found, or already exists, or a role already granted, or a deletion which can no longer be
+// canceled, is an expected outcome, not a failure.
+func (is *InstrumentedStore) observe(method string, begin time.Time, err *error) {
+	success := *err == nil || *err == ErrUserNotFound || *err == ErrUserAlreadyExists ||
+		*err == ErrUsernameUnavailable || *err == ErrRoleAlreadyGranted || *err == ErrDeletionGracePassed
+	is.duration.With("method", method, "success", strconv.FormatBool(success)).
+		Observe(time.Since(begin).Seconds())
+}
@@ -0,0 +1,248 @@
+package user
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// memUser is a user held by a MemStore, along with what the database associates with them.
+type memUser struct {
+	user        User
+	fullName    string
+	encodedHash string
+	roles       map[string]bool
+	// deletionRequested is when the user requested their account be deleted, or the zero time if they have not.
+	deletionRequested time.Time
+}
+
+// MemStore represents a user.Store held in the memory of the process, which is lost when it exits.
+// This should be used only for development and testing, production systems should use a database.
+//
+// Each operation returns the same errors as MsSqlStore, and usernames are found ignoring case, as they are
+// in mssql.
+type MemStore struct {
+	mx    sync.RWMutex
+	users map[uuid.UUID]*memUser
+	// usernames holds the uuid of each user by their username in lower case.
+	usernames map[string]uuid.UUID
+}
+
+// NewMemStore constructs a new, empty MemStore.
+func NewMemStore() *MemStore {
+	return &MemStore{
+		users:     make(map[uuid.UUID]*memUser),
+		usernames: make(map[string]uuid.UUID),
+	}
+}
+
+// CREATE /////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// CreateUser will add the new user to the store.
+func (ms *MemStore) CreateUser(_ context.Context, newUser *NewUser) (*User, error) {
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	key := strings.ToLower(newUser.Username)
+	if _, taken := ms.usernames[key]; taken {
+		return &User{}, ErrUsernameUnavailable
+	}
+	mu := &memUser{
+		user:        User{Uuid: uuid.NewV4(), Username: newUser.Username, DisplayName: newUser.DisplayName},
+		fullName:    newUser.FullName,
+		encodedHash: newUser.EncodedHash,
+		roles:       make(map[string]bool),
+	}
+	ms.users[mu.user.Uuid] = mu
+	ms.usernames[key] = mu.user.Uuid
+	user := mu.user
+	return &user, nil
+}
+
+// CreateUserRole grants the role to the given user.
+func (ms *MemStore) CreateUserRole(_ context.Context, userUuid uuid.UUID, role string) error {
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	mu, found := ms.users[userUuid]
+	if !found {
+		return ErrUserNotFound
+	}
+	if mu.roles[role] {
+		return ErrRoleAlreadyGranted
+	}
+	mu.roles[role] = true
+	return nil
+}
+
+// READ /////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// ReadUserEncodedHash gets the encoded hash of the users password.
+func (ms *MemStore) ReadUserEncodedHash(_ context.Context, username string) (string, error) {
+	ms.mx.RLock()
+	defer ms.mx.RUnlock()
+	mu, found := ms.byUsername(username)
+	if !found {
+		return InvalidEncodedPasswordHash, ErrUserNotFound
+	}
+	return mu.encodedHash, nil
+}
+
+// ReadUserInfo gets the basic information about the user.
+func (ms *MemStore) ReadUserInfo(_ context.Context, userUuid uuid.UUID) (*User, error) {
+	ms.mx.RLock()
+	defer ms.mx.RUnlock()
+	mu, found := ms.users[userUuid]
+	if !found {
+		return &User{}, ErrUserNotFound
+	}
+	user := mu.user
+	return &user, nil
+}
+
+// ReadUserPersonalData gets the personal data held about the user. A MemStore holds no emails or sessions,
+// and the profile of every user is empty and not shared.
+func (ms *MemStore) ReadUserPersonalData(_ context.Context, userUuid uuid.UUID) (*PersonalData, error) {
+	ms.mx.RLock()
+	defer ms.mx.RUnlock()
+	mu, found := ms.users[userUuid]
+	if !found {
+		return nil, ErrUserNotFound
+	}
+	data := &PersonalData{
+		Account: Account{Uuid: mu.user.Uuid, Username: mu.user.Username, FullName: mu.fullName,
+			DisplayName: mu.user.DisplayName},
+		Emails:   make([]Email, 0),
+		Roles:    make([]string, 0, len(mu.roles)),
+		Sessions: make([]SessionRecord, 0),
+	}
+	for role := range mu.roles {
+		data.Roles = append(data.Roles, role)
+	}
+	sort.Strings(data.Roles)
+	return data, nil
+}
+
+// ReadUserRoles gets the roles granted to the user, ordered by name.
+func (ms *MemStore) ReadUserRoles(_ context.Context, userUuid uuid.UUID) ([]string, error) {
+	ms.mx.RLock()
+	defer ms.mx.RUnlock()
+	mu, found := ms.users[userUuid]
+	if !found {
+		return nil, ErrUserNotFound
+	}
+	roles := make([]string, 0, len(mu.roles))
+	for role := range mu.roles {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+	return roles, nil
+}
+
+// ReadUserUuid gets the uuid for the user based on the given username.
+func (ms *MemStore) ReadUserUuid(_ context.Context, username string) (*uuid.UUID, error) {
+	ms.mx.RLock()
+	defer ms.mx.RUnlock()
+	mu, found := ms.byUsername(username)
+	if !found {
+		return nil, ErrUserNotFound
+	}
+	userUuid := mu.user.Uuid
+	return &userUuid, nil
+}
+
+// ReadUsersDeletionRequested gets the uuids of up to limit users who requested their account be deleted
+// before requestedBefore, oldest request first.
+func (ms *MemStore) ReadUsersDeletionRequested(_ context.Context, requestedBefore time.Time,
+	limit int) ([]uuid.UUID, error) {
+	ms.mx.RLock()
+	defer ms.mx.RUnlock()
+	requested := make([]*memUser, 0)
+	for _, mu := range ms.users {
+		if !mu.deletionRequested.IsZero() && mu.deletionRequested.Before(requestedBefore) {
+			requested = append(requested, mu)
+		}
+	}
+	sort.Slice(requested, func(i, j int) bool {
+		return requested[i].deletionRequested.Before(requested[j].deletionRequested)
+	})
+	userUuids := make([]uuid.UUID, 0, len(requested))
+	for _, mu := range requested {
+		if len(userUuids) == limit {
+			break
+		}
+		userUuids = append(userUuids, mu.user.Uuid)
+	}
+	return userUuids, nil
+}
+
+// UPDATE /////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// UpdateUserDeletionRequested sets the time the user requested their account be deleted.
+func (ms *MemStore) UpdateUserDeletionRequested(_ context.Context, userUuid uuid.UUID, requested time.Time) error {
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	mu, found := ms.users[userUuid]
+	if !found {
+		return ErrUserNotFound
+	}
+	mu.deletionRequested = requested
+	return nil
+}
+
+// UpdateUserEncodedHash updates the encoded hash associated with the user.
+func (ms *MemStore) UpdateUserEncodedHash(_ context.Context, userUuid uuid.UUID, encodedHash string) error {
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	mu, found := ms.users[userUuid]
+	if !found {
+		return ErrUserNotFound
+	}
+	mu.encodedHash = encodedHash
+	return nil
+}
+
+// DELETE /////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// DeleteUser removes the user from the store, along with everything associated with them.
+func (ms *MemStore) DeleteUser(_ context.Context, userUuid uuid.UUID) error {
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	mu, found := ms.users[userUuid]
+	if !found {
+		return ErrUserNotFound
+	}
+	delete(ms.usernames, strings.ToLower(mu.user.Username))
+	delete(ms.users, userUuid)
+	return nil
+}
+
+// DeleteUserDeletionRequested cancels the deletion the user requested, if it was requested after requestedAfter.
+func (ms *MemStore) DeleteUserDeletionRequested(_ context.Context, userUuid uuid.UUID,
+	requestedAfter time.Time) (bool, error) {
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	mu, found := ms.users[userUuid]
+	if !found {
+		return false, ErrUserNotFound
+	}
+	if mu.deletionRequested.IsZero() {
+		return false, nil
+	}
+	if mu.deletionRequested.Before(requestedAfter) {
+		return false, ErrDeletionGracePassed
+	}
+	mu.deletionRequested = time.Time{}
+	return true, nil
+}
+
+// byUsername returns the user with the username, ignoring case. The caller must hold the lock.
+func (ms *MemStore) byUsername(username string) (*memUser, bool) {
+	userUuid, found := ms.usernames[strings.ToLower(username)]
+	if !found {
+		return nil, false
+	}
+	return ms.users[userUuid], true
+}
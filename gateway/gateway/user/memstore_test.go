@@ -0,0 +1,11 @@
+// +build all unit
+
+package user
+
+import (
+	"testing"
+)
+
+func TestMemStore(t *testing.T) {
+	t.Run("TestMemStore_BasicCRUD", testStoreBasicCRUD(NewMemStore()))
+}
@@ -1,6 +1,7 @@
 package user
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"time"
@@ -52,7 +53,7 @@ type sessionInfo struct {
 //TODO: func (ms *MsSqlStore) CreateUserSessionAssociation(userUuid uuid.UUID, sessionUuid uuid.UUID) error
 
 // CreateUser will add the new user to the database
-func (ms *MsSqlStore) CreateUser(newUser *NewUser) (*User, error) {
+func (ms *MsSqlStore) CreateUser(ctx context.Context, newUser *NewUser) (*User, error) {
 	user := User{}
 	userInfo := userInfo{}
 
@@ -63,12 +64,12 @@ func (ms *MsSqlStore) CreateUser(newUser *NewUser) (*User, error) {
 		return &user, errSUID
 	}
 
-	stmt, errPS := ms.database.Prepare("USP_CreateUser")
+	stmt, errPS := ms.database.PrepareContext(ctx, "USP_CreateUser")
 	if errPS != nil {
 		return &user, ErrPreparingQuery
 	}
 	defer stmt.Close()
-	errQ := stmt.QueryRow(
+	errQ := stmt.QueryRowContext(ctx,
 		sql.Named("UserUuid", sqlUuid),
 		sql.Named("Username", newUser.Username),
 		sql.Named("FullName", newUser.FullName),
@@ -99,6 +100,33 @@ func (ms *MsSqlStore) CreateUser(newUser *NewUser) (*User, error) {
 // CreateUserEmail adds the email to the given user's account
 //TODO: func (ms *MsSqlStore) CreateUserEmail(userUuid uuid.UUID, email string) error
 
+// CreateUserRole grants the role to the given user.
+func (ms *MsSqlStore) CreateUserRole(ctx context.Context, userUuid uuid.UUID, role string) error {
+	sqlUuid := mssql.UniqueIdentifier{}
+	errSUID := sqlUuid.Scan(userUuid.String())
+	if errSUID != nil {
+		return ErrUnexpected
+	}
+
+	stmt, errPS := ms.database.PrepareContext(ctx, "USP_CreateUserRole")
+	if errPS != nil {
+		return ErrPreparingQuery
+	}
+	defer stmt.Close()
+	_, errQ := stmt.ExecContext(ctx, sql.Named("UserUuid", sqlUuid), sql.Named("Role", role))
+	if errQ != nil {
+		if msErr, ok := errQ.(mssql.Error); ok {
+			if msErr.Number == 50301 {
+				return ErrUserNotFound
+			} else if msErr.Number == 50401 {
+				return ErrRoleAlreadyGranted
+			}
+		}
+		return errQ
+	}
+	return nil
+}
+
 // READ /////////////////////////////////////////////////////////////////////////////////////////////////////////
 
 // ReadProcedureVersion gets the procedure version implemented in the database.
@@ -120,14 +148,14 @@ func (ms *MsSqlStore) CreateUser(newUser *NewUser) (*User, error) {
 //TODO: func (ms *MsSqlStore) ReadUserEmails(userUuid uuid.UUID) (TODO: define type, error)
 
 // ReadUserEncodedHash gets the encoded hash of the users password.
-func (ms *MsSqlStore) ReadUserEncodedHash(username string) (string, error) {
-	stmt, errPS := ms.database.Prepare("USP_ReadUserEncodedHash")
+func (ms *MsSqlStore) ReadUserEncodedHash(ctx context.Context, username string) (string, error) {
+	stmt, errPS := ms.database.PrepareContext(ctx, "USP_ReadUserEncodedHash")
 	if errPS != nil {
 		return InvalidEncodedPasswordHash, ErrPreparingQuery
 	}
 	defer stmt.Close()
 	encodedHash := ""
-	errQ := stmt.QueryRow(sql.Named("Username", username)).Scan(&encodedHash)
+	errQ := stmt.QueryRowContext(ctx, sql.Named("Username", username)).Scan(&encodedHash)
 	if errQ != nil {
 		if msErr, ok := errQ.(mssql.Error); ok {
 			if msErr.Number == 50101 {
@@ -143,7 +171,7 @@ func (ms *MsSqlStore) ReadUserEncodedHash(username string) (string, error) {
 }
 
 // ReadUserInfo gets the basic information about the user.
-func (ms *MsSqlStore) ReadUserInfo(userUuid uuid.UUID) (*User, error) {
+func (ms *MsSqlStore) ReadUserInfo(ctx context.Context, userUuid uuid.UUID) (*User, error) {
 	user := User{}
 	userInfo := userInfo{}
 	sqlUuid := mssql.UniqueIdentifier{}
@@ -152,12 +180,12 @@ func (ms *MsSqlStore) ReadUserInfo(userUuid uuid.UUID) (*User, error) {
 		return &user, ErrUnexpected
 	}
 
-	stmt, errPS := ms.database.Prepare("USP_ReadUserInfo")
+	stmt, errPS := ms.database.PrepareContext(ctx, "USP_ReadUserInfo")
 	if errPS != nil {
 		return &user, ErrPreparingQuery
 	}
 	defer stmt.Close()
-	errQ := stmt.QueryRow(sql.Named("UserUuid", sqlUuid)).Scan(
+	errQ := stmt.QueryRowContext(ctx, sql.Named("UserUuid", sqlUuid)).Scan(
 		&userInfo.Uuid, &userInfo.Username, &userInfo.DisplayName)
 	if errQ != nil {
 		if msErr, ok := errQ.(mssql.Error); ok {
@@ -169,6 +197,8 @@ func (ms *MsSqlStore) ReadUserInfo(userUuid uuid.UUID) (*User, error) {
 				return &user, ErrUnexpected
 			}
 		}
+		// Such as when the context of the call is done before the query completes
+		return &user, ErrUnexpected
 	}
 	errUQ := user.Uuid.Scan(userInfo.Uuid.String())
 	if errUQ != nil {
@@ -179,6 +209,86 @@ func (ms *MsSqlStore) ReadUserInfo(userUuid uuid.UUID) (*User, error) {
 	return &user, nil
 }
 
+// ReadUserPersonalData gets the personal data held about the user, using the procedures which read each part,
+// such as USP_ReadUserProfile and USP_ReadUserEmails.
+func (ms *MsSqlStore) ReadUserPersonalData(ctx context.Context, userUuid uuid.UUID) (*PersonalData, error) {
+	user, errRUI := ms.ReadUserInfo(ctx, userUuid)
+	if errRUI != nil {
+		return nil, errRUI
+	}
+	data := &PersonalData{
+		Account:  Account{Uuid: user.Uuid, Username: user.Username, DisplayName: user.DisplayName},
+		Emails:   make([]Email, 0),
+		Sessions: make([]SessionRecord, 0),
+	}
+	errFN := ms.queryUserProcedure(ctx, "USP_ReadUserFullName", userUuid, func(rows *sql.Rows) error {
+		fullName := sql.NullString{}
+		errS := rows.Scan(&fullName)
+		data.Account.FullName = fullName.String
+		return errS
+	})
+	if errFN != nil {
+		return nil, errFN
+	}
+	errP := ms.queryUserProcedure(ctx, "USP_ReadUserProfile", userUuid, func(rows *sql.Rows) error {
+		sqlUuid := mssql.UniqueIdentifier{}
+		var username, displayName, bio, gravatarUrl, shareDisplayName, shareBio, shareGravatarUrl sql.NullString
+		errS := rows.Scan(&sqlUuid, &username, &displayName, &bio, &gravatarUrl, &shareDisplayName, &shareBio,
+			&shareGravatarUrl)
+		data.Profile = Profile{Bio: bio.String, GravatarUrl: gravatarUrl.String}
+		data.Sharing = ProfileSharing{DisplayName: shared(shareDisplayName.String), Bio: shared(shareBio.String),
+			GravatarUrl: shared(shareGravatarUrl.String)}
+		return errS
+	})
+	if errP != nil {
+		return nil, errP
+	}
+	errE := ms.queryUserProcedure(ctx, "USP_ReadUserEmails", userUuid, func(rows *sql.Rows) error {
+		sqlUuid := mssql.UniqueIdentifier{}
+		email := Email{}
+		created := sql.NullTime{}
+		if errS := rows.Scan(&sqlUuid, &email.Email, &created); errS != nil {
+			return errS
+		}
+		email.Created = created.Time
+		if errUQ := email.Uuid.Scan(sqlUuid.String()); errUQ != nil {
+			return errUQ
+		}
+		data.Emails = append(data.Emails, email)
+		return nil
+	})
+	if errE != nil {
+		return nil, errE
+	}
+	errS := ms.queryUserProcedure(ctx, "USP_ReadUserSessions", userUuid, func(rows *sql.Rows) error {
+		sqlUuid := mssql.UniqueIdentifier{}
+		// The session id is part of the access token of the session, so is read but not returned
+		sessionInfo := sessionInfo{}
+		created := sql.NullTime{}
+		if errS := rows.Scan(&sqlUuid, &sessionInfo.SessionId, &sessionInfo.Status, &created); errS != nil {
+			return errS
+		}
+		record := SessionRecord{Status: sessionInfo.Status, Created: created.Time}
+		if errUQ := record.Uuid.Scan(sqlUuid.String()); errUQ != nil {
+			return errUQ
+		}
+		data.Sessions = append(data.Sessions, record)
+		return nil
+	})
+	if errS != nil {
+		return nil, errS
+	}
+	roles, errRUR := ms.ReadUserRoles(ctx, userUuid)
+	if errRUR != nil {
+		if errRUR == ErrUserNotFound {
+			return nil, errRUR
+		}
+		return nil, ErrUnexpected
+	}
+	data.Roles = roles
+	return data, nil
+}
+
 // ReadUserProfile gets the profile information for the user.
 //TODO: func (ms *MsSqlStore) ReadUserProfile(userUuid uuid.UUID) (TODO: define type, error)
 
@@ -188,17 +298,55 @@ func (ms *MsSqlStore) ReadUserInfo(userUuid uuid.UUID) (*User, error) {
 // ReadUserUsernamesByEmail gets the usernames associated with a given email.
 //TODO: func (ms *MsSqlStore) ReadUserUsernamesByEmail(email string) (TODO: define type, error)
 
+// ReadUserRoles gets the roles granted to the user, ordered by name.
+func (ms *MsSqlStore) ReadUserRoles(ctx context.Context, userUuid uuid.UUID) ([]string, error) {
+	sqlUuid := mssql.UniqueIdentifier{}
+	errSUID := sqlUuid.Scan(userUuid.String())
+	if errSUID != nil {
+		return nil, ErrUnexpected
+	}
+
+	stmt, errPS := ms.database.PrepareContext(ctx, "USP_ReadUserRoles")
+	if errPS != nil {
+		return nil, ErrPreparingQuery
+	}
+	defer stmt.Close()
+	rows, errQ := stmt.QueryContext(ctx, sql.Named("UserUuid", sqlUuid))
+	if errQ != nil {
+		if msErr, ok := errQ.(mssql.Error); ok && msErr.Number == 50301 {
+			return nil, ErrUserNotFound
+		}
+		return nil, errQ
+	}
+	defer rows.Close()
+	roles := make([]string, 0)
+	for rows.Next() {
+		var role string
+		if errS := rows.Scan(&role); errS != nil {
+			return nil, errS
+		}
+		roles = append(roles, role)
+	}
+	if errR := rows.Err(); errR != nil {
+		if msErr, ok := errR.(mssql.Error); ok && msErr.Number == 50301 {
+			return nil, ErrUserNotFound
+		}
+		return nil, errR
+	}
+	return roles, nil
+}
+
 // ReadUserUuid gets the uuid for the user based on the given username.
-func (ms *MsSqlStore) ReadUserUuid(username string) (*uuid.UUID, error) {
+func (ms *MsSqlStore) ReadUserUuid(ctx context.Context, username string) (*uuid.UUID, error) {
 
 	sqlUuid := mssql.UniqueIdentifier{}
 
-	stmt, errPS := ms.database.Prepare("USP_ReadUserUuid")
+	stmt, errPS := ms.database.PrepareContext(ctx, "USP_ReadUserUuid")
 	if errPS != nil {
 		return nil, ErrPreparingQuery
 	}
 	defer stmt.Close()
-	errQ := stmt.QueryRow(sql.Named("Username", username)).Scan(
+	errQ := stmt.QueryRowContext(ctx, sql.Named("Username", username)).Scan(
 		&sqlUuid)
 	if errQ != nil {
 		if msErr, ok := errQ.(mssql.Error); ok {
@@ -210,6 +358,8 @@ func (ms *MsSqlStore) ReadUserUuid(username string) (*uuid.UUID, error) {
 				return nil, ErrUnexpected
 			}
 		}
+		// Such as when the context of the call is done before the query completes
+		return nil, ErrUnexpected
 	}
 	userUuid := uuid.NewV4()
 	errUQ := userUuid.Scan(sqlUuid.String())
@@ -219,16 +369,128 @@ func (ms *MsSqlStore) ReadUserUuid(username string) (*uuid.UUID, error) {
 	return &userUuid, nil
 }
 
+// ReadUsersDeletionRequested gets the uuids of up to limit users who requested their account be deleted
+// before requestedBefore, oldest request first.
+func (ms *MsSqlStore) ReadUsersDeletionRequested(ctx context.Context, requestedBefore time.Time,
+	limit int) ([]uuid.UUID, error) {
+	stmt, errPS := ms.database.PrepareContext(ctx, "USP_ReadUsersDeletionRequested")
+	if errPS != nil {
+		return nil, ErrPreparingQuery
+	}
+	defer stmt.Close()
+	rows, errQ := stmt.QueryContext(ctx, sql.Named("RequestedBefore", requestedBefore.UTC()),
+		sql.Named("Limit", limit))
+	if errQ != nil {
+		return nil, ErrUnexpected
+	}
+	defer rows.Close()
+	userUuids := make([]uuid.UUID, 0)
+	for rows.Next() {
+		sqlUuid := mssql.UniqueIdentifier{}
+		if errS := rows.Scan(&sqlUuid); errS != nil {
+			return nil, ErrUnexpected
+		}
+		userUuid, errFS := uuid.FromString(sqlUuid.String())
+		if errFS != nil {
+			return nil, ErrUnexpected
+		}
+		userUuids = append(userUuids, userUuid)
+	}
+	if rows.Err() != nil {
+		return nil, ErrUnexpected
+	}
+	return userUuids, nil
+}
+
+// queryUserProcedure executes the procedure, which takes the uuid of a user, and calls scan for each row returned.
+// Returns ErrUserNotFound if the procedure reports that the user does not exist.
+func (ms *MsSqlStore) queryUserProcedure(ctx context.Context, procedure string, userUuid uuid.UUID,
+	scan func(rows *sql.Rows) error) error {
+	sqlUuid := mssql.UniqueIdentifier{}
+	if errSUID := sqlUuid.Scan(userUuid.String()); errSUID != nil {
+		return ErrUnexpected
+	}
+	stmt, errPS := ms.database.PrepareContext(ctx, procedure)
+	if errPS != nil {
+		return ErrPreparingQuery
+	}
+	defer stmt.Close()
+	rows, errQ := stmt.QueryContext(ctx, sql.Named("UserUuid", sqlUuid))
+	if errQ != nil {
+		if msErr, ok := errQ.(mssql.Error); ok && msErr.Number == 50301 {
+			return ErrUserNotFound
+		}
+		return ErrUnexpected
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if errS := scan(rows); errS != nil {
+			return ErrUnexpected
+		}
+	}
+	if errR := rows.Err(); errR != nil {
+		if msErr, ok := errR.(mssql.Error); ok && msErr.Number == 50301 {
+			return ErrUserNotFound
+		}
+		return ErrUnexpected
+	}
+	return nil
+}
+
 // UPDATE /////////////////////////////////////////////////////////////////////////////////////////////////////////
 
 // UpdateSessionExpired sets the given session's status to "Expired".
 //TODO: func (ms *MsSqlStore) UpdateSessionExpired(sessionUuid uuid.UUID) error
 
+// UpdateUserDeletionRequested sets the time the user requested their account be deleted.
+func (ms *MsSqlStore) UpdateUserDeletionRequested(ctx context.Context, userUuid uuid.UUID,
+	requested time.Time) error {
+	sqlUuid := mssql.UniqueIdentifier{}
+	errSUID := sqlUuid.Scan(userUuid.String())
+	if errSUID != nil {
+		return ErrUnexpected
+	}
+
+	stmt, errPS := ms.database.PrepareContext(ctx, "USP_UpdateUserDeletionRequested")
+	if errPS != nil {
+		return ErrPreparingQuery
+	}
+	defer stmt.Close()
+	_, errQ := stmt.ExecContext(ctx, sql.Named("UserUuid", sqlUuid), sql.Named("Requested", requested.UTC()))
+	if errQ != nil {
+		if msErr, ok := errQ.(mssql.Error); ok && msErr.Number == 50301 {
+			return ErrUserNotFound
+		}
+		return errQ
+	}
+	return nil
+}
+
 // UpdateUserDisplayName updates the display name of the user.
 //TODO: func (ms *MsSqlStore) UpdateUserDisplayName(displayName string) error
 
 // UpdateUserEncodedHash updates the encoded hash associated with the user.
-//TODO: func (ms *MsSqlStore) UpdateUserEncodedHash(userUuid uuid.UUID, encodedHash string) error
+func (ms *MsSqlStore) UpdateUserEncodedHash(ctx context.Context, userUuid uuid.UUID, encodedHash string) error {
+	sqlUuid := mssql.UniqueIdentifier{}
+	errSUID := sqlUuid.Scan(userUuid.String())
+	if errSUID != nil {
+		return ErrUnexpected
+	}
+
+	stmt, errPS := ms.database.PrepareContext(ctx, "USP_UpdateUserEncodedHash")
+	if errPS != nil {
+		return ErrPreparingQuery
+	}
+	defer stmt.Close()
+	_, errQ := stmt.ExecContext(ctx, sql.Named("UserUuid", sqlUuid), sql.Named("EncodedHash", encodedHash))
+	if errQ != nil {
+		if msErr, ok := errQ.(mssql.Error); ok && msErr.Number == 50301 {
+			return ErrUserNotFound
+		}
+		return errQ
+	}
+	return nil
+}
 
 // UpdateUserFullName updates the full name of the user.
 //TODO: func (ms *MsSqlStore) UpdateUserFullName(userUuid uuid.UUID, fullName string) error
@@ -257,19 +519,19 @@ func (ms *MsSqlStore) ReadUserUuid(username string) (*uuid.UUID, error) {
 // DELETE /////////////////////////////////////////////////////////////////////////////////////////////////////////
 
 // DeleteUser removes the user from the database.
-func (ms *MsSqlStore) DeleteUser(userUuid uuid.UUID) error {
+func (ms *MsSqlStore) DeleteUser(ctx context.Context, userUuid uuid.UUID) error {
 	sqlUuid := mssql.UniqueIdentifier{}
 	errSUID := sqlUuid.Scan(userUuid.String())
 	if errSUID != nil {
 		return ErrUnexpected
 	}
 
-	stmt, errPS := ms.database.Prepare("USP_DeleteUser")
+	stmt, errPS := ms.database.PrepareContext(ctx, "USP_DeleteUser")
 	if errPS != nil {
 		return ErrPreparingQuery
 	}
 	defer stmt.Close()
-	rs, errQ := stmt.Exec(sql.Named("UserUuid", sqlUuid))
+	rs, errQ := stmt.ExecContext(ctx, sql.Named("UserUuid", sqlUuid))
 	if errQ != nil {
 		if mssqlerr, ok := errQ.(mssql.Error); ok {
 			if mssqlerr.Number == 50101 {
@@ -287,6 +549,36 @@ func (ms *MsSqlStore) DeleteUser(userUuid uuid.UUID) error {
 	return nil
 }
 
+// DeleteUserDeletionRequested cancels the deletion the user requested, if it was requested after requestedAfter.
+func (ms *MsSqlStore) DeleteUserDeletionRequested(ctx context.Context, userUuid uuid.UUID,
+	requestedAfter time.Time) (bool, error) {
+	sqlUuid := mssql.UniqueIdentifier{}
+	errSUID := sqlUuid.Scan(userUuid.String())
+	if errSUID != nil {
+		return false, ErrUnexpected
+	}
+
+	stmt, errPS := ms.database.PrepareContext(ctx, "USP_DeleteUserDeletionRequested")
+	if errPS != nil {
+		return false, ErrPreparingQuery
+	}
+	defer stmt.Close()
+	var canceled bool
+	errQ := stmt.QueryRowContext(ctx, sql.Named("UserUuid", sqlUuid),
+		sql.Named("RequestedAfter", requestedAfter.UTC())).Scan(&canceled)
+	if errQ != nil {
+		if msErr, ok := errQ.(mssql.Error); ok {
+			if msErr.Number == 50301 {
+				return false, ErrUserNotFound
+			} else if msErr.Number == 50502 {
+				return false, ErrDeletionGracePassed
+			}
+		}
+		return false, ErrUnexpected
+	}
+	return canceled, nil
+}
+
 // DeleteUserEmail removes the given email from the users account.
 //TODO: func (ms *MsSqlStore) DeleteUserEmail(userUuid uuid.UUID, email string)
 
@@ -0,0 +1,58 @@
+package user
+
+import (
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// PersonalData is the personal data the database holds about a user, such as for the user to export.
+// The encoded hash of their password and the ids of their sessions are credentials, so are not included.
+type PersonalData struct {
+	Account  Account         `json:"account"`
+	Emails   []Email         `json:"emails"`
+	Profile  Profile         `json:"profile"`
+	Sharing  ProfileSharing  `json:"sharing"`
+	Roles    []string        `json:"roles"`
+	Sessions []SessionRecord `json:"sessions"`
+}
+
+// Account is the account information of a user.
+type Account struct {
+	Uuid        uuid.UUID `json:"uuid"`
+	Username    string    `json:"username"`
+	FullName    string    `json:"fullName"`
+	DisplayName string    `json:"displayName"`
+}
+
+// Email is an email address associated with a user.
+type Email struct {
+	Uuid    uuid.UUID `json:"uuid"`
+	Email   string    `json:"email"`
+	Created time.Time `json:"created"`
+}
+
+// Profile is the profile of a user.
+type Profile struct {
+	Bio         string `json:"bio"`
+	GravatarUrl string `json:"gravatarUrl"`
+}
+
+// ProfileSharing is which fields of the profile of a user are shared publicly.
+type ProfileSharing struct {
+	DisplayName bool `json:"displayName"`
+	Bio         bool `json:"bio"`
+	GravatarUrl bool `json:"gravatarUrl"`
+}
+
+// SessionRecord is a session of a user recorded in the database, such as Active or Expired.
+type SessionRecord struct {
+	Uuid    uuid.UUID `json:"uuid"`
+	Status  string    `json:"status"`
+	Created time.Time `json:"created"`
+}
+
+// shared converts a profile sharing field of the database, Y or N, to true if the field is shared.
+func shared(field string) bool {
+	return field == "Y"
+}
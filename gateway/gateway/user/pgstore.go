@@ -0,0 +1,414 @@
+package user
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+	uuid "github.com/satori/go.uuid"
+)
+
+// pqUniqueViolation is the code of an error returned when a row would duplicate a unique key.
+const pqUniqueViolation = "23505"
+
+// Constraints of the postgres schema which identify a duplicate user.
+const (
+	pgConstraintUserUuid     = "pk_user_uuid"
+	pgConstraintUserUsername = "uq_user_username"
+)
+
+// PgStore represents a user.Store backed by a PostgreSQL database, with the schema of the postgres migrations.
+//
+// Each operation does what the stored procedure of the same name does for MsSqlStore, such as USP_CreateUser,
+// and returns the same errors. Usernames are found ignoring case, as they are in mssql.
+type PgStore struct {
+	database *sql.DB
+}
+
+// NewPgStore constructs a new PgStore.
+// If *sql.DB is nil, function will return an error.
+func NewPgStore(db *sql.DB) (*PgStore, error) {
+	if db == nil {
+		return nil, errors.New("NewPgStore: db cannot be nil")
+	}
+	return &PgStore{db}, nil
+}
+
+// CREATE /////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// CreateUser will add the new user to the database, along with their credential, profile, and profile sharing.
+func (ps *PgStore) CreateUser(ctx context.Context, newUser *NewUser) (*User, error) {
+	user := User{}
+	userUuid := uuid.NewV4()
+	errIT := ps.inTransaction(ctx, func(tx *sql.Tx) error {
+		errQ := tx.QueryRowContext(ctx,
+			`INSERT INTO "user" (uuid, username, full_name, display_name) VALUES ($1, $2, $3, $4)
+				RETURNING uuid, username, display_name`,
+			userUuid, newUser.Username, newUser.FullName, newUser.DisplayName,
+		).Scan(&user.Uuid, &user.Username, &user.DisplayName)
+		if errQ != nil {
+			return errQ
+		}
+		if errC := insertCredential(ctx, tx, userUuid, newUser.EncodedHash); errC != nil {
+			return errC
+		}
+		_, errE := tx.ExecContext(ctx, `
+			WITH p AS (INSERT INTO profile DEFAULT VALUES RETURNING uuid)
+			INSERT INTO user_profile (user_uuid, profile_uuid) SELECT $1, uuid FROM p`, userUuid)
+		if errE != nil {
+			return errE
+		}
+		_, errE = tx.ExecContext(ctx, `
+			WITH s AS (INSERT INTO profile_sharing (bio, gravatar_url, display_name) VALUES ('N', 'N', 'N')
+				RETURNING uuid)
+			INSERT INTO user_profile_sharing (user_uuid, profile_sharing_uuid) SELECT $1, uuid FROM s`, userUuid)
+		return errE
+	})
+	if errIT != nil {
+		if pqErr, ok := errIT.(*pq.Error); ok && pqErr.Code == pqUniqueViolation {
+			switch pqErr.Constraint {
+			case pgConstraintUserUuid:
+				return &user, ErrUserAlreadyExists
+			case pgConstraintUserUsername:
+				return &user, ErrUsernameUnavailable
+			}
+		}
+		return &user, ErrUnexpected
+	}
+	return &user, nil
+}
+
+// CreateUserRole grants the role to the given user.
+func (ps *PgStore) CreateUserRole(ctx context.Context, userUuid uuid.UUID, role string) error {
+	exists, errUE := ps.userExists(ctx, userUuid)
+	if errUE != nil {
+		return ErrUnexpected
+	}
+	if !exists {
+		return ErrUserNotFound
+	}
+	_, errE := ps.database.ExecContext(ctx, "INSERT INTO user_role (user_uuid, role) VALUES ($1, $2)",
+		userUuid, role)
+	if errE != nil {
+		if pqErr, ok := errE.(*pq.Error); ok && pqErr.Code == pqUniqueViolation {
+			return ErrRoleAlreadyGranted
+		}
+		return ErrUnexpected
+	}
+	return nil
+}
+
+// READ /////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// ReadUserEncodedHash gets the encoded hash of the users password.
+func (ps *PgStore) ReadUserEncodedHash(ctx context.Context, username string) (string, error) {
+	encodedHash := ""
+	errQ := ps.database.QueryRowContext(ctx, `
+		SELECT c.encoded_hash
+			FROM credential AS c
+			INNER JOIN user_credential AS uc ON c.uuid = uc.credential_uuid
+			INNER JOIN "user" AS u ON uc.user_uuid = u.uuid
+			WHERE lower(u.username) = lower($1)`, username).Scan(&encodedHash)
+	if errQ != nil {
+		if errQ == sql.ErrNoRows {
+			return InvalidEncodedPasswordHash, ErrUserNotFound
+		}
+		return InvalidEncodedPasswordHash, ErrUnexpected
+	}
+	return encodedHash, nil
+}
+
+// ReadUserInfo gets the basic information about the user.
+func (ps *PgStore) ReadUserInfo(ctx context.Context, userUuid uuid.UUID) (*User, error) {
+	user := User{}
+	errQ := ps.database.QueryRowContext(ctx,
+		`SELECT uuid, username, COALESCE(display_name, '') FROM "user" WHERE uuid = $1`, userUuid,
+	).Scan(&user.Uuid, &user.Username, &user.DisplayName)
+	if errQ != nil {
+		if errQ == sql.ErrNoRows {
+			return &User{}, ErrUserNotFound
+		}
+		return &User{}, ErrUnexpected
+	}
+	return &user, nil
+}
+
+// ReadUserPersonalData gets the personal data held about the user, read in one transaction so every part
+// is from the same moment.
+func (ps *PgStore) ReadUserPersonalData(ctx context.Context, userUuid uuid.UUID) (*PersonalData, error) {
+	data := &PersonalData{Emails: make([]Email, 0), Roles: make([]string, 0), Sessions: make([]SessionRecord, 0)}
+	tx, errB := ps.database.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if errB != nil {
+		return nil, ErrUnexpected
+	}
+	defer func() { _ = tx.Rollback() }()
+	errQ := tx.QueryRowContext(ctx, `
+		SELECT uuid, username, COALESCE(full_name, ''), COALESCE(display_name, '')
+			FROM "user" WHERE uuid = $1`, userUuid,
+	).Scan(&data.Account.Uuid, &data.Account.Username, &data.Account.FullName, &data.Account.DisplayName)
+	if errQ != nil {
+		if errQ == sql.ErrNoRows {
+			return nil, ErrUserNotFound
+		}
+		return nil, ErrUnexpected
+	}
+	var shareDisplayName, shareBio, shareGravatarUrl string
+	errQ = tx.QueryRowContext(ctx, `
+		SELECT COALESCE(p.bio, ''), COALESCE(p.gravatar_url, ''), COALESCE(s.display_name, 'N'),
+				COALESCE(s.bio, 'N'), COALESCE(s.gravatar_url, 'N')
+			FROM user_profile AS up
+			INNER JOIN profile AS p ON up.profile_uuid = p.uuid
+			INNER JOIN user_profile_sharing AS ups ON up.user_uuid = ups.user_uuid
+			INNER JOIN profile_sharing AS s ON ups.profile_sharing_uuid = s.uuid
+			WHERE up.user_uuid = $1`, userUuid,
+	).Scan(&data.Profile.Bio, &data.Profile.GravatarUrl, &shareDisplayName, &shareBio, &shareGravatarUrl)
+	if errQ != nil && errQ != sql.ErrNoRows {
+		return nil, ErrUnexpected
+	}
+	data.Sharing = ProfileSharing{DisplayName: shared(shareDisplayName), Bio: shared(shareBio),
+		GravatarUrl: shared(shareGravatarUrl)}
+	errE := queryRows(ctx, tx, `
+		SELECT e.uuid, e.email, COALESCE(e.created, 'epoch')
+			FROM email AS e
+			INNER JOIN user_email AS ue ON e.uuid = ue.email_uuid
+			WHERE ue.user_uuid = $1
+			ORDER BY e.created`, userUuid, func(rows *sql.Rows) error {
+		email := Email{}
+		errS := rows.Scan(&email.Uuid, &email.Email, &email.Created)
+		data.Emails = append(data.Emails, email)
+		return errS
+	})
+	if errE != nil {
+		return nil, ErrUnexpected
+	}
+	errR := queryRows(ctx, tx, "SELECT role FROM user_role WHERE user_uuid = $1 ORDER BY role", userUuid,
+		func(rows *sql.Rows) error {
+			var role string
+			errS := rows.Scan(&role)
+			data.Roles = append(data.Roles, role)
+			return errS
+		})
+	if errR != nil {
+		return nil, ErrUnexpected
+	}
+	errS := queryRows(ctx, tx, `
+		SELECT s.uuid, s.status, COALESCE(s.created, 'epoch')
+			FROM session AS s
+			INNER JOIN user_session AS us ON s.uuid = us.session_uuid
+			WHERE us.user_uuid = $1
+			ORDER BY s.created`, userUuid, func(rows *sql.Rows) error {
+		record := SessionRecord{}
+		errS := rows.Scan(&record.Uuid, &record.Status, &record.Created)
+		data.Sessions = append(data.Sessions, record)
+		return errS
+	})
+	if errS != nil {
+		return nil, ErrUnexpected
+	}
+	return data, nil
+}
+
+// ReadUserRoles gets the roles granted to the user, ordered by name.
+func (ps *PgStore) ReadUserRoles(ctx context.Context, userUuid uuid.UUID) ([]string, error) {
+	exists, errUE := ps.userExists(ctx, userUuid)
+	if errUE != nil {
+		return nil, ErrUnexpected
+	}
+	if !exists {
+		return nil, ErrUserNotFound
+	}
+	rows, errQ := ps.database.QueryContext(ctx, "SELECT role FROM user_role WHERE user_uuid = $1 ORDER BY role",
+		userUuid)
+	if errQ != nil {
+		return nil, ErrUnexpected
+	}
+	defer rows.Close()
+	roles := make([]string, 0)
+	for rows.Next() {
+		var role string
+		if errS := rows.Scan(&role); errS != nil {
+			return nil, ErrUnexpected
+		}
+		roles = append(roles, role)
+	}
+	if rows.Err() != nil {
+		return nil, ErrUnexpected
+	}
+	return roles, nil
+}
+
+// ReadUserUuid gets the uuid for the user based on the given username.
+func (ps *PgStore) ReadUserUuid(ctx context.Context, username string) (*uuid.UUID, error) {
+	userUuid := uuid.UUID{}
+	errQ := ps.database.QueryRowContext(ctx, `SELECT uuid FROM "user" WHERE lower(username) = lower($1)`,
+		username).Scan(&userUuid)
+	if errQ != nil {
+		if errQ == sql.ErrNoRows {
+			return nil, ErrUserNotFound
+		}
+		return nil, ErrUnexpected
+	}
+	return &userUuid, nil
+}
+
+// ReadUsersDeletionRequested gets the uuids of up to limit users who requested their account be deleted
+// before requestedBefore, oldest request first.
+func (ps *PgStore) ReadUsersDeletionRequested(ctx context.Context, requestedBefore time.Time,
+	limit int) ([]uuid.UUID, error) {
+	rows, errQ := ps.database.QueryContext(ctx, `
+		SELECT uuid FROM "user"
+			WHERE deletion_requested < $1
+			ORDER BY deletion_requested
+			LIMIT $2`, requestedBefore, limit)
+	if errQ != nil {
+		return nil, ErrUnexpected
+	}
+	defer rows.Close()
+	userUuids := make([]uuid.UUID, 0)
+	for rows.Next() {
+		var userUuid uuid.UUID
+		if errS := rows.Scan(&userUuid); errS != nil {
+			return nil, ErrUnexpected
+		}
+		userUuids = append(userUuids, userUuid)
+	}
+	if rows.Err() != nil {
+		return nil, ErrUnexpected
+	}
+	return userUuids, nil
+}
+
+// UPDATE /////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// UpdateUserDeletionRequested sets the time the user requested their account be deleted.
+func (ps *PgStore) UpdateUserDeletionRequested(ctx context.Context, userUuid uuid.UUID,
+	requested time.Time) error {
+	rs, errE := ps.database.ExecContext(ctx, `UPDATE "user" SET deletion_requested = $2 WHERE uuid = $1`,
+		userUuid, requested)
+	if errE != nil {
+		return ErrUnexpected
+	}
+	if ra, errRA := rs.RowsAffected(); errRA == nil && ra < 1 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// UpdateUserEncodedHash replaces the credential of the user with one holding the encoded hash.
+func (ps *PgStore) UpdateUserEncodedHash(ctx context.Context, userUuid uuid.UUID, encodedHash string) error {
+	exists, errUE := ps.userExists(ctx, userUuid)
+	if errUE != nil {
+		return ErrUnexpected
+	}
+	if !exists {
+		return ErrUserNotFound
+	}
+	errIT := ps.inTransaction(ctx, func(tx *sql.Tx) error {
+		_, errE := tx.ExecContext(ctx, `
+			DELETE FROM credential
+				WHERE uuid IN (SELECT credential_uuid FROM user_credential WHERE user_uuid = $1)`, userUuid)
+		if errE != nil {
+			return errE
+		}
+		return insertCredential(ctx, tx, userUuid, encodedHash)
+	})
+	if errIT != nil {
+		return ErrUnexpected
+	}
+	return nil
+}
+
+// DELETE /////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// DeleteUser removes the user from the database, along with everything associated with them.
+func (ps *PgStore) DeleteUser(ctx context.Context, userUuid uuid.UUID) error {
+	rs, errE := ps.database.ExecContext(ctx, `DELETE FROM "user" WHERE uuid = $1`, userUuid)
+	if errE != nil {
+		return ErrUnexpected
+	}
+	if ra, errRA := rs.RowsAffected(); errRA == nil && ra < 1 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// DeleteUserDeletionRequested cancels the deletion the user requested, if it was requested after requestedAfter.
+func (ps *PgStore) DeleteUserDeletionRequested(ctx context.Context, userUuid uuid.UUID,
+	requestedAfter time.Time) (bool, error) {
+	canceled := false
+	errIT := ps.inTransaction(ctx, func(tx *sql.Tx) error {
+		var requested sql.NullTime
+		errQ := tx.QueryRowContext(ctx, `SELECT deletion_requested FROM "user" WHERE uuid = $1 FOR UPDATE`,
+			userUuid).Scan(&requested)
+		if errQ == sql.ErrNoRows {
+			return ErrUserNotFound
+		} else if errQ != nil {
+			return errQ
+		}
+		if !requested.Valid {
+			return nil
+		}
+		if requested.Time.Before(requestedAfter) {
+			return ErrDeletionGracePassed
+		}
+		if _, errE := tx.ExecContext(ctx, `UPDATE "user" SET deletion_requested = NULL WHERE uuid = $1`,
+			userUuid); errE != nil {
+			return errE
+		}
+		canceled = true
+		return nil
+	})
+	if errIT == ErrUserNotFound || errIT == ErrDeletionGracePassed {
+		return false, errIT
+	} else if errIT != nil {
+		return false, ErrUnexpected
+	}
+	return canceled, nil
+}
+
+// userExists returns true if the user is in the database.
+func (ps *PgStore) userExists(ctx context.Context, userUuid uuid.UUID) (bool, error) {
+	exists := false
+	errQ := ps.database.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM "user" WHERE uuid = $1)`,
+		userUuid).Scan(&exists)
+	return exists, errQ
+}
+
+// inTransaction runs fn in a transaction, which is committed if fn succeeds and rolled back if not.
+func (ps *PgStore) inTransaction(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, errB := ps.database.BeginTx(ctx, nil)
+	if errB != nil {
+		return errB
+	}
+	if errF := fn(tx); errF != nil {
+		_ = tx.Rollback()
+		return errF
+	}
+	return tx.Commit()
+}
+
+// queryRows runs the query, which takes the uuid of a user, in tx and calls scan for each row returned.
+func queryRows(ctx context.Context, tx *sql.Tx, query string, userUuid uuid.UUID,
+	scan func(rows *sql.Rows) error) error {
+	rows, errQ := tx.QueryContext(ctx, query, userUuid)
+	if errQ != nil {
+		return errQ
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if errS := scan(rows); errS != nil {
+			return errS
+		}
+	}
+	return rows.Err()
+}
+
+// insertCredential creates a credential holding the encoded hash, and associates it with the user.
+func insertCredential(ctx context.Context, tx *sql.Tx, userUuid uuid.UUID, encodedHash string) error {
+	_, errE := tx.ExecContext(ctx, `
+		WITH c AS (INSERT INTO credential (encoded_hash) VALUES ($2) RETURNING uuid)
+		INSERT INTO user_credential (user_uuid, credential_uuid) SELECT $1, uuid FROM c`, userUuid, encodedHash)
+	return errE
+}
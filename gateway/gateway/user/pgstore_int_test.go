@@ -0,0 +1,66 @@
+// +build all integration
+
+package user
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net"
+	"net/url"
+	"testing"
+
+	_ "github.com/lib/pq"
+
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/migration"
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/utility"
+)
+
+// All tests rely on an active connection to a postgres database, which the migrations are applied to.
+func TestPgStore(t *testing.T) {
+	db := setupPgConnection()
+	defer db.Close()
+	pgStore, errNPS := NewPgStore(db)
+	if errNPS != nil {
+		t.Fatal(errNPS)
+	}
+	t.Run("TestPgStore_BasicCRUD", testStoreBasicCRUD(pgStore))
+}
+
+func setupPgConnection() *sql.DB {
+	env := map[string]string{}
+	for _, name := range []string{"POSTGRES_HOST", "POSTGRES_PORT", "POSTGRES_USERNAME", "POSTGRES_PASSWORD",
+		"POSTGRES_DATABASE"} {
+		value, errRE := utility.RequireEnv(name)
+		// Fail if the value is not provided
+		if errRE != nil {
+			log.Fatal(errRE)
+		}
+		env[name] = value
+	}
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(env["POSTGRES_USERNAME"], env["POSTGRES_PASSWORD"]),
+		Host:     net.JoinHostPort(env["POSTGRES_HOST"], env["POSTGRES_PORT"]),
+		Path:     "/" + env["POSTGRES_DATABASE"],
+		RawQuery: "sslmode=disable",
+	}
+
+	pgDb, errO := sql.Open("postgres", dsn.String())
+	if errO != nil {
+		log.Fatalf("unexpected error connecting to postgres: %s", errO)
+	}
+	if errP := pgDb.Ping(); errP != nil {
+		log.Fatalf("unable to ping postgres: %s", errP)
+	}
+
+	migrations, errE := migration.Embedded(migration.Postgres)
+	if errE != nil {
+		log.Fatal(errE)
+	}
+	runner := migration.NewRunner(pgDb, migration.Postgres, migrations)
+	if _, errA := runner.Apply(context.Background(), func(*migration.Migration, bool) {}); errA != nil {
+		log.Fatalf("unable to apply migrations: %s", errA)
+	}
+	return pgDb
+}
@@ -1,7 +1,9 @@
 package user
 
 import (
+	"context"
 	"errors"
+	"time"
 
 	uuid "github.com/satori/go.uuid"
 )
@@ -11,11 +13,23 @@ var ErrDidNotComplete = errors.New("database operation did not complete")
 var ErrUserNotFound = errors.New("user not found")
 var ErrUserAlreadyExists = errors.New("user already exists")
 var ErrUsernameUnavailable = errors.New("username not available")
+var ErrRoleAlreadyGranted = errors.New("role already granted to user")
+
+// ErrDeletionGracePassed is returned when the deletion of a user can no longer be canceled, as it was requested
+// before the grace period to restore the account.
+var ErrDeletionGracePassed = errors.New("user deletion can no longer be canceled")
 
 var ErrPreparingQuery = errors.New("issue preparing query")
 
 var ErrUnexpected = errors.New("unexpected error occurred")
 
+// ErrTimeout is returned when the deadline of a call passed before the operation completed.
+var ErrTimeout = errors.New("user store: operation timed out")
+
+// ErrCanceled is returned when the context of a call was canceled before the operation completed,
+// such as when the client of the request closed the connection.
+var ErrCanceled = errors.New("user store: operation canceled")
+
 //var ErrSessionUuidDoesNotExist = errors.New("session does not exist")
 //var ErrSessionUuidAlreadyExists = errors.New("session does not exist")
 
@@ -23,6 +37,8 @@ var ErrUnexpected = errors.New("unexpected error occurred")
 //
 // Store abstracts the common actions involving the database for users,
 // abstracting the underlying interaction with the database.
+//
+// Every operation takes the context of the request it is made for, and should stop when the context is done.
 type Store interface {
 	// CREATE /////////////////////////////////////////////////////////////////////////////////////////////////////////
 
@@ -36,11 +52,14 @@ type Store interface {
 	//TODO: CreateUserSessionAssociation(userUuid uuid.UUID, sessionUuid uuid.UUID) error
 
 	// CreateUser will add the new user to the database
-	CreateUser(newUser *NewUser) (*User, error)
+	CreateUser(ctx context.Context, newUser *NewUser) (*User, error)
 
 	// CreateUserEmail adds the email to the given user's account
 	//TODO: CreateUserEmail(userUuid uuid.UUID, email string) error
 
+	// CreateUserRole grants the role to the given user.
+	CreateUserRole(ctx context.Context, userUuid uuid.UUID, role string) error
+
 	// READ /////////////////////////////////////////////////////////////////////////////////////////////////////////
 
 	// ReadProcedureVersion gets the procedure version implemented in the database.
@@ -62,10 +81,13 @@ type Store interface {
 	//TODO: ReadUserEmails(userUuid uuid.UUID) (TODO: define type, error)
 
 	// ReadUserEncodedHash gets the encoded hash of the users password.
-	ReadUserEncodedHash(username string) (string, error)
+	ReadUserEncodedHash(ctx context.Context, username string) (string, error)
 
 	// ReadUserInfo gets the basic information about the user.
-	ReadUserInfo(userUuid uuid.UUID) (*User, error)
+	ReadUserInfo(ctx context.Context, userUuid uuid.UUID) (*User, error)
+
+	// ReadUserPersonalData gets the personal data held about the user, such as for the user to export.
+	ReadUserPersonalData(ctx context.Context, userUuid uuid.UUID) (*PersonalData, error)
 
 	// ReadUserProfile gets the profile information for the user.
 	//TODO: ReadUserProfile(userUuid uuid.UUID) (TODO: define type, error)
@@ -76,19 +98,30 @@ type Store interface {
 	// ReadUserUsernamesByEmail gets the usernames associated with a given email.
 	//TODO: ReadUserUsernamesByEmail(email string) (TODO: define type, error)
 
+	// ReadUserRoles gets the roles granted to the user, ordered by name.
+	ReadUserRoles(ctx context.Context, userUuid uuid.UUID) ([]string, error)
+
 	// ReadUserUuid gets the uuid for the user based on the given username.
-	ReadUserUuid(username string) (*uuid.UUID, error)
+	ReadUserUuid(ctx context.Context, username string) (*uuid.UUID, error)
+
+	// ReadUsersDeletionRequested gets the uuids of up to limit users who requested their account be deleted
+	// before requestedBefore, oldest request first.
+	ReadUsersDeletionRequested(ctx context.Context, requestedBefore time.Time, limit int) ([]uuid.UUID, error)
 
 	// UPDATE /////////////////////////////////////////////////////////////////////////////////////////////////////////
 
 	// UpdateSessionExpired sets the given session's status to "Expired".
 	//TODO: UpdateSessionExpired(sessionUuid uuid.UUID) error
 
+	// UpdateUserDeletionRequested sets the time the user requested their account be deleted,
+	// which marks the account pending deletion until it is purged, or the deletion is canceled.
+	UpdateUserDeletionRequested(ctx context.Context, userUuid uuid.UUID, requested time.Time) error
+
 	// UpdateUserDisplayName updates the display name of the user.
 	//TODO: UpdateUserDisplayName(displayName string) error
 
 	// UpdateUserEncodedHash updates the encoded hash associated with the user.
-	//TODO: UpdateUserEncodedHash(userUuid uuid.UUID, encodedHash string) error
+	UpdateUserEncodedHash(ctx context.Context, userUuid uuid.UUID, encodedHash string) error
 
 	// UpdateUserFullName updates the full name of the user.
 	//TODO: UpdateUserFullName(userUuid uuid.UUID, fullName string) error
@@ -117,7 +150,12 @@ type Store interface {
 	// DELETE /////////////////////////////////////////////////////////////////////////////////////////////////////////
 
 	// DeleteUser removes the user from the database.
-	DeleteUser(userUuid uuid.UUID) error
+	DeleteUser(ctx context.Context, userUuid uuid.UUID) error
+
+	// DeleteUserDeletionRequested cancels the deletion the user requested, restoring their account.
+	// Returns true if a deletion was canceled, or false if the user had not requested deletion.
+	// Returns ErrDeletionGracePassed if the deletion was requested before requestedAfter.
+	DeleteUserDeletionRequested(ctx context.Context, userUuid uuid.UUID, requestedAfter time.Time) (bool, error)
 
 	// DeleteUserEmail removes the given email from the users account.
 	//TODO: DeleteUserEmail(userUuid uuid.UUID, email string)
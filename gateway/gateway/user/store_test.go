@@ -0,0 +1,188 @@
+// +build all unit integration
+
+package user
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// testStoreBasicCRUD runs tests designed to go through the basic CRUD ("Create Read Update Delete") cycle
+// of a Store, which every Store must pass, whether it is held in memory or backed by a database.
+func testStoreBasicCRUD(store Store) func(*testing.T) {
+	return func(t *testing.T) {
+		ctx := context.Background()
+		encodedHash, errCEH := CreateEncodedHash("TestIngPasswordHash")
+		if errCEH != nil {
+			t.Fatalf("unexpected error has occured when setting up test: error:%s", errCEH)
+		}
+		updatedHash, errCEHU := CreateEncodedHash("UpdatedTestIngPasswordHash")
+		if errCEHU != nil {
+			t.Fatalf("unexpected error has occured when setting up test: error:%s", errCEHU)
+		}
+		newUser := NewUser{
+			Username:    fmt.Sprintf("TestUserName%d", time.Now().UnixNano()),
+			FullName:    "The Full User Name",
+			DisplayName: "Andrew",
+			EncodedHash: encodedHash,
+		}
+		newUser.PrepNewUser()
+		if errVNU := newUser.ValidateNewUser(); errVNU != nil {
+			t.Fatalf("unexpected error has occured when setting up test: error:%s", errVNU)
+		}
+
+		// Create
+		user, errCU := store.CreateUser(ctx, &newUser)
+		if errCU != nil {
+			t.Fatalf("error not expected creating user, but error occured: %s", errCU)
+		}
+		if user.Username != newUser.Username || user.DisplayName != newUser.DisplayName {
+			t.Fatalf("user returned when creating user does not match expected user:\nuser returned:\n%+v\n"+
+				"expected user:\n%+v", user, newUser)
+		}
+		defer func() { _ = store.DeleteUser(ctx, user.Uuid) }()
+
+		sameUsername := newUser
+		sameUsername.Username = strings.ToUpper(newUser.Username)
+		if _, errCUD := store.CreateUser(ctx, &sameUsername); errCUD != ErrUsernameUnavailable {
+			t.Errorf("expected ErrUsernameUnavailable creating a user with a taken username in another case, "+
+				"but got: %v", errCUD)
+		}
+
+		if errCUR := store.CreateUserRole(ctx, user.Uuid, "admin"); errCUR != nil {
+			t.Errorf("error not expected granting role, but error occured: %s", errCUR)
+		}
+		if errCUR := store.CreateUserRole(ctx, user.Uuid, "admin"); errCUR != ErrRoleAlreadyGranted {
+			t.Errorf("expected ErrRoleAlreadyGranted granting a role twice, but got: %v", errCUR)
+		}
+
+		// Read
+		userRead, errRUI := store.ReadUserInfo(ctx, user.Uuid)
+		if errRUI != nil {
+			t.Errorf("error not expected reading user, but error occured: %s", errRUI)
+		} else if *userRead != *user {
+			t.Errorf("user returned when reading user does not match expected user:\nuser returned:\n%+v\n"+
+				"expected user:\n%+v", userRead, user)
+		}
+
+		userUuid, errRUU := store.ReadUserUuid(ctx, newUser.Username)
+		if errRUU != nil {
+			t.Errorf("error not expected reading user uuid, but error occured: %s", errRUU)
+		} else if *userUuid != user.Uuid {
+			t.Errorf("expected uuid %s reading user uuid, but got %s", user.Uuid, userUuid)
+		}
+
+		hash, errRUEH := store.ReadUserEncodedHash(ctx, newUser.Username)
+		if errRUEH != nil || hash != encodedHash {
+			t.Errorf("expected the encoded hash the user was created with, but got %q, error: %v", hash, errRUEH)
+		}
+
+		roles, errRUR := store.ReadUserRoles(ctx, user.Uuid)
+		if errRUR != nil || len(roles) != 1 || roles[0] != "admin" {
+			t.Errorf("expected the user to be granted [admin], but got %v, error: %v", roles, errRUR)
+		}
+
+		data, errRUPD := store.ReadUserPersonalData(ctx, user.Uuid)
+		if errRUPD != nil {
+			t.Errorf("error not expected reading personal data, but error occured: %s", errRUPD)
+		} else {
+			expectedAccount := Account{Uuid: user.Uuid, Username: newUser.Username, FullName: newUser.FullName,
+				DisplayName: newUser.DisplayName}
+			if data.Account != expectedAccount {
+				t.Errorf("account returned when reading personal data does not match expected account:\n"+
+					"account returned:\n%+v\nexpected account:\n%+v", data.Account, expectedAccount)
+			}
+			if len(data.Roles) != 1 || data.Roles[0] != "admin" {
+				t.Errorf("expected personal data to include the role [admin], but got %v", data.Roles)
+			}
+			if data.Sharing != (ProfileSharing{}) {
+				t.Errorf("expected the profile of a new user not to be shared, but got %+v", data.Sharing)
+			}
+			if data.Emails == nil || data.Sessions == nil {
+				t.Errorf("expected emails and sessions to be empty, not nil, so they are exported as []")
+			}
+		}
+
+		// Update
+		if errUUEH := store.UpdateUserEncodedHash(ctx, user.Uuid, updatedHash); errUUEH != nil {
+			t.Errorf("error not expected updating encoded hash, but error occured: %s", errUUEH)
+		}
+		hash, errRUEH = store.ReadUserEncodedHash(ctx, newUser.Username)
+		if errRUEH != nil || hash != updatedHash {
+			t.Errorf("expected the updated encoded hash, but got %q, error: %v", hash, errRUEH)
+		}
+
+		// Deletion requested
+		requested := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+		if errUUDR := store.UpdateUserDeletionRequested(ctx, user.Uuid, requested); errUUDR != nil {
+			t.Errorf("error not expected requesting deletion, but error occured: %s", errUUDR)
+		}
+		if !containsUuid(t, store, requested.Add(time.Second), user.Uuid) {
+			t.Errorf("expected the user to be read as pending deletion once deletion was requested")
+		}
+		if containsUuid(t, store, requested, user.Uuid) {
+			t.Errorf("expected the user not to be read as pending deletion before the time it was requested")
+		}
+		if _, errDUDR := store.DeleteUserDeletionRequested(ctx, user.Uuid,
+			requested.Add(time.Minute)); errDUDR != ErrDeletionGracePassed {
+			t.Errorf("expected ErrDeletionGracePassed canceling a deletion requested before the grace period, "+
+				"but got: %v", errDUDR)
+		}
+		canceled, errDUDR := store.DeleteUserDeletionRequested(ctx, user.Uuid, requested.Add(-time.Minute))
+		if errDUDR != nil || !canceled {
+			t.Errorf("expected the deletion to be canceled within the grace period, but got %t, error: %v",
+				canceled, errDUDR)
+		}
+		canceled, errDUDR = store.DeleteUserDeletionRequested(ctx, user.Uuid, requested.Add(-time.Minute))
+		if errDUDR != nil || canceled {
+			t.Errorf("expected no deletion to cancel once canceled, but got %t, error: %v", canceled, errDUDR)
+		}
+		if containsUuid(t, store, time.Now().UTC().Add(time.Minute), user.Uuid) {
+			t.Errorf("expected the user not to be read as pending deletion once the deletion was canceled")
+		}
+
+		// Delete
+		if errDU := store.DeleteUser(ctx, user.Uuid); errDU != nil {
+			t.Fatalf("error not expected deleting user, but error occured: %s", errDU)
+		}
+		if _, errRUI := store.ReadUserInfo(ctx, user.Uuid); errRUI != ErrUserNotFound {
+			t.Errorf("expected ErrUserNotFound reading a deleted user, but got: %v", errRUI)
+		}
+		if _, errRUPD := store.ReadUserPersonalData(ctx, user.Uuid); errRUPD != ErrUserNotFound {
+			t.Errorf("expected ErrUserNotFound reading the personal data of a deleted user, but got: %v", errRUPD)
+		}
+		if _, errRUU := store.ReadUserUuid(ctx, newUser.Username); errRUU != ErrUserNotFound {
+			t.Errorf("expected ErrUserNotFound reading the uuid of a deleted user, but got: %v", errRUU)
+		}
+		if errDU := store.DeleteUser(ctx, user.Uuid); errDU != ErrUserNotFound {
+			t.Errorf("expected ErrUserNotFound deleting a deleted user, but got: %v", errDU)
+		}
+		if errUUDR := store.UpdateUserDeletionRequested(ctx, user.Uuid, requested); errUUDR != ErrUserNotFound {
+			t.Errorf("expected ErrUserNotFound requesting deletion of a deleted user, but got: %v", errUUDR)
+		}
+		if _, errDUDR := store.DeleteUserDeletionRequested(ctx, user.Uuid, requested); errDUDR != ErrUserNotFound {
+			t.Errorf("expected ErrUserNotFound canceling the deletion of a deleted user, but got: %v", errDUDR)
+		}
+	}
+}
+
+// containsUuid returns true if userUuid is one of the users store reads as having requested deletion before
+// requestedBefore. Other tests may share the store, so every such user is read.
+func containsUuid(t *testing.T, store Store, requestedBefore time.Time, userUuid uuid.UUID) bool {
+	userUuids, errRUDR := store.ReadUsersDeletionRequested(context.Background(), requestedBefore, 1000)
+	if errRUDR != nil {
+		t.Errorf("error not expected reading users pending deletion, but error occured: %s", errRUDR)
+		return false
+	}
+	for _, requested := range userUuids {
+		if uuid.Equal(requested, userUuid) {
+			return true
+		}
+	}
+	return false
+}
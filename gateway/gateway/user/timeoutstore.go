@@ -0,0 +1,183 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// operations are the names of the operations of a Store, which may be given their own timeout.
+var operations = map[string]bool{"CreateUser": true, "CreateUserRole": true, "ReadUserEncodedHash": true,
+	"ReadUserInfo": true, "ReadUserPersonalData": true, "ReadUserRoles": true, "ReadUserUuid": true,
+	"ReadUsersDeletionRequested": true, "UpdateUserDeletionRequested": true, "UpdateUserEncodedHash": true,
+	"DeleteUser": true, "DeleteUserDeletionRequested": true}
+
+// Timeouts are the time allowed for calls to a Store, by operation.
+type Timeouts struct {
+	// Default is the time allowed for an operation which is not in Operations.
+	// Zero allows a call as long as its context does.
+	Default time.Duration
+	// Operations are the time allowed for each operation, by method name, such as "ReadUserInfo".
+	Operations map[string]time.Duration
+}
+
+// Validate returns an error if a timeout of an operation is negative, or is given for an operation the Store
+// does not have.
+func (t Timeouts) Validate() error {
+	for operation, timeout := range t.Operations {
+		if !operations[operation] {
+			return fmt.Errorf("unknown operation %s", operation)
+		}
+		if timeout < 0 {
+			return fmt.Errorf("timeout of %s must not be negative", operation)
+		}
+	}
+	return nil
+}
+
+// For returns the time allowed for a call to operation.
+func (t Timeouts) For(operation string) time.Duration {
+	if timeout, ok := t.Operations[operation]; ok {
+		return timeout
+	}
+	return t.Default
+}
+
+// TimeoutStore represents a user.Store which gives each call to the wrapped Store a deadline,
+// and returns ErrTimeout or ErrCanceled for a call which failed because its context was done.
+type TimeoutStore struct {
+	next     Store
+	timeouts Timeouts
+}
+
+// NewTimeoutStore constructs a new TimeoutStore wrapping next, with the deadline of each call set by timeouts.
+func NewTimeoutStore(next Store, timeouts Timeouts) *TimeoutStore {
+	if next == nil {
+		panic("no store provided")
+	}
+	return &TimeoutStore{next: next, timeouts: timeouts}
+}
+
+// CreateUser will add the new user to the wrapped store.
+func (ts *TimeoutStore) CreateUser(ctx context.Context, newUser *NewUser) (*User, error) {
+	ctx, cancel := ts.withTimeout(ctx, "CreateUser")
+	defer cancel()
+	usr, err := ts.next.CreateUser(ctx, newUser)
+	return usr, contextError(ctx, err)
+}
+
+// CreateUserRole grants the role to the given user in the wrapped store.
+func (ts *TimeoutStore) CreateUserRole(ctx context.Context, userUuid uuid.UUID, role string) error {
+	ctx, cancel := ts.withTimeout(ctx, "CreateUserRole")
+	defer cancel()
+	return contextError(ctx, ts.next.CreateUserRole(ctx, userUuid, role))
+}
+
+// ReadUserEncodedHash gets the encoded hash of the users password.
+func (ts *TimeoutStore) ReadUserEncodedHash(ctx context.Context, username string) (string, error) {
+	ctx, cancel := ts.withTimeout(ctx, "ReadUserEncodedHash")
+	defer cancel()
+	encodedHash, err := ts.next.ReadUserEncodedHash(ctx, username)
+	return encodedHash, contextError(ctx, err)
+}
+
+// ReadUserInfo gets the basic information about the user.
+func (ts *TimeoutStore) ReadUserInfo(ctx context.Context, userUuid uuid.UUID) (*User, error) {
+	ctx, cancel := ts.withTimeout(ctx, "ReadUserInfo")
+	defer cancel()
+	usr, err := ts.next.ReadUserInfo(ctx, userUuid)
+	return usr, contextError(ctx, err)
+}
+
+// ReadUserPersonalData gets the personal data held about the user.
+func (ts *TimeoutStore) ReadUserPersonalData(ctx context.Context, userUuid uuid.UUID) (*PersonalData, error) {
+	ctx, cancel := ts.withTimeout(ctx, "ReadUserPersonalData")
+	defer cancel()
+	data, err := ts.next.ReadUserPersonalData(ctx, userUuid)
+	return data, contextError(ctx, err)
+}
+
+// ReadUserRoles gets the roles granted to the user, ordered by name.
+func (ts *TimeoutStore) ReadUserRoles(ctx context.Context, userUuid uuid.UUID) ([]string, error) {
+	ctx, cancel := ts.withTimeout(ctx, "ReadUserRoles")
+	defer cancel()
+	roles, err := ts.next.ReadUserRoles(ctx, userUuid)
+	return roles, contextError(ctx, err)
+}
+
+// ReadUserUuid gets the uuid for the user based on the given username.
+func (ts *TimeoutStore) ReadUserUuid(ctx context.Context, username string) (*uuid.UUID, error) {
+	ctx, cancel := ts.withTimeout(ctx, "ReadUserUuid")
+	defer cancel()
+	userUuid, err := ts.next.ReadUserUuid(ctx, username)
+	return userUuid, contextError(ctx, err)
+}
+
+// ReadUsersDeletionRequested gets the uuids of up to limit users who requested their account be deleted
+// before requestedBefore, oldest request first.
+func (ts *TimeoutStore) ReadUsersDeletionRequested(ctx context.Context, requestedBefore time.Time,
+	limit int) ([]uuid.UUID, error) {
+	ctx, cancel := ts.withTimeout(ctx, "ReadUsersDeletionRequested")
+	defer cancel()
+	userUuids, err := ts.next.ReadUsersDeletionRequested(ctx, requestedBefore, limit)
+	return userUuids, contextError(ctx, err)
+}
+
+// UpdateUserDeletionRequested sets the time the user requested their account be deleted in the wrapped store.
+func (ts *TimeoutStore) UpdateUserDeletionRequested(ctx context.Context, userUuid uuid.UUID,
+	requested time.Time) error {
+	ctx, cancel := ts.withTimeout(ctx, "UpdateUserDeletionRequested")
+	defer cancel()
+	return contextError(ctx, ts.next.UpdateUserDeletionRequested(ctx, userUuid, requested))
+}
+
+// UpdateUserEncodedHash updates the encoded hash associated with the user in the wrapped store.
+func (ts *TimeoutStore) UpdateUserEncodedHash(ctx context.Context, userUuid uuid.UUID, encodedHash string) error {
+	ctx, cancel := ts.withTimeout(ctx, "UpdateUserEncodedHash")
+	defer cancel()
+	return contextError(ctx, ts.next.UpdateUserEncodedHash(ctx, userUuid, encodedHash))
+}
+
+// DeleteUser removes the user from the wrapped store.
+func (ts *TimeoutStore) DeleteUser(ctx context.Context, userUuid uuid.UUID) error {
+	ctx, cancel := ts.withTimeout(ctx, "DeleteUser")
+	defer cancel()
+	return contextError(ctx, ts.next.DeleteUser(ctx, userUuid))
+}
+
+// DeleteUserDeletionRequested cancels the deletion the user requested in the wrapped store.
+func (ts *TimeoutStore) DeleteUserDeletionRequested(ctx context.Context, userUuid uuid.UUID,
+	requestedAfter time.Time) (bool, error) {
+	ctx, cancel := ts.withTimeout(ctx, "DeleteUserDeletionRequested")
+	defer cancel()
+	canceled, err := ts.next.DeleteUserDeletionRequested(ctx, userUuid, requestedAfter)
+	return canceled, contextError(ctx, err)
+}
+
+// withTimeout returns ctx with the deadline of a call to operation, if it has a timeout.
+func (ts *TimeoutStore) withTimeout(ctx context.Context, operation string) (context.Context, context.CancelFunc) {
+	if timeout := ts.timeouts.For(operation); timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// contextError returns ErrTimeout or ErrCanceled in place of err if the call failed because ctx is done,
+// as MsSqlStore reports it as an unexpected error.
+// A user which is not found, or already exists, or a role already granted, or a deletion which can no longer be
+// canceled, is an outcome, so is kept.
+func contextError(ctx context.Context, err error) error {
+	if err == nil || err == ErrUserNotFound || err == ErrUserAlreadyExists || err == ErrUsernameUnavailable ||
+		err == ErrRoleAlreadyGranted || err == ErrDeletionGracePassed {
+		return err
+	}
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		return ErrTimeout
+	case context.Canceled:
+		return ErrCanceled
+	}
+	return err
+}
@@ -0,0 +1,135 @@
+package user
+
+import (
+	"context"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName identifies the spans created by this package.
+const tracerName = "github.com/uw-thalesians/perceptia-servers/gateway/gateway/user"
+
+// TracedStore represents a user.Store which records a span for each call to the wrapped Store,
+// as a child of the span in the context of the call.
+type TracedStore struct {
+	next Store
+}
+
+// NewTracedStore constructs a new TracedStore wrapping next.
+func NewTracedStore(next Store) *TracedStore {
+	if next == nil {
+		panic("no store provided")
+	}
+	return &TracedStore{next: next}
+}
+
+// CreateUser will add the new user to the wrapped store.
+func (ts *TracedStore) CreateUser(ctx context.Context, newUser *NewUser) (usr *User, err error) {
+	ctx, span := ts.start(ctx, "CreateUser")
+	defer end(span, &err)
+	return ts.next.CreateUser(ctx, newUser)
+}
+
+// CreateUserRole grants the role to the given user in the wrapped store.
+func (ts *TracedStore) CreateUserRole(ctx context.Context, userUuid uuid.UUID, role string) (err error) {
+	ctx, span := ts.start(ctx, "CreateUserRole")
+	defer end(span, &err)
+	return ts.next.CreateUserRole(ctx, userUuid, role)
+}
+
+// ReadUserEncodedHash gets the encoded hash of the users password.
+func (ts *TracedStore) ReadUserEncodedHash(ctx context.Context, username string) (encodedHash string, err error) {
+	ctx, span := ts.start(ctx, "ReadUserEncodedHash")
+	defer end(span, &err)
+	return ts.next.ReadUserEncodedHash(ctx, username)
+}
+
+// ReadUserInfo gets the basic information about the user.
+func (ts *TracedStore) ReadUserInfo(ctx context.Context, userUuid uuid.UUID) (usr *User, err error) {
+	ctx, span := ts.start(ctx, "ReadUserInfo")
+	defer end(span, &err)
+	return ts.next.ReadUserInfo(ctx, userUuid)
+}
+
+// ReadUserPersonalData gets the personal data held about the user.
+func (ts *TracedStore) ReadUserPersonalData(ctx context.Context, userUuid uuid.UUID) (data *PersonalData, err error) {
+	ctx, span := ts.start(ctx, "ReadUserPersonalData")
+	defer end(span, &err)
+	return ts.next.ReadUserPersonalData(ctx, userUuid)
+}
+
+// ReadUserRoles gets the roles granted to the user, ordered by name.
+func (ts *TracedStore) ReadUserRoles(ctx context.Context, userUuid uuid.UUID) (roles []string, err error) {
+	ctx, span := ts.start(ctx, "ReadUserRoles")
+	defer end(span, &err)
+	return ts.next.ReadUserRoles(ctx, userUuid)
+}
+
+// ReadUserUuid gets the uuid for the user based on the given username.
+func (ts *TracedStore) ReadUserUuid(ctx context.Context, username string) (userUuid *uuid.UUID, err error) {
+	ctx, span := ts.start(ctx, "ReadUserUuid")
+	defer end(span, &err)
+	return ts.next.ReadUserUuid(ctx, username)
+}
+
+// ReadUsersDeletionRequested gets the uuids of up to limit users who requested their account be deleted
+// before requestedBefore, oldest request first.
+func (ts *TracedStore) ReadUsersDeletionRequested(ctx context.Context, requestedBefore time.Time,
+	limit int) (userUuids []uuid.UUID, err error) {
+	ctx, span := ts.start(ctx, "ReadUsersDeletionRequested")
+	defer end(span, &err)
+	return ts.next.ReadUsersDeletionRequested(ctx, requestedBefore, limit)
+}
+
+// UpdateUserDeletionRequested sets the time the user requested their account be deleted in the wrapped store.
+func (ts *TracedStore) UpdateUserDeletionRequested(ctx context.Context, userUuid uuid.UUID,
+	requested time.Time) (err error) {
+	ctx, span := ts.start(ctx, "UpdateUserDeletionRequested")
+	defer end(span, &err)
+	return ts.next.UpdateUserDeletionRequested(ctx, userUuid, requested)
+}
+
+// UpdateUserEncodedHash updates the encoded hash associated with the user in the wrapped store.
+func (ts *TracedStore) UpdateUserEncodedHash(ctx context.Context, userUuid uuid.UUID, encodedHash string) (err error) {
+	ctx, span := ts.start(ctx, "UpdateUserEncodedHash")
+	defer end(span, &err)
+	return ts.next.UpdateUserEncodedHash(ctx, userUuid, encodedHash)
+}
+
+// DeleteUser removes the user from the wrapped store.
+func (ts *TracedStore) DeleteUser(ctx context.Context, userUuid uuid.UUID) (err error) {
+	ctx, span := ts.start(ctx, "DeleteUser")
+	defer end(span, &err)
+	return ts.next.DeleteUser(ctx, userUuid)
+}
+
+// DeleteUserDeletionRequested cancels the deletion the user requested in the wrapped store.
+func (ts *TracedStore) DeleteUserDeletionRequested(ctx context.Context, userUuid uuid.UUID,
+	requestedAfter time.Time) (canceled bool, err error) {
+	ctx, span := ts.start(ctx, "DeleteUserDeletionRequested")
+	defer end(span, &err)
+	return ts.next.DeleteUserDeletionRequested(ctx, userUuid, requestedAfter)
+}
+
+// start begins a span for a call to method, returning it and the context to make the call with, so work done
+// by the call is part of the span.
+func (ts *TracedStore) start(ctx context.Context, method string) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, "user.Store/"+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemMSSQL, semconv.DBOperation(method)))
+}
+
+// end records err on the span, if it is unexpected, and ends it.
+func end(span trace.Span, err *error) {
+	if *err != nil && *err != ErrUserNotFound && *err != ErrUserAlreadyExists && *err != ErrUsernameUnavailable &&
+		*err != ErrRoleAlreadyGranted {
+		span.RecordError(*err)
+		span.SetStatus(codes.Error, (*err).Error())
+	}
+	span.End()
+}
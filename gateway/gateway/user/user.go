@@ -23,6 +23,7 @@ const (
 	ValidUsernameMaxLength    = 255
 	ValidFullNameMaxLength    = 255
 	ValidDisplayNameMaxLength = 255
+	ValidRoleMaxLength        = 50
 )
 
 const InvalidEncodedPasswordHash = ""
@@ -44,27 +45,32 @@ var (
 		ValidPasswordMinLength)
 
 	// ErrPasswordLengthGreaterThanMax used when the provided password is too long.
-	ErrPasswordLengthGreaterThanMax = errors.New("password must be no more than " +
-		string(ValidPasswordMaxLength) + " characters long")
+	ErrPasswordLengthGreaterThanMax = fmt.Errorf("password must be no more than %d characters long",
+		ValidPasswordMaxLength)
 
 	// ErrUsernameLengthLessThanMin used when the provided username is not long enough.
-	ErrUsernameLengthLessThanMin = errors.New("username must be at least " +
-		string(ValidUsernameMinLength) + " characters long")
+	ErrUsernameLengthLessThanMin = fmt.Errorf("username must be at least %d characters long",
+		ValidUsernameMinLength)
 
 	// ErrUsernameLengthGreaterThanMax used when the provided username is too long.
-	ErrUsernameLengthGreaterThanMax = errors.New("username must be no more than " +
-		string(ValidUsernameMaxLength) + " characters long")
+	ErrUsernameLengthGreaterThanMax = fmt.Errorf("username must be no more than %d characters long",
+		ValidUsernameMaxLength)
 
 	// ErrUserNameHasSpace used when the provided username has spaces.
 	ErrUserNameHasSpace = errors.New("username must not have any spaces")
 
 	// ErrFullNameLengthGreaterThanMax used when the provided fullName is too long.
-	ErrFullNameLengthGreaterThanMax = errors.New("full name must be no more than " +
-		string(ValidFullNameMaxLength) + " characters long")
+	ErrFullNameLengthGreaterThanMax = fmt.Errorf("full name must be no more than %d characters long",
+		ValidFullNameMaxLength)
 
 	// ErrDisplayNameLengthGreaterThanMax used when the provided displayName is too long.
-	ErrDisplayNameLengthGreaterThanMax = errors.New("display name must be no more than " +
-		string(ValidDisplayNameMaxLength) + " characters long")
+	ErrDisplayNameLengthGreaterThanMax = fmt.Errorf("display name must be no more than %d characters long",
+		ValidDisplayNameMaxLength)
+
+	// ErrInvalidRole used when the provided role is empty, too long, or has characters other than
+	// lowercase letters, digits, and hyphens.
+	ErrInvalidRole = fmt.Errorf("role must be 1 to %d lowercase letters, digits, or hyphens",
+		ValidRoleMaxLength)
 
 	// ErrHashNotFromPassword used when the provided password was not
 	// the password used to create the user's EncodedHash.
@@ -286,6 +292,20 @@ func ValidateDisplayName(displayName string) error {
 	return nil
 }
 
+// ValidateRole validates the provided role, such as "admin".
+// If valid, returns nil, otherwise an error.
+func ValidateRole(role string) error {
+	if len(role) == 0 || len(role) > ValidRoleMaxLength {
+		return ErrInvalidRole
+	}
+	for _, r := range role {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' {
+			return ErrInvalidRole
+		}
+	}
+	return nil
+}
+
 // generateFromPassword generates an encoded hash of the provided password
 // using the provided Argon2id parameters `p`.
 //
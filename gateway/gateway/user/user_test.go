@@ -2,7 +2,10 @@
 
 package user
 
-import "testing"
+import (
+	"strings"
+	"testing"
+)
 
 // TODO: Write tests for user
 
@@ -185,3 +188,32 @@ func TestNewUser_PrepNewUser(t *testing.T) {
 		})
 	}
 }
+
+// TestValidateRole is a unit test ensuring ValidateRole only accepts lowercase role names.
+func TestValidateRole(t *testing.T) {
+	tests := []struct {
+		name        string
+		role        string
+		detail      string
+		expectError bool
+	}{
+		{"Valid Role", "admin", "Lowercase letters are a valid role. Should return nil", false},
+		{"Hyphen And Digits", "support-2", "Hyphens and digits are allowed. Should return nil", false},
+		{"Empty", "", "A role must not be empty. Should return an error", true},
+		{"Uppercase", "Admin", "Roles are lowercase, so they can be compared exactly. Should return an error", true},
+		{"Space", "super admin", "A role must not have spaces. Should return an error", true},
+		{"Too Long", strings.Repeat("a", ValidRoleMaxLength+1), "A role must fit in the database. Should return an error",
+			true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			errVR := ValidateRole(test.role)
+			if test.expectError && errVR == nil {
+				t.Errorf("An error was expected, but none occured.\n\tDetail: %s", test.detail)
+			} else if !test.expectError && errVR != nil {
+				t.Errorf("An error was not expected, but one occured.\n\t"+
+					"Error: %s\n\tDetail: %s", errVR, test.detail)
+			}
+		})
+	}
+}
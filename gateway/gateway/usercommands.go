@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/go-redis/redis"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/audit"
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/config"
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/handler"
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/session"
+	"github.com/uw-thalesians/perceptia-servers/gateway/gateway/user"
+)
+
+// operations are the stores used by the user and session commands, which are the same as the gateway uses.
+type operations struct {
+	db           *sql.DB
+	rc           *redis.Client
+	userStore    user.Store
+	sessionStore *session.RedisStore
+	auditLog     *audit.Log
+}
+
+// openOperations connects to the database and redis of the configuration.
+// Audit events are recorded as the gateway records them, with failures logged to stderr.
+// Calls to the user store are allowed the time the configuration allows the gateway.
+func openOperations(cfg *config.Config, stderr io.Writer) (*operations, error) {
+	if cfg.DevMode {
+		return nil, errDevMode
+	}
+	d := databaseOf(cfg)
+	db, errOD := d.connect(d.username, d.password)
+	if errOD != nil {
+		return nil, errOD
+	}
+	userStore, errNMSS := d.userStore(db)
+	if errNMSS != nil {
+		_ = db.Close()
+		return nil, errNMSS
+	}
+	auditStore, errNAS := d.auditStore(db)
+	if errNAS != nil {
+		_ = db.Close()
+		return nil, errNAS
+	}
+	rc := redis.NewClient(&redis.Options{Addr: cfg.Redis.Address, Password: "", DB: 0})
+	logger := kitlog.NewLogfmtLogger(kitlog.NewSyncWriter(stderr))
+	return &operations{
+		db:           db,
+		rc:           rc,
+		userStore:    user.NewTimeoutStore(cachedUserStore(userStore, rc, cfg), cfg.Stores.User()),
+		sessionStore: session.NewRedisStore(rc, sessionDuration),
+		auditLog:     newAuditLog(logger, auditStore, cfg.Audit.File),
+	}, nil
+}
+
+// cachedUserStore wraps userStore in the cache the gateway reads users through, so users changed by a command
+// are invalidated as they are when changed by the gateway. Returns userStore if users are not cached.
+func cachedUserStore(userStore user.Store, rc *redis.Client, cfg *config.Config) user.Store {
+	if cfg.Stores.UserCacheTtl <= 0 {
+		return userStore
+	}
+	return user.NewCachedStore(userStore, rc, time.Duration(cfg.Stores.UserCacheTtl))
+}
+
+// Close closes the connections to the database and redis, and the audit log.
+func (ops *operations) Close() {
+	_ = ops.auditLog.Close()
+	_ = ops.db.Close()
+	_ = ops.rc.Close()
+}
+
+// runOperation parses the flags of a user or session command, and runs fn with the stores of the configuration.
+// The context given to fn is canceled on interrupt, so a command waiting on a store can be stopped.
+func runOperation(name string, args []string, stderr io.Writer, defineFlags func(flags *flagSet),
+	fn func(ctx context.Context, ops *operations) int) int {
+	flags, path := newFlagSet(name, stderr)
+	fs := &flagSet{FlagSet: flags}
+	defineFlags(fs)
+	if errP := flags.Parse(args); errP != nil {
+		return 2
+	}
+	if missing := fs.missing(); len(missing) != 0 {
+		_, _ = fmt.Fprintf(stderr, "%s: -%s must be set\n", name, missing)
+		return 2
+	}
+	cfg := loadConfig(*path, stderr)
+	if cfg == nil {
+		return 1
+	}
+	ops, errOO := openOperations(cfg, stderr)
+	if errOO != nil {
+		_, _ = fmt.Fprintln(stderr, errOO)
+		return 1
+	}
+	defer ops.Close()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	return fn(ctx, ops)
+}
+
+// readUserUuid gets the uuid of the user with the username, printing an error to stderr if it can not be read.
+func (ops *operations) readUserUuid(ctx context.Context, username string, stderr io.Writer) (uuid.UUID, bool) {
+	userUuid, errRUU := ops.userStore.ReadUserUuid(ctx, user.PrepUsername(username))
+	if errRUU != nil {
+		if errRUU == user.ErrUserNotFound {
+			_, _ = fmt.Fprintf(stderr, "no user has the username %s\n", username)
+		} else {
+			_, _ = fmt.Fprintf(stderr, "unable to read user: %s\n", errRUU)
+		}
+		return uuid.Nil, false
+	}
+	return *userUuid, true
+}
+
+// revokeUserSessions ends every authenticated session of the user, returning the number ended.
+func (ops *operations) revokeUserSessions(ctx context.Context, userUuid uuid.UUID, detail string) (int, error) {
+	return handler.RevokeUserSessions(ctx, ops.sessionStore, userUuid, func(state *handler.SessionState) {
+		ops.auditLog.Record(&audit.Event{Type: audit.EventSessionRevoked, UserUuid: userUuid,
+			SessionUuid: state.SessionUuid, Detail: detail})
+	})
+}
+
+// userCreate creates a user, with the password read from stdin.
+func userCreate(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	var username, fullName, displayName *string
+	return runOperation("user create", args, stderr, func(flags *flagSet) {
+		username = flags.required("username", "username of the new user")
+		fullName = flags.String("full-name", "", "full name of the new user")
+		displayName = flags.String("display-name", "", "display name of the new user")
+	}, func(ctx context.Context, ops *operations) int {
+		password, errRP := readPassword(stdin)
+		if errRP != nil {
+			_, _ = fmt.Fprintln(stderr, errRP)
+			return 1
+		}
+		encodedHash, errCEH := user.CreateEncodedHash(password)
+		if errCEH != nil {
+			_, _ = fmt.Fprintf(stderr, "invalid password: %s\n", errCEH)
+			return 1
+		}
+		newUser := &user.NewUser{Username: *username, FullName: *fullName, DisplayName: *displayName,
+			EncodedHash: encodedHash}
+		newUser.PrepNewUser()
+		if errVNU := newUser.ValidateNewUser(); errVNU != nil {
+			_, _ = fmt.Fprintf(stderr, "invalid user: %s\n", errVNU)
+			return 1
+		}
+		usr, errCU := ops.userStore.CreateUser(ctx, newUser)
+		if errCU != nil {
+			_, _ = fmt.Fprintf(stderr, "unable to create user: %s\n", errCU)
+			return 1
+		}
+		ops.auditLog.Record(&audit.Event{Type: audit.EventSignUp, UserUuid: usr.Uuid,
+			Detail: "created with the gateway user create command"})
+		_, _ = fmt.Fprintf(stdout, "created user %s with uuid %s\n", usr.Username, usr.Uuid)
+		return 0
+	})
+}
+
+// userResetPassword replaces the password of a user with one read from stdin, revoking their sessions
+// unless -keep-sessions is set, as a reset is usually needed because the password may be known to someone else.
+func userResetPassword(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	var username *string
+	var keepSessions *bool
+	return runOperation("user reset-password", args, stderr, func(flags *flagSet) {
+		username = flags.required("username", "username of the user")
+		keepSessions = flags.Bool("keep-sessions", false, "do not revoke the sessions of the user")
+	}, func(ctx context.Context, ops *operations) int {
+		password, errRP := readPassword(stdin)
+		if errRP != nil {
+			_, _ = fmt.Fprintln(stderr, errRP)
+			return 1
+		}
+		encodedHash, errCEH := user.CreateEncodedHash(password)
+		if errCEH != nil {
+			_, _ = fmt.Fprintf(stderr, "invalid password: %s\n", errCEH)
+			return 1
+		}
+		userUuid, ok := ops.readUserUuid(ctx, *username, stderr)
+		if !ok {
+			return 1
+		}
+		if errUUEH := ops.userStore.UpdateUserEncodedHash(ctx, userUuid, encodedHash); errUUEH != nil {
+			_, _ = fmt.Fprintf(stderr, "unable to reset password: %s\n", errUUEH)
+			return 1
+		}
+		ops.auditLog.Record(&audit.Event{Type: audit.EventPasswordChanged, UserUuid: userUuid,
+			Detail: "reset with the gateway user reset-password command"})
+		_, _ = fmt.Fprintf(stdout, "reset password of %s\n", *username)
+		if *keepSessions {
+			return 0
+		}
+		revoked, errRUS := ops.revokeUserSessions(ctx, userUuid, "revoked by the gateway user reset-password command")
+		if errRUS != nil {
+			_, _ = fmt.Fprintf(stderr, "unable to revoke sessions, %d revoked: %s\n", revoked, errRUS)
+			return 1
+		}
+		_, _ = fmt.Fprintf(stdout, "revoked %d sessions\n", revoked)
+		return 0
+	})
+}
+
+// userGrantRole grants a role to a user. Granting a role the user already has is not an error.
+func userGrantRole(args []string, _ io.Reader, stdout, stderr io.Writer) int {
+	var username, role *string
+	return runOperation("user grant-role", args, stderr, func(flags *flagSet) {
+		username = flags.required("username", "username of the user")
+		role = flags.required("role", "role to grant, such as admin")
+	}, func(ctx context.Context, ops *operations) int {
+		if errVR := user.ValidateRole(*role); errVR != nil {
+			_, _ = fmt.Fprintln(stderr, errVR)
+			return 1
+		}
+		userUuid, ok := ops.readUserUuid(ctx, *username, stderr)
+		if !ok {
+			return 1
+		}
+		errCUR := ops.userStore.CreateUserRole(ctx, userUuid, *role)
+		if errCUR != nil && errCUR != user.ErrRoleAlreadyGranted {
+			_, _ = fmt.Fprintf(stderr, "unable to grant role: %s\n", errCUR)
+			return 1
+		}
+		if errCUR == nil {
+			ops.auditLog.Record(&audit.Event{Type: audit.EventAdminAction, UserUuid: userUuid,
+				Detail: "granted role " + *role + " with the gateway user grant-role command"})
+		}
+		roles, errRUR := ops.userStore.ReadUserRoles(ctx, userUuid)
+		if errRUR != nil {
+			_, _ = fmt.Fprintf(stderr, "unable to read roles: %s\n", errRUR)
+			return 1
+		}
+		_, _ = fmt.Fprintf(stdout, "%s has roles: %s\n", *username, strings.Join(roles, ", "))
+		return 0
+	})
+}
+
+// sessionRevoke ends every session of a user.
+func sessionRevoke(args []string, _ io.Reader, stdout, stderr io.Writer) int {
+	var username *string
+	return runOperation("session revoke", args, stderr, func(flags *flagSet) {
+		username = flags.required("user", "username of the user whose sessions are ended")
+	}, func(ctx context.Context, ops *operations) int {
+		userUuid, ok := ops.readUserUuid(ctx, *username, stderr)
+		if !ok {
+			return 1
+		}
+		revoked, errRUS := ops.revokeUserSessions(ctx, userUuid, "revoked by the gateway session revoke command")
+		if errRUS != nil {
+			_, _ = fmt.Fprintf(stderr, "unable to revoke sessions, %d revoked: %s\n", revoked, errRUS)
+			return 1
+		}
+		_, _ = fmt.Fprintf(stdout, "revoked %d sessions of %s\n", revoked, *username)
+		return 0
+	})
+}
@@ -277,6 +277,8 @@ if (!$CleanUp) {
     --env GATEWAY_TLSKEYPATH="$GATEWAY_TLSKEYPATH" `
     --env MSSQL_DATABASE="$MSSQL_DATABASE" `
     --env MSSQL_HOST="$MSSQL_HOST" `
+    --env MSSQL_MIGRATION_PASSWORD="$MSSQL_SA_PASSWORD" `
+    --env MSSQL_MIGRATION_USERNAME=sa `
     --env MSSQL_PASSWORD="$MSSQL_GATEWAY_SP_PASSWORD" `
     --env MSSQL_PORT="$MSSQL_PORT" `
     --env MSSQL_SCHEME="$MSSQL_SCHEME" `